@@ -23,8 +23,19 @@ type NodeConfig struct {
 	// Port for admin connections
 	AdminPort int // `json:"adminPort"`
 	// WalletPath should be empty for memory based wallet store
-	// OR should be a path to a valid folder with appropriate permissions
+	// OR should be a path to a valid folder with appropriate permissions. A
+	// file based store keeps a write ahead log of mutations so that a node
+	// restarting from a snapshot recovers a commit interrupted by a crash.
 	WalletPath string // `json:"walletPath"`
+	// SnapshotPath should be empty for no state snapshots on disk
+	// OR should be a path to a valid folder with appropriate permissions. A
+	// node with snapshots on disk restarts from the latest one on sync.
+	SnapshotPath string // `json:"snapshotPath"`
+	// BlockPath should be empty for no blocks on disk
+	// OR should be a path to a valid folder with appropriate permissions. A
+	// node with blocks on disk serves the entire history of the chain and
+	// restores its blocks on restart from a snapshot.
+	BlockPath string // `json:"blockPath"`
 	// LogPath should be empty for standard logging
 	// OR should be a path to a valid folder with appropriate permissions
 	LogPath string // `json:"logPath"`
@@ -34,6 +45,10 @@ type NodeConfig struct {
 	Relay config.RelayConfig // `json:"relay"`
 	// Genesis can be left empty for standard Genesis configuration
 	Genesis *config.GenesisConfig // `json:"genesis"`
+	// GenesisPath should be empty for the genesis of this configuration
+	// OR should be a path to a genesis JSON file shared by every node of the
+	// network. It takes precedence over Genesis.
+	GenesisPath string // `json:"genesisPath"`
 	// Trusted Nodes to connect when not actively participating in the validator
 	// pool.
 	TrustedNodes []config.Peer
@@ -64,6 +79,16 @@ func (c NodeConfig) Check() error {
 			return err
 		}
 	}
+	if c.SnapshotPath != "" {
+		if err := config.IsValidDir(c.SnapshotPath, "snapshot"); err != nil {
+			return err
+		}
+	}
+	if c.BlockPath != "" {
+		if err := config.IsValidDir(c.BlockPath, "block"); err != nil {
+			return err
+		}
+	}
 	if err := config.IsValidDir(c.LogPath, "log"); err != nil {
 		return err
 	}
@@ -72,6 +97,11 @@ func (c NodeConfig) Check() error {
 			return err
 		}
 	}
+	if c.GenesisPath != "" {
+		if _, err := os.Stat(c.GenesisPath); err != nil {
+			return fmt.Errorf("could not find genesis file: %v", err)
+		}
+	}
 	if err := c.Relay.Check(); err != nil {
 		return err
 	}
@@ -91,14 +121,14 @@ func CheckGenesisToken(stake crypto.Token, cfg *NodeConfig) error {
 		minimumStake = cfg.Network.Permission.POS.MinimumStake
 	}
 
-	deposit := 0
+	deposit := uint64(0)
 	for _, wallet := range cfg.Genesis.Wallets {
-		token, _, deposit := TokenBalanceAndDeposit(wallet)
+		token, _, value := TokenBalanceAndDeposit(wallet)
 		if token.Equal(stake) {
-			deposit += deposit
+			deposit += value
 		}
 	}
-	if deposit < minimumStake {
+	if deposit < uint64(minimumStake) {
 		return errors.New("node deposit is less than minimum stake, cannot start from genesis")
 	}
 	return nil
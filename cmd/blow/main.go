@@ -8,7 +8,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/consensus/relay"
 	"github.com/freehandle/breeze/consensus/swell"
 	"github.com/freehandle/breeze/crypto"
@@ -17,7 +19,7 @@ import (
 	"github.com/freehandle/breeze/socket"
 )
 
-const usage = "usage: blow <path-to-json-config-file> [genesis|sync address token|check]"
+const usage = "usage: blow <path-to-json-config-file> [genesis|sync address token|check|verify]"
 
 func main() {
 	var err error
@@ -30,6 +32,15 @@ func main() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	if cfg.GenesisPath != "" {
+		if cfg.Genesis, err = config.LoadConfig[config.GenesisConfig](cfg.GenesisPath); err != nil {
+			fmt.Printf("could not load genesis file: %v\n", err)
+			os.Exit(1)
+		}
+		if cfg.Genesis.Network != nil {
+			cfg.Network = cfg.Genesis.Network
+		}
+	}
 	if cfg.Network == nil {
 		cfg.Network = config.StandardBreezeNetworkConfig
 	}
@@ -46,6 +57,20 @@ func main() {
 		return
 	}
 
+	genesis, err := GenesisFromConfig(cfg)
+	if err != nil {
+		fmt.Printf("invalid genesis: %v\n", err)
+		os.Exit(1)
+	}
+
+	if os.Args[2] == "verify" {
+		if err := VerifyGenesis(cfg, genesis); err != nil {
+			fmt.Printf("genesis verification failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log := filepath.Join(cfg.LogPath, fmt.Sprintf("%v.log", cfg.Token[0:16]))
 
 	logFile, err := os.OpenFile(log, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
@@ -81,7 +106,11 @@ func main() {
 
 	}
 
-	swellConfig := config.SwellConfigFromConfig(cfg.Network, cfg.Genesis.NetworkID)
+	networkID := ""
+	if cfg.Genesis != nil {
+		networkID = cfg.Genesis.NetworkID
+	}
+	swellConfig := config.SwellConfigFromConfig(cfg.Network, networkID)
 	relayConfig := RelayFromConfig(ctx, cfg, nodeSecret)
 	relay, err := relay.Run(ctx, &relayConfig)
 	if err != nil {
@@ -98,16 +127,31 @@ func main() {
 	}
 
 	if os.Args[2] == "genesis" {
+		if err := CheckGenesisToken(nodeToken, cfg); err != nil {
+			fmt.Println(err)
+			cancel()
+			os.Exit(1)
+		}
 		fmt.Println("creating genesis node")
+		if genesis != nil {
+			fmt.Printf("genesis hash: %v\n", crypto.EncodeHash(genesis.Hash()))
+		}
 		validatorConfig := swell.ValidatorConfig{
 			Credentials:    nodeSecret,
 			WalletPath:     cfg.WalletPath,
+			SnapshotPath:   cfg.SnapshotPath,
+			BlockPath:      cfg.BlockPath,
 			SwellConfig:    swellConfig,
 			Relay:          relay,
 			Admin:          adm,
 			TrustedGateway: TokenAddrArrayFromPeeers(cfg.TrustedNodes),
+			Genesis:        genesis,
+		}
+		if swell.NewGenesisNode(ctx, nodeSecret, validatorConfig) == nil {
+			fmt.Println("could not create genesis node")
+			cancel()
+			os.Exit(1)
 		}
-		swell.NewGenesisNode(ctx, nodeSecret, validatorConfig)
 		<-ctx.Done()
 		return
 	} else if len(os.Args) < 5 {
@@ -126,17 +170,34 @@ func main() {
 		validatorConfig := swell.ValidatorConfig{
 			Credentials:    nodeSecret,
 			WalletPath:     cfg.WalletPath,
+			SnapshotPath:   cfg.SnapshotPath,
+			BlockPath:      cfg.BlockPath,
 			SwellConfig:    swellConfig,
 			Relay:          relay,
 			Admin:          adm,
 			TrustedGateway: TokenAddrArrayFromPeeers(cfg.TrustedNodes),
 		}
-		err = swell.FullSyncValidatorNode(ctx, validatorConfig, socket.TokenAddr{}, nil)
+		if cfg.Genesis != nil && cfg.Genesis.TimeStamp != "" {
+			// only a genesis with a timestamp is shared by the network
+			validatorConfig.Genesis = genesis
+		}
+		if cfg.SnapshotPath != "" && hasSnapshot(cfg.SnapshotPath) {
+			fmt.Println("restarting node from snapshot")
+			err = swell.RestartValidatorNode(ctx, validatorConfig, tokenAddr, nil)
+		} else {
+			err = swell.FullSyncValidatorNode(ctx, validatorConfig, tokenAddr, nil)
+		}
 	}
 	fmt.Printf("blow node terminated: %v\n", err)
 	cancel()
 }
 
+// hasSnapshot returns true if there is a state snapshot on the given path.
+func hasSnapshot(path string) bool {
+	snapshots, err := chain.OpenSnapshotStore(path)
+	return err == nil && snapshots.HasSnapshot()
+}
+
 func TokenAddrFromPeer(peer config.Peer) socket.TokenAddr {
 	return socket.TokenAddr{
 		Addr:  peer.Address,
@@ -187,10 +248,37 @@ func RelayFromConfig(ctx context.Context, config *NodeConfig, pk crypto.PrivateK
 	}
 }
 
-func CreateNodeFromGenesis(ctx context.Context, config *NodeConfig, secret crypto.PrivateKey) error {
-	if config.Genesis == nil {
-		return errors.New("genesis configuration not specified")
+// GenesisFromConfig returns the genesis of the network defined by the genesis
+// of the node configuration. It returns nil if the configuration has no
+// genesis, in which case a genesis node funds only its own credentials.
+func GenesisFromConfig(cfg *NodeConfig) (*chain.Genesis, error) {
+	if cfg.Genesis == nil {
+		return nil, nil
 	}
+	return config.GenesisFromConfig(cfg.Genesis, cfg.Network)
+}
 
+// VerifyGenesis prints the genesis hash of the network and checks that the
+// node token can start the network from the genesis. The genesis must have a
+// timestamp, otherwise its hash is not shared by every node.
+func VerifyGenesis(cfg *NodeConfig, genesis *chain.Genesis) error {
+	if genesis == nil {
+		return errors.New("genesis configuration not specified")
+	}
+	if cfg.Genesis.TimeStamp == "" {
+		return errors.New("genesis timestamp not specified")
+	}
+	supply := uint64(0)
+	for _, wallet := range genesis.Wallets {
+		supply += wallet.Wallet + wallet.Deposit
+	}
+	fmt.Printf("network: %v\n", cfg.Genesis.NetworkID)
+	fmt.Printf("start: %v\n", genesis.TimeStamp.UTC().Format(time.RFC3339))
+	fmt.Printf("wallets: %v\n", len(genesis.Wallets))
+	fmt.Printf("supply: %v\n", supply)
+	fmt.Printf("genesis hash: %v\n", crypto.EncodeHash(genesis.Hash()))
+	if err := CheckGenesisToken(crypto.TokenFromString(cfg.Token), cfg); err != nil {
+		fmt.Printf("node cannot start the network: %v\n", err)
+	}
 	return nil
 }
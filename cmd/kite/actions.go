@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/freehandle/breeze/consensus/messages"
@@ -18,6 +19,7 @@ type TransferCommand struct {
 	Ammount string
 	Fee     string
 	Reason  string
+	Nonce   string
 }
 
 func (t *TransferCommand) Execute(safe *Kite) error {
@@ -41,6 +43,13 @@ func (t *TransferCommand) Execute(safe *Kite) error {
 	if err != nil || fee < 0 {
 		return errors.New("invalid fee amount")
 	}
+	nonce := uint64(0)
+	if t.Nonce != "" {
+		nonce, err = strconv.ParseUint(t.Nonce, 10, 64)
+		if err != nil || nonce == 0 {
+			return errors.New("invalid nonce")
+		}
+	}
 	conn, epoch, err := safe.dialGateway()
 	if err != nil {
 		fmt.Print(err)
@@ -49,6 +58,7 @@ func (t *TransferCommand) Execute(safe *Kite) error {
 
 	transfer := actions.Transfer{
 		TimeStamp: epoch, // TODO
+		Nonce:     nonce,
 		From:      tokenFrom,
 		To: []crypto.TokenValue{
 			{Token: tokenTo, Value: uint64(amount)},
@@ -64,6 +74,18 @@ func (t *TransferCommand) Execute(safe *Kite) error {
 	return nil
 }
 
+// receiptStatus are the descriptions of the action statuses reported by
+// gateway receipts.
+var receiptStatus = map[byte]string{
+	messages.ActionSealed:      "sealed",
+	messages.ActionCommitted:   "committed",
+	messages.ActionInvalidated: "invalidated",
+	messages.ActionExpired:     "expired",
+}
+
+// SendAndConfirm sends the action to the gateway and waits for its receipts
+// until the action is committed, invalidated or expired. Receipts must be
+// signed by the gateway the connection was established with.
 func SendAndConfirm(conn *socket.SignedConnection, msg []byte) error {
 	if err := conn.Send(append([]byte{messages.MsgAction}, msg...)); err != nil {
 		return fmt.Errorf("error sending transfer to gateway: %s", err)
@@ -75,20 +97,87 @@ func SendAndConfirm(conn *socket.SignedConnection, msg []byte) error {
 	if len(resp) == 0 || resp[0] != messages.MsgActionForward {
 		return errors.New("action rejected by gateway")
 	}
-	resp, err = conn.Read()
+	msgHash := crypto.Hasher(msg)
+	fmt.Printf("action %v forwarded to validators\n", msgHash)
+	for {
+		resp, err = conn.Read()
+		if err != nil {
+			return fmt.Errorf("error receiving response from gateway: %s", err)
+		}
+		receipt := messages.ParseActionReceipt(resp)
+		if receipt == nil || !receipt.Gateway.Equal(conn.Token) {
+			return errors.New("invalid receipt from gateway")
+		}
+		if !receipt.Action.Equal(msgHash) {
+			continue
+		}
+		switch receipt.Status {
+		case messages.ActionExpired:
+			fmt.Printf("action %v expired at epoch %v without inclusion in a block\n", receipt.Action, receipt.Epoch)
+			return errors.New("action expired")
+		case messages.ActionInvalidated:
+			fmt.Printf("action %v invalidated by block epoch %v with hash %v\n", receipt.Action, receipt.Epoch, receipt.BlockHash)
+			return errors.New("action invalidated")
+		}
+		fmt.Printf("action %v %v on block epoch %v with hash %v\n", receipt.Action, receiptStatus[receipt.Status], receipt.Epoch, receipt.BlockHash)
+		if receipt.Status == messages.ActionCommitted {
+			return nil
+		}
+	}
+}
+
+type SubmitCommand struct {
+	File string
+}
+
+// Execute reads a JSON action from file, signs it with the vault secret of the
+// signing account and submits it to the gateway. Actions with zero epoch are
+// stamped with the current gateway epoch.
+func (s *SubmitCommand) Execute(safe *Kite) error {
+	data, err := os.ReadFile(s.File)
 	if err != nil {
-		return fmt.Errorf("error receiving response from gateway: %s", err)
+		return fmt.Errorf("could not read action file: %v", err)
 	}
-	if resp[0] != messages.MsgActionSealed {
-		return errors.New("action rejected by gateway")
+	action, err := actions.ParseJSON(data)
+	if err != nil {
+		return fmt.Errorf("invalid action file: %v", err)
 	}
-	msgHash := crypto.Hasher(msg)
-	hash, epoch, sealHash := messages.ParseSealedAction(resp)
-	if epoch == 0 || !hash.Equal(msgHash) {
-		return errors.New("invalid sealed action")
+	var signer crypto.Token
+	var timestamp *uint64
+	switch v := action.(type) {
+	case *actions.Transfer:
+		signer, timestamp = v.From, &v.TimeStamp
+	case *actions.Deposit:
+		signer, timestamp = v.Token, &v.TimeStamp
+	case *actions.Withdraw:
+		signer, timestamp = v.Token, &v.TimeStamp
+	case *actions.Void:
+		signer, timestamp = v.Wallet, &v.TimeStamp
+	default:
+		return errors.New("unsupported action")
 	}
-	fmt.Printf("action %v, incorporated into sealed block epoch %v with hash %v\n", hash, epoch, sealHash)
-	return nil
+	secret := safe.findSecret(signer)
+	if secret == crypto.ZeroPrivateKey {
+		return errors.New("cannot find secret of signing account")
+	}
+	conn, epoch, err := safe.dialGateway()
+	if err != nil {
+		return err
+	}
+	if *timestamp == 0 {
+		*timestamp = epoch
+	}
+	switch v := action.(type) {
+	case *actions.Transfer:
+		v.Sign(secret)
+	case *actions.Deposit:
+		v.Sign(secret)
+	case *actions.Withdraw:
+		v.Sign(secret)
+	case *actions.Void:
+		v.Sign(secret)
+	}
+	return SendAndConfirm(conn, action.Serialize())
 }
 
 type StakeCommand struct {
@@ -150,7 +239,30 @@ type BalanceCommand struct {
 	Account string
 }
 
+// Execute queries the gateway for the wallet and deposit balance of the account
+// at the last checksum of the answering node.
 func (c *BalanceCommand) Execute(vault *Kite) error {
+	token := crypto.TokenFromString(c.Account)
+	if token == crypto.ZeroToken {
+		return errors.New("invalid account")
+	}
+	conn, _, err := vault.dialGateway()
+	if err != nil {
+		return err
+	}
+	defer conn.Shutdown()
+	if err := conn.Send(messages.BalanceRequest(token)); err != nil {
+		return fmt.Errorf("error sending balance request to gateway: %s", err)
+	}
+	resp, err := conn.Read()
+	if err != nil {
+		return fmt.Errorf("error receiving response from gateway: %s", err)
+	}
+	balance := messages.ParseBalance(resp)
+	if balance == nil || balance.Token != token {
+		return errors.New("invalid balance response")
+	}
+	fmt.Printf("account %v\nwallet balance: %v\ndeposit balance: %v\nread at checksum epoch %v with hash %v\n", token, balance.Wallet, balance.Deposit, balance.Epoch, crypto.EncodeHash(balance.ChecksumHash))
 	return nil
 }
 
@@ -184,8 +296,8 @@ func (c *ListCommand) Execute(vault *Kite) error {
 		return err
 	}
 	for _, bytes := range actionList {
-		action := actions.ParseAction(bytes)
-		if action != nil {
+		action, err := actions.ParseAction(bytes)
+		if err == nil {
 			fmt.Println(action.JSON())
 		}
 	}
@@ -94,12 +94,16 @@ func parseCommandArgs(cmd byte, args []string) Command {
 			fmt.Println("insufficient arguments")
 			return nil
 		}
-		return &TransferCommand{
+		transfer := &TransferCommand{
 			From:    args[0],
 			To:      args[1],
 			Ammount: args[2],
 			Fee:     args[3],
 		}
+		if len(args) > 4 {
+			transfer.Nonce = args[4]
+		}
+		return transfer
 	case depositCmd:
 		if len(args) < 3 {
 			fmt.Println("insufficient arguments")
@@ -122,6 +126,14 @@ func parseCommandArgs(cmd byte, args []string) Command {
 			Fee:     args[2],
 			Deposit: false,
 		}
+	case submitCmd:
+		if len(args) < 1 {
+			fmt.Println("insufficient arguments")
+			return nil
+		}
+		return &SubmitCommand{
+			File: args[0],
+		}
 	case balanceCmd:
 		if len(args) < 1 {
 			fmt.Println("insufficient arguments")
@@ -85,9 +85,14 @@ associated to the secret key of the vault is configured with admin rights on the
 trusted node.
 `
 
-const helpTransfer = `usage: kite <path-tovault-file> transfer <from-account> <to-account> <ammount> <fee> 
+const helpTransfer = `usage: kite <path-tovault-file> transfer <from-account> <to-account> <ammount> <fee> [nonce]
 
 Will instruct node to transfer token-amount of funds from from-account to to-account.
+
+If a nonce is provided it must be the one following the last nonce used by
+from-account. A pending transfer with a nonce can be replaced by sending
+another transfer with the same nonce and a higher fee. To cancel a pending
+transfer replace it with a transfer to from-account itself.
 `
 
 const helpDeposit = `usage: kite <path-tovault-file> deposit <token-amount> <account>
@@ -100,9 +105,24 @@ const helpWithdraw = `usage: kite <path-tovault-file> withdraw <token-amount> <a
 Will instruct node to withdraw token-amount of funds from given account.
 `
 
+const helpSubmit = `usage: kite <path-to-vault-file> submit <action-file>
+
+Will read a transfer, deposit, withdraw or void action from the given JSON file,
+sign it with the vault secret of the signing account (from, token or wallet
+field) and submit it to the gateway. Fields follow the JSON representation of
+the action as printed by the list command, for example
+
+	{"kind":"transfer","epoch":0,"from":"0x...","to":[{"token":"0x...","value":10}],"fee":1}
+
+If epoch is zero or absent the action is stamped with the current gateway epoch.
+Any signature on the file is replaced.
+`
+
 const helpBalance = `usage: kite <path-tovault-file> balance <account>
 
-Will instruct node to provide balance information of appointed account 
+Will query the gateway for the wallet and deposit balance of appointed account.
+Balances are read at the last checksum of the answering node, and the checksum
+epoch and hash are shown so that answers of different nodes can be compared.
 `
 
 const helpConfig = `usage: kite <path-tovault-file> config <variable> <node-id>
@@ -143,6 +163,8 @@ func help(cmd string) {
 		fmt.Print(helpDeposit)
 	case "withdraw":
 		fmt.Print(helpWithdraw)
+	case "submit":
+		fmt.Print(helpSubmit)
 	case "balance":
 		fmt.Print(helpBalance)
 	case "config":
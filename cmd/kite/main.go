@@ -28,6 +28,7 @@ The commands are:
 	transfer  transfer tokens between accounts
 	deposit	  deposit tokens in account
 	withdraw  withdraw tokens from account
+	submit    sign and submit an action described in a JSON file
 	balance	  get token balanece information of given account
 	list      list all events associated to a token on breeze network
 
@@ -52,6 +53,7 @@ const (
 	transferCmd
 	depositCmd
 	withdrawCmd
+	submitCmd
 	balanceCmd
 	configCmd
 	showCmd
@@ -120,6 +122,8 @@ func parseCommand() byte {
 		return depositCmd
 	case "withdraw":
 		return withdrawCmd
+	case "submit":
+		return submitCmd
 	case "balance":
 		return balanceCmd
 	case "config":
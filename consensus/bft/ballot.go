@@ -49,12 +49,25 @@ func (b *Ballot) Serialize() []byte {
 	return bytes
 }
 
-func ParseBallot(data []byte) *Ballot {
-	ballot, _ := ParseBallotPosition(data, 0)
-	return ballot
+// ParseBallot parses a ballot. Returns a util.ParseError if the data is not a
+// valid ballot.
+func ParseBallot(data []byte) (*Ballot, error) {
+	ballot, position, err := ParseBallotPosition(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := util.CheckEnd("ballot", data, position); err != nil {
+		return nil, err
+	}
+	return ballot, nil
 }
 
-func ParseBallotPosition(data []byte, position int) (*Ballot, int) {
+// ParseBallotPosition parses a ballot in the middle of a byte slice and returns
+// the parsed ballot and the position at the end of the ballot bytes. Empty
+// votes and commits (see Ballot.Serialize) are skipped. Returns a
+// util.ParseError if the data is truncated or if the proposal, any vote or any
+// commit of the ballot is invalid.
+func ParseBallotPosition(data []byte, position int) (*Ballot, int, error) {
 	var bytes []byte
 	ballot := Ballot{
 		Votes:   make([]*RoundVote, 0),
@@ -67,35 +80,53 @@ func ParseBallotPosition(data []byte, position int) (*Ballot, int) {
 	ballot.TotalWeight = int(totalweight)
 	ballot.Round, position = util.ParseByte(data, position)
 	bytes, position = util.ParseByteArray(data, position)
+	if err := util.CheckTruncated("ballot", data, position); err != nil {
+		return nil, position, err
+	}
 	if len(bytes) > 0 {
-		ballot.Proposal = ParseRoundPropose(bytes)
+		proposal, err := ParseRoundPropose(bytes)
+		if err != nil {
+			return nil, position, util.NewParseError("ballot", position-len(bytes), err)
+		}
+		ballot.Proposal = proposal
 	}
 	var count uint16
 	count, position = util.ParseUint16(data, position)
 	for i := uint16(0); i < count; i++ {
 		bytes, position = util.ParseByteArray(data, position)
-		if vote := ParseRoundVote(bytes); vote != nil {
-			ballot.Votes = append(ballot.Votes, vote)
-		} else {
+		if err := util.CheckTruncated("ballot", data, position); err != nil {
+			return nil, position, err
+		}
+		if len(bytes) == 0 {
 			slog.Info("ballot parser: nil vote found")
+			continue
 		}
-	}
-	if position >= len(data) {
-		return nil, len(data) + 1
+		vote, err := ParseRoundVote(bytes)
+		if err != nil {
+			return nil, position, util.NewParseError("ballot", position-len(bytes), err)
+		}
+		ballot.Votes = append(ballot.Votes, vote)
 	}
 	count, position = util.ParseUint16(data, position)
 	for i := uint16(0); i < count; i++ {
 		bytes, position = util.ParseByteArray(data, position)
-		if commit := ParseRoundCommit(bytes); commit != nil {
-			ballot.Commits = append(ballot.Commits, commit)
-		} else {
+		if err := util.CheckTruncated("ballot", data, position); err != nil {
+			return nil, position, err
+		}
+		if len(bytes) == 0 {
 			slog.Info("ballot parser: nil commit found")
+			continue
+		}
+		commit, err := ParseRoundCommit(bytes)
+		if err != nil {
+			return nil, position, util.NewParseError("ballot", position-len(bytes), err)
 		}
+		ballot.Commits = append(ballot.Commits, commit)
 	}
-	if position > len(data) {
-		return nil, len(data) + 1
+	if err := util.CheckTruncated("ballot", data, position); err != nil {
+		return nil, position, err
 	}
-	return &ballot, position
+	return &ballot, position, nil
 }
 
 func NewBallot(round byte, weight int) *Ballot {
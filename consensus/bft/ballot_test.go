@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
 )
 
 func propose(pk crypto.PrivateKey) *RoundPropose {
@@ -48,11 +49,11 @@ type serializer interface {
 	Serialize() []byte
 }
 
-func doublePass(v serializer, p func([]byte) serializer) error {
+func doublePass(v serializer, p func([]byte) (serializer, error)) error {
 	msg := v.Serialize()
-	v2 := p(msg)
-	if v2 == nil {
-		return errors.New("Unable to parse")
+	v2, err := p(msg)
+	if err != nil {
+		return err
 	}
 	msg2 := v2.Serialize()
 	if len(msg) != len(msg2) {
@@ -66,19 +67,19 @@ func doublePass(v serializer, p func([]byte) serializer) error {
 	return nil
 }
 
-func parseProposse(data []byte) serializer {
+func parseProposse(data []byte) (serializer, error) {
 	return ParseRoundPropose(data)
 }
 
-func parseVote(data []byte) serializer {
+func parseVote(data []byte) (serializer, error) {
 	return ParseRoundVote(data)
 }
 
-func parseCommit(data []byte) serializer {
+func parseCommit(data []byte) (serializer, error) {
 	return ParseRoundCommit(data)
 }
 
-func parseBallot(data []byte) serializer {
+func parseBallot(data []byte) (serializer, error) {
 	return ParseBallot(data)
 }
 
@@ -112,3 +113,33 @@ func TestBallotSerialization(t *testing.T) {
 	}
 
 }
+
+func TestParseErrors(t *testing.T) {
+	_, pk := crypto.RandomAsymetricKey()
+	data := vote(pk).Serialize()
+	if _, err := ParseRoundVote(data[:len(data)-1]); !errors.Is(err, util.ErrTruncated) {
+		t.Errorf("truncated vote: %v", err)
+	}
+	if _, err := ParseRoundVote(append(data, 0)); !errors.Is(err, util.ErrTrailingBytes) {
+		t.Errorf("vote with trailing bytes: %v", err)
+	}
+	if _, err := ParseRoundCommit(data); !errors.Is(err, util.ErrUnknownKind) {
+		t.Errorf("vote parsed as commit: %v", err)
+	}
+	tampered := append([]byte{}, data...)
+	tampered[1] ^= 1
+	if _, err := ParseRoundVote(tampered); !errors.Is(err, util.ErrBadSignature) {
+		t.Errorf("tampered vote: %v", err)
+	}
+	ballot := &Ballot{TotalWeight: 100, Round: 1, Proposal: propose(pk), Votes: []*RoundVote{vote(pk)}, Commits: []*RoundCommit{commit(pk)}}
+	data = ballot.Serialize()
+	for n := 0; n < len(data); n++ {
+		if _, err := ParseBallot(data[:n]); !errors.Is(err, util.ErrTruncated) {
+			t.Fatalf("ballot truncated at %d: %v", n, err)
+		}
+	}
+	var parseErr *util.ParseError
+	if _, err := ParseBallot(append(data, 0)); !errors.As(err, &parseErr) || parseErr.Position != len(data) {
+		t.Errorf("ballot with trailing bytes: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package bft
 
 import (
+	"log/slog"
+
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/socket"
 )
@@ -35,8 +37,12 @@ func LaunchPooling(committee PoolingCommittee, credentials crypto.PrivateKey) *P
 				}
 				switch msg.Signal[0] {
 				case RoundProposeMsg:
-					propose := ParseRoundPropose(msg.Signal)
-					if propose == nil || propose.Token.Equal(token) {
+					propose, err := ParseRoundPropose(msg.Signal)
+					if err != nil {
+						slog.Info("pooling: invalid consensus message", "from", msg.Token, "error", err)
+						continue
+					}
+					if propose.Token.Equal(token) {
 						continue
 					}
 					committee.Gossip.BroadcastExcept(msg.Signal, msg.Token)
@@ -50,8 +56,12 @@ func LaunchPooling(committee PoolingCommittee, credentials crypto.PrivateKey) *P
 						}
 					}
 				case RoundVoteMsg:
-					vote := ParseRoundVote(msg.Signal)
-					if vote == nil || vote.Token.Equal(token) {
+					vote, err := ParseRoundVote(msg.Signal)
+					if err != nil {
+						slog.Info("pooling: invalid consensus message", "from", msg.Token, "error", err)
+						continue
+					}
+					if vote.Token.Equal(token) {
 						continue
 					}
 					//fmt.Printf("%v got vote from %v\n\n", credentials.PublicKey(), vote.Token)
@@ -67,8 +77,12 @@ func LaunchPooling(committee PoolingCommittee, credentials crypto.PrivateKey) *P
 						pooling.Check()
 					}
 				case RoundCommitMsg:
-					commit := ParseRoundCommit(msg.Signal)
-					if commit == nil || commit.Token.Equal(token) {
+					commit, err := ParseRoundCommit(msg.Signal)
+					if err != nil {
+						slog.Info("pooling: invalid consensus message", "from", msg.Token, "error", err)
+						continue
+					}
+					if commit.Token.Equal(token) {
 						continue
 					}
 					if w, ok := committee.Members[commit.Token]; ok {
@@ -65,49 +65,158 @@ func (d *Duplicate) Serialize() []byte {
 	return bytes
 }
 
-func ParseDuplicate(data []byte) *Duplicate {
-	parsed, _ := ParseDuplicatePosition(data, 0)
-	return parsed
+// ParseDuplicate parses evidence of duplicate consensus messages. Returns a
+// util.ParseError if the data is not valid evidence.
+func ParseDuplicate(data []byte) (*Duplicate, error) {
+	parsed, position, err := ParseDuplicatePosition(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := util.CheckEnd("duplicate", data, position); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// parseDuplicatePair parses a pair of consensus messages at the position with
+// the given parser.
+func parseDuplicatePair[T any](data []byte, position int, parse func([]byte) (*T, error)) (*T, *T, int, error) {
+	one, position := util.ParseByteArray(data, position)
+	two, position := util.ParseByteArray(data, position)
+	if err := util.CheckTruncated("duplicate", data, position); err != nil {
+		return nil, nil, position, err
+	}
+	first, err := parse(one)
+	if err != nil {
+		return nil, nil, position, util.NewParseError("duplicate", position-len(two)-2-len(one), err)
+	}
+	second, err := parse(two)
+	if err != nil {
+		return nil, nil, position, util.NewParseError("duplicate", position-len(two), err)
+	}
+	return first, second, position, nil
 }
 
-func ParseDuplicatePosition(data []byte, position int) (*Duplicate, int) {
+// ParseDuplicatePosition parses evidence of duplicate consensus messages in
+// the middle of a byte slice and returns the parsed evidence and the position
+// at the end of the evidence bytes. Returns a util.ParseError if the data is
+// truncated or if any of the messages is invalid.
+func ParseDuplicatePosition(data []byte, position int) (*Duplicate, int, error) {
 	duplicate := NewDuplicate()
 	var count uint16
 	count, position = util.ParseUint16(data, position)
-	var one, two []byte
 	for i := uint16(0); i < count; i++ {
-		one, position = util.ParseByteArray(data, position)
-		two, position = util.ParseByteArray(data, position)
-		oneVote := ParseRoundVote(one)
-		twoVote := ParseRoundVote(two)
-		if oneVote == nil || twoVote == nil {
-			return nil, len(data) + 1
+		one, two, next, err := parseDuplicatePair(data, position, ParseRoundVote)
+		if err != nil {
+			return nil, next, err
 		}
-		duplicate.AddVote(oneVote, twoVote)
+		duplicate.AddVote(one, two)
+		position = next
 	}
 	count, position = util.ParseUint16(data, position)
 	for i := uint16(0); i < count; i++ {
-		one, position = util.ParseByteArray(data, position)
-		two, position = util.ParseByteArray(data, position)
-		oneCommit := ParseRoundCommit(one)
-		twoCommit := ParseRoundCommit(two)
-		if oneCommit == nil || twoCommit == nil {
-			return nil, len(data) + 1
+		one, two, next, err := parseDuplicatePair(data, position, ParseRoundCommit)
+		if err != nil {
+			return nil, next, err
 		}
-		duplicate.AddCommit(oneCommit, twoCommit)
+		duplicate.AddCommit(one, two)
+		position = next
 	}
 	count, position = util.ParseUint16(data, position)
 	for i := uint16(0); i < count; i++ {
-		one, position = util.ParseByteArray(data, position)
-		two, position = util.ParseByteArray(data, position)
-		onePropose := ParseRoundPropose(one)
-		twoPropose := ParseRoundPropose(two)
-		if onePropose == nil || twoPropose == nil {
-			return nil, len(data)
+		one, two, next, err := parseDuplicatePair(data, position, ParseRoundPropose)
+		if err != nil {
+			return nil, next, err
 		}
-		duplicate.AddProposal(onePropose, twoPropose)
+		duplicate.AddProposal(one, two)
+		position = next
+	}
+	if err := util.CheckTruncated("duplicate", data, position); err != nil {
+		return nil, position, err
+	}
+	return duplicate, position, nil
+}
+
+// IsValid returns true if both votes are cast by the same token for the same
+// epoch and round with conflicting content.
+func (d DuplicateVote) IsValid() bool {
+	if d.One == nil || d.Two == nil {
+		return false
+	}
+	if !d.One.Token.Equal(d.Two.Token) || d.One.Epoch != d.Two.Epoch || d.One.Round != d.Two.Round {
+		return false
+	}
+	return d.One.HasHash != d.Two.HasHash || d.One.Blank != d.Two.Blank || !d.One.Value.Equal(d.Two.Value)
+}
+
+// IsValid returns true if both commits are cast by the same token for the same
+// epoch and round with conflicting content.
+func (d DuplicateCommit) IsValid() bool {
+	if d.One == nil || d.Two == nil {
+		return false
+	}
+	if !d.One.Token.Equal(d.Two.Token) || d.One.Epoch != d.Two.Epoch || d.One.Round != d.Two.Round {
+		return false
+	}
+	return d.One.Blank != d.Two.Blank || !d.One.Value.Equal(d.Two.Value)
+}
+
+// IsValid returns true if both proposals are cast by the same token for the
+// same epoch and round with conflicting content.
+func (d DuplicateProposal) IsValid() bool {
+	if d.One == nil || d.Two == nil {
+		return false
+	}
+	if !d.One.Token.Equal(d.Two.Token) || d.One.Epoch != d.Two.Epoch || d.One.Round != d.Two.Round {
+		return false
+	}
+	return d.One.LastRound != d.Two.LastRound || !d.One.Value.Equal(d.Two.Value)
+}
+
+// Offenses returns the valid evidence of the duplicate grouped by the epoch of
+// the offense. Invalid evidence is discarded.
+func (d *Duplicate) Offenses() map[uint64]*Duplicate {
+	offenses := make(map[uint64]*Duplicate)
+	if d == nil {
+		return offenses
+	}
+	get := func(epoch uint64) *Duplicate {
+		if offense, ok := offenses[epoch]; ok {
+			return offense
+		}
+		offense := NewDuplicate()
+		offenses[epoch] = offense
+		return offense
+	}
+	for _, vote := range d.Votes {
+		if vote.IsValid() {
+			offense := get(vote.One.Epoch)
+			offense.Votes = append(offense.Votes, vote)
+		}
+	}
+	for _, commit := range d.Commits {
+		if commit.IsValid() {
+			offense := get(commit.One.Epoch)
+			offense.Commits = append(offense.Commits, commit)
+		}
+	}
+	for _, proposal := range d.Proposals {
+		if proposal.IsValid() {
+			offense := get(proposal.One.Epoch)
+			offense.Proposals = append(offense.Proposals, proposal)
+		}
+	}
+	return offenses
+}
+
+// Append appends the evidence of another duplicate.
+func (d *Duplicate) Append(another *Duplicate) {
+	if another == nil {
+		return
 	}
-	return duplicate, position
+	d.Votes = append(d.Votes, another.Votes...)
+	d.Commits = append(d.Commits, another.Commits...)
+	d.Proposals = append(d.Proposals, another.Proposals...)
 }
 
 func (d *Duplicate) HasViolations() bool {
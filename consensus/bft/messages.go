@@ -19,6 +19,18 @@ type ConsensusMessage interface {
 	MsgKind() byte
 }
 
+// checkMessage returns a util.ParseError of the structure if the data is not a
+// message of the given kind and size.
+func checkMessage(structure string, data []byte, kind byte, size int) error {
+	if len(data) == 0 {
+		return util.NewParseError(structure, 0, util.ErrTruncated)
+	}
+	if data[0] != kind {
+		return util.NewParseError(structure, 0, util.ErrUnknownKind)
+	}
+	return util.CheckEnd(structure, data, size)
+}
+
 type Done struct {
 	Epoch     uint64
 	Token     crypto.Token
@@ -37,9 +49,11 @@ func (d *Done) MsgKind() byte {
 	return 4
 }
 
-func ParseDone(msg []byte) *Done {
-	if len(msg) != 1+crypto.TokenSize+crypto.SignatureSize+8 || msg[0] != 4 {
-		return nil
+// ParseDone parses a done message. Returns a util.ParseError if the data is
+// not a done message or if its signature is invalid.
+func ParseDone(msg []byte) (*Done, error) {
+	if err := checkMessage("done", msg, DoneMsg, 1+crypto.TokenSize+crypto.SignatureSize+8); err != nil {
+		return nil, err
 	}
 	done := &Done{}
 	position := 1
@@ -47,9 +61,9 @@ func ParseDone(msg []byte) *Done {
 	done.Token, position = util.ParseToken(msg, position)
 	done.Signature, _ = util.ParseSignature(msg, position)
 	if !done.Token.Verify(msg[:position], done.Signature) {
-		return nil
+		return nil, util.NewParseError("done", position, util.ErrBadSignature)
 	}
-	return done
+	return done, nil
 }
 
 func NewDone(epoch uint64, credentials crypto.PrivateKey) *Done {
@@ -76,9 +90,11 @@ type RoundPropose struct {
 	Signatute crypto.Signature
 }
 
-func ParseRoundPropose(bytes []byte) *RoundPropose {
-	if (len(bytes) != 11+crypto.TokenSize+crypto.Size+crypto.SignatureSize) || bytes[0] != RoundProposeMsg {
-		return nil
+// ParseRoundPropose parses a round propose message. Returns a util.ParseError
+// if the data is not a round propose message or if its signature is invalid.
+func ParseRoundPropose(bytes []byte) (*RoundPropose, error) {
+	if err := checkMessage("round propose", bytes, RoundProposeMsg, 11+crypto.TokenSize+crypto.Size+crypto.SignatureSize); err != nil {
+		return nil, err
 	}
 	position := 1
 	vote := RoundPropose{}
@@ -87,15 +103,11 @@ func ParseRoundPropose(bytes []byte) *RoundPropose {
 	vote.Token, position = util.ParseToken(bytes, position)
 	vote.Value, position = util.ParseHash(bytes, position)
 	vote.LastRound, position = util.ParseByte(bytes, position)
-	if position > len(bytes) {
-		return nil
-	}
 	vote.Signatute, _ = util.ParseSignature(bytes, position)
-	if vote.Token.Verify(bytes[:position], vote.Signatute) {
-		return &vote
-	} else {
-		return nil
+	if !vote.Token.Verify(bytes[:position], vote.Signatute) {
+		return nil, util.NewParseError("round propose", position, util.ErrBadSignature)
 	}
+	return &vote, nil
 }
 
 func (r *RoundPropose) MsgKind() byte {
@@ -137,9 +149,11 @@ type RoundVote struct {
 	Weight    int
 }
 
-func ParseRoundVote(bytes []byte) *RoundVote {
-	if len(bytes) != 12+crypto.TokenSize+crypto.Size+crypto.SignatureSize || bytes[0] != RoundVoteMsg {
-		return nil
+// ParseRoundVote parses a round vote message. Returns a util.ParseError if the
+// data is not a round vote message or if its signature is invalid.
+func ParseRoundVote(bytes []byte) (*RoundVote, error) {
+	if err := checkMessage("round vote", bytes, RoundVoteMsg, 12+crypto.TokenSize+crypto.Size+crypto.SignatureSize); err != nil {
+		return nil, err
 	}
 	position := 1
 	vote := RoundVote{}
@@ -149,15 +163,11 @@ func ParseRoundVote(bytes []byte) *RoundVote {
 	vote.Token, position = util.ParseToken(bytes, position)
 	vote.Value, position = util.ParseHash(bytes, position)
 	vote.HasHash, position = util.ParseBool(bytes, position)
-	if position > len(bytes) {
-		return nil
-	}
 	vote.Signatute, _ = util.ParseSignature(bytes, position)
-	if vote.Token.Verify(bytes[:position], vote.Signatute) {
-		return &vote
-	} else {
-		return nil
+	if !vote.Token.Verify(bytes[:position], vote.Signatute) {
+		return nil, util.NewParseError("round vote", position, util.ErrBadSignature)
 	}
+	return &vote, nil
 }
 
 func (r *RoundVote) MsgKind() byte {
@@ -195,9 +205,11 @@ type RoundCommit struct {
 	Weight    int
 }
 
-func ParseRoundCommit(bytes []byte) *RoundCommit {
-	if len(bytes) != 11+crypto.TokenSize+crypto.Size+crypto.SignatureSize || bytes[0] != RoundCommitMsg {
-		return nil
+// ParseRoundCommit parses a round commit message. Returns a util.ParseError if
+// the data is not a round commit message or if its signature is invalid.
+func ParseRoundCommit(bytes []byte) (*RoundCommit, error) {
+	if err := checkMessage("round commit", bytes, RoundCommitMsg, 11+crypto.TokenSize+crypto.Size+crypto.SignatureSize); err != nil {
+		return nil, err
 	}
 	position := 1
 	vote := RoundCommit{}
@@ -206,15 +218,11 @@ func ParseRoundCommit(bytes []byte) *RoundCommit {
 	vote.Blank, position = util.ParseBool(bytes, position)
 	vote.Token, position = util.ParseToken(bytes, position)
 	vote.Value, position = util.ParseHash(bytes, position)
-	if position > len(bytes) {
-		return nil
-	}
 	vote.Signatute, _ = util.ParseSignature(bytes, position)
-	if vote.Token.Verify(bytes[:position], vote.Signatute) {
-		return &vote
-	} else {
-		return nil
+	if !vote.Token.Verify(bytes[:position], vote.Signatute) {
+		return nil, util.NewParseError("round commit", position, util.ErrBadSignature)
 	}
+	return &vote, nil
 }
 
 func (r *RoundCommit) MsgKind() byte {
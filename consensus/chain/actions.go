@@ -22,14 +22,18 @@ func NewActionArray() *ActionArray {
 }
 
 // ParseAction parses byte array to an action array. The underlying byte array
-// must follow the format of a util.PutActionsArray.
-func ParseAction(data []byte, position int) (*ActionArray, int) {
+// must follow the format of a util.PutActionsArray. Returns a util.ParseError
+// if the data is truncated. Actions themselves are not parsed.
+func ParseAction(data []byte, position int) (*ActionArray, int, error) {
 	actions, position := util.ParseActionsArray(data, position)
+	if err := util.CheckTruncated("action array", data, position); err != nil {
+		return nil, position, err
+	}
 	if len(actions) == 0 {
 		return &ActionArray{
 			actions: make([]int, 0),
 			data:    make([]byte, 0),
-		}, position
+		}, position, nil
 	}
 	actionArray := &ActionArray{
 		actions: make([]int, 0, len(actions)),
@@ -38,7 +42,7 @@ func ParseAction(data []byte, position int) (*ActionArray, int) {
 	for _, action := range actions {
 		actionArray.Append(action)
 	}
-	return actionArray, position
+	return actionArray, position, nil
 }
 
 // Serialize serializes an action array to a byte array. The underlying byte
@@ -41,7 +41,8 @@ func (b *BlockBuilder) Hash() crypto.Hash {
 	return crypto.Hasher(append(hashHead[:], hashActions[:]...))
 }
 
-// Validates new action and appends it to the action array if valid.
+// Validates new action and appends it to the action array if valid. Actions
+// paying less than the minimum fee for their size are rejected.
 func (b *BlockBuilder) Validate(data []byte) bool {
 	if b.Validator.Validate(data) {
 		b.Actions.Append(data)
@@ -50,6 +51,20 @@ func (b *BlockBuilder) Validate(data []byte) bool {
 	return false
 }
 
+// ValidateBatch validates new actions with the same outcome as calling Validate
+// on each of them in order. Actions touching distinct wallets are validated in
+// parallel (see state.MutatingState.ValidateParallel). Valid actions are
+// appended to the action array in order. Returns the validity of each action.
+func (b *BlockBuilder) ValidateBatch(data [][]byte) []bool {
+	valid := b.Validator.ValidateParallel(data)
+	for n, ok := range valid {
+		if ok {
+			b.Actions.Append(data[n])
+		}
+	}
+	return valid
+}
+
 // Returns a pointer to a SeledBlock properly signed by the provided credentials.
 func (b *BlockBuilder) Seal(credentials crypto.PrivateKey) *SealedBlock {
 	hash := b.Hash()
@@ -86,23 +101,40 @@ type SealedBlock struct {
 	Mutations *state.Mutations
 }
 
-// ParseSealedBlock parses a byte array into a SealedBlock. Returns nil if the
-// byte array is not a valid SealedBlock.
-func ParseSealedBlock(data []byte) *SealedBlock {
+// ParseSealedBlock parses a byte array into a SealedBlock. Returns a
+// util.ParseError if the byte array is not a valid SealedBlock.
+func ParseSealedBlock(data []byte) (*SealedBlock, error) {
+	block, position, err := parseSealedBlockPosition("sealed block", data)
+	if err != nil {
+		return nil, err
+	}
+	if err := util.CheckEnd("sealed block", data, position); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// parseSealedBlockPosition parses the header, the action array and the seal at
+// the start of a sealed or committed block (named by structure in errors) and
+// returns the position at the end of the seal bytes.
+func parseSealedBlockPosition(structure string, data []byte) (*SealedBlock, int, error) {
 	var block SealedBlock
-	header, position := parseHeaderBlockHeaderPosition(data, 0)
-	if header == nil {
-		return nil
+	header, position, err := parseHeaderBlockHeaderPosition(data, 0)
+	if err != nil {
+		return nil, position, util.NewParseError(structure, 0, err)
 	}
 	block.Header = *header
-	block.Actions, position = ParseAction(data, position)
-	var seal *BlockSeal
-	seal, position = parseBlockSealPosition(data, position)
-	block.Seal = *seal
-	if position != len(data) {
-		return nil
+	start := position
+	if block.Actions, position, err = ParseAction(data, position); err != nil {
+		return nil, position, util.NewParseError(structure, start, err)
 	}
-	return &block
+	start = position
+	seal, position, err := parseBlockSealPosition(data, position)
+	if err != nil {
+		return nil, position, util.NewParseError(structure, start, err)
+	}
+	block.Seal = *seal
+	return &block, position, nil
 }
 
 // Serialize serializes a SealedBlock to a byte array.
@@ -113,11 +145,22 @@ func (s *SealedBlock) Serialize() []byte {
 	return bytes
 }
 
+// Hash returns the hash of the header and of the action array of the sealed
+// block. The hash of the seal of a valid sealed block equals it.
+func (s *SealedBlock) Hash() crypto.Hash {
+	hashHead := crypto.Hasher(s.Header.Serialize())
+	hashActions := s.Actions.Hash()
+	return crypto.Hasher(append(hashHead[:], hashActions[:]...))
+}
+
 // Revalidate checks if the actions of a sealed block remains valid according to
 // a more recent state. Hashes of invalidated actions are added to the block
 // commit. The block chain shoul ignore those invalidated actions in order to
 // advance the state of the chain. Nonetheless the invalidated actions are not
-// purged from the action array in the CommitBlock.
+// purged from the action array in the CommitBlock. Signatures of the actions
+// are batch verified in parallel before validation (see ActionArray.PreVerify)
+// and actions touching distinct wallets are validated in parallel (see
+// state.MutatingState.ValidateActions).
 // Commit is an individual action of a node and not subject to a committe for
 // further validation and consensus formation. Users receiving a commit block
 // must decide if the trust the publisher or if theuy should independtly check
@@ -126,12 +169,24 @@ func (c *SealedBlock) Revalidate(validator *state.MutatingState, publish crypto.
 	invalidated := make([]crypto.Hash, 0)
 	feesCollected := c.Seal.FeesCollected
 	if validator != nil {
-		for n := 0; n < c.Actions.Len(); n++ {
-			action := c.Actions.Get(n)
-			if !validator.Validate(action) {
-				actionFee := actions.GetFeeFromBytes(action)
-				if feesCollected > actionFee {
-					feesCollected -= actionFee
+		data := make([][]byte, c.Actions.Len())
+		for n := range data {
+			data[n] = c.Actions.Get(n)
+		}
+		valid := validator.ValidateActions(data, c.Actions.PreVerify())
+		for n, action := range data {
+			if !valid[n] {
+				// the minimum fee is burned and was never collected
+				collected := actions.GetFeeFromBytes(action)
+				if minimumFee := validator.MinimumFee(len(action)); collected > minimumFee {
+					collected -= minimumFee
+				} else {
+					collected = 0
+				}
+				if feesCollected > collected {
+					feesCollected -= collected
+				} else {
+					feesCollected = 0
 				}
 				invalidated = append(invalidated, crypto.Hasher(action))
 			}
@@ -171,26 +226,22 @@ func (c *CommitBlock) Sealed() *SealedBlock {
 	}
 }
 
-// ParseCommitBlock parses a byte array into a CommitBlock. Returns nil if the
-// byte array is not a valid CommitBlock.
-func ParseCommitBlock(data []byte) *CommitBlock {
-	var block CommitBlock
-	header, position := parseHeaderBlockHeaderPosition(data, 0)
-	if header == nil {
-		return nil
+// ParseCommitBlock parses a byte array into a CommitBlock. Returns a
+// util.ParseError if the byte array is not a valid CommitBlock.
+func ParseCommitBlock(data []byte) (*CommitBlock, error) {
+	sealed, position, err := parseSealedBlockPosition("commit block", data)
+	if err != nil {
+		return nil, err
 	}
-	block.Header = *header
-	block.Actions, position = ParseAction(data, position)
-	var seal *BlockSeal
-	seal, position = parseBlockSealPosition(data, position)
-	block.Seal = *seal
-	var commit *BlockCommit
-	commit, position = parseBlockCommitPosition(data, position)
-	block.Commit = commit
-	if position != len(data) {
-		return nil
+	block := CommitBlock{Header: sealed.Header, Actions: sealed.Actions, Seal: sealed.Seal}
+	start := position
+	if block.Commit, position, err = parseBlockCommitPosition(data, position); err != nil {
+		return nil, util.NewParseError("commit block", start, err)
+	}
+	if err := util.CheckEnd("commit block", data, position); err != nil {
+		return nil, err
 	}
-	return &block
+	return &block, nil
 }
 
 // Serialize serializes a CommitBlock to a byte array without signature.
@@ -202,6 +253,11 @@ func (b *CommitBlock) serializeForPublish() []byte {
 	return bytes
 }
 
+// VerifyPublisher returns true if the block commit is signed by its publisher.
+func (b *CommitBlock) VerifyPublisher() bool {
+	return b.Commit.PublishedBy.Verify(b.serializeForPublish(), b.Commit.PublishSign)
+}
+
 // Serialize serializes a CommitBlock to a byte array.
 func (b *CommitBlock) Serialize() []byte {
 	bytes := b.serializeForPublish()
@@ -0,0 +1,272 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/freehandle/breeze/util"
+)
+
+const blocksFileName = "blocks.dat"
+
+// Kinds of records on the block store.
+const (
+	recordSealed byte = iota + 1
+	recordCommit
+)
+
+// blockRecord is the position of a serialized block on the block store file.
+type blockRecord struct {
+	offset int64
+	size   int
+}
+
+// BlockStore keeps on a directory an append only log with every block sealed
+// and committed by the chain. The latest record of an epoch supersedes previous
+// ones, as after a recovery. With a block store a node can serve the entire
+// history of the chain to syncing peers and, after a crash, commit again the
+// blocks following its last commit on record (see RestoreBlocks) without
+// resorting to peers.
+type BlockStore struct {
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	sealed    map[uint64]blockRecord
+	committed map[uint64]blockRecord
+}
+
+// OpenBlockStore opens the block store on the given directory. The directory
+// is created if it does not exist. A truncated last record, as left by a crash
+// during an append, is discarded.
+func OpenBlockStore(path string) (*BlockStore, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, fmt.Errorf("could not create block store directory: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(path, blocksFileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	store := &BlockStore{
+		file:      file,
+		sealed:    make(map[uint64]blockRecord),
+		committed: make(map[uint64]blockRecord),
+	}
+	position := 0
+	for position < len(data) {
+		start := position
+		var record []byte
+		if position+4 <= len(data) {
+			record, position = util.ParseLargeByteArray(data, position)
+		}
+		if len(record) < 9 || position > len(data) {
+			slog.Warn("BlockStore: discarding truncated block at the end of the log")
+			if err := file.Truncate(int64(start)); err != nil {
+				file.Close()
+				return nil, err
+			}
+			position = start
+			break
+		}
+		epoch, _ := util.ParseUint64(record, 1)
+		entry := blockRecord{offset: int64(start + 4 + 9), size: len(record) - 9}
+		switch record[0] {
+		case recordSealed:
+			store.sealed[epoch] = entry
+		case recordCommit:
+			store.committed[epoch] = entry
+		default:
+			file.Close()
+			return nil, errors.New("invalid record on the block store")
+		}
+	}
+	store.size = int64(position)
+	return store, nil
+}
+
+// append appends a block record of the given kind and epoch to the log.
+func (s *BlockStore) append(kind byte, epoch uint64, block []byte) error {
+	record := []byte{kind}
+	util.PutUint64(epoch, &record)
+	record = append(record, block...)
+	bytes := make([]byte, 0, len(record)+4)
+	util.PutLargeByteArray(record, &bytes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.WriteAt(bytes, s.size); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	entry := blockRecord{offset: s.size + 4 + 9, size: len(block)}
+	if kind == recordSealed {
+		s.sealed[epoch] = entry
+	} else {
+		s.committed[epoch] = entry
+	}
+	s.size += int64(len(bytes))
+	return nil
+}
+
+// AppendSealed appends a sealed block to the log.
+func (s *BlockStore) AppendSealed(sealed *SealedBlock) error {
+	return s.append(recordSealed, sealed.Header.Epoch, sealed.Serialize())
+}
+
+// AppendCommit appends a committed block to the log.
+func (s *BlockStore) AppendCommit(commit *CommitBlock) error {
+	return s.append(recordCommit, commit.Header.Epoch, commit.Serialize())
+}
+
+// read reads the block of the record from the log.
+func (s *BlockStore) read(entry blockRecord) ([]byte, error) {
+	data := make([]byte, entry.size)
+	if _, err := s.file.ReadAt(data, entry.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Commit returns the committed block of the epoch on the log, or nil if there
+// is none.
+func (s *BlockStore) Commit(epoch uint64) (*CommitBlock, error) {
+	s.mu.Lock()
+	entry, ok := s.committed[epoch]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	data, err := s.read(entry)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCommitBlock(data)
+}
+
+// Sealed returns the sealed block of the epoch on the log, or nil if there is
+// none.
+func (s *BlockStore) Sealed(epoch uint64) (*SealedBlock, error) {
+	s.mu.Lock()
+	entry, ok := s.sealed[epoch]
+	s.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	data, err := s.read(entry)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSealedBlock(data)
+}
+
+// Epochs returns the first and the last epochs with a block on the log, or
+// zero if the log is empty.
+func (s *BlockStore) Epochs() (uint64, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first, last := uint64(0), uint64(0)
+	for _, records := range []map[uint64]blockRecord{s.sealed, s.committed} {
+		for epoch := range records {
+			if first == 0 || epoch < first {
+				first = epoch
+			}
+			if epoch > last {
+				last = epoch
+			}
+		}
+	}
+	return first, last
+}
+
+// Close closes the block store file.
+func (s *BlockStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// appendSealed records a sealed block on the block store, if any.
+func (c *Blockchain) appendSealed(sealed *SealedBlock) {
+	if c.Blocks == nil {
+		return
+	}
+	if err := c.Blocks.AppendSealed(sealed); err != nil {
+		slog.Error("Blockchain: could not append sealed block to block store", "epoch", sealed.Header.Epoch, "err", err)
+	}
+}
+
+// appendCommit records a committed block on the block store, if any, and
+// prunes from memory committed blocks older than KeepLastNBlocks that are no
+// longer needed to validate blocks against checkpoints after the checksum.
+func (c *Blockchain) appendCommit(commit *CommitBlock) {
+	if c.Blocks == nil {
+		return
+	}
+	if err := c.Blocks.AppendCommit(commit); err != nil {
+		slog.Error("Blockchain: could not append committed block to block store", "epoch", commit.Header.Epoch, "err", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prune := 0
+	for _, block := range c.RecentBlocks {
+		if block.Header.Epoch+KeepLastNBlocks > c.LastCommitEpoch || block.Header.Epoch >= c.Checksum.Epoch {
+			break
+		}
+		prune += 1
+	}
+	if prune > 0 {
+		c.RecentBlocks = append(make([]*CommitBlock, 0, len(c.RecentBlocks)-prune), c.RecentBlocks[prune:]...)
+	}
+}
+
+// RestoreBlocks adds to the blockchain the blocks on the block store following
+// the last commit epoch, so that a node restarted from genesis or from a
+// snapshot commits again the blocks it had committed or sealed before a crash.
+// Committed blocks are added as sealed blocks and revalidated. It returns the
+// number of blocks added.
+func (c *Blockchain) RestoreBlocks() (int, error) {
+	if c.Blocks == nil {
+		return 0, errors.New("blockchain has no block store")
+	}
+	_, last := c.Blocks.Epochs()
+	count := 0
+	for epoch := c.LastCommitEpoch + 1; epoch <= last; epoch++ {
+		var sealed *SealedBlock
+		commit, err := c.Blocks.Commit(epoch)
+		if err != nil {
+			return count, err
+		}
+		if commit != nil {
+			sealed = commit.Sealed()
+		} else if sealed, err = c.Blocks.Sealed(epoch); err != nil {
+			return count, err
+		}
+		if sealed == nil {
+			continue
+		}
+		// commits are on hold while a checkpoint is being calculated
+		for c.IsCloning() {
+			time.Sleep(time.Millisecond)
+		}
+		c.AddSealedBlock(sealed)
+		count += 1
+	}
+	for c.IsCloning() {
+		time.Sleep(time.Millisecond)
+	}
+	c.CommitChain()
+	slog.Info("Blockchain: restored blocks from block store", "count", count, "last commit epoch", c.LastCommitEpoch)
+	return count, nil
+}
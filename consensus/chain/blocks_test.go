@@ -0,0 +1,98 @@
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+func TestBlockStore(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	blockchain := newTestChain(key)
+	path := t.TempDir()
+	store, err := OpenBlockStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Blocks = store
+	addTestBlocks(t, blockchain, key, 1, 3)
+	// epoch 5 is sealed but cannot be committed without epoch 4
+	pending := sealTestBlock(t, blockchain, key, 5)
+	superseding := sealTestBlock(t, blockchain, key, 5)
+	missing := sealTestBlock(t, blockchain, key, 4)
+	blockchain.AddSealedBlock(pending)
+	if first, last := store.Epochs(); first != 1 || last != 5 {
+		t.Fatalf("unexpected epochs on block store: %d to %d", first, last)
+	}
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		commit, err := store.Commit(epoch)
+		if err != nil || commit == nil || !commit.Seal.Hash.Equal(blockchain.RecentBlocks[epoch-1].Seal.Hash) {
+			t.Fatalf("committed block %d not on block store: %v", epoch, err)
+		}
+	}
+	if sealed, err := store.Sealed(5); err != nil || sealed == nil || !sealed.Seal.Hash.Equal(pending.Seal.Hash) {
+		t.Fatalf("sealed block not on block store: %v", err)
+	}
+	if commit, err := store.Commit(5); commit != nil || err != nil {
+		t.Fatal("uncommitted block on block store")
+	}
+	if sealed, err := store.Sealed(4); sealed != nil || err != nil {
+		t.Fatal("unknown block on block store")
+	}
+
+	// the latest record of an epoch supersedes previous ones
+	if err := store.AppendSealed(superseding); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := store.Sealed(5); sealed == nil || !sealed.Seal.Hash.Equal(superseding.Seal.Hash) {
+		t.Fatal("sealed block not superseded")
+	}
+
+	// a truncated record at the end of the log is discarded on reopen
+	store.Close()
+	file, err := os.OpenFile(filepath.Join(path, blocksFileName), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0, 1, 0, 0, recordSealed, 6}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if store, err = OpenBlockStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if first, last := store.Epochs(); first != 1 || last != 5 {
+		t.Fatalf("unexpected epochs on reopened block store: %d to %d", first, last)
+	}
+	if sealed, _ := store.Sealed(5); sealed == nil || !sealed.Seal.Hash.Equal(superseding.Seal.Hash) {
+		t.Fatal("superseding sealed block not on reopened block store")
+	}
+	// records appended after the discarded one are read on reopen
+	if err := store.AppendSealed(missing); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = OpenBlockStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if sealed, err := store.Sealed(4); err != nil || sealed == nil || !sealed.Seal.Hash.Equal(missing.Seal.Hash) {
+		t.Fatalf("block appended after truncated record not on block store: %v", err)
+	}
+
+	// a chain restarted from genesis commits again the blocks on the store
+	restored := newTestChain(key)
+	restored.Blocks = store
+	if count, err := restored.RestoreBlocks(); err != nil || count != 5 {
+		t.Fatalf("unexpected restored blocks %d: %v", count, err)
+	}
+	for restored.IsCloning() {
+		time.Sleep(time.Millisecond)
+	}
+	if restored.LastCommitEpoch != 5 || !restored.LastCommitHash.Equal(superseding.Seal.Hash) {
+		t.Fatalf("restored last commit %d, expected 5", restored.LastCommitEpoch)
+	}
+}
@@ -31,7 +31,8 @@ import (
 )
 
 // block chain should keep as many KeepLastNBlocks blocks in memory for fast
-// sync jobs and for recovery purposes.
+// sync jobs and for recovery purposes. Older blocks are pruned from memory only
+// if the chain has a block store to serve them from.
 const KeepLastNBlocks = 100
 
 // Force and Empty commit after so many blocks stagnated on a given checkpoint.
@@ -48,6 +49,8 @@ type Checksum struct {
 	State         *state.State
 	LastBlockHash crypto.Hash
 	Hash          crypto.Hash
+	treeOnce      sync.Once
+	tree          *state.BalanceTree
 }
 
 // The last perceived epoch-to-clock synchronization in possession of the node.
@@ -70,6 +73,7 @@ func (c ClockSyncronization) Timer(d time.Duration) time.Duration {
 type Blockchain struct {
 	mu              sync.Mutex
 	NetworkHash     crypto.Hash
+	GenesisHash     crypto.Hash // hash of the genesis of the network, zero if unknown
 	Credentials     crypto.PrivateKey
 	LastCommitEpoch uint64
 	LastCommitHash  crypto.Hash
@@ -80,9 +84,15 @@ type Blockchain struct {
 	Checksum        *Checksum
 	NextChecksum    *Checksum
 	Clock           ClockSyncronization
-	Punishment      map[crypto.Token]uint64
+	Punishment      map[crypto.Token]uint64 // total deposit burned by token
+	Punish          Punisher                // slashing rule for duplicate evidence
 	BlockInterval   time.Duration
 	ChecksumWindow  int
+	Snapshots       *SnapshotStore      // optional on disk snapshots and diffs
+	Blocks          *BlockStore         // optional on disk sealed and committed blocks
+	Log             *state.MutationsLog // optional write ahead log of mutations
+	weightsMu       sync.Mutex
+	windowWeights   map[uint64]map[crypto.Token]int // validator weights per window start
 }
 
 // IsChecksumEpoch returns true if the provided epoch is a checksum epoch and
@@ -101,36 +111,33 @@ func (b *Blockchain) IsChecksumCommit() bool {
 // creates the genesis state and depoits the initial tokens on the credentials
 // wallet. Credentials is also accredited as a validator for the first checksum
 // window. hash is the network hash. interval is the block interval. checksum
-// window is the number of epochs between checksums.
-func BlockchainFromGenesisState(credentials crypto.PrivateKey, walletPath string, hash crypto.Hash, interval time.Duration, cehcksumWindow int) *Blockchain {
-	genesis := state.NewGenesisStateWithToken(credentials.PublicKey(), walletPath)
-	if genesis == nil {
+// window is the number of epochs between checksums. minFeePerByte and
+// targetBlockSize are the parameters of the genesis fee market. issuance is the
+// schedule of block rewards. The genesis timestamp is the current time and the
+// genesis hash is the hash of the credentials token. See BlockchainFromGenesis
+// for networks with many genesis wallets.
+func BlockchainFromGenesisState(credentials crypto.PrivateKey, walletPath string, hash crypto.Hash, interval time.Duration, cehcksumWindow, unbondingWindows int, minFeePerByte uint64, targetBlockSize int, issuance state.IssuanceSchedule) *Blockchain {
+	genesis := &Genesis{
+		NetworkHash:      hash,
+		TimeStamp:        time.Now(),
+		Wallets:          []GenesisWallet{{Token: credentials.PublicKey(), Wallet: state.GenesisMint, Deposit: state.GenesisMint}},
+		BlockInterval:    interval,
+		ChecksumWindow:   cehcksumWindow,
+		UnbondingWindows: unbondingWindows,
+		MinFeePerByte:    minFeePerByte,
+		TargetBlockSize:  targetBlockSize,
+		Issuance:         issuance,
+	}
+	blockchain, err := BlockchainFromGenesis(genesis, credentials, walletPath)
+	if err != nil {
+		slog.Error("BlockchainFromGenesisState: could not create genesis", "error", err)
 		return nil
 	}
-	cloned := genesis.Clone()
-	blockchain := &Blockchain{
-		mu:              sync.Mutex{},
-		NetworkHash:     hash,
-		Credentials:     credentials,
-		LastCommitEpoch: 0,
-		LastCommitHash:  crypto.HashToken(credentials.PublicKey()),
-		CommitState:     genesis,
-		SealedBlocks:    make([]*SealedBlock, 0),
-		RecentBlocks:    make([]*CommitBlock, 0),
-		Checksum: &Checksum{
-			Epoch:         0,
-			State:         cloned,
-			LastBlockHash: crypto.HashToken(credentials.PublicKey()),
-			Hash:          cloned.ChecksumHash(),
-		},
-		Clock: ClockSyncronization{
-			Epoch:     0,
-			TimeStamp: time.Now(),
-		},
-		BlockInterval:  interval,
-		ChecksumWindow: cehcksumWindow,
-	}
-	slog.Info("gensis state created", "token", credentials.PublicKey(), "genesis hash", crypto.EncodeHash(blockchain.Checksum.Hash))
+	// a genesis started by a single node is identified by its token
+	hash = crypto.HashToken(credentials.PublicKey())
+	blockchain.GenesisHash = hash
+	blockchain.LastCommitHash = hash
+	blockchain.Checksum.LastBlockHash = hash
 	return blockchain
 }
 
@@ -164,6 +171,7 @@ func BlockchainFromChecksumState(c *Checksum, clock ClockSyncronization, credent
 		RecentBlocks:    make([]*CommitBlock, 0),
 		Checksum:        c,
 		Clock:           clock,
+		Punishment:      make(map[crypto.Token]uint64),
 		BlockInterval:   interval,
 		ChecksumWindow:  checksumWindow,
 	}
@@ -298,8 +306,9 @@ func (c *Blockchain) AddSealedBlock(sealed *SealedBlock) {
 	if !hasFound {
 		c.SealedBlocks = append(c.SealedBlocks, sealed)
 	}
+	c.appendSealed(sealed)
 	slog.Info("Blockchain: added sealed block", "epoch", sealed.Header.Epoch, "hash", crypto.EncodeHash(sealed.Seal.Hash), "publisher", sealed.Header.Proposer)
-	if !c.Cloning {
+	if !c.IsCloning() {
 		c.CommitChain()
 	}
 }
@@ -373,6 +382,8 @@ func (c *Blockchain) CheckForceEmptyCommit() bool {
 	c.RecentBlocks = append(c.RecentBlocks, &commit)
 	c.LastCommitEpoch += 1
 	c.LastCommitHash = commit.Seal.Hash
+	c.appendDiff(&Diff{Epoch: c.LastCommitEpoch, Hash: c.LastCommitHash})
+	c.appendCommit(&commit)
 	return true
 }
 
@@ -385,14 +396,19 @@ func (c *Blockchain) CommitBlock(blockEpoch uint64) bool {
 	defer func() {
 		if r := recover(); r != nil {
 			slog.Error("chain CommitBlock panic", "err", r)
+			c.rollbackMutations()
 		}
 	}()
-	if c.Cloning {
+	if c.IsCloning() {
 		return false
 	}
 	if blockEpoch != c.LastCommitEpoch+1 {
 		return false // commit must be sequential
 	}
+	if !c.hasRewardWeights(blockEpoch) {
+		slog.Error("Blockchain: unknown window weights, cannot commit block", "epoch", blockEpoch)
+		return false
+	}
 	var block *SealedBlock
 	for n, sealed := range c.SealedBlocks {
 		if sealed.Header.Epoch == blockEpoch {
@@ -408,15 +424,19 @@ func (c *Blockchain) CommitBlock(blockEpoch uint64) bool {
 	var validator *state.MutatingState
 	if epoch != c.LastCommitEpoch {
 		validator = c.CommitState.Validator(state.NewMutations(epoch), epoch)
+		c.applyEvidence(block.Header, validator)
 	}
 	commit := block.Revalidate(validator, c.Credentials)
 	if commit == nil {
 		return false
 	}
 	c.RecentBlocks = append(c.RecentBlocks, commit)
-	validator.Incorporate(c.Credentials.PublicKey())
+	validator.Reward(c.rewardWeights(validator, epoch))
+	c.incorporate(validator, block.Header.Proposer, block.Seal.Hash)
 	c.LastCommitEpoch = block.Header.Epoch
 	c.LastCommitHash = block.Seal.Hash
+	c.appendDiff(&Diff{Epoch: c.LastCommitEpoch, Hash: c.LastCommitHash, Mutations: validator.Mutations()})
+	c.appendCommit(commit)
 	if c.IsChecksumCommit() {
 		c.MarkCheckpoint()
 	}
@@ -470,24 +490,31 @@ func (c *Blockchain) Recovery(epoch uint64) error {
 		return errors.New("dont need recovery to an epoch after last commit")
 	}
 	commit := make([]*CommitBlock, 0)
-	mutations := make([]*state.Mutations, 0)
 	for _, block := range c.RecentBlocks {
 		if block.Header.Epoch <= epoch {
 			commit = append(commit, block)
-			mutations = append(mutations, block.mutations)
+			// incorporation depends on the epoch and the size of each block, so
+			// blocks after the checksum are incorporated one by one in order
+			if block.Header.Epoch > c.Checksum.Epoch && block.mutations != nil {
+				c.Checksum.State.IncorporateMutations(block.mutations)
+			}
 		}
 		if block.Header.Epoch == epoch {
 			c.LastCommitHash = block.Seal.Hash
 		}
 	}
-	groupedMutations := state.NewMutations(epoch).Append(mutations)
-	c.Checksum.State.IncorporateMutations(groupedMutations)
 	c.RecentBlocks = commit
 	c.LastCommitEpoch = epoch
 	return nil
 }
 
 func (c *Blockchain) Shutdown() {
+	if c.Blocks != nil {
+		c.Blocks.Close()
+	}
+	if c.Log != nil {
+		c.Log.Close()
+	}
 	if c.CommitState != nil {
 		c.CommitState.Shutdown()
 	}
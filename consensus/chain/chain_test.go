@@ -0,0 +1,102 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+const testChecksumWindow = 4
+
+var testNetwork = crypto.Hasher([]byte("chain test network"))
+
+// newTestChain returns a blockchain from a genesis state minted to the key
+// with the key as the only validator of the first windows.
+func newTestChain(key crypto.PrivateKey) *Blockchain {
+	return newTargetTestChain(key, 0)
+}
+
+// newTargetTestChain returns a test chain whose base fee adapts to the given
+// target block size.
+func newTargetTestChain(key crypto.PrivateKey, targetBlockSize int) *Blockchain {
+	blockchain := BlockchainFromGenesisState(key, "", testNetwork, time.Second, testChecksumWindow, 2, 0, targetBlockSize, state.IssuanceSchedule{})
+	for start := uint64(1); start < 3*testChecksumWindow; start += testChecksumWindow {
+		blockchain.SetWindowWeights(start, map[crypto.Token]int{key.PublicKey(): 1})
+	}
+	return blockchain
+}
+
+// testTransfer returns a signed transfer from the key to a random token.
+func testTransfer(epoch uint64, from crypto.PrivateKey, value uint64) []byte {
+	to, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{
+		TimeStamp: epoch,
+		From:      from.PublicKey(),
+		To:        []crypto.TokenValue{{Token: to, Value: value}},
+		Fee:       1000,
+	}
+	transfer.Sign(from)
+	return transfer.Serialize()
+}
+
+// sealTestBlock seals a block for the epoch on the blockchain with a transfer
+// from the key.
+func sealTestBlock(t *testing.T, blockchain *Blockchain, key crypto.PrivateKey, epoch uint64) *SealedBlock {
+	header := blockchain.NextBlock(epoch)
+	if header == nil {
+		t.Fatalf("could not create header for epoch %d", epoch)
+	}
+	builder := blockchain.CheckpointValidator(*header)
+	if !builder.Validate(testTransfer(epoch, key, epoch)) {
+		t.Fatalf("invalid transfer for epoch %d", epoch)
+	}
+	sealed, err := ParseSealedBlock(builder.Seal(key).Serialize())
+	if err != nil {
+		t.Fatalf("could not parse sealed block: %v", err)
+	}
+	return sealed
+}
+
+// addTestBlocks seals and commits blocks from epoch first to last on the
+// blockchain.
+func addTestBlocks(t *testing.T, blockchain *Blockchain, key crypto.PrivateKey, first, last uint64) {
+	for epoch := first; epoch <= last; epoch++ {
+		blockchain.AddSealedBlock(sealTestBlock(t, blockchain, key, epoch))
+		for blockchain.IsCloning() {
+			time.Sleep(time.Millisecond)
+		}
+		if blockchain.LastCommitEpoch != epoch {
+			t.Fatalf("block %d not committed", epoch)
+		}
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	// blocks above the target raise the base fee at every incorporation
+	blockchain := newTargetTestChain(key, 1)
+	addTestBlocks(t, blockchain, key, 1, 3)
+	// reference state with the blocks up to epoch 2 committed one by one
+	sequential := newTargetTestChain(key, 1)
+	for _, commit := range blockchain.RecentBlocks[:2] {
+		sequential.AddSealedBlock(commit.Sealed())
+		for sequential.IsCloning() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if sequential.LastCommitEpoch != 2 {
+		t.Fatal("blocks not committed on reference chain")
+	}
+	if err := blockchain.Recovery(2); err != nil {
+		t.Fatal(err)
+	}
+	if blockchain.LastCommitEpoch != 2 || !blockchain.LastCommitHash.Equal(sequential.LastCommitHash) {
+		t.Fatalf("recovered last commit %d, expected 2", blockchain.LastCommitEpoch)
+	}
+	if !blockchain.Checksum.State.ChecksumHash().Equal(sequential.CommitState.ChecksumHash()) {
+		t.Fatal("recovered state differs from sequential commits")
+	}
+}
@@ -15,28 +15,59 @@ func (c *Blockchain) MarkCheckpoint() {
 	c.mu.Lock()
 	c.Cloning = true
 	go func() {
-		epoch := c.LastCommitEpoch
-		hash := c.LastCommitHash
-		clonedState := c.CommitState.Clone()
-		if clonedState == nil {
+		checksum := c.checkpoint()
+		if checksum == nil {
 			slog.Error("MarkChekpoint: cloned state is nil")
 			return
 		}
-		checksumHash := clonedState.ChecksumHash()
-		checksumHash = crypto.Hasher(append(util.Uint64ToBytes(epoch), checksumHash[:]...))
-		c.NextChecksum = &Checksum{
-			Epoch:         epoch,
-			State:         clonedState,
-			LastBlockHash: hash,
-			Hash:          checksumHash,
-		}
+		c.mu.Lock()
+		c.NextChecksum = checksum
 		c.Cloning = false
-		slog.Info("Blockchain: checkpoint calculation job completed", "epoch", c.NextChecksum.Epoch, "last block", c.NextChecksum.LastBlockHash, "cehckpoint hash", c.NextChecksum.Hash)
+		c.mu.Unlock()
+		slog.Info("Blockchain: checkpoint calculation job completed", "epoch", checksum.Epoch, "last block", checksum.LastBlockHash, "cehckpoint hash", checksum.Hash)
+		if c.Snapshots != nil {
+			if err := c.Snapshots.WriteSnapshot(checksum, c.Clock); err != nil {
+				slog.Error("MarkCheckpoint: could not write snapshot", "epoch", checksum.Epoch, "err", err)
+			}
+		}
 	}()
 	c.mu.Unlock()
 
 }
 
+// IsCloning returns true while the checkpoint job started by MarkCheckpoint is
+// cloning the commit state. Blocks are not committed until it completes.
+// Goroutines other than the one committing blocks must wait for the job with
+// IsCloning instead of reading Cloning.
+func (c *Blockchain) IsCloning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Cloning
+}
+
+// checkpoint returns a checksum of a clone of the state at the last commit
+// epoch. It returns nil if the state could not be cloned.
+func (c *Blockchain) checkpoint() *Checksum {
+	epoch := c.LastCommitEpoch
+	hash := c.LastCommitHash
+	clonedState := c.CommitState.Clone()
+	if clonedState == nil {
+		return nil
+	}
+	return &Checksum{
+		Epoch:         epoch,
+		State:         clonedState,
+		LastBlockHash: hash,
+		Hash:          EpochChecksumHash(epoch, clonedState.ChecksumHash()),
+	}
+}
+
+// EpochChecksumHash returns the checksum hash of a state at a checkpoint epoch
+// as published on naked checksum statements.
+func EpochChecksumHash(epoch uint64, stateHash crypto.Hash) crypto.Hash {
+	return crypto.Hasher(append(util.Uint64ToBytes(epoch), stateHash[:]...))
+}
+
 // ChecksumStatement is a message every candidate node for validating during
 // the next checksum window period msut send to current validator nodes. It is
 // first sent with the checksum hash hashed with the node's token and with
@@ -91,15 +122,24 @@ func (d *ChecksumStatement) Serialize() []byte {
 	return bytes
 }
 
-// ParseChecksumStatement parses a ChecksumStatement from a byte slice.
-func ParseChecksumStatement(data []byte) *ChecksumStatement {
-	parsed, _ := ParseChecksumStatementPosition(data, 0)
-	return parsed
+// ParseChecksumStatement parses a ChecksumStatement from a byte slice. Returns
+// a util.ParseError if the byte slice does not contain a valid statement.
+func ParseChecksumStatement(data []byte) (*ChecksumStatement, error) {
+	parsed, position, err := ParseChecksumStatementPosition(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := util.CheckEnd("checksum statement", data, position); err != nil {
+		return nil, err
+	}
+	return parsed, nil
 }
 
 // ParseChecksumStatementPosition parses a ChecksumStatement in the middle of
-// a byte slice and returns the parsed ChecksumStatement and the position
-func ParseChecksumStatementPosition(data []byte, position int) (*ChecksumStatement, int) {
+// a byte slice and returns the parsed ChecksumStatement and the position at the
+// end of the statement bytes. Returns a util.ParseError if the data is
+// truncated or if the signature of the node is invalid.
+func ParseChecksumStatementPosition(data []byte, position int) (*ChecksumStatement, int, error) {
 	initial := position
 	dressed := ChecksumStatement{}
 	dressed.Epoch, position = util.ParseUint64(data, position)
@@ -107,11 +147,21 @@ func ParseChecksumStatementPosition(data []byte, position int) (*ChecksumStateme
 	dressed.Address, position = util.ParseString(data, position)
 	dressed.Naked, position = util.ParseBool(data, position)
 	dressed.Hash, position = util.ParseHash(data, position)
+	if err := util.CheckTruncated("checksum statement", data, position+crypto.SignatureSize); err != nil {
+		return nil, position + crypto.SignatureSize, err
+	}
 	dressed.Signature, _ = util.ParseSignature(data, position)
-	if dressed.Node.Verify(data[initial:position], dressed.Signature) {
-		return &dressed, position + crypto.SignatureSize
+	if !dressed.Node.Verify(data[initial:position], dressed.Signature) {
+		return nil, position + crypto.SignatureSize, util.NewParseError("checksum statement", position, util.ErrBadSignature)
 	}
-	return nil, position + crypto.SignatureSize
+	return &dressed, position + crypto.SignatureSize, nil
+}
+
+// VerifySignature returns true if the statement is signed by its node.
+func (d *ChecksumStatement) VerifySignature() bool {
+	bytes := make([]byte, 0)
+	putChecksumStatementForSign(d, &bytes)
+	return d.Node.Verify(bytes, d.Signature)
 }
 
 // IsDressed returns true if the naked ChecksumStatement is compatible with the
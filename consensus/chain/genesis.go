@@ -0,0 +1,184 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+	"github.com/freehandle/breeze/util"
+)
+
+// GenesisWallet is an account funded at genesis with tokens on its wallet and
+// on its deposit.
+type GenesisWallet struct {
+	Token   crypto.Token
+	Wallet  uint64
+	Deposit uint64
+}
+
+// Genesis defines the initial state and the parameters of a network. Nodes
+// starting a network from the same genesis arrive at the same genesis state
+// and the same genesis hash (see Hash), regardless of the order of the wallets.
+type Genesis struct {
+	NetworkHash      crypto.Hash
+	TimeStamp        time.Time // start of epoch 0
+	Wallets          []GenesisWallet
+	BlockInterval    time.Duration
+	ChecksumWindow   int
+	UnbondingWindows int
+	MinFeePerByte    uint64
+	TargetBlockSize  int
+	Issuance         state.IssuanceSchedule
+}
+
+// Check returns an error if the genesis is not a valid definition of a network.
+func (g *Genesis) Check() error {
+	if len(g.Wallets) == 0 {
+		return errors.New("genesis has no wallets")
+	}
+	if g.BlockInterval <= 0 {
+		return errors.New("genesis block interval must be positive")
+	}
+	if g.ChecksumWindow <= 0 {
+		return errors.New("genesis checksum window must be positive")
+	}
+	if g.UnbondingWindows < 0 || g.TargetBlockSize < 0 {
+		return errors.New("genesis unbonding windows and target block size must not be negative")
+	}
+	seen := make(map[crypto.Token]struct{})
+	supply := uint64(0)
+	for _, wallet := range g.Wallets {
+		if wallet.Token.Equal(crypto.ZeroToken) {
+			return errors.New("genesis wallet with zero token")
+		}
+		if _, ok := seen[wallet.Token]; ok {
+			return fmt.Errorf("duplicate genesis wallet %v", wallet.Token)
+		}
+		seen[wallet.Token] = struct{}{}
+		if wallet.Wallet+wallet.Deposit == 0 {
+			return fmt.Errorf("genesis wallet %v is not funded", wallet.Token)
+		}
+		for _, value := range []uint64{wallet.Wallet, wallet.Deposit} {
+			if supply+value < supply {
+				return errors.New("genesis supply overflow")
+			}
+			supply += value
+		}
+	}
+	return nil
+}
+
+// sortedWallets returns a copy of the genesis wallets sorted by token.
+func (g *Genesis) sortedWallets() []GenesisWallet {
+	wallets := make([]GenesisWallet, len(g.Wallets))
+	copy(wallets, g.Wallets)
+	sort.Slice(wallets, func(i, j int) bool {
+		for n := 0; n < crypto.TokenSize; n++ {
+			if wallets[i].Token[n] != wallets[j].Token[n] {
+				return wallets[i].Token[n] < wallets[j].Token[n]
+			}
+		}
+		return false
+	})
+	return wallets
+}
+
+// Serialize returns a deterministic byte representation of the genesis. Wallets
+// are sorted by token and the timestamp is taken in unix nanoseconds, so that
+// the representation does not depend on the order of the definition or on the
+// location of the timestamp.
+func (g *Genesis) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutHash(g.NetworkHash, &bytes)
+	util.PutUint64(uint64(g.TimeStamp.UnixNano()), &bytes)
+	util.PutUint64(uint64(g.BlockInterval), &bytes)
+	util.PutUint32(uint32(g.ChecksumWindow), &bytes)
+	util.PutUint32(uint32(g.UnbondingWindows), &bytes)
+	util.PutUint64(g.MinFeePerByte, &bytes)
+	util.PutUint64(uint64(g.TargetBlockSize), &bytes)
+	util.PutUint64(g.Issuance.BlockReward, &bytes)
+	util.PutUint64(g.Issuance.HalvingInterval, &bytes)
+	util.PutUint64(g.Issuance.InflationRate, &bytes)
+	wallets := g.sortedWallets()
+	util.PutUint32(uint32(len(wallets)), &bytes)
+	for _, wallet := range wallets {
+		util.PutToken(wallet.Token, &bytes)
+		util.PutUint64(wallet.Wallet, &bytes)
+		util.PutUint64(wallet.Deposit, &bytes)
+	}
+	return bytes
+}
+
+// Hash returns the genesis hash of the network. It is the hash of the last
+// block prior to epoch 1.
+func (g *Genesis) Hash() crypto.Hash {
+	return crypto.Hasher(g.Serialize())
+}
+
+// State creates the genesis state crediting every genesis wallet and deposit
+// and configured with the network parameters. If walletPath is not empty the
+// state is persisted on files under it. Returns nil if the state could not be
+// created.
+func (g *Genesis) State(walletPath string) *state.State {
+	accounts := make([]state.Account, 0, len(g.Wallets))
+	for _, wallet := range g.sortedWallets() {
+		accounts = append(accounts, state.Account{Hash: crypto.HashToken(wallet.Token), Wallet: wallet.Wallet, Deposit: wallet.Deposit})
+	}
+	genesis := state.NewGenesisStateWithAccounts(accounts, walletPath)
+	if genesis == nil {
+		return nil
+	}
+	genesis.Unbonding.Period = uint64(g.UnbondingWindows * g.ChecksumWindow)
+	genesis.Fees.MinFeePerByte = g.MinFeePerByte
+	genesis.Fees.BaseFeePerByte = g.MinFeePerByte
+	genesis.Fees.TargetBlockSize = uint64(g.TargetBlockSize)
+	genesis.Issuance.Schedule = g.Issuance
+	return genesis
+}
+
+// BlockchainFromGenesis creates a new blockchain from a genesis definition. The
+// genesis hash is taken as the hash of the last commit and the clock starts at
+// the genesis timestamp. Credentials is the key of the node. Returns an error
+// if the genesis is invalid or if the genesis state could not be created.
+func BlockchainFromGenesis(genesis *Genesis, credentials crypto.PrivateKey, walletPath string) (*Blockchain, error) {
+	if err := genesis.Check(); err != nil {
+		return nil, err
+	}
+	commit := genesis.State(walletPath)
+	if commit == nil {
+		return nil, errors.New("could not create genesis state")
+	}
+	hash := genesis.Hash()
+	cloned := commit.Clone()
+	blockchain := &Blockchain{
+		mu:              sync.Mutex{},
+		NetworkHash:     genesis.NetworkHash,
+		GenesisHash:     hash,
+		Credentials:     credentials,
+		LastCommitEpoch: 0,
+		LastCommitHash:  hash,
+		CommitState:     commit,
+		SealedBlocks:    make([]*SealedBlock, 0),
+		RecentBlocks:    make([]*CommitBlock, 0),
+		Checksum: &Checksum{
+			Epoch:         0,
+			State:         cloned,
+			LastBlockHash: hash,
+			Hash:          cloned.ChecksumHash(),
+		},
+		Clock: ClockSyncronization{
+			Epoch:     0,
+			TimeStamp: genesis.TimeStamp,
+		},
+		Punishment:     make(map[crypto.Token]uint64),
+		BlockInterval:  genesis.BlockInterval,
+		ChecksumWindow: genesis.ChecksumWindow,
+	}
+	slog.Info("genesis state created", "wallets", len(genesis.Wallets), "genesis hash", crypto.EncodeHash(hash), "checksum hash", crypto.EncodeHash(blockchain.Checksum.Hash))
+	return blockchain, nil
+}
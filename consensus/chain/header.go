@@ -57,34 +57,52 @@ func (b BlockHeader) Serialize() []byte {
 	return bytes
 }
 
-// ParseBlockHeader parses a byte slice to a block header. Return nil if the
-// byte slice does not contain a valid block header.
-func ParseBlockHeader(data []byte) *BlockHeader {
-	header, position := parseHeaderBlockHeaderPosition(data, 0)
-	if position != len(data) {
-		return nil
-	}
-	return header
+// ParseBlockHeader parses a byte slice to a block header. Returns a
+// util.ParseError if the byte slice does not contain a valid block header.
+func ParseBlockHeader(data []byte) (*BlockHeader, error) {
+	header, position, err := parseHeaderBlockHeaderPosition(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := util.CheckEnd("block header", data, position); err != nil {
+		return nil, err
+	}
+	return header, nil
 }
 
 // ParseBlockHeaderPosition parses a block header in the middle of a byte slice
 // and returns the parsed block header and the position at the end of the header
 // bytes.
-func parseHeaderBlockHeaderPosition(data []byte, position int) (*BlockHeader, int) {
+func parseHeaderBlockHeaderPosition(data []byte, position int) (*BlockHeader, int, error) {
 	var block BlockHeader
+	var err error
 	block.NetworkHash, position = util.ParseHash(data, position)
 	block.Epoch, position = util.ParseUint64(data, position)
 	block.CheckPoint, position = util.ParseUint64(data, position)
 	block.CheckpointHash, position = util.ParseHash(data, position)
 	block.Proposer, position = util.ParseToken(data, position)
 	block.ProposedAt, position = util.ParseTime(data, position)
-	block.Duplicate, position = bft.ParseDuplicatePosition(data, position)
+	if err := util.CheckTruncated("block header", data, position); err != nil {
+		return nil, position, err
+	}
+	start := position
+	if block.Duplicate, position, err = bft.ParseDuplicatePosition(data, position); err != nil {
+		return nil, position, util.NewParseError("block header", start, err)
+	}
 	count, position := util.ParseUint16(data, position)
-	block.Candidate = make([]*ChecksumStatement, count)
+	block.Candidate = make([]*ChecksumStatement, 0)
 	for i := 0; i < int(count); i++ {
-		block.Candidate[i], position = ParseChecksumStatementPosition(data, position)
+		start = position
+		var candidate *ChecksumStatement
+		if candidate, position, err = ParseChecksumStatementPosition(data, position); err != nil {
+			return nil, position, util.NewParseError("block header", start, err)
+		}
+		block.Candidate = append(block.Candidate, candidate)
+	}
+	if err := util.CheckTruncated("block header", data, position); err != nil {
+		return nil, position, err
 	}
-	return &block, position
+	return &block, position, nil
 }
 
 // Seal for a proposed block. It contains the hash of the proposed block, the
@@ -121,29 +139,39 @@ func (b BlockSeal) Serialize() []byte {
 	return bytes
 }
 
-// ParseBlockSeal parses a byte slice to a block seal. Return nil if the byte
-// slice does not contain a valid block seal.
-func ParseBlockSeal(data []byte) *BlockSeal {
-	block, position := parseBlockSealPosition(data, 0)
-	if position != len(data) {
-		return nil
+// ParseBlockSeal parses a byte slice to a block seal. Returns a
+// util.ParseError if the byte slice does not contain a valid block seal.
+func ParseBlockSeal(data []byte) (*BlockSeal, error) {
+	block, position, err := parseBlockSealPosition(data, 0)
+	if err != nil {
+		return nil, err
 	}
-	return block
+	if err := util.CheckEnd("block seal", data, position); err != nil {
+		return nil, err
+	}
+	return block, nil
 }
 
 // ParseBlockSealPosition parses a block seal in the middle of a byte slice and
 // returns the parsed block seal and the position at the end of the seal bytes.
-func parseBlockSealPosition(data []byte, position int) (*BlockSeal, int) {
+func parseBlockSealPosition(data []byte, position int) (*BlockSeal, int, error) {
 	var block BlockSeal
 	block.Hash, position = util.ParseHash(data, position)
 	block.FeesCollected, position = util.ParseUint64(data, position)
 	block.SealSignature, position = util.ParseSignature(data, position)
 	count, position := util.ParseByte(data, position)
+	if err := util.CheckTruncated("block seal", data, position); err != nil {
+		return nil, position, err
+	}
 	block.Consensus = make([]*bft.Ballot, count)
 	for i := 0; i < int(count); i++ {
-		block.Consensus[i], position = bft.ParseBallotPosition(data, position)
+		start := position
+		var err error
+		if block.Consensus[i], position, err = bft.ParseBallotPosition(data, position); err != nil {
+			return nil, position, util.NewParseError("block seal", start, err)
+		}
 	}
-	return &block, position
+	return &block, position, nil
 }
 
 // BlockCommit is the final structure of a block. Every validating node must
@@ -181,24 +209,30 @@ func (b BlockCommit) Serialize() []byte {
 	return bytes
 }
 
-// ParseBlockCommit parses a byte slice to a block commit. Return nil if the
-// byte slice does not contain a valid block commit.
-func ParseBlockCommit(data []byte) *BlockCommit {
-	block, position := parseBlockCommitPosition(data, 0)
-	if position != len(data) {
-		return nil
+// ParseBlockCommit parses a byte slice to a block commit. Returns a
+// util.ParseError if the byte slice does not contain a valid block commit.
+func ParseBlockCommit(data []byte) (*BlockCommit, error) {
+	block, position, err := parseBlockCommitPosition(data, 0)
+	if err != nil {
+		return nil, err
 	}
-	return block
+	if err := util.CheckEnd("block commit", data, position); err != nil {
+		return nil, err
+	}
+	return block, nil
 }
 
 // ParseBlockCommitPosition parses a block commit in the middle of a byte slice
 // and returns the parsed block commit and the position at the end of the commit
 // bytes.
-func parseBlockCommitPosition(data []byte, position int) (*BlockCommit, int) {
+func parseBlockCommitPosition(data []byte, position int) (*BlockCommit, int, error) {
 	var block BlockCommit
 	block.Invalidated, position = util.ParseHashArray(data, position)
 	block.FeesCollected, position = util.ParseUint64(data, position)
 	block.PublishedBy, position = util.ParseToken(data, position)
 	block.PublishSign, position = util.ParseSignature(data, position)
-	return &block, position
+	if err := util.CheckTruncated("block commit", data, position); err != nil {
+		return nil, position, err
+	}
+	return &block, position, nil
 }
@@ -0,0 +1,88 @@
+package chain
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+// incorporate incorporates the mutations of the validator into the commit
+// state. If the chain has a mutations log the mutations are recorded on it
+// first, so that an interrupted incorporation can be recovered.
+func (c *Blockchain) incorporate(validator *state.MutatingState, proposer crypto.Token, hash crypto.Hash) {
+	if c.Log == nil {
+		validator.Incorporate(proposer)
+		return
+	}
+	if err := validator.IncorporateLogged(proposer, hash, c.Log); err != nil {
+		slog.Error("Blockchain: could not record mutations on mutations log", "epoch", validator.Epoch, "err", err)
+	}
+}
+
+// rollbackMutations brings the commit state back to the last commit epoch if
+// the incorporation of the mutations of the following block was interrupted,
+// as by a panic recovered by CommitBlock. The block is dropped from the recent
+// blocks and must be synced again.
+func (c *Blockchain) rollbackMutations() {
+	if c.Log == nil {
+		return
+	}
+	entry, done, err := c.Log.Last()
+	if err != nil || entry == nil || done || entry.Epoch != c.LastCommitEpoch+1 {
+		return
+	}
+	changed, err := c.CommitState.Recover(entry, false)
+	if err != nil {
+		slog.Error("Blockchain: could not roll back interrupted mutations", "epoch", entry.Epoch, "err", err)
+		return
+	}
+	if err := c.Log.Discard(); err != nil {
+		slog.Error("Blockchain: could not discard mutations log entry", "epoch", entry.Epoch, "err", err)
+	}
+	for len(c.RecentBlocks) > 0 && c.RecentBlocks[len(c.RecentBlocks)-1].Header.Epoch > c.LastCommitEpoch {
+		c.RecentBlocks = c.RecentBlocks[:len(c.RecentBlocks)-1]
+	}
+	slog.Warn("Blockchain: rolled back interrupted mutations", "epoch", entry.Epoch, "changed", changed)
+}
+
+// RecoverMutations resolves the last entry on the mutations log against the
+// commit state. It must be called once the blockchain is recreated, from
+// genesis or from a snapshot, and before any block is committed. An entry for
+// the epoch following the last commit epoch, as left by a crash between the
+// incorporation of the mutations of a block and the record of its diff, is
+// rolled forward: whatever part of the mutations is missing is incorporated,
+// the diff is recorded and the block becomes the last commit. An entry for a
+// later epoch cannot be applied to the commit state and is discarded, rolling
+// the chain back to its last commit epoch. Entries up to the last commit epoch
+// are already incorporated.
+func (c *Blockchain) RecoverMutations() error {
+	if c.Log == nil {
+		return errors.New("blockchain has no mutations log")
+	}
+	entry, done, err := c.Log.Last()
+	if err != nil || entry == nil {
+		return err
+	}
+	if entry.Epoch <= c.LastCommitEpoch {
+		if !done {
+			return c.Log.Done(entry.Epoch)
+		}
+		return nil
+	}
+	if entry.Epoch > c.LastCommitEpoch+1 {
+		slog.Warn("Blockchain: discarding mutations beyond last commit epoch", "epoch", entry.Epoch, "last commit epoch", c.LastCommitEpoch)
+		return c.Log.Discard()
+	}
+	changed, err := c.CommitState.Recover(entry, true)
+	if err != nil {
+		return err
+	}
+	diff := &Diff{Epoch: entry.Epoch, Hash: entry.Hash, Mutations: entry.Mutations}
+	c.appendDiff(diff)
+	// mutations are already incorporated
+	c.replay([]*Diff{{Epoch: diff.Epoch, Hash: diff.Hash}}, c.Snapshots)
+	slog.Info("Blockchain: rolled forward mutations from mutations log", "epoch", entry.Epoch, "changed", changed)
+	return c.Log.Done(entry.Epoch)
+}
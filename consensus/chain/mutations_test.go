@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+func TestRecoverMutations(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	blockchain := newTestChain(key)
+	if blockchain.RecoverMutations() == nil {
+		t.Fatal("mutations recovered without mutations log")
+	}
+	log, err := state.OpenMutationsLog(filepath.Join(t.TempDir(), "mutations.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Log = log
+	store, err := OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Snapshots = store
+	if err := blockchain.WriteSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	addTestBlocks(t, blockchain, key, 1, 3)
+	if entry, done, err := log.Last(); err != nil || entry == nil || entry.Epoch != 3 || !done {
+		t.Fatalf("committed block not done on mutations log: %v", err)
+	}
+
+	// begin appends an entry for the mutations of epoch 4 on the log as of the
+	// commit state at epoch 3
+	transfer := testTransfer(4, key, 10)
+	hash := crypto.Hasher([]byte("block 4"))
+	begin := func() *state.Mutations {
+		validator := blockchain.CommitState.Validator(state.NewMutations(4), 4)
+		if !validator.Validate(transfer) {
+			t.Fatal("invalid transfer")
+		}
+		if err := log.Begin(blockchain.CommitState.LogEntry(validator.Mutations(), hash)); err != nil {
+			t.Fatal(err)
+		}
+		return validator.Mutations()
+	}
+	before := blockchain.CommitState.ChecksumHash()
+
+	// interrupted incorporation rolled back
+	blockchain.CommitState.IncorporateMutations(begin())
+	after := blockchain.CommitState.ChecksumHash()
+	blockchain.rollbackMutations()
+	if !blockchain.CommitState.ChecksumHash().Equal(before) {
+		t.Fatal("interrupted mutations not rolled back")
+	}
+	if entry, _, _ := log.Last(); entry != nil {
+		t.Fatal("rolled back entry not discarded")
+	}
+
+	// interrupted incorporation rolled forward, as after a crash
+	begin()
+	if err := blockchain.RecoverMutations(); err != nil {
+		t.Fatal(err)
+	}
+	if blockchain.LastCommitEpoch != 4 || !blockchain.LastCommitHash.Equal(hash) {
+		t.Fatalf("last commit %d after recovery, expected 4", blockchain.LastCommitEpoch)
+	}
+	if !blockchain.CommitState.ChecksumHash().Equal(after) {
+		t.Fatal("interrupted mutations not rolled forward")
+	}
+	if entry, done, _ := log.Last(); entry == nil || entry.Epoch != 4 || !done {
+		t.Fatal("rolled forward entry not done")
+	}
+	// diffs follow the snapshot of the checkpoint of epoch 2
+	if _, diffs, err := store.Latest(); err != nil || len(diffs) != 2 || !diffs[1].Hash.Equal(hash) || diffs[1].Mutations == nil {
+		t.Fatalf("diff of rolled forward entry not on snapshot store: %v", err)
+	}
+
+	// an entry up to the last commit epoch is already incorporated
+	entry, _, _ := log.Last()
+	if err := log.Begin(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.RecoverMutations(); err != nil {
+		t.Fatal(err)
+	}
+	if _, done, _ := log.Last(); !done || !blockchain.CommitState.ChecksumHash().Equal(after) {
+		t.Fatal("incorporated entry not marked done")
+	}
+
+	// an entry beyond the following epoch cannot be applied
+	mutations := state.NewMutations(6)
+	if err := log.Begin(blockchain.CommitState.LogEntry(mutations, hash)); err != nil {
+		t.Fatal(err)
+	}
+	if err := blockchain.RecoverMutations(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _, _ := log.Last(); entry != nil {
+		t.Fatal("entry beyond last commit epoch not discarded")
+	}
+	if blockchain.LastCommitEpoch != 4 || !blockchain.CommitState.ChecksumHash().Equal(after) {
+		t.Fatal("entry beyond last commit epoch applied")
+	}
+}
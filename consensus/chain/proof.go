@@ -0,0 +1,129 @@
+package chain
+
+import (
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+	"github.com/freehandle/breeze/util"
+)
+
+// BalanceProof is a proof of the wallet and deposit balance of an account at
+// a checksum epoch. It carries the proof of the account against the balance
+// tree of the checksum state and the hash of the remaining components of that
+// state, so that the checksum hash published by naked checksum statements of
+// the committee can be recomputed from the proof alone.
+type BalanceProof struct {
+	Epoch      uint64
+	Components crypto.Hash
+	Proof      *state.BalanceProof
+}
+
+// ProveBalance returns a proof of the balance of the token at the last
+// checksum of the blockchain.
+func (c *Blockchain) ProveBalance(token crypto.Token) *BalanceProof {
+	c.mu.Lock()
+	checksum := c.Checksum
+	c.mu.Unlock()
+	if checksum == nil || checksum.State == nil {
+		return nil
+	}
+	return &BalanceProof{
+		Epoch:      checksum.Epoch,
+		Components: checksum.State.ComponentsHash(),
+		Proof:      checksum.balanceTree().Prove(crypto.HashToken(token)),
+	}
+}
+
+// balanceTree returns the balance tree of the checksum state. The tree is
+// built on first use and kept for subsequent proofs.
+func (c *Checksum) balanceTree() *state.BalanceTree {
+	c.treeOnce.Do(func() {
+		c.tree = c.State.BalanceTree()
+	})
+	return c.tree
+}
+
+// ChecksumHash returns the checksum hash implied by the proof. It returns
+// false if the proof is inconsistent.
+func (p *BalanceProof) ChecksumHash() (crypto.Hash, bool) {
+	if p.Proof == nil {
+		return crypto.ZeroHash, false
+	}
+	root, ok := p.Proof.Root()
+	if !ok {
+		return crypto.ZeroHash, false
+	}
+	return EpochChecksumHash(p.Epoch, state.CommitmentHash(root, p.Components)), true
+}
+
+// Verify returns true if the proof is consistent with the naked checksum
+// statement of a node for the same epoch.
+func (p *BalanceProof) Verify(statement *ChecksumStatement) bool {
+	if statement == nil || !statement.Naked || statement.Epoch != p.Epoch || !statement.VerifySignature() {
+		return false
+	}
+	hash, ok := p.ChecksumHash()
+	return ok && hash.Equal(statement.Hash)
+}
+
+// VerifyCommittee returns true if the proof is consistent with naked checksum
+// statements of committee members with more than 2/3 of the total committee
+// weight. Each member is counted once.
+func (p *BalanceProof) VerifyCommittee(statements []*ChecksumStatement, weights map[crypto.Token]int) bool {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	hash, ok := p.ChecksumHash()
+	if !ok || total == 0 {
+		return false
+	}
+	counted := make(map[crypto.Token]struct{})
+	attested := 0
+	for _, statement := range statements {
+		if statement == nil || !statement.Naked || statement.Epoch != p.Epoch || !statement.Hash.Equal(hash) {
+			continue
+		}
+		if _, ok := counted[statement.Node]; ok || weights[statement.Node] == 0 || !statement.VerifySignature() {
+			continue
+		}
+		counted[statement.Node] = struct{}{}
+		attested += weights[statement.Node]
+	}
+	return attested > 2*total/3
+}
+
+// Balance returns the account balance proven.
+func (p *BalanceProof) Balance() (wallet, deposit uint64) {
+	if p.Proof == nil {
+		return 0, 0
+	}
+	return p.Proof.Account.Wallet, p.Proof.Account.Deposit
+}
+
+// Serialize returns a byte representation of the proof.
+func (p *BalanceProof) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(p.Epoch, &bytes)
+	util.PutHash(p.Components, &bytes)
+	if p.Proof != nil {
+		bytes = append(bytes, p.Proof.Serialize()...)
+	}
+	return bytes
+}
+
+// ParseBalanceProof parses a serialized balance proof. Returns nil if the data
+// is not a valid serialization.
+func ParseBalanceProof(data []byte) *BalanceProof {
+	if len(data) < 8+crypto.Size {
+		return nil
+	}
+	proof := BalanceProof{}
+	position := 0
+	proof.Epoch, position = util.ParseUint64(data, position)
+	proof.Components, position = util.ParseHash(data, position)
+	proof.Proof = state.ParseBalanceProof(data[position:])
+	if proof.Proof == nil {
+		return nil
+	}
+	return &proof
+}
@@ -0,0 +1,49 @@
+package chain
+
+import (
+	"bytes"
+	"log/slog"
+	"sort"
+
+	"github.com/freehandle/breeze/consensus/bft"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+// Punisher returns the amount of deposit to be burned from each of the
+// violators evidenced by duplicates.
+type Punisher func(duplicates *bft.Duplicate) map[crypto.Token]uint64
+
+// applyEvidence slashes the deposits of the violators evidenced on the block
+// header duplicates. Evidence is applied at commit time, before the actions of
+// the block are revalidated, so that every node punishes the same violators
+// with the same amounts at the same epoch. Offenses are processed in ascending
+// epoch order and violators in ascending token order. Each offense (token and
+// epoch) is punished at most once, even if evidence is presented again on
+// subsequent blocks.
+func (c *Blockchain) applyEvidence(header BlockHeader, validator *state.MutatingState) {
+	if c.Punish == nil || validator == nil || header.Duplicate == nil {
+		return
+	}
+	offenses := header.Duplicate.Offenses()
+	epochs := make([]uint64, 0, len(offenses))
+	for epoch := range offenses {
+		epochs = append(epochs, epoch)
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	for _, epoch := range epochs {
+		punishments := c.Punish(offenses[epoch])
+		tokens := make([]crypto.Token, 0, len(punishments))
+		for token := range punishments {
+			tokens = append(tokens, token)
+		}
+		sort.Slice(tokens, func(i, j int) bool { return bytes.Compare(tokens[i][:], tokens[j][:]) < 0 })
+		for _, token := range tokens {
+			burned := validator.Slash(token, epoch, punishments[token])
+			if burned > 0 {
+				c.Punishment[token] += burned
+				slog.Info("Blockchain: deposit slashed", "token", token, "offense epoch", epoch, "block", header.Epoch, "burned", burned)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package chain
+
+import (
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+	"github.com/freehandle/breeze/util"
+)
+
+// KeepWindowWeights is the number of checksum windows for which validator
+// weights are kept by the blockchain, the current one included.
+const KeepWindowWeights = 3
+
+// windowStart returns the first epoch of the checksum window of the epoch.
+// Windows start at epoch 1 and span ChecksumWindow epochs.
+func (c *Blockchain) windowStart(epoch uint64) uint64 {
+	if epoch == 0 {
+		return 1
+	}
+	window := uint64(c.ChecksumWindow)
+	return ((epoch-1)/window)*window + 1
+}
+
+// SetWindowWeights records the weights of the validators of the checksum
+// window starting at the given epoch. They are incorporated into the state by
+// the first block committed in the window and block rewards of the window are
+// split among validators according to them. Weights of windows older than
+// KeepWindowWeights windows are discarded.
+func (c *Blockchain) SetWindowWeights(start uint64, weights map[crypto.Token]int) {
+	c.weightsMu.Lock()
+	defer c.weightsMu.Unlock()
+	if c.windowWeights == nil {
+		c.windowWeights = make(map[uint64]map[crypto.Token]int)
+	}
+	copied := make(map[crypto.Token]int, len(weights))
+	for token, weight := range weights {
+		copied[token] = weight
+	}
+	c.windowWeights[c.windowStart(start)] = copied
+	oldest := uint64(0)
+	if keep := uint64(KeepWindowWeights * c.ChecksumWindow); start > keep {
+		oldest = start - keep
+	}
+	for epoch := range c.windowWeights {
+		if epoch < oldest {
+			delete(c.windowWeights, epoch)
+		}
+	}
+}
+
+// WindowWeights returns the weights of the validators of the checksum window
+// of the given epoch. Returns nil if the weights are unknown.
+func (c *Blockchain) WindowWeights(epoch uint64) map[crypto.Token]int {
+	c.weightsMu.Lock()
+	defer c.weightsMu.Unlock()
+	return c.windowWeights[c.windowStart(epoch)]
+}
+
+// rewardWeights returns the weights among which the reward of the block of the
+// given epoch is split. Weights are part of the state checksum: they are read
+// from the state and the first block committed in a window records on its
+// mutations the weights known by the blockchain (see SetWindowWeights). Returns
+// nil if the weights are neither on the state nor known, in which case the
+// block must not be committed.
+func (c *Blockchain) rewardWeights(validator *state.MutatingState, epoch uint64) map[crypto.Token]int {
+	start := c.windowStart(epoch)
+	if weights := validator.WindowWeights(start); len(weights) > 0 {
+		return weights
+	}
+	weights := c.WindowWeights(epoch)
+	if len(weights) == 0 {
+		return nil
+	}
+	validator.SetWindowWeights(start, weights)
+	return weights
+}
+
+// hasRewardWeights returns true if the weights of the window of the epoch are
+// either on the committed state or known by the blockchain.
+func (c *Blockchain) hasRewardWeights(epoch uint64) bool {
+	if len(c.CommitState.Issuance.WindowWeights(c.windowStart(epoch))) > 0 {
+		return true
+	}
+	return len(c.WindowWeights(epoch)) > 0
+}
+
+// SerializeWindowWeights returns a byte representation of the validator
+// weights of the checksum windows known by the blockchain.
+func (c *Blockchain) SerializeWindowWeights() []byte {
+	c.weightsMu.Lock()
+	defer c.weightsMu.Unlock()
+	bytes := make([]byte, 0)
+	util.PutUint16(uint16(len(c.windowWeights)), &bytes)
+	for start, weights := range c.windowWeights {
+		util.PutUint64(start, &bytes)
+		util.PutUint16(uint16(len(weights)), &bytes)
+		for token, weight := range weights {
+			util.PutToken(token, &bytes)
+			util.PutUint32(uint32(weight), &bytes)
+		}
+	}
+	return bytes
+}
+
+// ParseWindowWeights parses the validator weights of checksum windows indexed
+// by the starting epoch of each window. Returns nil if the data is invalid.
+func ParseWindowWeights(data []byte) map[uint64]map[crypto.Token]int {
+	if len(data) < 2 {
+		return nil
+	}
+	windows := make(map[uint64]map[crypto.Token]int)
+	count, position := util.ParseUint16(data, 0)
+	for n := 0; n < int(count); n++ {
+		if position+10 > len(data) {
+			return nil
+		}
+		var start uint64
+		var size uint16
+		start, position = util.ParseUint64(data, position)
+		size, position = util.ParseUint16(data, position)
+		if position+int(size)*(crypto.TokenSize+4) > len(data) {
+			return nil
+		}
+		weights := make(map[crypto.Token]int, size)
+		for i := 0; i < int(size); i++ {
+			var token crypto.Token
+			var weight uint32
+			token, position = util.ParseToken(data, position)
+			weight, position = util.ParseUint32(data, position)
+			weights[token] = int(weight)
+		}
+		windows[start] = weights
+	}
+	if position != len(data) {
+		return nil
+	}
+	return windows
+}
@@ -0,0 +1,59 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+func TestWindowWeightsOnState(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	other, _ := crypto.RandomAsymetricKey()
+	network := crypto.Hasher([]byte("window weights test network"))
+	chains := make([]*Blockchain, 3)
+	for n := range chains {
+		chains[n] = BlockchainFromGenesisState(key, "", network, time.Second, 10, 2, 0, 0, state.IssuanceSchedule{})
+	}
+	chains[1].SetWindowWeights(1, map[crypto.Token]int{token: 1})
+	chains[2].SetWindowWeights(1, map[crypto.Token]int{token: 1, other: 1})
+
+	header := chains[1].NextBlock(1)
+	if header == nil {
+		t.Fatal("could not create header for epoch 1")
+	}
+	sealed := chains[1].CheckpointValidator(*header).Seal(key)
+	for _, blockchain := range chains {
+		parsed, err := ParseSealedBlock(sealed.Serialize())
+		if err != nil {
+			t.Fatalf("could not parse sealed block: %v", err)
+		}
+		blockchain.AddSealedBlock(parsed)
+	}
+	if chains[0].LastCommitEpoch != 0 {
+		t.Fatal("block committed without window weights")
+	}
+	for n, blockchain := range chains[1:] {
+		if blockchain.LastCommitEpoch != 1 {
+			t.Fatalf("chain %d: block not committed with window weights", n+1)
+		}
+		if len(blockchain.CommitState.Issuance.WindowWeights(1)) != n+1 {
+			t.Fatalf("chain %d: window weights not on state", n+1)
+		}
+	}
+	if chains[1].CommitState.ChecksumHash().Equal(chains[2].CommitState.ChecksumHash()) {
+		t.Fatal("window weights are not part of the state checksum")
+	}
+	// weights on state prevail over weights later known by the blockchain
+	chains[1].SetWindowWeights(1, map[crypto.Token]int{other: 1})
+	header = chains[1].NextBlock(2)
+	sealed = chains[1].CheckpointValidator(*header).Seal(key)
+	chains[1].AddSealedBlock(sealed)
+	if chains[1].LastCommitEpoch != 2 {
+		t.Fatal("block 2 not committed")
+	}
+	if weights := chains[1].CommitState.Issuance.WindowWeights(1); len(weights) != 1 || weights[token] != 1 {
+		t.Fatal("window weights on state overwritten")
+	}
+}
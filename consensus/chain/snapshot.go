@@ -0,0 +1,418 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+	"github.com/freehandle/breeze/util"
+)
+
+// KeepSnapshots is the number of checksum snapshots kept on disk. Older
+// snapshots and the diff files preceding the oldest kept snapshot are pruned.
+const KeepSnapshots = 2
+
+const (
+	snapshotPrefix = "snapshot_"
+	snapshotSuffix = ".dat"
+	diffPrefix     = "diffs_"
+)
+
+// Diff is the record of a committed block on the snapshot store: its epoch,
+// its seal hash and the mutations it incorporated into the state. Mutations is
+// nil for forced empty commits, which do not change the state.
+type Diff struct {
+	Epoch     uint64
+	Hash      crypto.Hash
+	Mutations *state.Mutations
+}
+
+// Serialize returns a byte representation of the diff.
+func (d *Diff) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(d.Epoch, &bytes)
+	util.PutHash(d.Hash, &bytes)
+	if d.Mutations == nil {
+		util.PutBool(false, &bytes)
+		return bytes
+	}
+	util.PutBool(true, &bytes)
+	return append(bytes, d.Mutations.Serialize()...)
+}
+
+// ParseDiff parses a serialized diff. Returns nil if the data is not a valid
+// serialization.
+func ParseDiff(data []byte) *Diff {
+	if len(data) < 8+crypto.Size+1 {
+		return nil
+	}
+	diff := Diff{}
+	position := 0
+	diff.Epoch, position = util.ParseUint64(data, position)
+	diff.Hash, position = util.ParseHash(data, position)
+	hasMutations, position := util.ParseBool(data, position)
+	if !hasMutations {
+		if position != len(data) {
+			return nil
+		}
+		return &diff
+	}
+	if diff.Mutations = state.ParseMutations(data[position:]); diff.Mutations == nil {
+		return nil
+	}
+	return &diff
+}
+
+// Snapshot is a checksum of the chain as recorded on disk together with the
+// clock synchronization of the chain at the time it was taken.
+type Snapshot struct {
+	Epoch         uint64
+	LastBlockHash crypto.Hash
+	Hash          crypto.Hash
+	Clock         ClockSyncronization
+	data          []byte
+}
+
+// State recreates the state of the snapshot. See state.ParseSnapshot for the
+// meaning of filePath. It returns nil if the state does not match the
+// checksum hash of the snapshot.
+func (s *Snapshot) State(filePath string) *state.State {
+	recreated := state.ParseSnapshot(s.data, filePath)
+	if recreated == nil {
+		return nil
+	}
+	stateHash := recreated.ChecksumHash()
+	// the genesis checksum hash is not prefixed by the epoch
+	if !s.Hash.Equal(EpochChecksumHash(s.Epoch, stateHash)) && !(s.Epoch == 0 && s.Hash.Equal(stateHash)) {
+		slog.Error("Snapshot: state does not match checksum hash", "epoch", s.Epoch, "hash", crypto.EncodeHash(s.Hash))
+		recreated.Shutdown()
+		return nil
+	}
+	return recreated
+}
+
+func serializeSnapshot(checksum *Checksum, clock ClockSyncronization) []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(checksum.Epoch, &bytes)
+	util.PutHash(checksum.LastBlockHash, &bytes)
+	util.PutHash(checksum.Hash, &bytes)
+	util.PutUint64(clock.Epoch, &bytes)
+	util.PutTime(clock.TimeStamp, &bytes)
+	return append(bytes, checksum.State.Snapshot()...)
+}
+
+func parseSnapshot(data []byte) *Snapshot {
+	if len(data) < 2*8+2*crypto.Size+8 {
+		return nil
+	}
+	snapshot := Snapshot{}
+	position := 0
+	snapshot.Epoch, position = util.ParseUint64(data, position)
+	snapshot.LastBlockHash, position = util.ParseHash(data, position)
+	snapshot.Hash, position = util.ParseHash(data, position)
+	snapshot.Clock.Epoch, position = util.ParseUint64(data, position)
+	snapshot.Clock.TimeStamp, position = util.ParseTime(data, position)
+	if position > len(data) {
+		return nil
+	}
+	snapshot.data = data[position:]
+	return &snapshot
+}
+
+// SnapshotStore keeps on a directory periodic snapshots of the checksum states
+// of the chain and append only logs with the diff of every block committed
+// since. A node can be restarted from the latest snapshot by replaying the
+// diffs that follow it (see BlockchainFromSnapshot) instead of synchronizing
+// the entire state from a peer. Diffs are appended to one file per snapshot
+// interval, named after the epoch of its first diff. A new file is started
+// with the first diff after each snapshot, and files whose diffs all precede
+// the oldest kept snapshot are deleted as a whole.
+type SnapshotStore struct {
+	mu        sync.Mutex
+	path      string
+	diffStart uint64 // first epoch of the current diff file, 0 if none
+	rotate    bool   // start a new diff file on the next diff
+}
+
+// OpenSnapshotStore opens the snapshot store on the given directory. The
+// directory is created if it does not exist.
+func OpenSnapshotStore(path string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, fmt.Errorf("could not create snapshot directory: %v", err)
+	}
+	store := &SnapshotStore{path: path}
+	if starts := store.files(diffPrefix); len(starts) > 0 {
+		store.diffStart = starts[len(starts)-1]
+	}
+	return store, nil
+}
+
+// files returns the epochs on the names of the files of the store with the
+// given prefix in ascending order.
+func (s *SnapshotStore) files(prefix string) []uint64 {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil
+	}
+	epochs := make([]uint64, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		epoch, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), snapshotSuffix), 10, 64)
+		if err == nil {
+			epochs = append(epochs, epoch)
+		}
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	return epochs
+}
+
+// epochs returns the epochs of the snapshots on disk in ascending order.
+func (s *SnapshotStore) epochs() []uint64 {
+	return s.files(snapshotPrefix)
+}
+
+func (s *SnapshotStore) snapshotPath(epoch uint64) string {
+	return filepath.Join(s.path, fmt.Sprintf("%v%v%v", snapshotPrefix, epoch, snapshotSuffix))
+}
+
+func (s *SnapshotStore) diffPath(start uint64) string {
+	return filepath.Join(s.path, fmt.Sprintf("%v%v%v", diffPrefix, start, snapshotSuffix))
+}
+
+// HasSnapshot returns true if there is at least one snapshot on the store.
+func (s *SnapshotStore) HasSnapshot() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.epochs()) > 0
+}
+
+// WriteSnapshot writes a snapshot of the checksum on disk and closes the current
+// diff file. Snapshots beyond the latest KeepSnapshots and the diff files not
+// needed to replay from the oldest kept snapshot are pruned.
+func (s *SnapshotStore) WriteSnapshot(checksum *Checksum, clock ClockSyncronization) error {
+	data := serializeSnapshot(checksum, clock)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := s.snapshotPath(checksum.Epoch)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	s.rotate = true
+	epochs := s.epochs()
+	if len(epochs) <= KeepSnapshots {
+		return nil
+	}
+	for _, epoch := range epochs[:len(epochs)-KeepSnapshots] {
+		if err := os.Remove(s.snapshotPath(epoch)); err != nil {
+			slog.Warn("SnapshotStore: could not remove old snapshot", "epoch", epoch, "err", err)
+		}
+	}
+	return s.pruneDiffs(epochs[len(epochs)-KeepSnapshots])
+}
+
+// pruneDiffs deletes the diff files holding only diffs up to the given epoch.
+// Diffs are appended to the last file, so every diff of a file precedes the
+// first epoch of the next one, except for epochs committed again after a
+// recovery, which are superseded by the later files anyway (see Latest).
+func (s *SnapshotStore) pruneDiffs(epoch uint64) error {
+	starts := s.files(diffPrefix)
+	for n := 0; n+1 < len(starts) && starts[n+1] <= epoch+1; n++ {
+		if err := os.Remove(s.diffPath(starts[n])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendDiff appends the diff of a committed block to the current diff file.
+// The first diff after a snapshot starts a new file.
+func (s *SnapshotStore) AppendDiff(diff *Diff) error {
+	bytes := make([]byte, 0)
+	util.PutLargeByteArray(diff.Serialize(), &bytes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.diffStart == 0 || s.rotate {
+		// file names must follow the order of appends
+		start := diff.Epoch
+		if start <= s.diffStart {
+			start = s.diffStart + 1
+		}
+		s.diffStart = start
+		s.rotate = false
+	}
+	file, err := os.OpenFile(s.diffPath(s.diffStart), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(bytes); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// readDiffs reads the diff files in order. A truncated last record of a file,
+// as left by a crash during AppendDiff, is ignored.
+func (s *SnapshotStore) readDiffs() ([]*Diff, error) {
+	diffs := make([]*Diff, 0)
+	for _, start := range s.files(diffPrefix) {
+		data, err := os.ReadFile(s.diffPath(start))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		position := 0
+		for position < len(data) {
+			var record []byte
+			if position+4 <= len(data) {
+				record, position = util.ParseLargeByteArray(data, position)
+			}
+			if len(record) == 0 || position > len(data) {
+				slog.Warn("SnapshotStore: ignoring truncated diff at the end of the file", "start", start)
+				break
+			}
+			diff := ParseDiff(record)
+			if diff == nil {
+				return nil, errors.New("invalid diff on the log")
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+// Latest returns the latest snapshot on the store and the diffs following it
+// in sequence. If an epoch was committed more than once, as after a recovery,
+// the last diff for the epoch supersedes the previous ones and those that
+// followed them. It returns io.EOF if there is no snapshot on the store.
+func (s *SnapshotStore) Latest() (*Snapshot, []*Diff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	epochs := s.epochs()
+	if len(epochs) == 0 {
+		return nil, nil, io.EOF
+	}
+	data, err := os.ReadFile(s.snapshotPath(epochs[len(epochs)-1]))
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot := parseSnapshot(data)
+	if snapshot == nil {
+		return nil, nil, errors.New("invalid snapshot file")
+	}
+	diffs, err := s.readDiffs()
+	if err != nil {
+		return nil, nil, err
+	}
+	following := make([]*Diff, 0)
+	for _, diff := range diffs {
+		if diff.Epoch <= snapshot.Epoch {
+			continue
+		}
+		if n := int(diff.Epoch-snapshot.Epoch) - 1; n <= len(following) {
+			following = append(following[:n], diff)
+		}
+	}
+	return snapshot, following, nil
+}
+
+// appendDiff records a committed block on the snapshot store, if any.
+func (c *Blockchain) appendDiff(diff *Diff) {
+	if c.Snapshots == nil {
+		return
+	}
+	if err := c.Snapshots.AppendDiff(diff); err != nil {
+		slog.Error("Blockchain: could not append diff to snapshot store", "epoch", diff.Epoch, "err", err)
+	}
+}
+
+// WriteSnapshot writes a snapshot of the current checksum on the snapshot
+// store. Nodes call it once the blockchain is created from genesis or from a
+// state sync job, so that they can be restarted before the next checkpoint.
+func (c *Blockchain) WriteSnapshot() error {
+	if c.Snapshots == nil {
+		return errors.New("blockchain has no snapshot store")
+	}
+	c.mu.Lock()
+	checksum := c.Checksum
+	c.mu.Unlock()
+	return c.Snapshots.WriteSnapshot(checksum, c.Clock)
+}
+
+// BlockchainFromSnapshot recreates a blockchain from the latest snapshot on the
+// store. The snapshot becomes the checksum of the chain and the commit state
+// is brought to the last committed epoch on record by replaying the diffs
+// following the snapshot. If walletPath is not empty the commit state is
+// persisted on files under it. Sealed blocks and recent committed blocks are
+// not on the store and must be synced from a peer from the last commit epoch.
+func BlockchainFromSnapshot(snapshots *SnapshotStore, walletPath string, credentials crypto.PrivateKey, networkHash crypto.Hash, interval time.Duration, checksumWindow int) (*Blockchain, error) {
+	snapshot, diffs, err := snapshots.Latest()
+	if err != nil {
+		return nil, err
+	}
+	checksumState := snapshot.State("")
+	if checksumState == nil {
+		return nil, errors.New("invalid snapshot state")
+	}
+	commitState := snapshot.State(walletPath)
+	if commitState == nil {
+		checksumState.Shutdown()
+		return nil, errors.New("could not recreate commit state from snapshot")
+	}
+	checksum := &Checksum{
+		Epoch:         snapshot.Epoch,
+		State:         checksumState,
+		LastBlockHash: snapshot.LastBlockHash,
+		Hash:          snapshot.Hash,
+	}
+	blockchain := BlockchainFromChecksumState(checksum, snapshot.Clock, credentials, networkHash, interval, checksumWindow)
+	blockchain.CommitState = commitState
+	blockchain.replay(diffs, snapshots)
+	blockchain.Snapshots = snapshots
+	slog.Info("blockchain restored from snapshot", "snapshot epoch", snapshot.Epoch, "last commit epoch", blockchain.LastCommitEpoch)
+	return blockchain, nil
+}
+
+// replay incorporates the diffs of sequential committed blocks into the commit
+// state. Checkpoints on the way are taken synchronously, written on the given
+// snapshot store, if any, and rolled into the checksum as CommitBlock does.
+func (c *Blockchain) replay(diffs []*Diff, snapshots *SnapshotStore) {
+	for _, diff := range diffs {
+		if diff.Epoch != c.LastCommitEpoch+1 {
+			return
+		}
+		if diff.Mutations != nil {
+			c.CommitState.IncorporateMutations(diff.Mutations)
+		}
+		c.LastCommitEpoch = diff.Epoch
+		c.LastCommitHash = diff.Hash
+		if c.IsChecksumCommit() {
+			if c.NextChecksum = c.checkpoint(); c.NextChecksum != nil && snapshots != nil {
+				if err := snapshots.WriteSnapshot(c.NextChecksum, c.Clock); err != nil {
+					slog.Error("Blockchain: could not write snapshot during replay", "epoch", diff.Epoch, "err", err)
+				}
+			}
+		}
+		if diff.Epoch%uint64(c.ChecksumWindow) == 0 && c.NextChecksum != nil {
+			c.Checksum = c.NextChecksum
+			c.NextChecksum = nil
+		}
+	}
+}
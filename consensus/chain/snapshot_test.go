@@ -0,0 +1,197 @@
+package chain
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+// appendDiffs appends empty diffs from epoch first to last to the store.
+func appendDiffs(t *testing.T, store *SnapshotStore, first, last uint64) {
+	for epoch := first; epoch <= last; epoch++ {
+		if err := store.AppendDiff(&Diff{Epoch: epoch, Hash: crypto.Hasher([]byte{byte(epoch)})}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotDiffFiles(t *testing.T) {
+	genesis, _ := state.NewGenesisState()
+	store, err := OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := func(epoch uint64) {
+		if err := store.WriteSnapshot(&Checksum{Epoch: epoch, State: genesis}, ClockSyncronization{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot(0)
+	appendDiffs(t, store, 1, 12)
+	// snapshot of epoch 10 written two blocks late
+	snapshot(10)
+	appendDiffs(t, store, 13, 20)
+	snapshot(20)
+	appendDiffs(t, store, 21, 22)
+	if starts := store.files(diffPrefix); len(starts) != 3 || starts[0] != 1 || starts[1] != 13 || starts[2] != 21 {
+		t.Fatalf("unexpected diff files %v", starts)
+	}
+	latest, diffs, err := store.Latest()
+	if err != nil || latest.Epoch != 20 || len(diffs) != 2 || diffs[0].Epoch != 21 {
+		t.Fatalf("unexpected latest snapshot and diffs: %v", err)
+	}
+
+	// a reopened store keeps appending to the current file
+	if store, err = OpenSnapshotStore(store.path); err != nil {
+		t.Fatal(err)
+	}
+	appendDiffs(t, store, 23, 30)
+	snapshot(30)
+	if starts := store.files(diffPrefix); len(starts) != 1 || starts[0] != 21 {
+		t.Fatalf("diff files before oldest kept snapshot not deleted: %v", starts)
+	}
+	appendDiffs(t, store, 31, 31)
+	latest, diffs, err = store.Latest()
+	if err != nil || latest.Epoch != 30 || len(diffs) != 1 || diffs[0].Epoch != 31 {
+		t.Fatalf("unexpected latest snapshot and diffs after pruning: %v", err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	blockchain := newTestChain(key)
+	store, err := OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Snapshots = store
+	if err := blockchain.WriteSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, diffs, err := store.Latest()
+	if err != nil || snapshot.Epoch != 0 || len(diffs) != 0 {
+		t.Fatalf("unexpected latest snapshot: %v", err)
+	}
+	if !snapshot.Hash.Equal(blockchain.Checksum.Hash) || !snapshot.LastBlockHash.Equal(blockchain.Checksum.LastBlockHash) {
+		t.Fatal("snapshot hashes do not match checksum")
+	}
+	if snapshot.Clock.Epoch != blockchain.Clock.Epoch || !snapshot.Clock.TimeStamp.Equal(blockchain.Clock.TimeStamp) {
+		t.Fatal("snapshot clock does not match blockchain clock")
+	}
+	expected := blockchain.Checksum.State.ChecksumHash()
+	for _, filePath := range []string{"", t.TempDir() + "/"} {
+		recreated := snapshot.State(filePath)
+		if recreated == nil || !recreated.ChecksumHash().Equal(expected) {
+			t.Fatalf("state recreated on %q does not match checksum", filePath)
+		}
+		recreated.Shutdown()
+	}
+	snapshot.Hash = crypto.Hasher([]byte("tampered"))
+	if snapshot.State("") != nil {
+		t.Fatal("state recreated from snapshot with tampered hash")
+	}
+
+	sealed := sealTestBlock(t, blockchain, key, 1)
+	validator := blockchain.CommitState.Validator(state.NewMutations(1), 1)
+	for n := 0; n < sealed.Actions.Len(); n++ {
+		if !validator.Validate(sealed.Actions.Get(n)) {
+			t.Fatal("invalid action on sealed block")
+		}
+	}
+	for _, diff := range []*Diff{{Epoch: 1, Hash: sealed.Seal.Hash, Mutations: validator.Mutations()}, {Epoch: 2, Hash: sealed.Seal.Hash}} {
+		data := diff.Serialize()
+		parsed := ParseDiff(data)
+		if parsed == nil || !bytes.Equal(parsed.Serialize(), data) {
+			t.Fatalf("diff of epoch %d does not round trip", diff.Epoch)
+		}
+		if (parsed.Mutations == nil) != (diff.Mutations == nil) {
+			t.Fatalf("diff of epoch %d: mutations not parsed", diff.Epoch)
+		}
+		if ParseDiff(data[:len(data)-1]) != nil {
+			t.Fatalf("truncated diff of epoch %d parsed", diff.Epoch)
+		}
+	}
+}
+
+func TestLatestSupersedes(t *testing.T) {
+	genesis, _ := state.NewGenesisState()
+	store, err := OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteSnapshot(&Checksum{Epoch: 0, State: genesis}, ClockSyncronization{}); err != nil {
+		t.Fatal(err)
+	}
+	appendDiffs(t, store, 1, 3)
+	// epochs 2 and 3 committed again after a recovery, with a diff out of
+	// sequence in between
+	recommitted := crypto.Hasher([]byte("recommitted"))
+	for _, epoch := range []uint64{2, 5, 3} {
+		if err := store.AppendDiff(&Diff{Epoch: epoch, Hash: recommitted}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, diffs, err := store.Latest()
+	if err != nil || len(diffs) != 3 {
+		t.Fatalf("unexpected diffs: %v", err)
+	}
+	for n, diff := range diffs {
+		if diff.Epoch != uint64(n+1) {
+			t.Fatalf("diff %d: unexpected epoch %d", n, diff.Epoch)
+		}
+		if superseded := diff.Epoch >= 2; superseded != diff.Hash.Equal(recommitted) {
+			t.Fatalf("diff of epoch %d: last diff for the epoch does not supersede", diff.Epoch)
+		}
+	}
+	// a recommit of epoch 1 supersedes the diffs that followed it
+	appendDiffs(t, store, 1, 1)
+	if _, diffs, err = store.Latest(); err != nil || len(diffs) != 1 || diffs[0].Hash.Equal(recommitted) {
+		t.Fatalf("following diffs not superseded: %v", err)
+	}
+}
+
+func TestBlockchainFromSnapshot(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	blockchain := newTestChain(key)
+	store, err := OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Snapshots = store
+	if err := blockchain.WriteSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	checkRestored := func(snapshotEpoch uint64) {
+		// the snapshot of a checkpoint is written after the checkpoint job
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if epochs := store.epochs(); epochs[len(epochs)-1] == snapshotEpoch {
+				break
+			}
+		}
+		restored, err := BlockchainFromSnapshot(store, "", key, testNetwork, time.Second, testChecksumWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer restored.Shutdown()
+		if restored.LastCommitEpoch != blockchain.LastCommitEpoch || !restored.LastCommitHash.Equal(blockchain.LastCommitHash) {
+			t.Fatalf("restored last commit %d, expected %d", restored.LastCommitEpoch, blockchain.LastCommitEpoch)
+		}
+		if !restored.CommitState.ChecksumHash().Equal(blockchain.CommitState.ChecksumHash()) {
+			t.Fatalf("restored commit state at epoch %d does not match", restored.LastCommitEpoch)
+		}
+		if restored.Checksum.Epoch != blockchain.Checksum.Epoch || !restored.Checksum.Hash.Equal(blockchain.Checksum.Hash) {
+			t.Fatalf("restored checksum %d, expected %d", restored.Checksum.Epoch, blockchain.Checksum.Epoch)
+		}
+	}
+	// diffs replayed from the genesis snapshot through the checkpoint of
+	// epoch 2 and the checksum window of epoch 4
+	addTestBlocks(t, blockchain, key, 1, 5)
+	checkRestored(2)
+	// diffs replayed from the snapshot of the checkpoint of epoch 6 through
+	// the checksum window of epoch 8
+	addTestBlocks(t, blockchain, key, 6, 9)
+	checkRestored(6)
+}
@@ -4,6 +4,8 @@ import (
 	"log/slog"
 
 	"github.com/freehandle/breeze/consensus/messages"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
 	"github.com/freehandle/breeze/socket"
 	"github.com/freehandle/breeze/util"
 )
@@ -22,7 +24,13 @@ func (c *Blockchain) SyncBlocksServer(conn *socket.CachedConnection, epoch uint6
 		}
 	}()
 	c.mu.Lock()
-	if len(c.RecentBlocks) > 0 && epoch+1 < c.RecentBlocks[0].Header.Epoch {
+	// committed blocks before the first recent block are served from the block
+	// store, if any
+	firstRecent := c.LastCommitEpoch + 1
+	if len(c.RecentBlocks) > 0 {
+		firstRecent = c.RecentBlocks[0].Header.Epoch
+	}
+	if c.Blocks == nil && len(c.RecentBlocks) > 0 && epoch+1 < firstRecent {
 		c.mu.Unlock()
 		conn.Send(append([]byte{messages.MsgSyncError}, []byte("node does not have information that old")...))
 		conn.Close()
@@ -42,6 +50,17 @@ func (c *Blockchain) SyncBlocksServer(conn *socket.CachedConnection, epoch uint6
 		}
 	}
 	c.mu.Unlock()
+	for stored := epoch + 1; stored < firstRecent && c.Blocks != nil; stored++ {
+		block, err := c.Blocks.Commit(stored)
+		if err != nil || block == nil {
+			slog.Error("sync blocks server: could not read committed block from block store", "epoch", stored, "err", err)
+			conn.Send(append([]byte{messages.MsgSyncError}, []byte("node does not have information that old")...))
+			conn.Close()
+			conn.Live = false
+			return
+		}
+		conn.SendDirect(append([]byte{messages.MsgCommittedBlock}, block.Serialize()...))
+	}
 	for _, block := range cacheCommit {
 		conn.SendDirect(append([]byte{messages.MsgCommittedBlock}, block.Serialize()...))
 	}
@@ -51,15 +70,102 @@ func (c *Blockchain) SyncBlocksServer(conn *socket.CachedConnection, epoch uint6
 	conn.Ready()
 }
 
+// SyncComponent is a component of the state transferred on its own message on
+// state sync jobs (see Blockchain.SyncState).
+type SyncComponent struct {
+	Kind  byte   // kind of the sync message
+	Name  string // name of the component on logs and errors
+	File  string // file of the component under the path of a file based state
+	Bytes func(s *state.State) []byte
+	// Parse sets the component of the state from its serialization. If filePath
+	// is not empty the component is persisted on File under filePath. Returns
+	// false if data is not a valid serialization.
+	Parse func(s *state.State, filePath string, data []byte) bool
+}
+
+// SyncComponents are the components of the state in order of transmission on
+// state sync jobs.
+var SyncComponents = []SyncComponent{
+	syncComponent(messages.MsgSyncStateWallets, "wallets", "wallet.dat",
+		func(s *state.State) **state.Wallet { return &s.Wallets }, (*state.Wallet).Bytes,
+		func(data []byte) *state.Wallet { return state.NewMemoryWalletStoreFromBytes("wallet", data) },
+		func(filePath string, data []byte) *state.Wallet {
+			return state.NewFileWalletStoreFromBytes(filePath, "wallet", data)
+		}),
+	syncComponent(messages.MsgSyncStateDeposits, "deposits", "deposit.dat",
+		func(s *state.State) **state.Wallet { return &s.Deposits }, (*state.Wallet).Bytes,
+		func(data []byte) *state.Wallet { return state.NewMemoryWalletStoreFromBytes("deposit", data) },
+		func(filePath string, data []byte) *state.Wallet {
+			return state.NewFileWalletStoreFromBytes(filePath, "deposit", data)
+		}),
+	syncComponent(messages.MsgSyncStateActions, "recent actions", "recent.dat",
+		func(s *state.State) **state.RecentActions { return &s.Recent }, (*state.RecentActions).Bytes,
+		state.ParseRecentActions, state.NewFileRecentActionsFromBytes),
+	syncComponent(messages.MsgSyncStateMultisig, "multisig policies", "multisig.dat",
+		func(s *state.State) **state.MultisigPolicies { return &s.Multisig }, (*state.MultisigPolicies).Bytes,
+		state.ParseMultisigPolicies, state.NewFileMultisigPoliciesFromBytes),
+	syncComponent(messages.MsgSyncStateLocks, "time locks", "locks.dat",
+		func(s *state.State) **state.Locks { return &s.Locks }, (*state.Locks).Bytes,
+		state.ParseLocks, state.NewFileLocksFromBytes),
+	syncComponent(messages.MsgSyncStateUnbonding, "unbonding queue", "unbonding.dat",
+		func(s *state.State) **state.UnbondingQueue { return &s.Unbonding }, (*state.UnbondingQueue).Bytes,
+		state.ParseUnbondingQueue, state.NewFileUnbondingQueueFromBytes),
+	syncComponent(messages.MsgSyncStateNonces, "nonces", "nonces.dat",
+		func(s *state.State) **state.Nonces { return &s.Nonces }, (*state.Nonces).Bytes,
+		state.ParseNonces, state.NewFileNoncesFromBytes),
+	syncComponent(messages.MsgSyncStateFees, "fee market", "fees.dat",
+		func(s *state.State) **state.FeeMarket { return &s.Fees }, (*state.FeeMarket).Bytes,
+		state.ParseFeeMarket, state.NewFileFeeMarketFromBytes),
+	syncComponent(messages.MsgSyncStateDelegations, "delegations", "delegations.dat",
+		func(s *state.State) **state.Delegations { return &s.Delegations }, (*state.Delegations).Bytes,
+		state.ParseDelegations, state.NewFileDelegationsFromBytes),
+	syncComponent(messages.MsgSyncStateIssuance, "issuance", "issuance.dat",
+		func(s *state.State) **state.Issuance { return &s.Issuance }, (*state.Issuance).Bytes,
+		state.ParseIssuance, state.NewFileIssuanceFromBytes),
+	syncComponent(messages.MsgSyncStateProtocols, "protocols", "protocols.dat",
+		func(s *state.State) **state.Protocols { return &s.Protocols }, (*state.Protocols).Bytes,
+		state.ParseProtocols, state.NewFileProtocolsFromBytes),
+}
+
+// syncComponent returns the sync component of the state field with the given
+// serialization and parsers of the component in memory and on file.
+func syncComponent[T any](kind byte, name, file string, field func(*state.State) **T, bytes func(*T) []byte, parse func([]byte) *T, parseFile func(string, []byte) *T) SyncComponent {
+	return SyncComponent{
+		Kind:  kind,
+		Name:  name,
+		File:  file,
+		Bytes: func(s *state.State) []byte { return bytes(*field(s)) },
+		Parse: func(s *state.State, filePath string, data []byte) bool {
+			if filePath == "" {
+				*field(s) = parse(data)
+			} else {
+				*field(s) = parseFile(filePath+file, data)
+			}
+			return *field(s) != nil
+		},
+	}
+}
+
 // SyncBlocksClient answers a request for the state of the system at the last
-// recorded checksum. It sends the state of the wallets and the state of the
-// deposits. It then requests a block sync from that epoch forward.
+// recorded checksum. It sends the genesis hash of the network, the clock, the
+// checksum and every component of the state (see SyncComponents). It then
+// requests a block sync from that epoch forward.
 func (c *Blockchain) SyncState(conn *socket.CachedConnection) {
 	c.mu.Lock()
-	wallet := c.Checksum.State.Wallets.Bytes()
-	deposits := c.Checksum.State.Deposits.Bytes()
+	components := make([][]byte, len(SyncComponents))
+	for n, component := range SyncComponents {
+		components[n] = component.Bytes(c.Checksum.State)
+	}
 	c.mu.Unlock()
 
+	genesis := []byte{messages.MsgSyncGenesis}
+	util.PutHash(c.GenesisHash, &genesis)
+	if err := conn.SendDirect(genesis); err != nil {
+		slog.Error("sync state: could not send genesis hash", "err", err)
+		conn.Close()
+		return
+	}
+
 	clock := []byte{messages.MsgClockSync}
 	util.PutUint64(c.Clock.Epoch, &clock)
 	util.PutTime(c.Clock.TimeStamp, &clock)
@@ -80,16 +186,28 @@ func (c *Blockchain) SyncState(conn *socket.CachedConnection) {
 		return
 	}
 
-	if err := conn.SendDirect(append([]byte{messages.MsgSyncStateWallets}, wallet...)); err != nil {
-		slog.Error("sync state: could not send wallets", "err", err)
-		conn.Close()
-		return
+	for n, component := range SyncComponents {
+		if err := conn.SendDirect(append([]byte{component.Kind}, components[n]...)); err != nil {
+			slog.Error("sync state: could not send state component", "component", component.Name, "err", err)
+			conn.Close()
+			return
+		}
 	}
+	c.SyncBlocksServer(conn, c.Checksum.Epoch)
+}
 
-	if err := conn.SendDirect(append([]byte{messages.MsgSyncStateDeposits}, deposits...)); err != nil {
-		slog.Error("sync state: could not send wallets", "err", err)
-		conn.Close()
-		return
+// Balance returns the wallet and deposit balance of the given token at the
+// state of the last checksum. The response carries the checksum epoch and hash
+// so that it can be checked against the answers of other nodes.
+func (c *Blockchain) Balance(token crypto.Token) *messages.Balance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	balance := &messages.Balance{
+		Token:        token,
+		Epoch:        c.Checksum.Epoch,
+		ChecksumHash: c.Checksum.Hash,
 	}
-	c.SyncBlocksServer(conn, c.Checksum.Epoch)
+	_, balance.Wallet = c.Checksum.State.Wallets.Balance(token)
+	_, balance.Deposit = c.Checksum.State.Deposits.Balance(token)
+	return balance
 }
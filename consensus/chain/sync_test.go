@@ -0,0 +1,22 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/freehandle/breeze/protocol/state"
+)
+
+func TestSyncComponents(t *testing.T) {
+	genesis, _ := state.NewGenesisState()
+	for _, filePath := range []string{"", t.TempDir() + "/"} {
+		synced := &state.State{Epoch: genesis.Epoch}
+		for _, component := range SyncComponents {
+			if !component.Parse(synced, filePath, component.Bytes(genesis)) {
+				t.Fatalf("could not parse %v", component.Name)
+			}
+		}
+		if !synced.ChecksumHash().Equal(genesis.ChecksumHash()) {
+			t.Fatalf("synced state checksum differs (file path %q)", filePath)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package chain
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+)
+
+// VerifyBatchSize is the number of actions whose signatures are verified as a
+// single batch. Batches are cut at fixed positions of the action array, so that
+// the outcome of the verification does not depend on the number of cores of
+// the node.
+const VerifyBatchSize = 64
+
+// PreVerify parses every action of the array and verifies their signatures in
+// batches of VerifyBatchSize actions spread across all available cores. It
+// returns the parsed actions in the order of the array, with nil for actions
+// that could not be parsed or that carry an invalid signature. Returned actions
+// are meant to be validated against the state with
+// state.MutatingState.ValidateAction.
+func (b *ActionArray) PreVerify() []actions.Action {
+	verified := make([]actions.Action, b.Len())
+	batches := (b.Len() + VerifyBatchSize - 1) / VerifyBatchSize
+	if batches == 0 {
+		return verified
+	}
+	workers := runtime.NumCPU()
+	if workers > batches {
+		workers = batches
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for batch := range next {
+				starts := batch * VerifyBatchSize
+				ends := starts + VerifyBatchSize
+				if ends > b.Len() {
+					ends = b.Len()
+				}
+				b.verifyBatch(verified[starts:ends], starts)
+			}
+		}()
+	}
+	for batch := 0; batch < batches; batch++ {
+		next <- batch
+	}
+	close(next)
+	wg.Wait()
+	return verified
+}
+
+// verifyBatch parses the actions of the array starting at position starts into
+// verified and batch verifies their signatures. Actions with any invalid
+// signature are set to nil.
+func (b *ActionArray) verifyBatch(verified []actions.Action, starts int) {
+	batch := crypto.NewBatchVerifier(len(verified))
+	owner := make([]int, 0, len(verified))
+	for n := range verified {
+		action, signatures, err := actions.ParseActionUnverified(b.Get(starts + n))
+		if err != nil {
+			continue
+		}
+		verified[n] = action
+		for _, signature := range signatures {
+			batch.Add(signature.Token, signature.Message, signature.Signature)
+			owner = append(owner, n)
+		}
+	}
+	for n, valid := range batch.VerifyEach() {
+		if !valid {
+			verified[owner[n]] = nil
+		}
+	}
+}
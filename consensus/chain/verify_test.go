@@ -0,0 +1,80 @@
+package chain
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/crypto/edwards25519"
+	"github.com/freehandle/breeze/protocol/actions"
+)
+
+// torsionTransfer returns a transfer signed with the point of order 8 as the
+// commitment of the signature, valid only under the cofactored equation of a
+// batch.
+func torsionTransfer(epoch uint64) []byte {
+	var seed [64]byte
+	copy(seed[:], []byte("torsion transfer secret scalar"))
+	var a [32]byte
+	edwards25519.ScReduce(&a, &seed)
+	var A edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&A, &a)
+	var publicKey [32]byte
+	A.ToBytes(&publicKey)
+	transfer := actions.Transfer{TimeStamp: epoch, From: crypto.Token(publicKey), To: []crypto.TokenValue{{Token: crypto.ZeroToken, Value: 1}}, Fee: 1}
+	data := transfer.Serialize()
+	msg := data[:len(data)-crypto.SignatureSize]
+	torsion, _ := hex.DecodeString("26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05")
+	h := sha512.New()
+	h.Write(torsion)
+	h.Write(publicKey[:])
+	h.Write(msg)
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var hReduced, s, zero [32]byte
+	edwards25519.ScReduce(&hReduced, &digest)
+	edwards25519.ScMulAdd(&s, &hReduced, &a, &zero)
+	copy(data[len(msg):], torsion)
+	copy(data[len(msg)+32:], s[:])
+	return data
+}
+
+func TestPreVerifyTorsion(t *testing.T) {
+	array := NewActionArray()
+	for n := 0; n < 2*VerifyBatchSize; n++ {
+		if n == 3 || n == VerifyBatchSize+1 {
+			array.Append(torsionTransfer(uint64(n + 1)))
+			continue
+		}
+		token, key := crypto.RandomAsymetricKey()
+		transfer := actions.Transfer{TimeStamp: uint64(n + 1), From: token, To: []crypto.TokenValue{{Token: crypto.ZeroToken, Value: 1}}, Fee: 1}
+		transfer.Sign(key)
+		data := transfer.Serialize()
+		if n == VerifyBatchSize+5 {
+			// invalid signature forces the individual fallback on the batch
+			data[len(data)-1] ^= 1
+		}
+		array.Append(data)
+	}
+	verified := array.PreVerify()
+	for n := range verified {
+		if n == 3 {
+			continue
+		}
+		_, err := actions.ParseAction(array.Get(n))
+		if (verified[n] != nil) != (err == nil) {
+			t.Errorf("action %d: batch verification %v, individual verification %v", n, verified[n] != nil, err)
+		}
+	}
+	// a torsion signature is accepted by a passing batch only
+	if verified[3] == nil {
+		t.Error("torsion signature rejected by passing batch")
+	}
+	if verified[VerifyBatchSize+1] != nil {
+		t.Error("torsion signature accepted by individual fallback")
+	}
+	if verified[VerifyBatchSize+5] != nil {
+		t.Error("invalid signature accepted")
+	}
+}
@@ -0,0 +1,374 @@
+package light
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/freehandle/breeze/consensus/chain"
+	"github.com/freehandle/breeze/consensus/messages"
+	"github.com/freehandle/breeze/consensus/swell"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/breeze/util"
+)
+
+// Config defines the parameters of the swell network followed by a light
+// client. They must match those of the validators of the network.
+type Config struct {
+	NetworkHash      crypto.Hash // hash of the network
+	MaxPoolSize      int         // max number of validator in each hash consensus pool
+	MaxCommitteeSize int         // max number of validators in the checksum window
+	// Weights returns the weights of the candidates to the next committee under
+	// the permission rule of the network (see swell.Permission). If nil every
+	// candidate has weight one, as in permissionless networks.
+	Weights func(candidates []crypto.Token) map[crypto.Token]int
+}
+
+// Header is a block header verified against the signatures of the committee
+// together with the block commit of a member of the committee.
+type Header struct {
+	Header chain.BlockHeader
+	Hash   crypto.Hash
+	Commit *chain.BlockCommit
+	Block  *chain.CommitBlock
+}
+
+// Client follows the breeze chain without re-executing blocks. It keeps track
+// of the committee of each checksum window, starting from a trusted committee,
+// and accepts sealed blocks only if they carry the signature of the epoch
+// proposer and the consensus of the epoch pool. A sealed block is committed
+// once a member of the committee publishes a signed block commit for it. The
+// committee of the next window is derived, as validators do, from the naked
+// checksum statements on verified block headers of the current window.
+// Committed headers are streamed in epoch order on Headers.
+type Client struct {
+	Headers    *util.Chain[*Header]
+	mu         sync.Mutex
+	config     Config
+	committees []*Committee
+	statements map[uint64][]*chain.ChecksumStatement // per window start
+	sealed     map[uint64]*chain.SealedBlock
+	commits    map[uint64]*chain.BlockCommit
+	committed  map[uint64]crypto.Hash
+	lastEpoch  uint64
+	lastHash   crypto.Hash
+}
+
+// NewClient returns a light client that trusts the given committee and the
+// block with the given hash committed at the given epoch. Headers of blocks
+// after that epoch are streamed on the Headers chain.
+func NewClient(ctx context.Context, config Config, trusted *Committee, epoch uint64, hash crypto.Hash) *Client {
+	return &Client{
+		Headers:    util.NewChain[*Header](ctx, epoch+1),
+		config:     config,
+		committees: []*Committee{trusted},
+		statements: make(map[uint64][]*chain.ChecksumStatement),
+		sealed:     make(map[uint64]*chain.SealedBlock),
+		commits:    make(map[uint64]*chain.BlockCommit),
+		committed:  map[uint64]crypto.Hash{epoch: hash},
+		lastEpoch:  epoch,
+		lastHash:   hash,
+	}
+}
+
+// LastCommit returns the epoch and the hash of the last committed block.
+func (c *Client) LastCommit() (uint64, crypto.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastEpoch, c.lastHash
+}
+
+// Committee returns the known committee of the checksum window of the epoch
+// or nil if it is not known.
+func (c *Client) Committee(epoch uint64) *Committee {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.committee(epoch)
+}
+
+func (c *Client) committee(epoch uint64) *Committee {
+	for _, committee := range c.committees {
+		if epoch >= committee.Start && epoch <= committee.End {
+			return committee
+		}
+	}
+	return nil
+}
+
+// verifySealed checks the network hash of the sealed block and its seal. A
+// forced empty block is only accepted for the epoch after the last commit if
+// enough verified sealed blocks are stuck on the last commit.
+func (c *Client) verifySealed(sealed *chain.SealedBlock) error {
+	if !sealed.Header.NetworkHash.Equal(c.config.NetworkHash) {
+		return fmt.Errorf("%w: network hash mismatch", ErrInvalidSeal)
+	}
+	if isForcedEmpty(sealed) {
+		if hash, ok := c.committed[sealed.Header.Epoch]; ok && hash.Equal(sealed.Seal.Hash) {
+			return nil
+		}
+		if sealed.Header.Epoch != c.lastEpoch+1 || sealed.Header.CheckPoint != c.lastEpoch || !sealed.Header.CheckpointHash.Equal(c.lastHash) {
+			return fmt.Errorf("%w: forced empty block not after last commit", ErrInvalidSeal)
+		}
+		count := 0
+		for _, pending := range c.sealed {
+			if pending.Header.CheckPoint == c.lastEpoch && pending.Header.CheckpointHash.Equal(c.lastHash) {
+				count += 1
+			}
+		}
+		if count < chain.ForceEmptyCommitAfter {
+			return fmt.Errorf("%w: forced empty block before commit lag", ErrInvalidSeal)
+		}
+		return nil
+	}
+	committee := c.committee(sealed.Header.Epoch)
+	if committee == nil {
+		return ErrUnknownCommittee
+	}
+	return verifySeal(sealed, committee, c.config.MaxPoolSize)
+}
+
+// VerifySealed returns nil if the sealed block is signed by the proposer of
+// its epoch and by the consensus of the epoch pool of its committee.
+func (c *Client) VerifySealed(sealed *chain.SealedBlock) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.verifySealed(sealed)
+}
+
+// VerifyCommit returns nil if the commit block has a verified seal and is
+// signed by its publisher. Blocks of already committed epochs must match the
+// hash of the committed block.
+func (c *Client) VerifyCommit(block *chain.CommitBlock) error {
+	if block.Commit == nil {
+		return ErrInvalidCommit
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hash, ok := c.committed[block.Header.Epoch]; ok && !hash.Equal(block.Seal.Hash) {
+		return fmt.Errorf("%w: hash differs from committed block", ErrInvalidCommit)
+	}
+	if err := c.verifySealed(block.Sealed()); err != nil {
+		return err
+	}
+	if !block.VerifyPublisher() {
+		return fmt.Errorf("%w: invalid publisher signature", ErrInvalidCommit)
+	}
+	return nil
+}
+
+// AddSealed verifies the sealed block and keeps it until it is committed.
+// Checksum statements on the header are collected for the verification of the
+// committee of the next window.
+func (c *Client) AddSealed(sealed *chain.SealedBlock) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	epoch := sealed.Header.Epoch
+	if epoch <= c.lastEpoch {
+		return nil
+	}
+	if existing, ok := c.sealed[epoch]; ok {
+		if existing.Seal.Hash.Equal(sealed.Seal.Hash) {
+			return nil
+		}
+		return fmt.Errorf("%w: conflicting sealed block for epoch %v", ErrInvalidSeal, epoch)
+	}
+	if err := c.verifySealed(sealed); err != nil {
+		return err
+	}
+	c.sealed[epoch] = sealed
+	if committee := c.committee(epoch); committee != nil {
+		for _, statement := range sealed.Header.Candidate {
+			if statement.VerifySignature() {
+				c.statements[committee.Start] = append(c.statements[committee.Start], statement)
+			}
+		}
+	}
+	return c.advance()
+}
+
+// AddCommit keeps the block commit for the sealed block with the given epoch
+// and hash and commits as many blocks as possible.
+func (c *Client) AddCommit(epoch uint64, hash crypto.Hash, commit *chain.BlockCommit) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch <= c.lastEpoch {
+		return nil
+	}
+	if sealed, ok := c.sealed[epoch]; ok && !sealed.Seal.Hash.Equal(hash) {
+		return fmt.Errorf("%w: commit for unknown seal hash", ErrUnknownBlock)
+	}
+	if _, ok := c.commits[epoch]; !ok {
+		c.commits[epoch] = commit
+	}
+	return c.advance()
+}
+
+// advance commits sealed blocks after the last commit for which a block commit
+// signed by a member of the committee is known, and pushes their headers to
+// the header stream.
+func (c *Client) advance() error {
+	for {
+		epoch := c.lastEpoch + 1
+		sealed, ok := c.sealed[epoch]
+		if !ok {
+			return nil
+		}
+		commit, ok := c.commits[epoch]
+		if !ok {
+			return nil
+		}
+		block := &chain.CommitBlock{Header: sealed.Header, Actions: sealed.Actions, Seal: sealed.Seal, Commit: commit}
+		committee := c.committee(epoch)
+		if committee == nil || committee.weights()[commit.PublishedBy] == 0 || !block.VerifyPublisher() {
+			delete(c.commits, epoch)
+			return fmt.Errorf("%w: epoch %v", ErrInvalidCommit, epoch)
+		}
+		delete(c.sealed, epoch)
+		delete(c.commits, epoch)
+		c.lastEpoch = epoch
+		c.lastHash = sealed.Seal.Hash
+		c.committed[epoch] = sealed.Seal.Hash
+		c.Headers.Push(&Header{Header: sealed.Header, Hash: sealed.Seal.Hash, Commit: commit, Block: block}, epoch)
+	}
+}
+
+// NextCommittee accepts the order of the committee of the window following the
+// last known window. The hash of the checksum must be stated on naked checksum
+// statements by members of the current committee with more than two thirds of
+// its weight. The order must be the one validators derive from that hash: the
+// candidates with a naked statement of the hash, weighted by Config.Weights and
+// sorted by swell.SortCandidates with the hash as seed.
+func (c *Client) NextCommittee(order []crypto.Token) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(order) == 0 {
+		return ErrInvalidCommittee
+	}
+	current := c.committees[len(c.committees)-1]
+	statements := c.statements[current.Start]
+	hash, ok := consensusHash(statements, current.weights())
+	if !ok {
+		return fmt.Errorf("%w: no consensus checksum hash", ErrInvalidCommittee)
+	}
+	expected := c.nextOrder(statements, hash)
+	if len(expected) != len(order) {
+		return fmt.Errorf("%w: order not derived from checksum hash", ErrInvalidCommittee)
+	}
+	for n, token := range order {
+		if !token.Equal(expected[n]) {
+			return fmt.Errorf("%w: order not derived from checksum hash", ErrInvalidCommittee)
+		}
+	}
+	c.committees = append(c.committees, current.next(order))
+	delete(c.statements, current.Start)
+	return nil
+}
+
+// nextOrder returns the order of the next committee derived from the naked
+// statements of the consensus checksum hash, or nil if no candidate is
+// permissioned.
+func (c *Client) nextOrder(statements []*chain.ChecksumStatement, hash crypto.Hash) []crypto.Token {
+	candidates := make([]crypto.Token, 0)
+	for _, statement := range statements {
+		if statement.Naked && statement.Hash.Equal(hash) {
+			candidates = append(candidates, statement.Node)
+		}
+	}
+	var weights map[crypto.Token]int
+	if c.config.Weights != nil {
+		weights = c.config.Weights(candidates)
+	} else {
+		weights = make(map[crypto.Token]int)
+		for _, token := range candidates {
+			weights[token] = 1
+		}
+	}
+	for token, weight := range weights {
+		if weight <= 0 {
+			delete(weights, token)
+		}
+	}
+	if len(weights) == 0 {
+		return nil
+	}
+	return swell.SortCandidates(weights, hash[:], c.config.MaxCommitteeSize)
+}
+
+// Receive processes a block event of a relay node: sealed blocks, block commits
+// and the committee of the next window. Other messages are ignored. Repeated
+// announcements of the last accepted committee are ignored.
+func (c *Client) Receive(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	switch data[0] {
+	case messages.MsgSealedBlock:
+		sealed, err := chain.ParseSealedBlock(data[1:])
+		if err != nil {
+			return err
+		}
+		return c.AddSealed(sealed)
+	case messages.MsgCommit:
+		epoch, hash, commitBytes := messages.ParseEpochAndHash(data)
+		commit, err := chain.ParseBlockCommit(commitBytes)
+		if err != nil {
+			return err
+		}
+		return c.AddCommit(epoch, hash, commit)
+	case messages.MsgNextCommittee:
+		order, _ := swell.ParseCommitee(data[1:])
+		if order == nil {
+			return util.NewParseError("next committee", 1, util.ErrInvalidValue)
+		}
+		if err := c.NextCommittee(order); err != nil && !c.knownOrder(order) {
+			return err
+		}
+		return nil
+	}
+	return nil
+}
+
+// knownOrder returns true if the order is the order of the last known window.
+func (c *Client) knownOrder(order []crypto.Token) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := c.committees[len(c.committees)-1]
+	if len(last.Order) != len(order) {
+		return false
+	}
+	for n, token := range order {
+		if !token.Equal(last.Order[n]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen subscribes to the block events of the relay node on the other end of
+// the connection and feeds the light client with them until the context is
+// done or the connection is lost.
+func (c *Client) Listen(ctx context.Context, conn *socket.SignedConnection) error {
+	if err := conn.Send([]byte{messages.MsgSubscribeBlockEvents}); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Shutdown()
+	}()
+	for {
+		data, err := conn.Read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.Receive(data); err != nil {
+			slog.Info("light client: rejected block event", "error", err)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package light
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/freehandle/breeze/consensus/bft"
+	"github.com/freehandle/breeze/consensus/chain"
+	"github.com/freehandle/breeze/consensus/messages"
+	"github.com/freehandle/breeze/consensus/swell"
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+var testNetwork = crypto.Hasher([]byte("light client test network"))
+
+func sealBlock(epoch uint64, proposer crypto.PrivateKey, statements []*chain.ChecksumStatement, signers []crypto.PrivateKey) *chain.SealedBlock {
+	sealed := &chain.SealedBlock{
+		Header: chain.BlockHeader{
+			NetworkHash: testNetwork,
+			Epoch:       epoch,
+			CheckPoint:  epoch - 1,
+			Proposer:    proposer.PublicKey(),
+			ProposedAt:  time.Now(),
+			Candidate:   statements,
+		},
+		Actions: chain.NewActionArray(),
+	}
+	hash := sealed.Hash()
+	sealed.Seal = chain.BlockSeal{Hash: hash, SealSignature: proposer.Sign(hash[:])}
+	if len(signers) > 0 {
+		ballot := &bft.Ballot{Round: 0, Commits: make([]*bft.RoundCommit, 0)}
+		for _, signer := range signers {
+			commit := &bft.RoundCommit{Epoch: epoch, Token: signer.PublicKey(), Value: hash}
+			commit.Sign(signer)
+			ballot.Commits = append(ballot.Commits, commit)
+		}
+		sealed.Seal.Consensus = []*bft.Ballot{ballot}
+	}
+	return sealed
+}
+
+func publish(sealed *chain.SealedBlock, publisher crypto.PrivateKey) *chain.BlockCommit {
+	block := &chain.CommitBlock{
+		Header:  sealed.Header,
+		Actions: sealed.Actions,
+		Seal:    sealed.Seal,
+		Commit:  &chain.BlockCommit{Invalidated: make([]crypto.Hash, 0), PublishedBy: publisher.PublicKey()},
+	}
+	data := block.Serialize()
+	block.Commit.PublishSign = publisher.Sign(data[:len(data)-crypto.SignatureSize])
+	return block.Commit
+}
+
+func TestSoloCommittee(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	committee := &Committee{Start: 1, End: 10, Order: []crypto.Token{key.PublicKey()}}
+	client := NewClient(context.Background(), Config{NetworkHash: testNetwork, MaxPoolSize: 10}, committee, 0, crypto.ZeroHash)
+	sealed := sealBlock(1, key, nil, nil)
+	if err := client.AddSealed(sealed); err != nil {
+		t.Fatalf("solo sealed block rejected: %v", err)
+	}
+	if err := client.AddCommit(1, sealed.Seal.Hash, publish(sealed, key)); err != nil {
+		t.Fatalf("solo block commit rejected: %v", err)
+	}
+	header := client.Headers.Pop()
+	if header.Header.Epoch != 1 || !header.Hash.Equal(sealed.Seal.Hash) {
+		t.Fatalf("unexpected header on stream: epoch %v", header.Header.Epoch)
+	}
+	_, other := crypto.RandomAsymetricKey()
+	if err := client.VerifySealed(sealBlock(2, other, nil, nil)); !errors.Is(err, ErrInvalidSeal) {
+		t.Fatalf("sealed block by other than leader: %v", err)
+	}
+	if err := client.VerifySealed(sealBlock(11, key, nil, nil)); !errors.Is(err, ErrUnknownCommittee) {
+		t.Fatalf("sealed block after known windows: %v", err)
+	}
+}
+
+func TestCommitteeConsensus(t *testing.T) {
+	keys := make([]crypto.PrivateKey, 4)
+	order := make([]crypto.Token, 4)
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+		order[n] = keys[n].PublicKey()
+	}
+	committee := &Committee{Start: 1, End: 10, Order: order}
+	client := NewClient(context.Background(), Config{NetworkHash: testNetwork, MaxPoolSize: 4, MaxCommitteeSize: 4}, committee, 0, crypto.ZeroHash)
+
+	if err := client.VerifySealed(sealBlock(1, keys[0], nil, keys[:2])); !errors.Is(err, ErrNoConsensus) {
+		t.Fatalf("sealed block with two of four commits: %v", err)
+	}
+	if err := client.VerifySealed(sealBlock(1, keys[1], nil, keys[:3])); !errors.Is(err, ErrInvalidSeal) {
+		t.Fatalf("sealed block by other than leader: %v", err)
+	}
+	_, outsider := crypto.RandomAsymetricKey()
+	if err := client.VerifySealed(sealBlock(1, keys[0], nil, append(keys[:2:2], outsider))); !errors.Is(err, ErrNoConsensus) {
+		t.Fatalf("sealed block with commit of non member: %v", err)
+	}
+
+	sealed := sealBlock(1, keys[0], nil, keys[1:])
+	if err := client.AddSealed(sealed); err != nil {
+		t.Fatalf("sealed block with consensus rejected: %v", err)
+	}
+	if err := client.AddCommit(1, sealed.Seal.Hash, publish(sealed, outsider)); !errors.Is(err, ErrInvalidCommit) {
+		t.Fatalf("block commit by non member: %v", err)
+	}
+	commit := publish(sealed, keys[2])
+	if err := client.AddCommit(1, sealed.Seal.Hash, commit); err != nil {
+		t.Fatalf("block commit rejected: %v", err)
+	}
+	if header := client.Headers.Pop(); !header.Hash.Equal(sealed.Seal.Hash) {
+		t.Fatal("unexpected header on stream")
+	}
+	block := &chain.CommitBlock{Header: sealed.Header, Actions: sealed.Actions, Seal: sealed.Seal, Commit: commit}
+	if err := client.VerifyCommit(block); err != nil {
+		t.Fatalf("verified commit rejected: %v", err)
+	}
+	block.Commit.FeesCollected = 1
+	if err := client.VerifyCommit(block); !errors.Is(err, ErrInvalidCommit) {
+		t.Fatalf("tampered commit: %v", err)
+	}
+
+	// next committee derived from naked statements of the current committee
+	_, candidate := crypto.RandomAsymetricKey()
+	if err := client.NextCommittee([]crypto.Token{candidate.PublicKey()}); !errors.Is(err, ErrInvalidCommittee) {
+		t.Fatalf("next committee without statements: %v", err)
+	}
+	checksum := crypto.Hasher([]byte("checksum"))
+	stated := []crypto.PrivateKey{keys[0], keys[1], keys[2], candidate}
+	statements := make([]*chain.ChecksumStatement, 0)
+	weights := make(map[crypto.Token]int)
+	for _, key := range stated {
+		statements = append(statements, chain.NewCheckSum(8, key, "", true, checksum))
+		weights[key.PublicKey()] = 1
+	}
+	sealed = sealBlock(2, keys[1], statements, keys[:3])
+	if err := client.Receive(messages.SealedBlock(sealed.Serialize())); err != nil {
+		t.Fatalf("sealed block message rejected: %v", err)
+	}
+	if err := client.Receive(messages.Commit(2, sealed.Seal.Hash, publish(sealed, keys[1]).Serialize())); err != nil {
+		t.Fatalf("commit message rejected: %v", err)
+	}
+	if epoch, hash := client.LastCommit(); epoch != 2 || !hash.Equal(sealed.Seal.Hash) {
+		t.Fatalf("unexpected last commit %v", epoch)
+	}
+	if err := client.NextCommittee([]crypto.Token{keys[3].PublicKey()}); !errors.Is(err, ErrInvalidCommittee) {
+		t.Fatalf("next committee with member without statement: %v", err)
+	}
+	// a relay cannot narrow the committee down to one of the stated candidates
+	if err := client.Receive(nextCommitteeMessage([]crypto.Token{candidate.PublicKey()})); !errors.Is(err, ErrInvalidCommittee) {
+		t.Fatalf("one member order from relay: %v", err)
+	}
+	if client.Committee(11) != nil {
+		t.Fatal("one member order from relay accepted")
+	}
+	next := swell.SortCandidates(weights, checksum[:], 4)
+	if err := client.Receive(nextCommitteeMessage(next)); err != nil {
+		t.Fatalf("derived next committee rejected: %v", err)
+	}
+	if window := client.Committee(11); window == nil || window.End != 20 || !window.Order[0].Equal(next[0]) {
+		t.Fatal("next committee not tracked")
+	}
+	leader := stated[0]
+	for _, key := range stated {
+		if key.PublicKey().Equal(next[1]) {
+			leader = key
+		}
+	}
+	if err := client.VerifySealed(sealBlock(12, leader, nil, stated)); err != nil {
+		t.Fatalf("sealed block of next window rejected: %v", err)
+	}
+}
+
+func TestDerivedSoloCommittee(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	committee := &Committee{Start: 1, End: 10, Order: []crypto.Token{key.PublicKey()}}
+	client := NewClient(context.Background(), Config{NetworkHash: testNetwork, MaxPoolSize: 10, MaxCommitteeSize: 10}, committee, 0, crypto.ZeroHash)
+	checksum := crypto.Hasher([]byte("checksum"))
+	sealed := sealBlock(1, key, []*chain.ChecksumStatement{chain.NewCheckSum(8, key, "", true, checksum)}, nil)
+	if err := client.AddSealed(sealed); err != nil {
+		t.Fatalf("solo sealed block rejected: %v", err)
+	}
+	next := swell.SortCandidates(map[crypto.Token]int{key.PublicKey(): 1}, checksum[:], 10)
+	if err := client.NextCommittee(next); err != nil {
+		t.Fatalf("derived solo committee rejected: %v", err)
+	}
+	// only a trusted solo committee seals without consensus
+	if err := client.VerifySealed(sealBlock(11, key, nil, nil)); !errors.Is(err, ErrNoConsensus) {
+		t.Fatalf("sealed block of derived solo committee without consensus: %v", err)
+	}
+	if err := client.VerifySealed(sealBlock(11, key, nil, []crypto.PrivateKey{key})); err != nil {
+		t.Fatalf("sealed block of derived solo committee rejected: %v", err)
+	}
+}
+
+// nextCommitteeMessage returns the message of a relay announcing the order of
+// the next committee.
+func nextCommitteeMessage(order []crypto.Token) []byte {
+	data := []byte{messages.MsgNextCommittee, messages.MsgNetworkTopologyResponse}
+	util.PutUint16(uint16(len(order)), &data)
+	for _, token := range order {
+		util.PutToken(token, &data)
+	}
+	util.PutUint16(0, &data)
+	return data
+}
@@ -0,0 +1,152 @@
+package light
+
+import (
+	"errors"
+	"time"
+
+	"github.com/freehandle/breeze/consensus/chain"
+	"github.com/freehandle/breeze/crypto"
+)
+
+// Reasons for rejecting a block or a committee. Methods of the light client
+// return them, possibly wrapped, so that callers can tell them apart with
+// errors.Is.
+var (
+	ErrUnknownCommittee = errors.New("committee of the checksum window is unknown")
+	ErrInvalidSeal      = errors.New("invalid block seal")
+	ErrNoConsensus      = errors.New("block seal without committee consensus")
+	ErrInvalidCommit    = errors.New("invalid block commit")
+	ErrUnknownBlock     = errors.New("sealed block is unknown")
+	ErrInvalidCommittee = errors.New("committee not backed by checksum statements")
+)
+
+// Committee is the ordered list of validators of a checksum window from Start
+// to End epochs. The weight of a validator is the number of times its token
+// appears on the order.
+type Committee struct {
+	Start   uint64
+	End     uint64
+	Order   []crypto.Token
+	derived bool // learned through NextCommittee rather than trusted
+}
+
+// weights returns the weight of each member of the committee.
+func (c *Committee) weights() map[crypto.Token]int {
+	weights := make(map[crypto.Token]int)
+	for _, token := range c.Order {
+		weights[token] += 1
+	}
+	return weights
+}
+
+// leader returns the position on the order of the proposer of the epoch.
+func (c *Committee) leader(epoch uint64) int {
+	return int(epoch-c.Start) % len(c.Order)
+}
+
+// pool returns the weight of each member of the consensus pool of the epoch
+// according to swell pool formation rule: the leader of the epoch and the
+// following members of the order up to maxPoolSize seats.
+func (c *Committee) pool(epoch uint64, maxPoolSize int) (map[crypto.Token]int, int) {
+	weights := c.weights()
+	pool := make(map[crypto.Token]int)
+	total := 0
+	leader := c.leader(epoch)
+	for i := 0; i < maxPoolSize; i++ {
+		token := c.Order[(leader+i)%len(c.Order)]
+		pool[token] += weights[token]
+		total += weights[token]
+	}
+	return pool, total
+}
+
+// next returns the window following the committee window.
+func (c *Committee) next(order []crypto.Token) *Committee {
+	return &Committee{
+		Start:   c.End + 1,
+		End:     c.End + 1 + (c.End - c.Start),
+		Order:   order,
+		derived: true,
+	}
+}
+
+// verifySeal checks that the sealed block is sealed by the leader of the epoch
+// and that more than two thirds of the weight of the consensus pool of the
+// epoch committed to the seal hash. Consensus is waived only for a trusted
+// committee with a single member, never for a derived one, whose single member
+// would otherwise be free to seal any header of the window.
+func verifySeal(sealed *chain.SealedBlock, committee *Committee, maxPoolSize int) error {
+	hash := sealed.Hash()
+	if !sealed.Seal.Hash.Equal(hash) {
+		return ErrInvalidSeal
+	}
+	epoch := sealed.Header.Epoch
+	if !sealed.Header.Proposer.Equal(committee.Order[committee.leader(epoch)]) {
+		return ErrInvalidSeal
+	}
+	if !sealed.Header.Proposer.Verify(hash[:], sealed.Seal.SealSignature) {
+		return ErrInvalidSeal
+	}
+	if !committee.derived && len(committee.weights()) == 1 {
+		return nil
+	}
+	pool, total := committee.pool(epoch, maxPoolSize)
+	for _, ballot := range sealed.Seal.Consensus {
+		signed := make(map[crypto.Token]struct{})
+		weight := 0
+		for _, commit := range ballot.Commits {
+			if commit.Blank || commit.Epoch != epoch || !commit.Value.Equal(hash) {
+				continue
+			}
+			if _, ok := signed[commit.Token]; ok {
+				continue
+			}
+			member, ok := pool[commit.Token]
+			if !ok {
+				continue
+			}
+			bytes := commit.Serialize()
+			if !commit.Token.Verify(bytes[:len(bytes)-crypto.SignatureSize], commit.Signatute) {
+				continue
+			}
+			signed[commit.Token] = struct{}{}
+			weight += member
+			if weight > 2*total/3 {
+				return nil
+			}
+		}
+	}
+	return ErrNoConsensus
+}
+
+// isForcedEmpty returns true if the sealed block has the form of an empty
+// unsigned block forced by validators into the chain after the block of an
+// epoch could not be committed (see chain.Blockchain.CheckForceEmptyCommit).
+func isForcedEmpty(sealed *chain.SealedBlock) bool {
+	return sealed.Header.Proposer.Equal(crypto.ZeroToken) && sealed.Header.ProposedAt.Equal(time.Unix(0, 0)) && sealed.Actions.Len() == 0 && len(sealed.Seal.Consensus) == 0 && sealed.Seal.Hash.Equal(sealed.Hash())
+}
+
+// consensusHash returns the checksum hash stated on naked statements by
+// members of the committee with more than two thirds of its weight.
+func consensusHash(statements []*chain.ChecksumStatement, weights map[crypto.Token]int) (crypto.Hash, bool) {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	stated := make(map[crypto.Token]struct{})
+	perHash := make(map[crypto.Hash]int)
+	for _, statement := range statements {
+		if !statement.Naked {
+			continue
+		}
+		if _, ok := stated[statement.Node]; ok {
+			continue
+		}
+		stated[statement.Node] = struct{}{}
+		perHash[statement.Hash] += weights[statement.Node]
+		if perHash[statement.Hash] > 2*total/3 {
+			return statement.Hash, true
+		}
+	}
+	return crypto.ZeroHash, false
+}
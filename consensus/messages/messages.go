@@ -56,6 +56,20 @@ const (
 	MsgActionCommit
 
 	MsgError
+	MsgSyncStateActions
+	MsgSyncStateMultisig
+	MsgSyncStateLocks
+	MsgSyncStateUnbonding
+	MsgSyncStateNonces
+	MsgSyncStateFees
+	MsgBalanceRequest // Request wallet and deposit balance of a token
+	MsgBalance        // Wallet and deposit balance of a token at a checksum
+	MsgSyncStateDelegations
+	MsgSyncStateIssuance
+	MsgSyncWindowWeights // Validator weights of recent checksum windows
+	MsgSyncGenesis       // Genesis hash of the network
+	MsgSyncStateProtocols
+	MsgActionReceipt // Gateway signed receipt of the status of an action
 )
 
 type NetworkTopology struct {
@@ -180,24 +194,125 @@ func SealedBlock(sealed []byte) []byte {
 	return append([]byte{MsgSealedBlock}, sealed...)
 }
 
-func SealedAction(action crypto.Hash, block uint64, blockHash crypto.Hash) []byte {
-	msg := []byte{MsgActionSealed}
-	util.PutHash(action, &msg)
-	util.PutUint64(block, &msg)
-	util.PutHash(blockHash, &msg)
-	return msg
+// Status of an action reported on an ActionReceipt. Sealed and committed
+// actions were included in the block identified by the receipt, invalidated
+// actions were included but rejected by the block commit, and expired actions
+// were dropped by the gateway without inclusion.
+const (
+	ActionSealed byte = iota + 1
+	ActionCommitted
+	ActionInvalidated
+	ActionExpired
+)
+
+// ActionReceipt is the receipt sent by a gateway to the connection that
+// submitted an action. Epoch and BlockHash identify the block including the
+// action, or the gateway epoch and a zero hash for expired actions. The receipt
+// is signed by the Gateway token.
+type ActionReceipt struct {
+	Action    crypto.Hash
+	Status    byte
+	Epoch     uint64
+	BlockHash crypto.Hash
+	Gateway   crypto.Token
+	Signature crypto.Signature
+}
+
+func (r *ActionReceipt) serializeToSign() []byte {
+	bytes := []byte{MsgActionReceipt}
+	util.PutHash(r.Action, &bytes)
+	util.PutByte(r.Status, &bytes)
+	util.PutUint64(r.Epoch, &bytes)
+	util.PutHash(r.BlockHash, &bytes)
+	util.PutToken(r.Gateway, &bytes)
+	return bytes
+}
+
+// Sign signs the receipt with the gateway credentials.
+func (r *ActionReceipt) Sign(credentials crypto.PrivateKey) {
+	r.Gateway = credentials.PublicKey()
+	r.Signature = credentials.Sign(r.serializeToSign())
+}
+
+func (r *ActionReceipt) Serialize() []byte {
+	bytes := r.serializeToSign()
+	util.PutSignature(r.Signature, &bytes)
+	return bytes
+}
+
+// ParseActionReceipt parses a receipt message. Returns nil if the message is
+// invalid or the receipt signature does not match its gateway token.
+func ParseActionReceipt(data []byte) *ActionReceipt {
+	if len(data) < 1 || data[0] != MsgActionReceipt {
+		return nil
+	}
+	receipt := ActionReceipt{}
+	position := 1
+	receipt.Action, position = util.ParseHash(data, position)
+	receipt.Status, position = util.ParseByte(data, position)
+	receipt.Epoch, position = util.ParseUint64(data, position)
+	receipt.BlockHash, position = util.ParseHash(data, position)
+	receipt.Gateway, position = util.ParseToken(data, position)
+	msg := position
+	receipt.Signature, position = util.ParseSignature(data, position)
+	if position != len(data) || receipt.Status < ActionSealed || receipt.Status > ActionExpired {
+		return nil
+	}
+	if !receipt.Gateway.Verify(data[:msg], receipt.Signature) {
+		return nil
+	}
+	return &receipt
+}
+
+// Balance is the response to a balance request. Balances are read from the
+// state of the last checksum of the responding node: Epoch and ChecksumHash
+// identify that checksum, so that responses from different nodes for the same
+// epoch can be compared against each other and against checksum statements.
+type Balance struct {
+	Token        crypto.Token
+	Epoch        uint64
+	ChecksumHash crypto.Hash
+	Wallet       uint64
+	Deposit      uint64
 }
 
-func ParseSealedAction(msg []byte) (crypto.Hash, uint64, crypto.Hash) {
-	if len(msg) < 1 || msg[0] != MsgActionSealed {
-		return crypto.Hash{}, 0, crypto.Hash{}
+func BalanceRequest(token crypto.Token) []byte {
+	bytes := []byte{MsgBalanceRequest}
+	util.PutToken(token, &bytes)
+	return bytes
+}
+
+func ParseBalanceRequest(data []byte) crypto.Token {
+	if len(data) != 1+crypto.TokenSize || data[0] != MsgBalanceRequest {
+		return crypto.ZeroToken
 	}
+	token, _ := util.ParseToken(data, 1)
+	return token
+}
+
+func (b *Balance) Serialize() []byte {
+	bytes := []byte{MsgBalance}
+	util.PutToken(b.Token, &bytes)
+	util.PutUint64(b.Epoch, &bytes)
+	util.PutHash(b.ChecksumHash, &bytes)
+	util.PutUint64(b.Wallet, &bytes)
+	util.PutUint64(b.Deposit, &bytes)
+	return bytes
+}
+
+func ParseBalance(data []byte) *Balance {
+	if len(data) < 1 || data[0] != MsgBalance {
+		return nil
+	}
+	balance := Balance{}
 	position := 1
-	action, position := util.ParseHash(msg, position)
-	block, position := util.ParseUint64(msg, position)
-	blockHash, position := util.ParseHash(msg, position)
-	if position != len(msg) {
-		return crypto.Hash{}, 0, crypto.Hash{}
+	balance.Token, position = util.ParseToken(data, position)
+	balance.Epoch, position = util.ParseUint64(data, position)
+	balance.ChecksumHash, position = util.ParseHash(data, position)
+	balance.Wallet, position = util.ParseUint64(data, position)
+	balance.Deposit, position = util.ParseUint64(data, position)
+	if position != len(data) {
+		return nil
 	}
-	return action, block, blockHash
+	return &balance
 }
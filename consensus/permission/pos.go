@@ -43,11 +43,13 @@ func (pos *ProofOfStake) Punish(duplicates *bft.Duplicate, weights map[crypto.To
 	return punishments
 }
 
-// DeterminePool returns the autorized candidates with their respective deposits.
+// DeterminePool returns the autorized candidates with their respective weights.
+// The stake of a candidate is its deposit plus the stake delegated to it.
 func (pos *ProofOfStake) DeterminePool(chain *chain.Blockchain, candidates []crypto.Token) map[crypto.Token]int {
 	validated := make(map[crypto.Token]int)
 	for _, token := range candidates {
 		_, deposit := chain.Checksum.State.Deposits.Balance(token)
+		deposit += chain.Checksum.State.Delegations.Delegated(crypto.HashToken(token))
 		if deposit >= pos.MinimumStage {
 			validated[token] = int(deposit / pos.MinimumStage)
 		}
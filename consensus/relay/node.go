@@ -56,12 +56,15 @@ type Firewall struct {
 // channel shoud be read by the validating node to receive proposed actions.
 // BlockEvents channel should be write by the validating node to broadcast block
 // events. SyncRequest channel should be read by the validating node to receive
-// requests for state sync and recenet blocks sync.
+// requests for state sync and recenet blocks sync. BalanceRequest channel
+// should be read by the validating node to answer balance queries received on
+// either port.
 type Node struct {
 	ActionGateway      chan []byte                   // Sends actions to swell engine
 	BlockEvents        chan []byte                   // receive block events from swell engine
 	SyncRequest        chan SyncRequest              // sends sync requests to swell engine
 	TopologyRequest    chan *socket.SignedConnection // sends request for topology
+	BalanceRequest     chan BalanceRequest           // sends balance queries to swell engine
 	Statement          chan []byte
 	config             *Config
 	gatewayConnections map[crypto.Token]*socket.SignedConnection
@@ -100,6 +103,13 @@ type SyncRequest struct {
 	Conn  *socket.CachedConnection
 }
 
+// BalanceRequest defines a query for the balance of a token. The response
+// should be sent to the connection.
+type BalanceRequest struct {
+	Token crypto.Token
+	Conn  *socket.SignedConnection
+}
+
 // Run starts a relay network. It returns a Node and an error. On cancelation
 // of the context, the entire relay network is graciously shutdown.
 func Run(ctx context.Context, cfg *Config) (*Node, error) {
@@ -109,6 +119,7 @@ func Run(ctx context.Context, cfg *Config) (*Node, error) {
 		BlockEvents:     make(chan []byte),
 		SyncRequest:     make(chan SyncRequest),
 		TopologyRequest: make(chan *socket.SignedConnection),
+		BalanceRequest:  make(chan BalanceRequest),
 		config:          cfg,
 	}
 
@@ -158,7 +169,7 @@ func Run(ctx context.Context, cfg *Config) (*Node, error) {
 			case conn := <-newGateway:
 				if conn != nil {
 					n.gatewayConnections[conn.Token] = conn
-					go WaitForProtocolActions(conn, endGateway, action)
+					go WaitForProtocolActions(conn, endGateway, action, n.BalanceRequest)
 				}
 			case proposed := <-action:
 				if len(proposed) > 0 {
@@ -220,7 +231,7 @@ func Run(ctx context.Context, cfg *Config) (*Node, error) {
 					conn.Close()
 					continue
 				}
-				go WaitForOutgoingSyncRequest(trustedConn, newBlockListener, dropConnection, action, n.TopologyRequest)
+				go WaitForOutgoingSyncRequest(trustedConn, newBlockListener, dropConnection, action, n.TopologyRequest, n.BalanceRequest)
 			} else {
 				slog.Warn("poa outgoing listener error", "error", err)
 				return
@@ -232,9 +243,10 @@ func Run(ctx context.Context, cfg *Config) (*Node, error) {
 }
 
 // WaitForProtocolActions reads proposed actions from a connection and sends them
-// to the action channel. If the connection is terminated, it sends the connection
-// token to the terminate channel.
-func WaitForProtocolActions(conn *socket.SignedConnection, terminate chan crypto.Token, action chan []byte) {
+// to the action channel. Balance queries are sent to the balance channel. If the
+// connection is terminated, it sends the connection token to the terminate
+// channel.
+func WaitForProtocolActions(conn *socket.SignedConnection, terminate chan crypto.Token, action chan []byte, balance chan BalanceRequest) {
 	for {
 		data, err := conn.Read()
 		if err != nil || len(data) < 2 {
@@ -247,6 +259,14 @@ func WaitForProtocolActions(conn *socket.SignedConnection, terminate chan crypto
 			terminate <- conn.Token
 			return
 		}
+		if data[0] == messages.MsgBalanceRequest {
+			if token := messages.ParseBalanceRequest(data); token != crypto.ZeroToken {
+				balance <- BalanceRequest{Token: token, Conn: conn}
+			} else {
+				conn.Send([]byte{messages.MsgError})
+			}
+			continue
+		}
 		action <- data
 	}
 }
@@ -254,7 +274,7 @@ func WaitForProtocolActions(conn *socket.SignedConnection, terminate chan crypto
 // WaitForOutgoingSyncRequest reads a sync request from a connection and sends
 // it to the sync request channel. If it is not a valid request, if closes the
 // conection and returns without sending anything to outgoing channel.
-func WaitForOutgoingSyncRequest(conn *socket.SignedConnection, outgoing chan SyncRequest, drop chan crypto.Token, action chan []byte, topology chan *socket.SignedConnection) {
+func WaitForOutgoingSyncRequest(conn *socket.SignedConnection, outgoing chan SyncRequest, drop chan crypto.Token, action chan []byte, topology chan *socket.SignedConnection, balance chan BalanceRequest) {
 	if conn == nil {
 		slog.Error("relay node synchronization: nil connection")
 		return
@@ -289,6 +309,12 @@ func WaitForOutgoingSyncRequest(conn *socket.SignedConnection, outgoing chan Syn
 			cached := socket.NewCachedConnection(conn)
 			cached.Ready()
 			outgoing <- SyncRequest{Conn: cached, Epoch: 1<<64 - 1}
+		} else if data[0] == messages.MsgBalanceRequest {
+			if token := messages.ParseBalanceRequest(data); token != crypto.ZeroToken {
+				balance <- BalanceRequest{Token: token, Conn: conn}
+			} else {
+				conn.Send([]byte{messages.MsgError})
+			}
 		} else {
 			conn.Send([]byte{messages.MsgError})
 		}
@@ -36,8 +36,10 @@ type Sealed struct {
 }
 
 type Seal struct {
-	Epoch  uint64
-	Origin *socket.SignedConnection
+	Epoch      uint64
+	BlockEpoch uint64
+	BlockHash  crypto.Hash
+	Origin     *socket.SignedConnection
 }
 
 type SealOnBlock struct {
@@ -58,6 +60,11 @@ func (v *ActionVault) Commit(hash crypto.Hash) {
 	v.commit <- hash
 }
 
+// Invalidate marks a sealed action as invalidated by the block commit.
+func (v *ActionVault) Invalidate(hash crypto.Hash) {
+	v.invalidate <- hash
+}
+
 type PendingUpdate struct {
 	hash   crypto.Hash
 	action byte
@@ -81,6 +88,10 @@ type ActionVault struct {
 	seal chan SealOnBlock
 	// channel to mark actions as commit
 	commit chan crypto.Hash
+	// channel to mark actions as invalidated
+	invalidate chan crypto.Hash
+	// credentials to sign receipts sent to the origin of actions
+	credentials crypto.PrivateKey
 	// channel to pop actions from the vault
 	Pop chan []byte
 	// channel to push new actions into the vault
@@ -91,7 +102,7 @@ type ActionVault struct {
 
 func NewActionVaultNoReply(ctx context.Context, epoch uint64, action chan []byte) *ActionVault {
 	propose := make(chan *Propose)
-	vault := NewActionVault(ctx, epoch, propose)
+	vault := NewActionVault(ctx, epoch, propose, crypto.ZeroPrivateKey)
 	go func() {
 		for {
 			select {
@@ -107,16 +118,22 @@ func NewActionVaultNoReply(ctx context.Context, epoch uint64, action chan []byte
 	return vault
 }
 
-func NewActionVault(ctx context.Context, epoch uint64, actions chan *Propose) *ActionVault {
+// NewActionVault returns a new action vault clocked for the specified epoch.
+// Receipts of the status of actions are signed with credentials and sent to the
+// connection that proposed them.
+func NewActionVault(ctx context.Context, epoch uint64, actions chan *Propose, credentials crypto.PrivateKey) *ActionVault {
 	vault := ActionVault{
-		clock:   epoch,
-		pending: make(map[crypto.Hash]*Pending),
-		epoch:   make([][]crypto.Hash, 0),
-		seal:    make(chan SealOnBlock),
-		sealed:  make(map[crypto.Hash]Seal),
-		Pop:     make(chan []byte, 1),
-		Push:    actions,
-		timer:   make(chan struct{}),
+		clock:       epoch,
+		pending:     make(map[crypto.Hash]*Pending),
+		epoch:       make([][]crypto.Hash, 0),
+		seal:        make(chan SealOnBlock),
+		sealed:      make(map[crypto.Hash]Seal),
+		commit:      make(chan crypto.Hash),
+		invalidate:  make(chan crypto.Hash),
+		credentials: credentials,
+		Pop:         make(chan []byte, 1),
+		Push:        actions,
+		timer:       make(chan struct{}),
 	}
 	for n := 0; n < 2*MaxActionDelay; n++ {
 		vault.epoch = append(vault.epoch, make([]crypto.Hash, 0))
@@ -153,6 +170,8 @@ func NewActionVault(ctx context.Context, epoch uint64, actions chan *Propose) *A
 					vault.sealAction(sealed.Action, sealed.Epoch, sealed.BlockHash)
 				case hash := <-vault.commit:
 					vault.commitAction(hash)
+				case hash := <-vault.invalidate:
+					vault.invalidateAction(hash)
 				}
 			} else {
 				// if there are actions to pop
@@ -167,12 +186,16 @@ func NewActionVault(ctx context.Context, epoch uint64, actions chan *Propose) *A
 						return
 					}
 					if !vault.push(data) {
-						data.Conn.Send([]byte{messages.MsgError})
+						if data.Conn != nil {
+							data.Conn.Send([]byte{messages.MsgError})
+						}
 					}
 				case sealed := <-vault.seal:
 					vault.sealAction(sealed.Action, sealed.Epoch, sealed.BlockHash)
 				case hash := <-vault.commit:
 					vault.commitAction(hash)
+				case hash := <-vault.invalidate:
+					vault.invalidateAction(hash)
 				}
 			}
 		}
@@ -192,6 +215,8 @@ func (v *ActionVault) movenext() {
 		if pending.retries < MaxRetries {
 			pending.retries += 1
 			v.pending[pending.hash] = pending
+		} else {
+			v.sendReceipt(pending.origin, pending.hash, messages.ActionExpired, v.clock, crypto.ZeroHash)
 		}
 	}
 	for n := 0; n < ReservationTime-1; n++ {
@@ -199,6 +224,13 @@ func (v *ActionVault) movenext() {
 	}
 	v.sent[ReservationTime-1] = make(map[crypto.Hash]*Pending)
 	if v.clock > MaxActionDelay {
+		// drops pending actions too old to be sealed
+		for _, hash := range v.epoch[0] {
+			if pending, ok := v.pending[hash]; ok {
+				delete(v.pending, hash)
+				v.sendReceipt(pending.origin, hash, messages.ActionExpired, v.clock, crypto.ZeroHash)
+			}
+		}
 		v.epoch = append(v.epoch[1:], make([]crypto.Hash, 0))
 		v.committed = append(v.committed[1:], make(map[crypto.Hash]struct{}))
 	} else {
@@ -209,7 +241,9 @@ func (v *ActionVault) movenext() {
 func (v *ActionVault) sealAction(action []byte, blockEpoch uint64, blockHash crypto.Hash) {
 	hash := crypto.Hasher(action)
 	seal := Seal{
-		Epoch: actions.GetEpochFromByteArray(action),
+		Epoch:      actions.GetEpochFromByteArray(action),
+		BlockEpoch: blockEpoch,
+		BlockHash:  blockHash,
 	}
 	var pending *Pending
 	hasPending := false
@@ -228,8 +262,7 @@ func (v *ActionVault) sealAction(action []byte, blockEpoch uint64, blockHash cry
 	for r := 0; r < ReservationTime; r++ {
 		delete(v.sent[r], hash)
 	}
-	msg := messages.SealedAction(hash, blockEpoch, blockHash)
-	pending.origin.Send(msg)
+	v.sendReceipt(pending.origin, hash, messages.ActionSealed, blockEpoch, blockHash)
 }
 
 func (v *ActionVault) commitAction(hash crypto.Hash) {
@@ -240,15 +273,40 @@ func (v *ActionVault) commitAction(hash crypto.Hash) {
 	}
 	delete(v.sealed, hash)
 	bucket := v.bucket(seal.Epoch)
-	if bucket < 0 || bucket >= ReservationTime {
-		slog.Error("ActionStore: commit called on unreserved action", "hash", hash)
+	if bucket < 0 || bucket >= len(v.committed) {
+		slog.Error("ActionStore: commit called on action out of range", "hash", hash)
+	} else {
+		v.committed[bucket][hash] = struct{}{}
+	}
+	v.sendReceipt(seal.Origin, hash, messages.ActionCommitted, seal.BlockEpoch, seal.BlockHash)
+}
+
+// invalidateAction forgets a sealed action invalidated by the block commit and
+// informs the connection of the action status.
+func (v *ActionVault) invalidateAction(hash crypto.Hash) {
+	seal, ok := v.sealed[hash]
+	if !ok {
+		slog.Warn("ActionStore: invalidate called on unsealed action", "hash", hash)
+		return
+	}
+	delete(v.sealed, hash)
+	v.sendReceipt(seal.Origin, hash, messages.ActionInvalidated, seal.BlockEpoch, seal.BlockHash)
+}
+
+// sendReceipt sends a signed receipt of the action status to the connection
+// that proposed the action, if any.
+func (v *ActionVault) sendReceipt(origin *socket.SignedConnection, hash crypto.Hash, status byte, epoch uint64, blockHash crypto.Hash) {
+	if origin == nil {
 		return
 	}
-	v.committed[bucket][hash] = struct{}{}
-	if seal.Origin != nil {
-		msg := append([]byte{messages.MsgActionCommit}, hash[:]...)
-		seal.Origin.Send(msg)
+	receipt := messages.ActionReceipt{
+		Action:    hash,
+		Status:    status,
+		Epoch:     epoch,
+		BlockHash: blockHash,
 	}
+	receipt.Sign(v.credentials)
+	origin.Send(receipt.Serialize())
 }
 
 // sentAction moves the pending action from pending hashmap to sent hashmap
@@ -307,7 +365,7 @@ func (v *ActionVault) bucket(epoch uint64) int {
 	// first epoch in the bucket
 	firstBucketEpoch := 0
 	if v.clock > MaxActionDelay {
-		firstBucketEpoch = int(epoch) - MaxActionDelay
+		firstBucketEpoch = int(v.clock) - MaxActionDelay
 	}
 	return int(epoch) - firstBucketEpoch
 }
@@ -316,8 +374,8 @@ func (v *ActionVault) push(propose *Propose) bool {
 	if propose == nil || len(propose.Data) == 0 {
 		return false // invalid
 	}
-	action := actions.ParseAction(propose.Data)
-	if action == nil {
+	action, err := actions.ParseAction(propose.Data)
+	if err != nil {
 		fmt.Println("1 ruim")
 		return false // invalid
 	}
@@ -28,7 +28,8 @@ func TestActionVault(t *testing.T) {
 	conn1, conn2 := socket.CreateConnectionPair("node", 7400)
 	fmt.Println("ok")
 	propose := make(chan *Propose)
-	v := NewActionVault(context.Background(), 1, propose)
+	_, credentials := crypto.RandomAsymetricKey()
+	v := NewActionVault(context.Background(), 1, propose, credentials)
 	if v == nil {
 		t.Fatal("NewActionVault returned nil")
 	}
@@ -59,9 +60,17 @@ func TestActionVault(t *testing.T) {
 		Action:    data,
 	}
 	resp, _ = conn2.Read()
-	_, epochSeal, _ := messages.ParseSealedAction(resp)
-	if epochSeal != 2 {
+	receipt := messages.ParseActionReceipt(resp)
+	if receipt == nil || receipt.Status != messages.ActionSealed || receipt.Epoch != 2 {
 		t.Fatal("did not seal", resp)
 	}
-
+	if !receipt.Gateway.Equal(credentials.PublicKey()) || !receipt.Action.Equal(crypto.Hasher(data)) {
+		t.Fatal("unexpected seal receipt", receipt)
+	}
+	v.Commit(crypto.Hasher(data))
+	resp, _ = conn2.Read()
+	receipt = messages.ParseActionReceipt(resp)
+	if receipt == nil || receipt.Status != messages.ActionCommitted || receipt.Epoch != 2 || !receipt.BlockHash.Equal(crypto.Hasher(data)) {
+		t.Fatal("did not commit", resp)
+	}
 }
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"container/heap"
+	"math/bits"
+)
+
+// Sides of the priority queue of available actions. Actions are served from
+// the highest side and evicted from the lowest side.
+const (
+	highest = 0
+	lowest  = 1
+)
+
+// precedes returns true if action a is served before action b: a pays a higher
+// fee per byte, or the same fee per byte and is dated to an older epoch, or is
+// dated to the same epoch and arrived first.
+func precedes(a, b *StoredAction) bool {
+	// a.fee / len(a.Data) > b.fee / len(b.Data) without loss of precision
+	aHigh, aLow := bits.Mul64(a.fee, uint64(len(b.Data)))
+	bHigh, bLow := bits.Mul64(b.fee, uint64(len(a.Data)))
+	if aHigh != bHigh {
+		return aHigh > bHigh
+	}
+	if aLow != bLow {
+		return aLow > bLow
+	}
+	if a.Epoch != b.Epoch {
+		return a.Epoch < b.Epoch
+	}
+	return a.sequence < b.sequence
+}
+
+// actionHeap is a heap of stored actions ordered by precedes, from the top
+// priority action for the highest side and from the bottom priority action for
+// the lowest side. The position of each action on the heap is kept in its
+// index for the side, -1 if not on the heap.
+type actionHeap struct {
+	side    int
+	actions []*StoredAction
+}
+
+func newActionHeap(side int) *actionHeap {
+	return &actionHeap{side: side, actions: make([]*StoredAction, 0)}
+}
+
+func (h *actionHeap) Len() int {
+	return len(h.actions)
+}
+
+func (h *actionHeap) Less(i, j int) bool {
+	if h.side == highest {
+		return precedes(h.actions[i], h.actions[j])
+	}
+	return precedes(h.actions[j], h.actions[i])
+}
+
+func (h *actionHeap) Swap(i, j int) {
+	h.actions[i], h.actions[j] = h.actions[j], h.actions[i]
+	h.actions[i].index[h.side] = i
+	h.actions[j].index[h.side] = j
+}
+
+func (h *actionHeap) Push(x any) {
+	action := x.(*StoredAction)
+	action.index[h.side] = len(h.actions)
+	h.actions = append(h.actions, action)
+}
+
+func (h *actionHeap) Pop() any {
+	last := len(h.actions) - 1
+	action := h.actions[last]
+	h.actions[last] = nil
+	h.actions = h.actions[:last]
+	action.index[h.side] = -1
+	return action
+}
+
+// top returns the action at the top of the heap or nil if the heap is empty.
+func (h *actionHeap) top() *StoredAction {
+	if len(h.actions) == 0 {
+		return nil
+	}
+	return h.actions[0]
+}
+
+// add adds the action to the heap if not already there.
+func (h *actionHeap) add(action *StoredAction) {
+	if action.index[h.side] < 0 {
+		heap.Push(h, action)
+	}
+}
+
+// remove removes the action from the heap if it is there.
+func (h *actionHeap) remove(action *StoredAction) {
+	if action.index[h.side] >= 0 {
+		heap.Remove(h, action.index[h.side])
+	}
+}
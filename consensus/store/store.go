@@ -1,9 +1,17 @@
 /*
 Package store implements a store for actions.
 
-The store is a FIFO queue of actions ordered by epoch. Actions from oldest
-epochs are served first. Actions from epochs older than MaxActionDelay are
-discarded.
+The store is a priority queue of actions ordered by fee per byte. Actions
+paying the highest fee per byte are served first, ties are served by oldest
+epoch and then by order of arrival. Actions from epochs older than
+MaxActionDelay are discarded. A pending transfer carrying a nonce is replaced by
+a transfer from the same wallet with the same nonce and a higher fee, and is not
+served while the transfer with the preceding nonce is still available.
+
+The store is bounded. Each sender can have at most MaxSenderActions pending
+actions and available actions are limited to MaxStoreSize bytes in total. When
+the store is full the action with the lowest priority is evicted to make room
+for a new action of higher priority, otherwise the new action is rejected.
 
 The store is used by the consensus engine to store actions received from the
 gateway. The consensus engine reads actions from the store and sends them to
@@ -19,41 +27,99 @@ package store
 import (
 	"context"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/protocol/actions"
 )
 
 const (
-	MaxActionDelay = 100 // messages outside current epoch +/- MaxActionDelay are discarded
-	mark           = 0
-	exclude        = 1
-	unmark         = 2
+	MaxActionDelay   = 100     // messages outside current epoch +/- MaxActionDelay are discarded
+	MaxSenderActions = 256     // pending (available or reserved) actions per sender
+	MaxStoreSize     = 1 << 26 // total bytes of available actions
+	mark             = 0
+	exclude          = 1
+	unmark           = 2
 )
 
-// ActionStore is a store for actions. It is a FIFO queue of actions ordered by
-// epoch. Actions from oldest epochs are served first. Actions from epochs older
-// than MaxActionDelay are discarded.
+// ActionStore is a store for actions. It is a priority queue of actions ordered
+// by fee per byte. Actions from epochs older than MaxActionDelay are discarded.
 // Users should use Push and Pop channels to push and pop actions from the store.
 // Users should use Mark, Unmark and Exclude methods  to mark, unmark and exclude
 // actions.
 // Users should use Epoch channel to update the store epoch.
+// Users should use Metrics to monitor pending actions.
 type ActionStore struct {
-	clock    uint64
-	Live     bool
-	epoch    [][]crypto.Hash
-	data     map[crypto.Hash]*StoredAction
-	reserved map[crypto.Hash]*StoredAction
-	Pop      chan *StoredAction
-	Push     chan []byte
-	evolve   chan struct{}
-	updates  chan hashaction
+	clock     uint64
+	Live      bool
+	epoch     [][]crypto.Hash
+	data      map[crypto.Hash]*StoredAction
+	reserved  map[crypto.Hash]*StoredAction
+	nonces    map[nonceKey]crypto.Hash
+	senders   map[crypto.Hash]int
+	serving   *actionHeap
+	evicting  *actionHeap
+	size      int
+	maxSize   int
+	maxSender int
+	sequence  uint64
+	metrics   storeMetrics
+	Pop       chan *StoredAction
+	Push      chan []byte
+	evolve    chan struct{}
+	updates   chan hashaction
 }
 
 type StoredAction struct {
-	Epoch  uint64
-	Action actions.Action
-	Data   []byte
+	Epoch    uint64
+	Action   actions.Action
+	Data     []byte
+	hash     crypto.Hash
+	fee      uint64
+	sender   crypto.Hash
+	sequence uint64
+	index    [2]int
+}
+
+// StoreMetrics is a snapshot of the pending actions of the store. Available
+// actions can be served, Reserved actions were served or marked and are pending
+// exclusion, Size is the total bytes of available actions. Evicted, Rejected and
+// Expired count actions dropped since the store was created: evicted to make
+// room for an action of higher priority, rejected for a full store or a sender
+// over its limit, and expired for being older than MaxActionDelay.
+type StoreMetrics struct {
+	Available int
+	Reserved  int
+	Size      int
+	Evicted   uint64
+	Rejected  uint64
+	Expired   uint64
+}
+
+// storeMetrics are the metrics of the store updated by the store goroutine
+// and read concurrently by Metrics.
+type storeMetrics struct {
+	available atomic.Int64
+	reserved  atomic.Int64
+	size      atomic.Int64
+	evicted   atomic.Uint64
+	rejected  atomic.Uint64
+	expired   atomic.Uint64
+}
+
+// nonceKey identifies a nonce bearing action by its sender and nonce.
+type nonceKey struct {
+	token crypto.Token
+	nonce uint64
+}
+
+// getNonceKey returns the nonce key of the action and true if the action
+// carries a nonce.
+func getNonceKey(action actions.Action) (nonceKey, bool) {
+	if transfer, ok := action.(*actions.Transfer); ok && transfer.Nonce > 0 {
+		return nonceKey{token: transfer.From, nonce: transfer.Nonce}, true
+	}
+	return nonceKey{}, false
 }
 
 // hashaction is used to mark, unmark or exclude an action from the store
@@ -70,18 +136,30 @@ type hashaction struct {
 // actions.
 // Users should use Epoch channel to update the store epoch.
 func NewActionStore(ctx context.Context, epoch uint64, actions chan []byte) *ActionStore {
+	return newActionStore(ctx, epoch, actions, MaxStoreSize, MaxSenderActions)
+}
+
+// newActionStore returns a new action store limited to maxSize bytes of
+// available actions and maxSender pending actions per sender.
+func newActionStore(ctx context.Context, epoch uint64, actions chan []byte, maxSize, maxSender int) *ActionStore {
 	if actions == nil {
 		actions = make(chan []byte)
 	}
 	store := &ActionStore{
-		Live:     true,
-		data:     make(map[crypto.Hash]*StoredAction),
-		reserved: make(map[crypto.Hash]*StoredAction),
-		epoch:    make([][]crypto.Hash, 2*MaxActionDelay+1),
-		Pop:      make(chan *StoredAction),
-		Push:     actions,
-		evolve:   make(chan struct{}),
-		updates:  make(chan hashaction),
+		Live:      true,
+		data:      make(map[crypto.Hash]*StoredAction),
+		reserved:  make(map[crypto.Hash]*StoredAction),
+		nonces:    make(map[nonceKey]crypto.Hash),
+		senders:   make(map[crypto.Hash]int),
+		serving:   newActionHeap(highest),
+		evicting:  newActionHeap(lowest),
+		maxSize:   maxSize,
+		maxSender: maxSender,
+		epoch:     make([][]crypto.Hash, 2*MaxActionDelay+1),
+		Pop:       make(chan *StoredAction),
+		Push:      actions,
+		evolve:    make(chan struct{}),
+		updates:   make(chan hashaction),
 	}
 	for n := 0; n < len(store.epoch); n++ {
 		store.epoch[n] = make([]crypto.Hash, 0)
@@ -96,8 +174,9 @@ func NewActionStore(ctx context.Context, epoch uint64, actions chan []byte) *Act
 		}()
 		done := ctx.Done()
 		for {
-			// if store is empty wait for new action
-			if len(store.data) == 0 {
+			store.publish()
+			// if no action can be served wait for new action
+			if store.serving.Len() == 0 {
 				select {
 				case <-done:
 					return
@@ -111,12 +190,15 @@ func NewActionStore(ctx context.Context, epoch uint64, actions chan []byte) *Act
 					store.update(update)
 				}
 			} else {
+				// the top action is only reserved once it is actually served
+				hash, next := store.peek()
 				select {
 				case <-done:
 					return
 				case <-store.evolve:
 					store.moveNext()
-				case store.Pop <- store.pop():
+				case store.Pop <- next:
+					store.reserve(hash)
 				case data := <-store.Push:
 					if len(data) > 0 {
 						store.push(data)
@@ -133,17 +215,99 @@ func NewActionStore(ctx context.Context, epoch uint64, actions chan []byte) *Act
 func (a *ActionStore) update(update hashaction) {
 	if update.action == mark {
 		if stored, ok := a.data[update.hash]; ok {
+			a.withdraw(stored)
 			a.reserved[update.hash] = stored
-			delete(a.data, update.hash)
 		}
 	} else if update.action == unmark {
 		if reserved, ok := a.reserved[update.hash]; ok {
-			a.data[update.hash] = reserved
 			delete(a.reserved, update.hash)
+			a.makeAvailable(reserved)
 		}
 	} else if update.action == exclude {
-		delete(a.reserved, update.hash)
-		delete(a.data, update.hash)
+		if stored, ok := a.data[update.hash]; ok {
+			a.withdraw(stored)
+			a.drop(stored)
+		} else if stored, ok := a.reserved[update.hash]; ok {
+			delete(a.reserved, update.hash)
+			a.drop(stored)
+		}
+	}
+}
+
+// makeAvailable adds the stored action to the available actions. The action
+// is served unless held by its preceding nonce, and holds its succeeding
+// nonce.
+func (a *ActionStore) makeAvailable(stored *StoredAction) {
+	a.data[stored.hash] = stored
+	a.size += len(stored.Data)
+	a.evicting.add(stored)
+	if !a.held(stored) {
+		a.serving.add(stored)
+	}
+	if next := a.successor(stored); next != nil {
+		a.serving.remove(next)
+	}
+}
+
+// withdraw removes the stored action from the available actions and releases
+// its succeeding nonce.
+func (a *ActionStore) withdraw(stored *StoredAction) {
+	delete(a.data, stored.hash)
+	a.size -= len(stored.Data)
+	a.serving.remove(stored)
+	a.evicting.remove(stored)
+	if next := a.successor(stored); next != nil && !a.held(next) {
+		a.serving.add(next)
+	}
+}
+
+// drop forgets a stored action that is neither available nor reserved.
+func (a *ActionStore) drop(stored *StoredAction) {
+	a.forgetNonce(stored.hash, stored)
+	if count := a.senders[stored.sender]; count > 1 {
+		a.senders[stored.sender] = count - 1
+	} else {
+		delete(a.senders, stored.sender)
+	}
+}
+
+// held returns true if the stored action carries a nonce and the action with
+// the preceding nonce of the same sender is available: serving it first would
+// get it rejected by the validator.
+func (a *ActionStore) held(stored *StoredAction) bool {
+	key, ok := getNonceKey(stored.Action)
+	if !ok || key.nonce < 2 {
+		return false
+	}
+	previous, ok := a.nonces[nonceKey{token: key.token, nonce: key.nonce - 1}]
+	if !ok {
+		return false
+	}
+	_, ok = a.data[previous]
+	return ok
+}
+
+// successor returns the available action with the succeeding nonce of the
+// same sender of the stored action, or nil if there is none.
+func (a *ActionStore) successor(stored *StoredAction) *StoredAction {
+	key, ok := getNonceKey(stored.Action)
+	if !ok {
+		return nil
+	}
+	next, ok := a.nonces[nonceKey{token: key.token, nonce: key.nonce + 1}]
+	if !ok {
+		return nil
+	}
+	return a.data[next]
+}
+
+// forgetNonce removes the nonce entry of the stored action if it still points
+// to the given hash.
+func (a *ActionStore) forgetNonce(hash crypto.Hash, stored *StoredAction) {
+	if key, ok := getNonceKey(stored.Action); ok {
+		if existing, ok := a.nonces[key]; ok && existing.Equal(hash) {
+			delete(a.nonces, key)
+		}
 	}
 }
 
@@ -163,37 +327,34 @@ func (a *ActionStore) Exlude(hash crypto.Hash) {
 	a.updates <- hashaction{hash, exclude}
 }
 
-// pop implements the pop operation of the store. The Pop request is sent
-// to the Pop channel. pop returns nil if the store is empty. otherwise it
-// returns the oldest action in the store (ordered by epoch and order of arrival).
-func (a *ActionStore) pop() *StoredAction {
-	if len(a.data) == 0 {
+// peek returns the next action to be served to the Pop channel together with
+// its hash. peek returns nil if no action can be served. otherwise it returns
+// the available action with highest priority. The action remains available
+// until reserved.
+func (a *ActionStore) peek() (crypto.Hash, *StoredAction) {
+	next := a.serving.top()
+	if next == nil {
 		slog.Error("ActionStore: pop from empty store")
-		return nil
+		return crypto.ZeroHash, nil
 	}
-	for n, hashes := range a.epoch {
-		if len(hashes) > 0 {
-			// will purge epoch[n] of excluded actions until it finds an available
-			// non reserved action for the epoch
-			cleaned := make([]crypto.Hash, 0, len(hashes))
-			for m, hash := range hashes {
-				if action, ok := a.data[hash]; ok {
-					delete(a.data, hash)
-					a.reserved[hash] = action
-					a.epoch[n] = append(cleaned, hashes[m:]...)
-					return action
-				} else if _, ok := a.reserved[hash]; ok {
-					cleaned = append(cleaned, hash)
-				}
-			}
-		}
+	return next.hash, next
+}
+
+// reserve moves a served action from the available to the reserved actions.
+func (a *ActionStore) reserve(hash crypto.Hash) {
+	if action, ok := a.data[hash]; ok {
+		a.withdraw(action)
+		a.reserved[hash] = action
 	}
-	return nil
 }
 
 // push implements the push operation of the store. The Push request is sent
 // to the Push channel. push adds the action to the store if the action epoch
-// is within the MaxActionDelay range of the current epoch.
+// is within the MaxActionDelay range of the current epoch. If the action
+// carries a nonce already used by an available action of the same sender, the
+// action replaces the available one if it pays a higher fee and is discarded
+// otherwise. Other actions are rejected if the sender has MaxSenderActions
+// pending actions or if the store is full of actions of higher priority.
 func (a *ActionStore) push(data []byte) {
 	hash := crypto.Hasher(data)
 	if _, ok := a.data[hash]; ok {
@@ -206,8 +367,8 @@ func (a *ActionStore) push(data []byte) {
 	if epoch == 0 || epoch+MaxActionDelay < a.clock || epoch > a.clock+MaxActionDelay {
 		return
 	}
-	action := actions.ParseAction(data)
-	if action == nil {
+	action, err := actions.ParseAction(data)
+	if err != nil {
 		return
 	}
 	firstBucketEpoch := 0
@@ -219,26 +380,139 @@ func (a *ActionStore) push(data []byte) {
 		slog.Error("ActionStore: bucket out of range", "bucket", bucket, "epoch", epoch, "current", a.clock)
 		return
 	}
+	stored := &StoredAction{
+		Epoch:    epoch,
+		Action:   action,
+		Data:     data,
+		fee:      actions.GetFeeFromBytes(data),
+		sender:   getSender(action),
+		sequence: a.sequence,
+		hash:     hash,
+		index:    [2]int{-1, -1},
+	}
+	a.sequence += 1
+	var replaced *StoredAction
+	key, hasNonce := getNonceKey(action)
+	if hasNonce {
+		if existing, ok := a.nonces[key]; ok {
+			if available, ok := a.data[existing]; ok {
+				if action.FeePaid() <= available.Action.FeePaid() {
+					return
+				}
+				replaced = available
+			} else if reserved, ok := a.reserved[existing]; ok && action.FeePaid() <= reserved.Action.FeePaid() {
+				return
+			}
+		}
+	}
+	if replaced == nil && a.senders[stored.sender] >= a.maxSender {
+		a.metrics.rejected.Add(1)
+		slog.Debug("ActionStore: sender over pending actions limit", "sender", stored.sender)
+		return
+	}
+	if !a.makeRoom(stored, replaced) {
+		a.metrics.rejected.Add(1)
+		return
+	}
+	if replaced != nil {
+		a.withdraw(replaced)
+		a.drop(replaced)
+	}
 	a.epoch[bucket] = append(a.epoch[bucket], hash)
-	a.data[hash] = &StoredAction{
-		Epoch:  epoch,
-		Action: action,
-		Data:   data,
+	a.senders[stored.sender] += 1
+	if hasNonce {
+		a.nonces[key] = hash
 	}
+	a.makeAvailable(stored)
 }
 
-// moveNext moves the store to the next epoch. It deletes all actions from
-// epochs older than MaxActionDelay.
+// makeRoom evicts available actions of lowest priority until the stored action
+// fits within the maximum size of the store, not counting the action it
+// replaces if any. Only actions preceded by the stored action are evicted.
+// Returns false, evicting nothing, if the stored action does not fit.
+func (a *ActionStore) makeRoom(stored, replaced *StoredAction) bool {
+	free := a.maxSize - a.size
+	if replaced != nil {
+		free += len(replaced.Data)
+	}
+	victims := make([]*StoredAction, 0)
+	for free < len(stored.Data) {
+		lowest := a.evicting.top()
+		if lowest == nil || !precedes(stored, lowest) {
+			break
+		}
+		a.evicting.remove(lowest)
+		victims = append(victims, lowest)
+		if lowest != replaced {
+			free += len(lowest.Data)
+		}
+	}
+	if free < len(stored.Data) {
+		for _, victim := range victims {
+			a.evicting.add(victim)
+		}
+		return false
+	}
+	for _, victim := range victims {
+		if victim != replaced {
+			a.withdraw(victim)
+			a.drop(victim)
+			a.metrics.evicted.Add(1)
+		}
+	}
+	return true
+}
+
+// getSender returns the account paying for the action, that is, its first
+// debited wallet.
+func getSender(action actions.Action) crypto.Hash {
+	if payments := action.Payments(); payments != nil && len(payments.Debit) > 0 {
+		return payments.Debit[0].Account
+	}
+	return crypto.ZeroHash
+}
+
+// moveNext moves the store to the next epoch. It deletes all available and
+// reserved actions from epochs older than MaxActionDelay.
 func (a *ActionStore) moveNext() {
 	a.clock += 1
 	if a.clock > MaxActionDelay {
 		for _, hash := range a.epoch[0] {
-			delete(a.data, hash)
+			if stored, ok := a.data[hash]; ok {
+				a.withdraw(stored)
+				a.drop(stored)
+				a.metrics.expired.Add(1)
+			} else if stored, ok := a.reserved[hash]; ok {
+				delete(a.reserved, hash)
+				a.drop(stored)
+				a.metrics.expired.Add(1)
+			}
 		}
 		a.epoch = append(a.epoch[1:], make([]crypto.Hash, 0))
 	}
+	slog.Debug("ActionStore: pending actions", "epoch", a.clock, "available", len(a.data), "reserved", len(a.reserved), "size", a.size)
 }
 
 func (a *ActionStore) NextEpoch() {
 	a.evolve <- struct{}{}
 }
+
+// publish updates the metrics of pending actions read by Metrics.
+func (a *ActionStore) publish() {
+	a.metrics.available.Store(int64(len(a.data)))
+	a.metrics.reserved.Store(int64(len(a.reserved)))
+	a.metrics.size.Store(int64(a.size))
+}
+
+// Metrics returns a snapshot of the pending actions of the store. It is safe
+// to call concurrently with the store operations.
+func (a *ActionStore) Metrics() StoreMetrics {
+	return StoreMetrics{
+		Available: int(a.metrics.available.Load()),
+		Reserved:  int(a.metrics.reserved.Load()),
+		Size:      int(a.metrics.size.Load()),
+		Evicted:   a.metrics.evicted.Load(),
+		Rejected:  a.metrics.rejected.Load(),
+		Expired:   a.metrics.expired.Load(),
+	}
+}
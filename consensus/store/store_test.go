@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+)
+
+func TestActionStoreNonceReplacement(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewActionStore(ctx, 1, nil)
+	from, key := crypto.RandomAsymetricKey()
+	transfer := func(nonce, fee uint64) []byte {
+		action := actions.Transfer{
+			TimeStamp: 1,
+			Nonce:     nonce,
+			From:      from,
+			To:        []crypto.TokenValue{{Token: from, Value: 0}},
+			Fee:       fee,
+		}
+		action.Sign(key)
+		return action.Serialize()
+	}
+	store.Push <- transfer(1, 5)
+	store.Push <- transfer(1, 4) // lower fee is discarded
+	store.Push <- transfer(1, 9) // higher fee replaces
+	store.Push <- transfer(2, 1)
+	first := <-store.Pop
+	if first.Action.FeePaid() != 9 {
+		t.Fatalf("expected replacement with fee 9, got fee %d", first.Action.FeePaid())
+	}
+	second := <-store.Pop
+	if second.Action.(*actions.Transfer).Nonce != 2 {
+		t.Fatalf("expected nonce 2, got %d", second.Action.(*actions.Transfer).Nonce)
+	}
+	// an action already served cannot be withdrawn: a lower fee alternative is
+	// discarded, a higher fee one is kept and the validator accepts only one
+	store.Push <- transfer(2, 1)
+	store.Push <- transfer(2, 3)
+	store.Push <- transfer(3, 1)
+	third := <-store.Pop
+	if third.Action.FeePaid() != 3 {
+		t.Fatalf("expected alternative with fee 3, got fee %d", third.Action.FeePaid())
+	}
+	fourth := <-store.Pop
+	if fourth.Action.(*actions.Transfer).Nonce != 3 {
+		t.Fatalf("expected nonce 3, got %d", fourth.Action.(*actions.Transfer).Nonce)
+	}
+}
+
+// signedTransfer returns a signed transfer of a new random wallet.
+func signedTransfer(nonce, fee uint64) []byte {
+	from, key := crypto.RandomAsymetricKey()
+	action := actions.Transfer{
+		TimeStamp: 1,
+		Nonce:     nonce,
+		From:      from,
+		To:        []crypto.TokenValue{{Token: from, Value: 0}},
+		Fee:       fee,
+	}
+	action.Sign(key)
+	return action.Serialize()
+}
+
+func TestActionStoreFeePriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewActionStore(ctx, 1, nil)
+	for _, fee := range []uint64{1, 5, 3, 5} {
+		store.Push <- signedTransfer(0, fee)
+	}
+	for _, fee := range []uint64{5, 5, 3, 1} {
+		if next := <-store.Pop; next.Action.FeePaid() != fee {
+			t.Fatalf("expected fee %d, got fee %d", fee, next.Action.FeePaid())
+		}
+	}
+}
+
+func TestActionStoreNonceOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewActionStore(ctx, 1, nil)
+	from, key := crypto.RandomAsymetricKey()
+	transfer := func(nonce, fee uint64) []byte {
+		action := actions.Transfer{TimeStamp: 1, Nonce: nonce, From: from, To: []crypto.TokenValue{{Token: from, Value: 0}}, Fee: fee}
+		action.Sign(key)
+		return action.Serialize()
+	}
+	// a higher fee does not serve a nonce before its predecessor
+	store.Push <- transfer(2, 9)
+	store.Push <- transfer(1, 1)
+	store.Push <- signedTransfer(0, 5)
+	for _, fee := range []uint64{5, 1, 9} {
+		if next := <-store.Pop; next.Action.FeePaid() != fee {
+			t.Fatalf("expected fee %d, got fee %d", fee, next.Action.FeePaid())
+		}
+	}
+}
+
+func TestActionStoreLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	size := len(signedTransfer(0, 1))
+	store := newActionStore(ctx, 1, nil, 2*size, 2)
+	from, key := crypto.RandomAsymetricKey()
+	transfer := func(nonce, fee uint64) []byte {
+		action := actions.Transfer{TimeStamp: 1, Nonce: nonce, From: from, To: []crypto.TokenValue{{Token: from, Value: 0}}, Fee: fee}
+		action.Sign(key)
+		return action.Serialize()
+	}
+	store.Push <- transfer(0, 1)
+	store.Push <- transfer(0, 2)
+	store.Push <- transfer(0, 3)       // sender over its limit
+	store.Push <- signedTransfer(0, 4) // evicts fee 1
+	store.Push <- signedTransfer(0, 1) // store full of higher priority
+	store.Push <- nil                  // waits for metrics to be published
+	metrics := store.Metrics()
+	if metrics.Available != 2 || metrics.Size != 2*size || metrics.Evicted != 1 || metrics.Rejected != 2 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+	first := <-store.Pop
+	if first.Action.FeePaid() != 4 {
+		t.Fatalf("expected fee 4, got fee %d", first.Action.FeePaid())
+	}
+	store.Push <- nil
+	if metrics := store.Metrics(); metrics.Available != 1 || metrics.Reserved != 1 {
+		t.Fatalf("unexpected metrics after pop %+v", metrics)
+	}
+	// the evicted action no longer counts against the sender limit
+	store.Exlude(crypto.Hasher(first.Data))
+	store.Push <- transfer(0, 5)
+	if next := <-store.Pop; next.Action.FeePaid() != 5 {
+		t.Fatalf("expected fee 5, got fee %d", next.Action.FeePaid())
+	}
+}
+
+func TestActionStoreExpireReserved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newActionStore(ctx, 1, nil, MaxStoreSize, 1)
+	from, key := crypto.RandomAsymetricKey()
+	transfer := func(epoch uint64) []byte {
+		action := actions.Transfer{TimeStamp: epoch, From: from, To: []crypto.TokenValue{{Token: from, Value: 0}}, Fee: 1}
+		action.Sign(key)
+		return action.Serialize()
+	}
+	store.Push <- transfer(1)
+	<-store.Pop // reserved and never marked
+	// the action of epoch 1 expires as the clock moves to epoch MaxActionDelay+2
+	epoch := uint64(MaxActionDelay + 2)
+	for n := uint64(0); n < epoch; n++ {
+		store.NextEpoch()
+	}
+	store.Push <- nil
+	if metrics := store.Metrics(); metrics.Reserved != 0 || metrics.Expired != 1 {
+		t.Fatalf("reserved action not expired %+v", metrics)
+	}
+	// the expired action no longer counts against the sender limit
+	store.Push <- transfer(epoch)
+	if next := <-store.Pop; next.Epoch != epoch {
+		t.Fatalf("expected action of epoch %d, got epoch %d", epoch, next.Epoch)
+	}
+}
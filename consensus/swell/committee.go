@@ -1,6 +1,7 @@
 package swell
 
 import (
+	"bytes"
 	"context"
 	"sort"
 
@@ -29,12 +30,7 @@ func (h TokenHashArray) Len() int {
 }
 
 func (h TokenHashArray) Less(i, j int) bool {
-	for n := 0; n < crypto.Size; n++ {
-		if h[i].Hash[n] < h[j].Hash[n] {
-			return true
-		}
-	}
-	return false
+	return bytes.Compare(h[i].Hash[:], h[j].Hash[:]) < 0
 }
 
 func (h TokenHashArray) Swap(i, j int) {
@@ -122,7 +118,13 @@ func BroadcastPercolationRule(nodecount int) socket.PercolationRule {
 	}
 }
 
-func sortCandidates(candidates map[crypto.Token]int, seed []byte, committeeSize int) []crypto.Token {
+// SortCandidates returns the order of the committee of a checksum window with
+// committeeSize seats from the weights of the permissioned candidates and the
+// consensus checksum hash as seed. Each unit of weight of a candidate is ranked
+// by its hash with the seed and seats are taken in rank order, cycling if there
+// are fewer units than seats. The order depends only on its arguments, so that
+// validators and light clients derive the same committee.
+func SortCandidates(candidates map[crypto.Token]int, seed []byte, committeeSize int) []crypto.Token {
 	hashes := make(TokenHashArray, 0)
 	for token, weight := range candidates {
 		for w := 1; w <= weight; w++ {
@@ -9,10 +9,12 @@ import (
 	"github.com/freehandle/breeze/consensus/bft"
 	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/consensus/messages"
+	"github.com/freehandle/breeze/consensus/permission"
 	"github.com/freehandle/breeze/consensus/relay"
 	"github.com/freehandle/breeze/consensus/store"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/middleware/admin"
+	"github.com/freehandle/breeze/protocol/state"
 	"github.com/freehandle/breeze/socket"
 	"github.com/freehandle/breeze/util"
 )
@@ -20,12 +22,16 @@ import (
 // SwellNetrworkConfiguration defines the parameters for the unerlying crypto
 // network running the swell protocol.
 type SwellNetworkConfiguration struct {
-	NetworkHash      crypto.Hash   // there should be a unique hash for each network
-	MaxPoolSize      int           // max number of validator in each hash consensus pool
-	MaxCommitteeSize int           // max number of validators in the checksum window
-	BlockInterval    time.Duration // time duration for each block
-	ChecksumWindow   int           // number of blocks in the checksum window
-	Permission       Permission    // permission rules to be a validator in the network
+	NetworkHash      crypto.Hash            // there should be a unique hash for each network
+	MaxPoolSize      int                    // max number of validator in each hash consensus pool
+	MaxCommitteeSize int                    // max number of validators in the checksum window
+	BlockInterval    time.Duration          // time duration for each block
+	ChecksumWindow   int                    // number of blocks in the checksum window
+	UnbondingWindows int                    // number of checksum windows for a withdraw to mature
+	MinFeePerByte    uint64                 // minimum fee per byte of action
+	TargetBlockSize  int                    // block size in bytes at which the base fee is stable
+	Issuance         state.IssuanceSchedule // block rewards for validators of the checksum window
+	Permission       Permission             // permission rules to be a validator in the network
 }
 
 // Permission is an interface that defines the rules for a validator
@@ -42,24 +48,47 @@ type BlockConsensusConfirmation struct {
 // ValidatorConfig defines the configuration for a validator node.
 type ValidatorConfig struct {
 	Credentials crypto.PrivateKey
-	WalletPath  string
+	// WalletPath should be empty for a memory based state OR should be a
+	// prefix for the files of the state. File based states keep a write ahead
+	// log of mutations on the mutations.log file under the prefix.
+	WalletPath string
+	// SnapshotPath should be empty for no state snapshots on disk OR should
+	// be a path to a folder where snapshots and diffs are kept
+	SnapshotPath string
+	// BlockPath should be empty for no blocks on disk OR should be a path to a
+	// folder where sealed and committed blocks are kept
+	BlockPath   string
 	SwellConfig SwellNetworkConfiguration
 	//Actions        *store.ActionStore
 	Relay          *relay.Node
 	Admin          *admin.Administration
 	Hostname       string
 	TrustedGateway []socket.TokenAddr
+	// Genesis should be nil for a genesis with a single funded wallet OR
+	// should be the shared genesis of the network. Syncing nodes verify the
+	// genesis hash of their peers against it.
+	Genesis *chain.Genesis
 }
 
 // const BlockInterval = time.Second
 
 // NewGenesisNode creates a new blockchain from genesis state (associated to the
-// given wallet), and starts a validating node interacting with the given relay
-// network.
+// given wallet, or to the genesis of the configuration if provided), and starts
+// a validating node interacting with the given relay network.
 func NewGenesisNode(ctx context.Context, wallet crypto.PrivateKey, config ValidatorConfig) *SwellNode {
 	token := config.Credentials.PublicKey()
+	var blockchain *chain.Blockchain
+	if config.Genesis != nil {
+		var err error
+		if blockchain, err = chain.BlockchainFromGenesis(config.Genesis, wallet, config.WalletPath); err != nil {
+			slog.Error("NewGenesisNode: invalid genesis", "err", err)
+			return nil
+		}
+	} else {
+		blockchain = chain.BlockchainFromGenesisState(wallet, config.WalletPath, config.SwellConfig.NetworkHash, config.SwellConfig.BlockInterval, config.SwellConfig.ChecksumWindow, config.SwellConfig.UnbondingWindows, config.SwellConfig.MinFeePerByte, config.SwellConfig.TargetBlockSize, config.SwellConfig.Issuance)
+	}
 	node := &SwellNode{
-		blockchain: chain.BlockchainFromGenesisState(wallet, config.WalletPath, config.SwellConfig.NetworkHash, config.SwellConfig.BlockInterval, config.SwellConfig.ChecksumWindow),
+		blockchain: blockchain,
 		actions:    store.NewActionStore(ctx, 1, config.Relay.ActionGateway),
 		//actions:     store.NewActionVaultNoReply(ctx, 1, config.Relay.ActionGateway),
 		credentials: config.Credentials,
@@ -72,6 +101,35 @@ func NewGenesisNode(ctx context.Context, wallet crypto.PrivateKey, config Valida
 		admin:    config.Admin,
 		hostname: config.Hostname,
 	}
+	node.blockchain.Punish = node.punish
+	node.blockchain.SetWindowWeights(1, node.validators.weights)
+	if config.SnapshotPath != "" {
+		if snapshots, err := chain.OpenSnapshotStore(config.SnapshotPath); err != nil {
+			slog.Error("NewGenesisNode: could not open snapshot store", "err", err)
+		} else {
+			node.blockchain.Snapshots = snapshots
+			if err := node.blockchain.WriteSnapshot(); err != nil {
+				slog.Error("NewGenesisNode: could not write genesis snapshot", "err", err)
+			}
+		}
+	}
+	if config.BlockPath != "" {
+		if blocks, err := chain.OpenBlockStore(config.BlockPath); err != nil {
+			slog.Error("NewGenesisNode: could not open block store", "err", err)
+		} else {
+			node.blockchain.Blocks = blocks
+		}
+	}
+	if config.WalletPath != "" {
+		if log, err := openMutationsLog(config.WalletPath); err != nil {
+			slog.Error("NewGenesisNode: could not open mutations log", "err", err)
+		} else if err := log.Discard(); err != nil {
+			slog.Error("NewGenesisNode: could not discard mutations log", "err", err)
+			log.Close()
+		} else {
+			node.blockchain.Log = log
+		}
+	}
 	//RunActionsGateway(ctx, config.Relay.ActionGateway, node.actions)
 	go node.ServeAdmin(ctx)
 	window := Window{
@@ -86,6 +144,12 @@ func NewGenesisNode(ctx context.Context, wallet crypto.PrivateKey, config Valida
 	return node
 }
 
+// openMutationsLog opens the mutations log of a file based state with the given
+// wallet path.
+func openMutationsLog(walletPath string) (*state.MutationsLog, error) {
+	return state.OpenMutationsLog(fmt.Sprintf("%vmutations.log", walletPath))
+}
+
 // RunActionsGateway keep track of the actions gateway channel and populates the
 // node action store with information gathered from there.
 /*func RunActionsGateway(ctx context.Context, gateway chan []byte, store *store.ActionVault) {
@@ -156,6 +220,21 @@ type SwellNode struct {
 	cancel   context.CancelFunc
 }
 
+// punish determines the slashing of the violators evidenced by duplicates
+// according to the network permission rules. The weight of each violator is
+// derived from the chain state so that every node arrives at the same amounts.
+func (s *SwellNode) punish(duplicates *bft.Duplicate) map[crypto.Token]uint64 {
+	if s.config.Permission == nil {
+		return nil
+	}
+	violators := make([]crypto.Token, 0)
+	for token := range permission.Violations(duplicates) {
+		violators = append(violators, token)
+	}
+	weights := s.config.Permission.DeterminePool(s.blockchain, violators)
+	return s.config.Permission.Punish(duplicates, weights)
+}
+
 func (s *SwellNode) AdminReport() string {
 	status := ""
 	if s.relay != nil {
@@ -2,6 +2,7 @@ package swell
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/consensus/messages"
@@ -36,21 +37,22 @@ func ReadMessages(cancel context.CancelFunc, conn ReaderShutdowner) chan *chain.
 				close(newSealed)
 				return
 			case messages.MsgSealedBlock:
-				sealed := chain.ParseSealedBlock(msg[1:])
-				if sealed != nil {
-					newSealed <- sealed
+				sealed, err := chain.ParseSealedBlock(msg[1:])
+				if err != nil {
+					slog.Info("ReadMessages: invalid sealed block", "error", err)
+					continue
 				}
+				newSealed <- sealed
 			case messages.MsgCommit:
 				// on swell each blockchain will commit by itself.
 			case messages.MsgCommittedBlock:
 				// extract the sealed block from the committed block
-				committed := chain.ParseCommitBlock(msg[1:])
-				if committed != nil {
-					sealed := committed.Sealed()
-					if sealed != nil {
-						newSealed <- sealed
-					}
+				committed, err := chain.ParseCommitBlock(msg[1:])
+				if err != nil {
+					slog.Info("ReadMessages: invalid committed block", "error", err)
+					continue
 				}
+				newSealed <- committed.Sealed()
 			}
 		}
 	}()
@@ -34,8 +34,8 @@ func RetrieveBlock(epoch uint64, hash crypto.Hash, order []*socket.BufferedMulti
 			if len(data) == 0 {
 				return
 			}
-			sealed := chain.ParseSealedBlock(data)
-			if sealed != nil && sealed.Header.Epoch == epoch && sealed.Seal.Hash.Equal(hash) {
+			sealed, err := chain.ParseSealedBlock(data)
+			if err == nil && sealed.Header.Epoch == epoch && sealed.Seal.Hash.Equal(hash) {
 				status.Done(sealed)
 			}
 		}(n, channel, &status)
@@ -1,17 +1,26 @@
 package swell
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/freehandle/breeze/consensus/bft"
 	"github.com/freehandle/breeze/consensus/chain"
+	"github.com/freehandle/breeze/consensus/messages"
 	"github.com/freehandle/breeze/consensus/permission"
 	"github.com/freehandle/breeze/consensus/relay"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/middleware/admin"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/protocol/state"
 	"github.com/freehandle/breeze/socket"
+	"github.com/freehandle/breeze/util"
 )
 
 var swellTestConfig = SwellNetworkConfiguration{
@@ -20,6 +29,7 @@ var swellTestConfig = SwellNetworkConfiguration{
 	MaxCommitteeSize: 10,
 	BlockInterval:    10 * time.Millisecond,
 	ChecksumWindow:   10,
+	UnbondingWindows: 2,
 	Permission:       permission.Permissionless{},
 }
 
@@ -191,3 +201,498 @@ func TestGenesisNode(t *testing.T) {
 	}
 	cancel()
 }
+
+func doubleVote(key crypto.PrivateKey, epoch uint64, conflicting bool) *bft.Duplicate {
+	one := &bft.RoundVote{Epoch: epoch, Token: key.PublicKey(), Value: crypto.Hasher([]byte("one")), HasHash: true}
+	two := &bft.RoundVote{Epoch: epoch, Token: key.PublicKey(), Value: one.Value, HasHash: true}
+	if conflicting {
+		two.Value = crypto.Hasher([]byte("two"))
+	}
+	one.Sign(key)
+	two.Sign(key)
+	duplicate := bft.NewDuplicate()
+	duplicate.AddVote(one, two)
+	return duplicate
+}
+
+// newSlashingTestNode returns a node with a genesis blockchain under proof of
+// stake. The genesis token has 1e9 deposited and therefore weight 3.
+func newSlashingTestNode(key crypto.PrivateKey) *SwellNode {
+	config := swellTestConfig
+	config.Permission = &permission.ProofOfStake{MinimumStage: 3e8}
+	node := &SwellNode{
+		blockchain:  chain.BlockchainFromGenesisState(key, "", config.NetworkHash, config.BlockInterval, config.ChecksumWindow, config.UnbondingWindows, config.MinFeePerByte, config.TargetBlockSize, config.Issuance),
+		credentials: key,
+		config:      config,
+	}
+	node.blockchain.Punish = node.punish
+	node.blockchain.SetWindowWeights(1, map[crypto.Token]int{key.PublicKey(): 1})
+	return node
+}
+
+// addTestBlock seals a block carrying the duplicate evidence and adds it to the
+// blockchains as received through the network.
+func addTestBlock(key crypto.PrivateKey, epoch uint64, evidence *bft.Duplicate, chains ...*chain.Blockchain) error {
+	header := chains[0].NextBlock(epoch)
+	if header == nil {
+		return fmt.Errorf("could not create header for epoch %d", epoch)
+	}
+	header.Duplicate = evidence
+	sealed := chains[0].CheckpointValidator(*header).Seal(key)
+	for _, blockchain := range chains {
+		parsed, err := chain.ParseSealedBlock(sealed.Serialize())
+		if err != nil {
+			return fmt.Errorf("could not parse sealed block for epoch %d: %w", epoch, err)
+		}
+		blockchain.AddSealedBlock(parsed)
+		if blockchain.LastCommitEpoch != epoch {
+			return fmt.Errorf("block %d not committed", epoch)
+		}
+	}
+	return nil
+}
+
+func TestSlashDoubleVote(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	nodes := []*SwellNode{newSlashingTestNode(key), newSlashingTestNode(key)}
+	chains := []*chain.Blockchain{nodes[0].blockchain, nodes[1].blockchain}
+	deposit := func(blockchain *chain.Blockchain) uint64 {
+		_, balance := blockchain.CommitState.Deposits.Balance(token)
+		return balance
+	}
+	if err := addTestBlock(key, 1, nil, chains...); err != nil {
+		t.Fatal(err)
+	}
+	// identical votes are not evidence of a violation
+	if err := addTestBlock(key, 2, doubleVote(key, 1, false), chains...); err != nil {
+		t.Fatal(err)
+	}
+	if deposit(chains[0]) != 1e9 {
+		t.Fatalf("deposit slashed without valid evidence: %d", deposit(chains[0]))
+	}
+	if err := addTestBlock(key, 3, doubleVote(key, 2, true), chains...); err != nil {
+		t.Fatal(err)
+	}
+	for n, blockchain := range chains {
+		if deposit(blockchain) != 1e8 {
+			t.Fatalf("chain %d: expected deposit 1e8 after slashing, got %d", n, deposit(blockchain))
+		}
+		if blockchain.Punishment[token] != 9e8 {
+			t.Fatalf("chain %d: expected punishment 9e8, got %d", n, blockchain.Punishment[token])
+		}
+	}
+	if !chains[0].CommitState.ChecksumHash().Equal(chains[1].CommitState.ChecksumHash()) {
+		t.Fatal("slashing is not deterministic across nodes")
+	}
+	// the same offense presented again is not punished twice
+	if err := addTestBlock(key, 4, doubleVote(key, 2, true), chains...); err != nil {
+		t.Fatal(err)
+	}
+	if deposit(chains[0]) != 1e8 {
+		t.Fatalf("offense punished twice: deposit %d", deposit(chains[0]))
+	}
+	// offenses too old to be tracked are not punished
+	nodes[0].blockchain.LastCommitEpoch = 3 + state.MaxEpochDifference
+	nodes[0].blockchain.CommitState.Epoch = nodes[0].blockchain.LastCommitEpoch
+	window := uint64(swellTestConfig.ChecksumWindow)
+	nodes[0].blockchain.SetWindowWeights(((3+state.MaxEpochDifference)/window)*window+1, map[crypto.Token]int{token: 1})
+	if err := addTestBlock(key, 4+state.MaxEpochDifference, doubleVote(key, 3, true), chains[0]); err != nil {
+		t.Fatal(err)
+	}
+	if deposit(chains[0]) != 1e8 {
+		t.Fatalf("stale offense punished: deposit %d", deposit(chains[0]))
+	}
+}
+
+func TestBalanceQuery(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	node := newSlashingTestNode(key)
+	if messages.ParseBalanceRequest(messages.BalanceRequest(token)) != token {
+		t.Fatal("balance request round trip failed")
+	}
+	balance := messages.ParseBalance(node.blockchain.Balance(token).Serialize())
+	if balance == nil {
+		t.Fatal("could not parse balance response")
+	}
+	_, wallet := node.blockchain.Checksum.State.Wallets.Balance(token)
+	_, deposit := node.blockchain.Checksum.State.Deposits.Balance(token)
+	if balance.Token != token || balance.Wallet != wallet || balance.Deposit != deposit || wallet+deposit == 0 {
+		t.Errorf("unexpected balance %+v: wallet %v deposit %v", balance, wallet, deposit)
+	}
+	if balance.Epoch != node.blockchain.Checksum.Epoch || !balance.ChecksumHash.Equal(node.blockchain.Checksum.Hash) {
+		t.Error("balance not anchored to checksum")
+	}
+	other, _ := crypto.RandomAsymetricKey()
+	if empty := node.blockchain.Balance(other); empty.Wallet != 0 || empty.Deposit != 0 {
+		t.Errorf("unexpected balance for unknown token %+v", empty)
+	}
+}
+
+func TestBalanceProof(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	node := newSlashingTestNode(key)
+	checksum := node.blockchain.Checksum
+	proof := chain.ParseBalanceProof(node.blockchain.ProveBalance(token).Serialize())
+	if proof == nil {
+		t.Fatal("could not parse balance proof")
+	}
+	_, wallet := checksum.State.Wallets.Balance(token)
+	_, deposit := checksum.State.Deposits.Balance(token)
+	if proofWallet, proofDeposit := proof.Balance(); proofWallet != wallet || proofDeposit != deposit {
+		t.Fatalf("unexpected balance on proof: %v %v", proofWallet, proofDeposit)
+	}
+	hash := chain.EpochChecksumHash(checksum.Epoch, checksum.State.ChecksumHash())
+	naked := chain.NewCheckSum(checksum.Epoch, key, "localhost", true, hash)
+	if !proof.Verify(naked) {
+		t.Error("proof not verified against naked statement")
+	}
+	if proof.Verify(chain.NewCheckSum(checksum.Epoch, key, "localhost", false, hash)) {
+		t.Error("proof verified against dressed statement")
+	}
+	if proof.Verify(chain.NewCheckSum(checksum.Epoch+1, key, "localhost", true, hash)) {
+		t.Error("proof verified against statement of another epoch")
+	}
+	other, otherKey := crypto.RandomAsymetricKey()
+	statements := []*chain.ChecksumStatement{naked}
+	if !proof.VerifyCommittee(statements, map[crypto.Token]int{token: 3, other: 1}) {
+		t.Error("proof not verified by committee majority")
+	}
+	if proof.VerifyCommittee(append(statements, naked), map[crypto.Token]int{token: 1, other: 1}) {
+		t.Error("proof verified without committee majority")
+	}
+	statements = append(statements, chain.NewCheckSum(checksum.Epoch, otherKey, "localhost", true, hash))
+	if !proof.VerifyCommittee(statements, map[crypto.Token]int{token: 1, other: 1}) {
+		t.Error("proof not verified by whole committee")
+	}
+	stranger, _ := crypto.RandomAsymetricKey()
+	empty := node.blockchain.ProveBalance(stranger)
+	if w, d := empty.Balance(); w != 0 || d != 0 || !empty.Verify(naked) {
+		t.Error("invalid zero balance proof")
+	}
+	empty.Proof.Account.Wallet = 1
+	if empty.Verify(naked) {
+		t.Error("tampered proof verified")
+	}
+}
+
+func TestSnapshotRestart(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	node := newSlashingTestNode(key)
+	blockchain := node.blockchain
+	snapshots, err := chain.OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Snapshots = snapshots
+	if err := blockchain.WriteSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	restart := func() *chain.Blockchain {
+		restored, err := chain.BlockchainFromSnapshot(snapshots, "", key, swellTestConfig.NetworkHash, swellTestConfig.BlockInterval, swellTestConfig.ChecksumWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.LastCommitEpoch != blockchain.LastCommitEpoch || !restored.LastCommitHash.Equal(blockchain.LastCommitHash) {
+			t.Fatalf("restored at epoch %v instead of %v", restored.LastCommitEpoch, blockchain.LastCommitEpoch)
+		}
+		if !restored.CommitState.ChecksumHash().Equal(blockchain.CommitState.ChecksumHash()) {
+			t.Fatal("restored commit state diverges")
+		}
+		return restored
+	}
+	addBlocks := func(from, to uint64) {
+		for epoch := from; epoch <= to; epoch++ {
+			if err := addTestBlock(key, epoch, nil, blockchain); err != nil {
+				t.Fatal(err)
+			}
+			for blockchain.IsCloning() {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	addBlocks(1, 3)
+	restart()
+	// epoch 5 is a checkpoint and its snapshot is written in the background
+	addBlocks(4, 7)
+	for n := 0; n < 1000; n++ {
+		if snapshot, _, err := snapshots.Latest(); err == nil && snapshot.Epoch == 5 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	restored := restart()
+	if restored.Checksum.Epoch != 5 || !restored.Checksum.Hash.Equal(blockchain.NextChecksum.Hash) {
+		t.Errorf("restored checksum at epoch %v", restored.Checksum.Epoch)
+	}
+}
+
+func TestBlockStoreRestore(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	blockchain := newSlashingTestNode(key).blockchain
+	path := t.TempDir()
+	blocks, err := chain.OpenBlockStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Blocks = blocks
+	for epoch := uint64(1); epoch <= 7; epoch++ {
+		if err := addTestBlock(key, epoch, nil, blockchain); err != nil {
+			t.Fatal(err)
+		}
+		for blockchain.IsCloning() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// epoch 9 is sealed but cannot be committed without epoch 8
+	header := blockchain.NextBlock(9)
+	blockchain.AddSealedBlock(blockchain.CheckpointValidator(*header).Seal(key))
+	commit, err := blocks.Commit(3)
+	if err != nil || commit == nil || !commit.Seal.Hash.Equal(blockchain.RecentAfter(2)[0].Seal.Hash) {
+		t.Fatalf("committed block not on block store: %v", err)
+	}
+	blocks.Close()
+	// a crash in the middle of an append leaves a truncated record
+	file, err := os.OpenFile(filepath.Join(path, "blocks.dat"), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{0, 0, 1, 0, 2})
+	file.Close()
+
+	restored := newSlashingTestNode(key).blockchain
+	if restored.Blocks, err = chain.OpenBlockStore(path); err != nil {
+		t.Fatal(err)
+	}
+	if first, last := restored.Blocks.Epochs(); first != 1 || last != 9 {
+		t.Fatalf("block store with epochs %v to %v", first, last)
+	}
+	if count, err := restored.RestoreBlocks(); err != nil || count != 8 {
+		t.Fatalf("restored %v blocks: %v", count, err)
+	}
+	if restored.LastCommitEpoch != 7 || !restored.LastCommitHash.Equal(blockchain.LastCommitHash) {
+		t.Fatalf("restored at epoch %v instead of 7", restored.LastCommitEpoch)
+	}
+	if !restored.CommitState.ChecksumHash().Equal(blockchain.CommitState.ChecksumHash()) {
+		t.Fatal("restored commit state diverges")
+	}
+	if len(restored.SealedBlocks) != 1 || restored.SealedBlocks[0].Header.Epoch != 9 {
+		t.Fatal("sealed block not restored")
+	}
+}
+
+func TestMutationsLogRecovery(t *testing.T) {
+	_, key := crypto.RandomAsymetricKey()
+	blockchain := newSlashingTestNode(key).blockchain
+	snapshots, err := chain.OpenSnapshotStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockchain.Snapshots = snapshots
+	if err := blockchain.WriteSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(t.TempDir(), "mutations.log")
+	if blockchain.Log, err = state.OpenMutationsLog(logPath); err != nil {
+		t.Fatal(err)
+	}
+	for epoch := uint64(1); epoch <= 4; epoch++ {
+		// a crash after the mutations of epoch 4 are incorporated and before
+		// its diff is recorded
+		if epoch == 4 {
+			blockchain.Snapshots = nil
+		}
+		if err := addTestBlock(key, epoch, nil, blockchain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blockchain.Log.Close()
+
+	restart := func() *chain.Blockchain {
+		restored, err := chain.BlockchainFromSnapshot(snapshots, "", key, swellTestConfig.NetworkHash, swellTestConfig.BlockInterval, swellTestConfig.ChecksumWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Log, err = state.OpenMutationsLog(logPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := restored.RecoverMutations(); err != nil {
+			t.Fatal(err)
+		}
+		if restored.LastCommitEpoch != 4 || !restored.LastCommitHash.Equal(blockchain.LastCommitHash) {
+			t.Fatalf("recovered at epoch %v instead of 4", restored.LastCommitEpoch)
+		}
+		if !restored.CommitState.ChecksumHash().Equal(blockchain.CommitState.ChecksumHash()) {
+			t.Fatal("recovered commit state diverges")
+		}
+		restored.Log.Close()
+		return restored
+	}
+	restart()
+	// the diff of epoch 4 is now on the snapshot store
+	restart()
+}
+
+func TestBlockReward(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	other, _ := crypto.RandomAsymetricKey()
+	config := swellTestConfig
+	config.Issuance = state.IssuanceSchedule{BlockReward: 300}
+	chains := make([]*chain.Blockchain, 2)
+	for n := range chains {
+		chains[n] = chain.BlockchainFromGenesisState(key, "", config.NetworkHash, config.BlockInterval, config.ChecksumWindow, config.UnbondingWindows, config.MinFeePerByte, config.TargetBlockSize, config.Issuance)
+		chains[n].SetWindowWeights(1, map[crypto.Token]int{token: 1, other: 2})
+	}
+	// weights of a window are carried to synced nodes
+	weights := chain.ParseWindowWeights(chains[0].SerializeWindowWeights())
+	if len(weights) != 1 || weights[1][other] != 2 || weights[1][token] != 1 {
+		t.Fatalf("window weights do not round trip: %v", weights)
+	}
+	if err := addTestBlock(key, 1, nil, chains...); err != nil {
+		t.Fatal(err)
+	}
+	for n, blockchain := range chains {
+		if _, balance := blockchain.CommitState.Wallets.Balance(other); balance != 200 {
+			t.Errorf("chain %d: expected reward 200, got %d", n, balance)
+		}
+		if supply := blockchain.CommitState.Issuance.Supply; supply != 2*state.GenesisMint+300 {
+			t.Errorf("chain %d: unexpected supply %d", n, supply)
+		}
+		if !blockchain.CommitState.Audit() {
+			t.Errorf("chain %d: supply does not match circulating tokens", n)
+		}
+	}
+	if !chains[0].CommitState.ChecksumHash().Equal(chains[1].CommitState.ChecksumHash()) {
+		t.Fatal("block rewards are not deterministic across nodes")
+	}
+}
+
+func TestGenesis(t *testing.T) {
+	tokens := make([]crypto.Token, 3)
+	for n := range tokens {
+		tokens[n], _ = crypto.RandomAsymetricKey()
+	}
+	_, key := crypto.RandomAsymetricKey()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	genesis := chain.Genesis{
+		NetworkHash:      crypto.Hasher([]byte("testnet")),
+		TimeStamp:        start,
+		Wallets:          []chain.GenesisWallet{{Token: tokens[0], Wallet: 100}, {Token: tokens[1], Wallet: 200, Deposit: 50}, {Token: tokens[2], Deposit: 1000}},
+		BlockInterval:    swellTestConfig.BlockInterval,
+		ChecksumWindow:   swellTestConfig.ChecksumWindow,
+		UnbondingWindows: swellTestConfig.UnbondingWindows,
+	}
+	// the genesis hash does not depend on the order or on the location of the timestamp
+	reordered := genesis
+	reordered.Wallets = []chain.GenesisWallet{genesis.Wallets[2], genesis.Wallets[0], genesis.Wallets[1]}
+	reordered.TimeStamp = start.In(time.FixedZone("test", 3600))
+	if !genesis.Hash().Equal(reordered.Hash()) {
+		t.Fatal("genesis hash is not deterministic")
+	}
+	later := genesis
+	later.TimeStamp = start.Add(time.Second)
+	if genesis.Hash().Equal(later.Hash()) {
+		t.Fatal("genesis hash does not depend on the timestamp")
+	}
+	blockchain, err := chain.BlockchainFromGenesis(&genesis, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blockchain.GenesisHash.Equal(genesis.Hash()) || !blockchain.LastCommitHash.Equal(genesis.Hash()) {
+		t.Fatal("genesis hash is not the last commit hash")
+	}
+	if !blockchain.Clock.TimeStamp.Equal(start) {
+		t.Fatalf("unexpected genesis clock %v", blockchain.Clock.TimeStamp)
+	}
+	for _, wallet := range genesis.Wallets {
+		_, balance := blockchain.CommitState.Wallets.Balance(wallet.Token)
+		_, deposit := blockchain.CommitState.Deposits.Balance(wallet.Token)
+		if balance != wallet.Wallet || deposit != wallet.Deposit {
+			t.Errorf("unexpected genesis balance %d and deposit %d", balance, deposit)
+		}
+	}
+	if blockchain.CommitState.Issuance.Supply != 1350 || !blockchain.CommitState.Audit() {
+		t.Errorf("unexpected genesis supply %d", blockchain.CommitState.Issuance.Supply)
+	}
+	duplicated := genesis
+	duplicated.Wallets = append([]chain.GenesisWallet{{Token: tokens[0], Wallet: 1}}, genesis.Wallets...)
+	if _, err := chain.BlockchainFromGenesis(&duplicated, key, ""); err == nil {
+		t.Error("genesis with duplicated wallet accepted")
+	}
+}
+
+func TestPreVerify(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	array := chain.NewActionArray()
+	count := 2*chain.VerifyBatchSize + 10
+	for n := 0; n < count; n++ {
+		transfer := actions.Transfer{TimeStamp: 1, From: token, To: []crypto.TokenValue{{Token: receiver, Value: uint64(n + 1)}}, Fee: 10}
+		transfer.Sign(key)
+		data := transfer.Serialize()
+		switch n {
+		case 3, chain.VerifyBatchSize + 1:
+			data[len(data)-1] ^= 1 // tampered signature
+		case count - 1:
+			data = data[:len(data)-1] // malformed action
+		}
+		array.Append(data)
+	}
+	verified := array.PreVerify()
+	if len(verified) != count {
+		t.Fatalf("expected %d pre-verified actions, got %d", count, len(verified))
+	}
+	for n, action := range verified {
+		invalid := n == 3 || n == chain.VerifyBatchSize+1 || n == count-1
+		if invalid && action != nil {
+			t.Errorf("action %d: invalid action pre-verified", n)
+		}
+		if !invalid && (action == nil || !bytes.Equal(action.Serialize(), array.Get(n))) {
+			t.Errorf("action %d: valid action not pre-verified", n)
+		}
+	}
+}
+
+func TestParseBlockErrors(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	hash := crypto.Hasher([]byte("block"))
+	vote := &bft.RoundVote{Epoch: 2, Token: token, Value: hash, HasHash: true}
+	vote.Sign(key)
+	blank := &bft.RoundVote{Epoch: 2, Token: token, Blank: true}
+	blank.Sign(key)
+	duplicate := bft.NewDuplicate()
+	duplicate.AddVote(vote, blank)
+	statement := chain.NewCheckSum(1, key, "localhost", false, hash)
+	header := chain.BlockHeader{Epoch: 2, CheckPoint: 1, Proposer: token, ProposedAt: time.Now(), Duplicate: duplicate, Candidate: []*chain.ChecksumStatement{statement}}
+	array := chain.NewActionArray()
+	transfer := actions.Transfer{TimeStamp: 1, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 10}}, Fee: 1}
+	transfer.Sign(key)
+	array.Append(transfer.Serialize())
+	ballot := &bft.Ballot{TotalWeight: 1, Votes: []*bft.RoundVote{vote}, Commits: []*bft.RoundCommit{}}
+	sealed := &chain.SealedBlock{Header: header, Actions: array, Seal: chain.BlockSeal{Hash: hash, FeesCollected: 1, Consensus: []*bft.Ballot{ballot}}}
+	committed := &chain.CommitBlock{Header: header, Actions: array, Seal: sealed.Seal, Commit: &chain.BlockCommit{Invalidated: []crypto.Hash{hash}, PublishedBy: token}}
+	blocks := []struct {
+		data  []byte
+		parse func([]byte) error
+	}{
+		{sealed.Serialize(), func(data []byte) error { _, err := chain.ParseSealedBlock(data); return err }},
+		{committed.Serialize(), func(data []byte) error { _, err := chain.ParseCommitBlock(data); return err }},
+	}
+	for _, block := range blocks {
+		if err := block.parse(block.data); err != nil {
+			t.Fatalf("could not parse block: %v", err)
+		}
+		for n := 0; n < len(block.data); n++ {
+			if err := block.parse(block.data[:n]); !errors.Is(err, util.ErrTruncated) {
+				t.Fatalf("block truncated at %d: %v", n, err)
+			}
+		}
+		if err := block.parse(append(block.data, 0)); !errors.Is(err, util.ErrTrailingBytes) {
+			t.Errorf("block with trailing bytes: %v", err)
+		}
+	}
+	statement.Signature[0] ^= 1
+	if _, err := chain.ParseBlockHeader(header.Serialize()); !errors.Is(err, util.ErrBadSignature) {
+		t.Errorf("header with invalid checksum statement: %v", err)
+	}
+}
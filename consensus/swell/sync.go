@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 
 	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/consensus/messages"
@@ -43,6 +44,25 @@ func FullSyncValidatorNode(ctx context.Context, config ValidatorConfig, sync soc
 	return nil
 }
 
+// RestartValidatorNode restarts a validator node from the latest snapshot on
+// disk (see RestartSync) and keeps it in sync with the network as a non
+// validating node, like FullSyncValidatorNode.
+func RestartValidatorNode(ctx context.Context, config ValidatorConfig, sync socket.TokenAddr, synced chan *SwellNode) error {
+	go func() {
+		window, conn, err := RestartSync(ctx, config, sync)
+		if err != nil {
+			slog.Error("RestartValidatorNode: could not restart from snapshot", "err", err)
+			return
+		}
+		go window.Node.ServeAdmin(ctx)
+		window.Node.cancel = StartNonValidatorEngine(window, conn, true)
+		if synced != nil {
+			synced <- window.Node
+		}
+	}()
+	return nil
+}
+
 // FullSyncValidatorNode tries to gather information from a given validator to
 // form a new non-validating node. This is used to bootstrap a new node from
 // scratch. A standy node just keep in sync with the network and cannot be a
@@ -60,24 +80,148 @@ func FullSync(ctx context.Context, config ValidatorConfig, sync socket.TokenAddr
 
 	clock := chain.ClockSyncronization{}
 
+	committe, err := syncCommittee(ctx, config, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	weights, err := syncWindowWeights(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	genesis, err := syncGenesis(conn, config.Genesis)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	msg, err := conn.Read()
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(msg) < 8 || msg[0] != messages.MsgClockSync {
+		return nil, nil, errors.New("invalid clock sync message")
+	}
+	position := 1
+	clock.Epoch, position = util.ParseUint64(msg, position)
+	clock.TimeStamp, _ = util.ParseTime(msg, position)
+
+	checksum, err := syncChecksum(conn, config.WalletPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	blockchain := chain.BlockchainFromChecksumState(checksum, clock, config.Credentials, config.SwellConfig.NetworkHash, config.SwellConfig.BlockInterval, config.SwellConfig.ChecksumWindow)
+	blockchain.GenesisHash = genesis
+	for start, window := range weights {
+		blockchain.SetWindowWeights(start, window)
+	}
+	if config.SnapshotPath != "" {
+		if blockchain.Snapshots, err = chain.OpenSnapshotStore(config.SnapshotPath); err != nil {
+			return nil, nil, err
+		}
+		if err := blockchain.WriteSnapshot(); err != nil {
+			slog.Error("FullSync: could not write snapshot of synced state", "err", err)
+		}
+	}
+	if config.BlockPath != "" {
+		if blockchain.Blocks, err = chain.OpenBlockStore(config.BlockPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	if config.WalletPath != "" {
+		if blockchain.Log, err = openMutationsLog(config.WalletPath); err != nil {
+			return nil, nil, err
+		}
+		// the synced state supersedes any entry left on the log
+		if err := blockchain.Log.Discard(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return syncedWindow(config, committe, blockchain), conn, nil
+}
+
+// RestartSync recreates the blockchain from the latest snapshot on the
+// snapshot path of the configuration and replays the blocks committed after
+// the snapshot as recorded on the snapshot store. For file based states the last
+// entry on the mutations log is recovered (see Blockchain.RecoverMutations). If the
+// configuration has a block path, blocks sealed or committed after the last commit on the snapshot
+// store are restored from the block store. It then gathers from a given
+// validator the current committee and the blocks after the last commit epoch
+// on record, instead of synchronizing the entire state as FullSync.
+func RestartSync(ctx context.Context, config ValidatorConfig, sync socket.TokenAddr) (*Window, *socket.SignedConnection, error) {
+	snapshots, err := chain.OpenSnapshotStore(config.SnapshotPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockchain, err := chain.BlockchainFromSnapshot(snapshots, config.WalletPath, config.Credentials, config.SwellConfig.NetworkHash, config.SwellConfig.BlockInterval, config.SwellConfig.ChecksumWindow)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.WalletPath != "" {
+		if blockchain.Log, err = openMutationsLog(config.WalletPath); err != nil {
+			blockchain.Shutdown()
+			return nil, nil, err
+		}
+		if err := blockchain.RecoverMutations(); err != nil {
+			slog.Error("RestartSync: could not recover mutations log", "err", err)
+		}
+	}
+	if config.BlockPath != "" {
+		if blockchain.Blocks, err = chain.OpenBlockStore(config.BlockPath); err != nil {
+			blockchain.Shutdown()
+			return nil, nil, err
+		}
+		if _, err := blockchain.RestoreBlocks(); err != nil {
+			slog.Error("RestartSync: could not restore blocks from block store", "err", err)
+		}
+	}
+	conn, err := socket.Dial(config.Hostname, sync.Addr, config.Credentials, sync.Token)
+	if err != nil {
+		blockchain.Shutdown()
+		return nil, nil, err
+	}
+	conn.Send(messages.SyncMessage(blockchain.LastCommitEpoch))
+	committe, err := syncCommittee(ctx, config, conn)
+	if err != nil {
+		conn.Shutdown()
+		blockchain.Shutdown()
+		return nil, nil, err
+	}
+	weights, err := syncWindowWeights(conn)
+	if err != nil {
+		conn.Shutdown()
+		blockchain.Shutdown()
+		return nil, nil, err
+	}
+	if config.Genesis != nil {
+		blockchain.GenesisHash = config.Genesis.Hash()
+	}
+	for start, window := range weights {
+		blockchain.SetWindowWeights(start, window)
+	}
+	return syncedWindow(config, committe, blockchain), conn, nil
+}
+
+// syncCommittee reads the committee of the current checksum window sent by a
+// validator as the first message of a sync job.
+func syncCommittee(ctx context.Context, config ValidatorConfig, conn *socket.SignedConnection) (*Committee, error) {
+	msg, err := conn.Read()
+	if err != nil {
+		return nil, err
+	}
 	if len(msg) < 1 || msg[0] != messages.MsgCommittee {
-		return nil, nil, errors.New("invalid committee message type")
+		return nil, errors.New("invalid committee message type")
 	}
 	order, validators := ParseCommitee(msg[1:])
 	if len(order) == 0 || len(validators) == 0 {
 		fmt.Println(order, validators)
-		return nil, nil, errors.New("invalid committee message")
+		return nil, errors.New("invalid committee message")
 	}
 	weights := make(map[crypto.Token]int)
 	for _, token := range order {
 		weights[token] += 1
 	}
 	ctx, cancel := context.WithCancel(ctx)
-	committe := Committee{
+	return &Committee{
 		ctx:         ctx,
 		cancel:      cancel,
 		hostname:    config.Hostname,
@@ -85,26 +229,59 @@ func FullSync(ctx context.Context, config ValidatorConfig, sync socket.TokenAddr
 		order:       order,
 		weights:     weights,
 		validators:  validators,
-	}
+	}, nil
+}
 
-	msg, err = conn.Read()
+// syncWindowWeights reads the validator weights of recent checksum windows sent
+// by a validator after the committee on a sync job.
+func syncWindowWeights(conn *socket.SignedConnection) (map[uint64]map[crypto.Token]int, error) {
+	msg, err := conn.Read()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	if len(msg) < 8 || msg[0] != messages.MsgClockSync {
-		return nil, nil, errors.New("invalid clock sync message")
+	if len(msg) < 1 || msg[0] != messages.MsgSyncWindowWeights {
+		return nil, errors.New("invalid window weights message type")
 	}
-	position := 1
-	clock.Epoch, position = util.ParseUint64(msg, position)
-	clock.TimeStamp, _ = util.ParseTime(msg, position)
+	weights := chain.ParseWindowWeights(msg[1:])
+	if weights == nil {
+		return nil, errors.New("invalid window weights message")
+	}
+	return weights, nil
+}
 
-	checksum, err := syncChecksum(conn, config.WalletPath)
+// syncGenesis reads the genesis hash of the network sent by a validator prior
+// to the state of a full sync job. If a genesis is provided the hash must match
+// its hash. A validator that does not know the genesis of the network sends a
+// zero hash, accepted with a warning.
+func syncGenesis(conn *socket.SignedConnection, genesis *chain.Genesis) (crypto.Hash, error) {
+	msg, err := conn.Read()
 	if err != nil {
-		return nil, nil, err
+		return crypto.ZeroHash, err
+	}
+	if len(msg) != 1+crypto.Size || msg[0] != messages.MsgSyncGenesis {
+		return crypto.ZeroHash, errors.New("invalid genesis message")
+	}
+	hash, _ := util.ParseHash(msg, 1)
+	if genesis == nil {
+		return hash, nil
 	}
+	expected := genesis.Hash()
+	if hash.Equal(crypto.Hash{}) {
+		slog.Warn("sync: peer does not know the genesis hash of the network", "expected", crypto.EncodeHash(expected))
+		return expected, nil
+	}
+	if !hash.Equal(expected) {
+		return crypto.ZeroHash, fmt.Errorf("genesis hash mismatch: peer %v, expected %v", crypto.EncodeHash(hash), crypto.EncodeHash(expected))
+	}
+	return hash, nil
+}
 
+// syncedWindow returns the checksum window of a node running on a synced
+// blockchain.
+func syncedWindow(config ValidatorConfig, committe *Committee, blockchain *chain.Blockchain) *Window {
+	ctx := committe.ctx
 	node := &SwellNode{
-		blockchain: chain.BlockchainFromChecksumState(checksum, clock, config.Credentials, config.SwellConfig.NetworkHash, config.SwellConfig.BlockInterval, config.SwellConfig.ChecksumWindow),
+		blockchain: blockchain,
 		//		actions:     store.NewActionStore(ctx, checksum.Epoch),
 		credentials: config.Credentials,
 		config:      config.SwellConfig,
@@ -112,25 +289,28 @@ func FullSync(ctx context.Context, config ValidatorConfig, sync socket.TokenAddr
 		admin:       config.Admin,
 		hostname:    config.Hostname,
 	}
+	node.blockchain.Punish = node.punish
 	if config.Relay == nil || config.Relay.ActionGateway == nil {
-		node.actions = store.NewActionStore(ctx, checksum.Epoch, nil)
+		node.actions = store.NewActionStore(ctx, blockchain.Checksum.Epoch, nil)
 	} else {
-		node.actions = store.NewActionStore(ctx, checksum.Epoch, config.Relay.ActionGateway)
+		node.actions = store.NewActionStore(ctx, blockchain.Checksum.Epoch, config.Relay.ActionGateway)
 	}
 
 	windowDuration := uint64(config.SwellConfig.ChecksumWindow)
-	windowStart := windowDuration*(checksum.Epoch/windowDuration) + 1
-	window := &Window{
+	windowStart := windowDuration*(blockchain.LastCommitEpoch/windowDuration) + 1
+	if blockchain.WindowWeights(windowStart) == nil {
+		blockchain.SetWindowWeights(windowStart, committe.weights)
+	}
+	return &Window{
 		ctx:         ctx,
 		Start:       windowStart,
 		End:         windowStart + windowDuration - 1,
-		Committee:   &committe,
+		Committee:   committe,
 		Node:        node,
 		newBlock:    make(chan BlockConsensusConfirmation),
 		unpublished: make([]*chain.ChecksumStatement, 0),
 		published:   make([]*chain.ChecksumStatement, 0),
 	}
-	return window, conn, nil
 }
 
 // syncCheksum is called by FullSyncValidatorNode to gather the checksum from
@@ -154,31 +334,17 @@ func syncChecksum(conn *socket.SignedConnection, walletPath string) (*chain.Chec
 		Epoch: checksum.Epoch,
 	}
 
-	msg, err = conn.Read()
-	if err != nil {
-		return nil, err
-	}
-	if len(msg) < 1 || msg[0] != messages.MsgSyncStateWallets {
-		return nil, errors.New("invalid sync wallet message")
-	}
-	if walletPath != "" {
-		checksum.State.Wallets = state.NewFileWalletStoreFromBytes(walletPath, "wallet", msg[1:])
-	} else {
-		checksum.State.Wallets = state.NewMemoryWalletStoreFromBytes("wallet", msg[1:])
-	}
-
-	msg, err = conn.Read()
-	if err != nil {
-		return nil, err
-	}
-	if len(msg) < 1 || msg[0] != messages.MsgSyncStateDeposits {
-		return nil, errors.New("invalid sync deposit message")
-	}
-
-	if walletPath != "" {
-		checksum.State.Deposits = state.NewFileWalletStoreFromBytes(walletPath, "deposit", msg[1:])
-	} else {
-		checksum.State.Deposits = state.NewMemoryWalletStoreFromBytes("deposit", msg[1:])
+	for _, component := range chain.SyncComponents {
+		msg, err = conn.Read()
+		if err != nil {
+			return nil, err
+		}
+		if len(msg) < 1 || msg[0] != component.Kind {
+			return nil, fmt.Errorf("invalid sync %v message", component.Name)
+		}
+		if !component.Parse(checksum.State, walletPath, msg[1:]) {
+			return nil, fmt.Errorf("invalid %v data", component.Name)
+		}
 	}
 
 	stateHash := checksum.State.ChecksumHash()
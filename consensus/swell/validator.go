@@ -88,20 +88,29 @@ func RunValidator(c *Window) {
 				if err := response.Send(topology.Serialize()); err != nil {
 					response.Shutdown()
 				}
+			case request := <-c.Node.relay.BalanceRequest:
+				balance := c.Node.blockchain.Balance(request.Token)
+				if err := request.Conn.Send(balance.Serialize()); err != nil {
+					slog.Info("BalanceRequest: could not send response", "error", err)
+				}
 			case syncRequest := <-c.Node.relay.SyncRequest:
 				msg := append([]byte{messages.MsgCommittee}, c.Committee.Serialize()...)
 				syncRequest.Conn.SendDirect(msg)
+				weights := append([]byte{messages.MsgSyncWindowWeights}, c.Node.blockchain.SerializeWindowWeights()...)
+				syncRequest.Conn.SendDirect(weights)
 				if syncRequest.State {
 					go c.Node.blockchain.SyncState(syncRequest.Conn)
 				} else {
 					go c.Node.blockchain.SyncBlocksServer(syncRequest.Conn, syncRequest.Epoch)
 				}
 			case statement := <-c.Node.relay.Statement:
-				checksumStatement := chain.ParseChecksumStatement(statement)
-				if checksumStatement != nil {
-					c.unpublished = append(c.unpublished, checksumStatement)
-					//c.incorporateStatement(checksumStatement, epoch)
+				checksumStatement, err := chain.ParseChecksumStatement(statement)
+				if err != nil {
+					slog.Info("SwellNode.RunValidatingNode: invalid checksum statement", "error", err)
+					continue
 				}
+				c.unpublished = append(c.unpublished, checksumStatement)
+				//c.incorporateStatement(checksumStatement, epoch)
 			case consensus := <-c.newBlock:
 				if consensus.Status {
 					for _, sealed := range c.Node.blockchain.SealedBlocks {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/freehandle/breeze/consensus/bft"
@@ -33,9 +34,34 @@ type Window struct {
 	hasPreparedNext bool
 	nextListener    chan *WindowWithValidators
 	nextCommittee   *Committee
+	evidence        *bft.Duplicate // duplicate evidence not yet included in a block header
+	mu              sync.Mutex
 	ctx             context.Context
 }
 
+// addEvidence keeps the duplicate evidence gathered by a consensus pool to be
+// included on the header of the next block proposed by the node.
+func (w *Window) addEvidence(duplicates *bft.Duplicate) {
+	if duplicates == nil || !duplicates.HasViolations() {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.evidence == nil {
+		w.evidence = bft.NewDuplicate()
+	}
+	w.evidence.Append(duplicates)
+}
+
+// takeEvidence returns the pending duplicate evidence and clears it.
+func (w *Window) takeEvidence() *bft.Duplicate {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	evidence := w.evidence
+	w.evidence = nil
+	return evidence
+}
+
 func (w *Window) Finished() bool {
 	return w.End <= w.Node.blockchain.LastCommitEpoch
 }
@@ -84,6 +110,7 @@ func (w *Window) StartNewBlock(epoch uint64) *chain.BlockBuilder {
 	}
 	header.Candidate = append(header.Candidate, w.unpublished...)
 	w.unpublished = w.unpublished[:0]
+	header.Duplicate = w.takeEvidence()
 	block := w.Node.blockchain.CheckpointValidator(*header)
 	return block
 }
@@ -119,7 +146,7 @@ func (w *Window) PrepareNewWindow() {
 	// permissioned = preCandidates after permission winth permissioned
 	permissioned := w.Node.config.Permission.DeterminePool(w.Node.blockchain, preCandidates)
 	// candidates = permissioned sorted by swell committee rule
-	candidates := sortCandidates(permissioned, consenusHash[:], w.Node.config.MaxCommitteeSize)
+	candidates := SortCandidates(permissioned, consenusHash[:], w.Node.config.MaxCommitteeSize)
 
 	aproved := make(map[crypto.Token]int)
 	for _, token := range candidates {
@@ -127,6 +154,7 @@ func (w *Window) PrepareNewWindow() {
 	}
 
 	slog.Info("Breeze: next window validator pool defined", "window start", next.Start, "validators", aproved)
+	w.Node.blockchain.SetWindowWeights(next.Start, aproved)
 
 	// test if node is amond selected candidates
 	amIIn := false
@@ -388,6 +416,7 @@ func (w *Window) BuildBlock(epoch uint64, pool *bft.Pooling) bool {
 		}
 	}()
 	consensus := <-pool.Finalize
+	w.addEvidence(consensus.Duplicates)
 	if sealed != nil && consensus.Value.Equal(sealed.Seal.Hash) {
 		sealed.Seal.Consensus = consensus.Rounds
 		w.AddSealedBlock(sealed)
@@ -417,9 +446,9 @@ func (w *Window) ListenToBlock(leader *socket.BufferedMultiChannel, others []*so
 			}
 			switch data[0] {
 			case messages.MsgNewBlock:
-				header := chain.ParseBlockHeader(data[1:])
-				if header == nil {
-					slog.Info("ListenToBlock: invalid block header")
+				header, err := chain.ParseBlockHeader(data[1:])
+				if err != nil {
+					slog.Info("ListenToBlock: invalid block header", "error", err)
 					return
 				}
 				block = w.Node.blockchain.CheckpointValidator(*header)
@@ -430,9 +459,9 @@ func (w *Window) ListenToBlock(leader *socket.BufferedMultiChannel, others []*so
 				}
 			case messages.MsgSeal:
 				epoch, position := util.ParseUint64(data, 1)
-				seal := chain.ParseBlockSeal(data[position:])
-				if seal == nil {
-					slog.Info("ListenToBlock: invalid seal", "epoch", epoch)
+				seal, err := chain.ParseBlockSeal(data[position:])
+				if err != nil {
+					slog.Info("ListenToBlock: invalid seal", "epoch", epoch, "error", err)
 					return
 				}
 				if block == nil {
@@ -461,6 +490,7 @@ func (w *Window) ListenToBlock(leader *socket.BufferedMultiChannel, others []*so
 		slog.Error("ListenToBlock: nil consensus received from channel")
 		return false
 	}
+	w.addEvidence(consensus.Duplicates)
 
 	if sealed == nil || (!consensus.Value.Equal(sealed.Seal.Hash)) {
 		nodesWithData := make(map[crypto.Token]struct{})
@@ -0,0 +1,148 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+
+	"github.com/freehandle/breeze/crypto/edwards25519"
+)
+
+// identityEncoding is the encoding of the neutral element of the curve.
+var identityEncoding = [32]byte{1}
+
+type batchEntry struct {
+	token     Token
+	msg       []byte
+	signature Signature
+}
+
+// BatchVerifier verifies many ed25519 signatures at once. A batch of n
+// signatures is checked with a single multi scalar multiplication of 2n+1
+// points, roughly twice as fast as n individual verifications for large
+// batches.
+//
+// Each signature is weighted by a random 128-bit scalar and the cofactor is
+// cleared from the combined equation, so that the outcome does not depend on
+// the random weights. As a consequence a batch accepts any signature satisfying
+// the cofactored verification equation, while Token.Verify rejects the rare
+// crafted signatures whose points carry a small order component. Honestly
+// generated signatures are accepted by both. A batch that fails falls back to
+// Token.Verify for each signature (see VerifyEach), so callers that need the
+// same outcome on every node must cut their batches deterministically.
+type BatchVerifier struct {
+	entries []batchEntry
+}
+
+// NewBatchVerifier returns an empty batch verifier with capacity for size
+// signatures.
+func NewBatchVerifier(size int) *BatchVerifier {
+	return &BatchVerifier{entries: make([]batchEntry, 0, size)}
+}
+
+// Add appends the signature of token over msg to the batch.
+func (b *BatchVerifier) Add(token Token, msg []byte, signature Signature) {
+	b.entries = append(b.entries, batchEntry{token: token, msg: msg, signature: signature})
+}
+
+// Len returns the number of signatures on the batch.
+func (b *BatchVerifier) Len() int {
+	return len(b.entries)
+}
+
+// Verify returns true if every signature on the batch is valid. An empty batch
+// is valid.
+func (b *BatchVerifier) Verify() bool {
+	switch len(b.entries) {
+	case 0:
+		return true
+	case 1:
+		return b.entries[0].token.Verify(b.entries[0].msg, b.entries[0].signature)
+	}
+	weights := make([]byte, 16*len(b.entries))
+	if _, err := rand.Read(weights); err != nil {
+		for _, valid := range b.verifyEach() {
+			if !valid {
+				return false
+			}
+		}
+		return true
+	}
+	// the combined equation is
+	// 8*((sum z_i s_i)*B - sum z_i*R_i - sum (z_i h_i)*A_i) = 0
+	scalars := make([][32]byte, 2*len(b.entries))
+	points := make([]edwards25519.ExtendedGroupElement, 2*len(b.entries))
+	var sum, zero [32]byte
+	for n, entry := range b.entries {
+		if entry.signature[63]&224 != 0 {
+			return false
+		}
+		var s [32]byte
+		copy(s[:], entry.signature[32:])
+		if !edwards25519.ScMinimal(&s) {
+			return false
+		}
+		publicKey := [32]byte(entry.token)
+		A := &points[2*n]
+		if !A.FromBytes(&publicKey) {
+			return false
+		}
+		edwards25519.FeNeg(&A.X, &A.X)
+		edwards25519.FeNeg(&A.T, &A.T)
+		var encodedR [32]byte
+		copy(encodedR[:], entry.signature[:32])
+		R := &points[2*n+1]
+		if !R.FromBytes(&encodedR) {
+			return false
+		}
+		edwards25519.FeNeg(&R.X, &R.X)
+		edwards25519.FeNeg(&R.T, &R.T)
+
+		h := sha512.New()
+		h.Write(encodedR[:])
+		h.Write(publicKey[:])
+		h.Write(entry.msg)
+		var digest [64]byte
+		h.Sum(digest[:0])
+		var hReduced [32]byte
+		edwards25519.ScReduce(&hReduced, &digest)
+
+		var z [32]byte
+		copy(z[:16], weights[16*n:16*(n+1)])
+		edwards25519.ScMulAdd(&scalars[2*n], &z, &hReduced, &zero)
+		scalars[2*n+1] = z
+		edwards25519.ScMulAdd(&sum, &z, &s, &sum)
+	}
+	var check edwards25519.ProjectiveGroupElement
+	edwards25519.GeMultiScalarMultVartime(&check, scalars, points, &sum)
+	var t edwards25519.CompletedGroupElement
+	for i := 0; i < 3; i++ {
+		check.Double(&t)
+		t.ToProjective(&check)
+	}
+	var encoded [32]byte
+	check.ToBytes(&encoded)
+	return encoded == identityEncoding
+}
+
+// VerifyEach returns the validity of each signature on the batch in the order
+// they were added. The batch is verified at once and, only if it fails, each
+// signature is verified individually to find the invalid ones.
+func (b *BatchVerifier) VerifyEach() []bool {
+	if b.Verify() {
+		valid := make([]bool, len(b.entries))
+		for n := range valid {
+			valid[n] = true
+		}
+		return valid
+	}
+	return b.verifyEach()
+}
+
+// verifyEach verifies each signature individually.
+func (b *BatchVerifier) verifyEach() []bool {
+	valid := make([]bool, len(b.entries))
+	for n, entry := range b.entries {
+		valid[n] = entry.token.Verify(entry.msg, entry.signature)
+	}
+	return valid
+}
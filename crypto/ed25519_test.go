@@ -9,10 +9,13 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha512"
 	"encoding/hex"
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/freehandle/breeze/crypto/edwards25519"
 )
 
 type zeroReader struct{}
@@ -135,3 +138,106 @@ func TestMalleability(t *testing.T) {
 		t.Fatal("non-canonical signature accepted")
 	}
 }
+
+func TestBatchVerify(t *testing.T) {
+	batch := NewBatchVerifier(64)
+	messages := make([][]byte, 64)
+	for n := range messages {
+		public, private := RandomAsymetricKey()
+		messages[n] = []byte(strings.Repeat("m", n))
+		batch.Add(public, messages[n], private.Sign(messages[n]))
+	}
+	if !batch.Verify() {
+		t.Fatal("valid batch rejected")
+	}
+	for n, valid := range batch.VerifyEach() {
+		if !valid {
+			t.Errorf("valid signature %d rejected", n)
+		}
+	}
+	batch.entries[17].msg = []byte("wrong message")
+	if batch.Verify() {
+		t.Fatal("batch with signature of different message accepted")
+	}
+	for n, valid := range batch.VerifyEach() {
+		if valid == (n == 17) {
+			t.Errorf("unexpected validity of signature %d: %v", n, valid)
+		}
+	}
+	batch.entries[17].msg = messages[17]
+	// non-canonical signature of TestMalleability
+	sig := batch.entries[3].signature
+	sig[63] |= 0x10
+	batch.entries[3].signature = sig
+	if batch.Verify() {
+		t.Fatal("batch with non-canonical signature accepted")
+	}
+	if !NewBatchVerifier(0).Verify() {
+		t.Error("empty batch rejected")
+	}
+}
+
+// torsionSign signs msg with the secret scalar a and the point of order 8 as
+// the commitment R. The signature satisfies the cofactored verification
+// equation but not the cofactorless one checked by Token.Verify.
+func torsionSign(msg []byte) (Token, Signature) {
+	var seed [64]byte
+	copy(seed[:], []byte("torsion signature secret scalar"))
+	var a [32]byte
+	edwards25519.ScReduce(&a, &seed)
+	var A edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&A, &a)
+	var publicKey [32]byte
+	A.ToBytes(&publicKey)
+	token := Token(publicKey)
+	torsion, _ := hex.DecodeString("26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05")
+	h := sha512.New()
+	h.Write(torsion)
+	h.Write(publicKey[:])
+	h.Write(msg)
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var hReduced, s, zero [32]byte
+	edwards25519.ScReduce(&hReduced, &digest)
+	edwards25519.ScMulAdd(&s, &hReduced, &a, &zero)
+	var signature Signature
+	copy(signature[:32], torsion)
+	copy(signature[32:], s[:])
+	return token, signature
+}
+
+func TestTorsionSignature(t *testing.T) {
+	msg := []byte("torsion")
+	token, signature := torsionSign(msg)
+	paths := func(msg []byte) []bool {
+		single := NewBatchVerifier(1)
+		single.Add(token, msg, signature)
+		batch := NewBatchVerifier(64)
+		fallback := NewBatchVerifier(64)
+		for n := 0; n < 63; n++ {
+			public, private := RandomAsymetricKey()
+			message := []byte(strings.Repeat("m", n))
+			batch.Add(public, message, private.Sign(message))
+			if n == 11 {
+				message = []byte("wrong message")
+			}
+			fallback.Add(public, message, private.Sign([]byte(strings.Repeat("m", n))))
+		}
+		batch.Add(token, msg, signature)
+		fallback.Add(token, msg, signature)
+		each := batch.VerifyEach()
+		return []bool{token.Verify(msg, signature), single.Verify(), batch.Verify(), each[63], fallback.VerifyEach()[63]}
+	}
+	// only a passing batch checks the cofactored equation, single and
+	// fallback verification check the cofactorless one
+	for n, valid := range paths(msg) {
+		if accepted := n == 2 || n == 3; valid != accepted {
+			t.Errorf("torsion signature on verification path %d: valid %v", n, valid)
+		}
+	}
+	for n, valid := range paths([]byte("other")) {
+		if valid {
+			t.Errorf("torsion signature of other message accepted by verification path %d", n)
+		}
+	}
+}
@@ -1791,3 +1791,67 @@ func ScMinimal(scalar *[32]byte) bool {
 
 	return true
 }
+
+// GeMultiScalarMultVartime sets r = a[0]*A[0] + ... + a[n-1]*A[n-1] + b*B
+// where B is the Ed25519 base point. Doublings are shared among all points
+// (Straus' method), so that the cost per point is mostly that of additions.
+// Scalars must be below 2^255.
+func GeMultiScalarMultVartime(r *ProjectiveGroupElement, a [][32]byte, A []ExtendedGroupElement, b *[32]byte) {
+	aSlide := make([][256]int8, len(A))
+	Ai := make([][8]CachedGroupElement, len(A)) // A,3A,5A,7A,9A,11A,13A,15A
+	var bSlide [256]int8
+	var t CompletedGroupElement
+	var u, A2 ExtendedGroupElement
+
+	for n := range A {
+		slide(&aSlide[n], &a[n])
+		A[n].ToCached(&Ai[n][0])
+		A[n].Double(&t)
+		t.ToExtended(&A2)
+		for i := 0; i < 7; i++ {
+			geAdd(&t, &A2, &Ai[n][i])
+			t.ToExtended(&u)
+			u.ToCached(&Ai[n][i+1])
+		}
+	}
+	slide(&bSlide, b)
+
+	r.Zero()
+
+	i := 255
+top:
+	for ; i >= 0; i-- {
+		if bSlide[i] != 0 {
+			break
+		}
+		for n := range aSlide {
+			if aSlide[n][i] != 0 {
+				break top
+			}
+		}
+	}
+
+	for ; i >= 0; i-- {
+		r.Double(&t)
+
+		for n := range aSlide {
+			if digit := aSlide[n][i]; digit > 0 {
+				t.ToExtended(&u)
+				geAdd(&t, &u, &Ai[n][digit/2])
+			} else if digit < 0 {
+				t.ToExtended(&u)
+				geSub(&t, &u, &Ai[n][(-digit)/2])
+			}
+		}
+
+		if bSlide[i] > 0 {
+			t.ToExtended(&u)
+			geMixedAdd(&t, &u, &bi[bSlide[i]/2])
+		} else if bSlide[i] < 0 {
+			t.ToExtended(&u)
+			geMixedSub(&t, &u, &bi[(-bSlide[i])/2])
+		}
+
+		t.ToProjective(r)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/protocol/state"
 	"github.com/freehandle/breeze/util"
 )
 
@@ -43,6 +44,7 @@ func TestSwell() {
 			MaxCommitteeSize: 100,
 			BlockInterval:    time.Second,
 			ChecksumWindow:   20,
+			UnbondingWindows: 2,
 			Permission:       permission.Permissionless{},
 		},
 		Relay:    relayNode,
@@ -106,6 +108,7 @@ func TestSwell() {
 				MaxCommitteeSize: 100,
 				BlockInterval:    time.Second,
 				ChecksumWindow:   20,
+				UnbondingWindows: 2,
 				Permission:       permission.Permissionless{},
 			},
 			Relay:    relayNode,
@@ -442,7 +445,7 @@ func main2() {
 	fmt.Println("Time taken to create transfers:", time.Since(start))
 
 	testChain := chain.BlockchainFromGenesisState(pks[0], "",
-		crypto.HashToken(pks[0].PublicKey()), time.Second, 900,
+		crypto.HashToken(pks[0].PublicKey()), time.Second, 900, 2, 0, 0, state.IssuanceSchedule{},
 	)
 
 	block, err := testChain.BlockBuilder(1)
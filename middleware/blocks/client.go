@@ -98,13 +98,34 @@ func (c *BlocksClient) RequestBlocks(start, end uint64) ([]*chain.CommitBlock, e
 		if !ok {
 			return data, nil
 		}
-		block := chain.ParseCommitBlock(blockBytes)
-		if block != nil {
+		block, err := chain.ParseCommitBlock(blockBytes)
+		if err == nil {
 			data = append(data, block)
 		}
 	}
 }
 
+// Verifier checks commit blocks independently of the provider of the blocks,
+// as light.Client does against the signatures of the committee.
+type Verifier interface {
+	VerifyCommit(block *chain.CommitBlock) error
+}
+
+// RequestVerifiedBlocks requests the commit blocks from start to end epochs and
+// returns them only if all of them are accepted by the verifier.
+func (c *BlocksClient) RequestVerifiedBlocks(start, end uint64, verifier Verifier) ([]*chain.CommitBlock, error) {
+	blocks, err := c.RequestBlocks(start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		if err := verifier.VerifyCommit(block); err != nil {
+			return nil, fmt.Errorf("block at epoch %v: %w", block.Header.Epoch, err)
+		}
+	}
+	return blocks, nil
+}
+
 func (c *BlocksClient) SubscribeBlocksAtfer(start uint64) (chan *chain.CommitBlock, error) {
 	if !c.live {
 		return nil, errors.New("connection is lost")
@@ -127,8 +148,8 @@ func pipeBytesToBlock(in chan []byte) chan *chain.CommitBlock {
 				close(out)
 				return
 			}
-			block := chain.ParseCommitBlock(bytes)
-			if block != nil {
+			block, err := chain.ParseCommitBlock(bytes)
+			if err == nil {
 				out <- block
 			}
 		}
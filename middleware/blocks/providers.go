@@ -6,6 +6,7 @@ import (
 	"log/slog"
 
 	"github.com/freehandle/breeze/consensus/chain"
+	"github.com/freehandle/breeze/consensus/light"
 	"github.com/freehandle/breeze/consensus/swell"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/middleware/blockdb"
@@ -103,6 +104,29 @@ func BreezeIndexerProvider(ctx context.Context, standby *swell.StandByNode, idx
 	return chain
 }
 
+// BreezeLightProvider indexes the commit blocks of the verified header stream
+// of a light client with the standard breeze index.
+func BreezeLightProvider(ctx context.Context, client *light.Client) *util.Chain[*blockdb.IndexedBlock] {
+	epoch, _ := client.LastCommit()
+	chain := util.NewChain[*blockdb.IndexedBlock](ctx, epoch+1)
+	go func() {
+		for {
+			header := client.Headers.Pop()
+			if header == nil {
+				slog.Warn("Breeze Light Provider: header stream terminated")
+				return
+			}
+			indexed := &blockdb.IndexedBlock{
+				Epoch: header.Header.Epoch,
+				Data:  header.Block.Serialize(),
+				Items: breezeCommitToIndex(header.Block, breezeIndexFn),
+			}
+			chain.Push(indexed, header.Header.Epoch)
+		}
+	}()
+	return chain
+}
+
 func breezeIndexFn(data []byte) []crypto.Hash {
 	tokens := actions.GetTokens(data)
 	hashes := make([]crypto.Hash, 0, len(tokens))
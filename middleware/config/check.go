@@ -76,6 +76,15 @@ func (c BreezeConfig) Check() error {
 	if c.MaxBlockSize < 1e6 {
 		return fmt.Errorf("MaxBlockSize must be at least 1MB")
 	}
+	if c.UnbondingWindows < 1 {
+		return fmt.Errorf("UnbondingWindows must be at least 1")
+	}
+	if c.MinFeePerByte < 0 {
+		return fmt.Errorf("MinFeePerByte cannot be negative")
+	}
+	if c.BlockReward < 0 || c.HalvingInterval < 0 || c.InflationRate < 0 {
+		return fmt.Errorf("BlockReward, HalvingInterval and InflationRate cannot be negative")
+	}
 	return nil
 
 }
@@ -111,6 +120,16 @@ func (c GenesisConfig) Check() error {
 			return fmt.Errorf("invalid wallet %d and deposit %d", wallet.Wallet, wallet.Deposit)
 		}
 	}
+	if c.TimeStamp != "" {
+		if _, err := time.Parse(time.RFC3339, c.TimeStamp); err != nil {
+			return fmt.Errorf("invalid timestamp %s: %v", c.TimeStamp, err)
+		}
+	}
+	if c.Network != nil {
+		if err := c.Network.Check(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -6,9 +6,11 @@ import (
 	"os"
 	"time"
 
+	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/consensus/permission"
 	"github.com/freehandle/breeze/consensus/swell"
 	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/state"
 	"github.com/freehandle/breeze/socket"
 )
 
@@ -108,6 +110,23 @@ type BreezeConfig struct {
 	// MaxBlockSize is the maximum size of a block in bytes that mitigates the
 	// risk of a DDOS attack. It must be at least 1MB.
 	MaxBlockSize int // `json:"maxBlockSize"`
+	// UnbondingWindows is the number of checksum windows a withdraw of deposit
+	// remains in the unbonding queue (and slashable) before being released to
+	// the wallet. It must be at least 1.
+	UnbondingWindows int // `json:"unbondingWindows"`
+	// MinFeePerByte is the minimum fee per byte of action. The base fee per
+	// byte starts at this value and adapts to the fullness of blocks relative
+	// to half the MaxBlockSize. The base fee is burned.
+	MinFeePerByte int // `json:"minFeePerByte"`
+	// BlockReward is the number of tokens minted at every block and split
+	// among validators of the checksum window according to their weights.
+	BlockReward int // `json:"blockReward"`
+	// HalvingInterval is the number of blocks between halvings of the block
+	// reward. Zero for no halving.
+	HalvingInterval int // `json:"halvingInterval"`
+	// InflationRate is the number of tokens minted at every block for each
+	// billion tokens of total supply, on top of the block reward.
+	InflationRate int // `json:"inflationRate"`
 	// Configurations for the parameters defining the Swell protocol
 	Swell SwellConfig // `json:"swell"`
 }
@@ -127,6 +146,63 @@ type Peer struct {
 type GenesisConfig struct {
 	Wallets   []GenesisWallet // `json:"wallets"`
 	NetworkID string          // `json:"networkID"`
+	// TimeStamp is the start of the network in RFC3339 format. It should be
+	// left empty only for a network started by a single node, in which case
+	// the network starts at the time the genesis node is created.
+	TimeStamp string // `json:"timeStamp"`
+	// Network parameters shared by every node of the network. Can be left
+	// empty for the network configuration of the node.
+	Network *NetworkConfig // `json:"network"`
+}
+
+// GenesisFromConfig returns the genesis of the network defined by the genesis
+// configuration. If the genesis configuration does not provide the network
+// parameters, the given network configuration is used, and standard parameters
+// fill in what is missing. If no timestamp is provided the genesis starts now.
+func GenesisFromConfig(cfg *GenesisConfig, network *NetworkConfig) (*chain.Genesis, error) {
+	if cfg.Network != nil {
+		network = cfg.Network
+	}
+	if network == nil {
+		network = StandardBreezeNetworkConfig
+	}
+	parameters := *network
+	if parameters.Breeze == nil {
+		parameters.Breeze = StandardBreezeConfig
+	}
+	if parameters.Permission == nil {
+		parameters.Permission = StandardPoSConfig
+	}
+	timestamp := time.Now()
+	if cfg.TimeStamp != "" {
+		var err error
+		if timestamp, err = time.Parse(time.RFC3339, cfg.TimeStamp); err != nil {
+			return nil, fmt.Errorf("invalid genesis timestamp: %v", err)
+		}
+	}
+	swell := SwellConfigFromConfig(&parameters, cfg.NetworkID)
+	genesis := &chain.Genesis{
+		NetworkHash:      swell.NetworkHash,
+		TimeStamp:        timestamp,
+		Wallets:          make([]chain.GenesisWallet, 0, len(cfg.Wallets)),
+		BlockInterval:    swell.BlockInterval,
+		ChecksumWindow:   swell.ChecksumWindow,
+		UnbondingWindows: swell.UnbondingWindows,
+		MinFeePerByte:    swell.MinFeePerByte,
+		TargetBlockSize:  swell.TargetBlockSize,
+		Issuance:         swell.Issuance,
+	}
+	for _, wallet := range cfg.Wallets {
+		genesis.Wallets = append(genesis.Wallets, chain.GenesisWallet{
+			Token:   crypto.TokenFromString(wallet.Token),
+			Wallet:  uint64(wallet.Wallet),
+			Deposit: uint64(wallet.Deposit),
+		})
+	}
+	if err := genesis.Check(); err != nil {
+		return nil, err
+	}
+	return genesis, nil
 }
 
 type FirewallConfig struct {
@@ -172,6 +248,8 @@ var StandardBreezeConfig = &BreezeConfig{
 	ChecksumWindowBlocks:  900,
 	ChecksumCommitteeSize: 100,
 	MaxBlockSize:          1e9,
+	UnbondingWindows:      2,
+	MinFeePerByte:         1,
 	Swell:                 StandardSwellConfig,
 }
 
@@ -252,6 +330,14 @@ func SwellConfigFromConfig(cfg *NetworkConfig, networkID string) swell.SwellNetw
 		MaxCommitteeSize: cfg.Breeze.ChecksumCommitteeSize,
 		BlockInterval:    time.Duration(cfg.Breeze.BlockInterval) * time.Millisecond,
 		ChecksumWindow:   cfg.Breeze.ChecksumWindowBlocks,
+		UnbondingWindows: cfg.Breeze.UnbondingWindows,
+		MinFeePerByte:    uint64(cfg.Breeze.MinFeePerByte),
+		TargetBlockSize:  cfg.Breeze.MaxBlockSize / 2,
+		Issuance: state.IssuanceSchedule{
+			BlockReward:     uint64(cfg.Breeze.BlockReward),
+			HalvingInterval: uint64(cfg.Breeze.HalvingInterval),
+			InflationRate:   uint64(cfg.Breeze.InflationRate),
+		},
 	}
 	if poa := cfg.Permission.POA; poa != nil {
 		tokens := make([]crypto.Token, 0)
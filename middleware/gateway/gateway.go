@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/freehandle/breeze/consensus/chain"
@@ -60,19 +61,24 @@ type Gateway struct {
 	feedPool         *socket.TrustedAggregator
 	currentWindow    *WindowValidators
 	nextWindow       *WindowValidators
-	sealedBlocks     map[uint64]*chain.SealedBlock
+	sealedBlocks     map[uint64]*chain.SealedBlock // sealed blocks after the last commit
+	lastCommit       uint64
 	store            *store.ActionVault
+	mu               sync.Mutex
+	balances         map[crypto.Token][]*socket.SignedConnection // pending balance queries
 }
 
-func LaunchGateway(ctx context.Context, config Configuration, trusted *socket.SignedConnection, topology *messages.NetworkTopology, propose chan *store.Propose) {
+func LaunchGateway(ctx context.Context, config Configuration, trusted *socket.SignedConnection, topology *messages.NetworkTopology, propose chan *store.Propose) *Gateway {
 	clock := NewClockSyn(topology.Start, topology.StartAt, config.Breeze.BlockInterval)
-	gateway := Gateway{
+	gateway := &Gateway{
 		ctx:              ctx,
 		config:           config,
 		sync:             clock,
 		liveActionRelays: make([]*socket.SignedConnection, 0),
 		activeFwdPool:    make([]*socket.SignedConnection, 0),
-		store:            store.NewActionVault(ctx, clock.Epoch, propose),
+		sealedBlocks:     make(map[uint64]*chain.SealedBlock),
+		store:            store.NewActionVault(ctx, clock.Epoch, propose, config.Credentials),
+		balances:         make(map[crypto.Token][]*socket.SignedConnection),
 	}
 
 	windowReady := LaunchWindow(ctx, config, topology.Start, topology.End, topology.Order, topology.Validators)
@@ -127,6 +133,36 @@ func LaunchGateway(ctx context.Context, config Configuration, trusted *socket.Si
 
 		}
 	}()
+	return gateway
+}
+
+// QueryBalance forwards a balance query for token to the validators the
+// gateway listens to. The first response is sent to the connection.
+func (g *Gateway) QueryBalance(token crypto.Token, conn *socket.SignedConnection) {
+	g.mu.Lock()
+	pending := g.balances[token]
+	g.balances[token] = append(pending, conn)
+	g.mu.Unlock()
+	if len(pending) == 0 {
+		g.feedPool.SendAll(messages.BalanceRequest(token))
+	}
+}
+
+// answerBalance sends a balance response to every connection waiting for it.
+func (g *Gateway) answerBalance(data []byte) {
+	balance := messages.ParseBalance(data)
+	if balance == nil {
+		return
+	}
+	g.mu.Lock()
+	pending := g.balances[balance.Token]
+	delete(g.balances, balance.Token)
+	g.mu.Unlock()
+	for _, conn := range pending {
+		if conn.Live {
+			conn.Send(data)
+		}
+	}
 }
 
 func (g *Gateway) Forward(data []byte) {
@@ -210,6 +246,10 @@ func (g *Gateway) PrepareNextWindow(order []crypto.Token, validators []socket.To
 }
 
 func (g *Gateway) Sealed(sealed *chain.SealedBlock) {
+	if sealed.Header.Epoch <= g.lastCommit {
+		return
+	}
+	g.sealedBlocks[sealed.Header.Epoch] = sealed
 	for n := 0; n < sealed.Actions.Len(); n++ {
 		action := sealed.Actions.Get(n)
 		g.store.SealOnBlock(sealed.Header.Epoch, sealed.Seal.Hash, action)
@@ -233,12 +273,22 @@ func (g *Gateway) Commit(epoch uint64, hash crypto.Hash, commit *chain.BlockComm
 	for n := 0; n < sealed.Actions.Len(); n++ {
 		action := sealed.Actions.Get(n)
 		hash := crypto.Hasher(action)
-		if _, ok := invalid[hash]; !ok {
+		if _, ok := invalid[hash]; ok {
+			g.store.Invalidate(hash)
+		} else {
 			g.store.Commit(hash)
 		}
 	}
-	// only commit once
-	delete(g.sealedBlocks, epoch)
+	// only commit once. Sealed blocks of earlier epochs that were never
+	// committed, as those replaced by forced empty blocks, are dropped as well.
+	for sealedEpoch := range g.sealedBlocks {
+		if sealedEpoch <= epoch {
+			delete(g.sealedBlocks, sealedEpoch)
+		}
+	}
+	if epoch > g.lastCommit {
+		g.lastCommit = epoch
+	}
 }
 
 func (g *Gateway) Blockfeed() {
@@ -250,20 +300,26 @@ func (g *Gateway) Blockfeed() {
 		}
 		switch data[0] {
 		case messages.MsgSealedBlock:
-			sealed := chain.ParseSealedBlock(data[1:])
-			if sealed != nil {
-				g.Sealed(sealed)
+			sealed, err := chain.ParseSealedBlock(data[1:])
+			if err != nil {
+				slog.Warn("Blockfeed: invalid sealed block", "error", err)
+				continue
 			}
+			g.Sealed(sealed)
 		case messages.MsgCommit:
 			epoch, hash, bytes := messages.ParseEpochAndHash(data)
 			if sealed, ok := g.sealedBlocks[epoch]; ok {
 				if sealed.Seal.Hash.Equal(hash) {
-					commit := chain.ParseBlockCommit(bytes)
-					if commit != nil {
-						g.Commit(epoch, hash, commit)
+					commit, err := chain.ParseBlockCommit(bytes)
+					if err != nil {
+						slog.Warn("Blockfeed: invalid block commit", "epoch", epoch, "error", err)
+						continue
 					}
+					g.Commit(epoch, hash, commit)
 				}
 			}
+		case messages.MsgBalance:
+			g.answerBalance(data)
 		case messages.MsgNextCommittee:
 			order, validators := swell.ParseCommitee(data[1:])
 			g.PrepareNextWindow(order, validators)
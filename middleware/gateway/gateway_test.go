@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/consensus/messages"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/middleware/admin"
@@ -125,3 +126,23 @@ func TestGateway(t *testing.T) {
 	}
 	cancel()
 }
+
+func TestSealedBlocksPruned(t *testing.T) {
+	gateway := &Gateway{sealedBlocks: make(map[uint64]*chain.SealedBlock)}
+	sealed := func(epoch uint64) *chain.SealedBlock {
+		return &chain.SealedBlock{Header: chain.BlockHeader{Epoch: epoch}, Actions: chain.NewActionArray()}
+	}
+	for _, epoch := range []uint64{1, 2, 3, 5} {
+		gateway.Sealed(sealed(epoch))
+	}
+	// epoch 2 never committed, as replaced by a forced empty block
+	gateway.Commit(1, crypto.ZeroHash, &chain.BlockCommit{})
+	gateway.Commit(3, crypto.ZeroHash, &chain.BlockCommit{})
+	if len(gateway.sealedBlocks) != 1 || gateway.sealedBlocks[5] == nil {
+		t.Fatalf("sealed blocks up to the committed epoch kept: %d", len(gateway.sealedBlocks))
+	}
+	gateway.Sealed(sealed(2))
+	if gateway.sealedBlocks[2] != nil {
+		t.Fatal("sealed block before the last commit kept")
+	}
+}
@@ -39,6 +39,7 @@ type Server struct {
 	mu      sync.Mutex
 	serving []*socket.SignedConnection
 	clock   *ClockSync
+	gateway *Gateway
 }
 
 func RetrieveTopology(config Configuration) (*messages.NetworkTopology, *socket.SignedConnection) {
@@ -78,10 +79,11 @@ func NewServer(ctx context.Context, config Configuration, administration *admin.
 
 	proposal := make(chan *store.Propose)
 	fmt.Println("launching gateway")
-	LaunchGateway(ctx, config, conn, topology, proposal)
+	gateway := LaunchGateway(ctx, config, conn, topology, proposal)
 
 	server := Server{
 		serving: make([]*socket.SignedConnection, 0),
+		gateway: gateway,
 	}
 
 	server.clock = &ClockSync{
@@ -158,6 +160,14 @@ func (s *Server) WaitForActions(conn *socket.SignedConnection, proposal chan *st
 			slog.Info("connection terminated by client", "token", conn.Token)
 			break
 		}
+		if data[0] == messages.MsgBalanceRequest {
+			if token := messages.ParseBalanceRequest(data); token != crypto.ZeroToken && s.gateway != nil {
+				s.gateway.QueryBalance(token, conn)
+			} else {
+				conn.Send([]byte{messages.MsgError})
+			}
+			continue
+		}
 		if data[0] == messages.MsgAction && len(data) > 1 {
 			proposal <- &store.Propose{
 				Data: data[1:],
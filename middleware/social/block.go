@@ -230,7 +230,10 @@ func ParseSocialBlock(data []byte) *SocialBlock {
 	block.Checkpoint, position = util.ParseUint64(data, position)
 	block.BreezeBlock, position = util.ParseHash(data, position)
 	block.Pedigree, position = ParsePedigree(data, position)
-	block.Actions, position = chain.ParseAction(data, position)
+	var err error
+	if block.Actions, position, err = chain.ParseAction(data, position); err != nil {
+		return nil
+	}
 	block.SealHash = crypto.Hasher(data[:position])
 	block.Invalidated, position = util.ParseHashArray(data, position)
 	block.CommitHash = crypto.Hasher(data[:position])
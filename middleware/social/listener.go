@@ -67,23 +67,26 @@ type breezeListener struct {
 func (b *breezeListener) Apply(msg []byte) {
 	switch msg[0] {
 	case messages.MsgSealedBlock:
-		sealed := chain.ParseSealedBlock(msg[1:])
+		sealed, err := chain.ParseSealedBlock(msg[1:])
+		if err != nil {
+			slog.Info("BreezeBlockListener: invalid sealed block", "error", err)
+			return
+		}
 		fmt.Println("sealed", sealed.Header.Epoch)
-		if sealed != nil {
-			social := BreezeSealedBlockToSocialBlock(sealed)
-			if social == nil {
-				slog.Error("BreezeBlockListener: return nil")
-				return
-			}
-			b.blocks <- social
+		social := BreezeSealedBlockToSocialBlock(sealed)
+		if social == nil {
+			slog.Error("BreezeBlockListener: return nil")
+			return
 		}
+		b.blocks <- social
 	case messages.MsgCommit:
 		epoch, hash, bytes := messages.ParseEpochAndHash(msg[1:])
-		commit := chain.ParseBlockCommit(bytes)
-		fmt.Println("commit", epoch)
-		if commit == nil {
+		commit, err := chain.ParseBlockCommit(bytes)
+		if err != nil {
+			slog.Info("BreezeBlockListener: invalid block commit", "epoch", epoch, "error", err)
 			return
 		}
+		fmt.Println("commit", epoch)
 		social := &SocialBlockCommit{
 			ProtocolCode:    b.code,
 			Epoch:           epoch,
@@ -96,16 +99,18 @@ func (b *breezeListener) Apply(msg []byte) {
 		b.commits <- social
 
 	case messages.MsgCommittedBlock:
-		committed := chain.ParseCommitBlock(msg[1:])
+		committed, err := chain.ParseCommitBlock(msg[1:])
+		if err != nil {
+			slog.Info("BreezeBlockListener: invalid committed block", "error", err)
+			return
+		}
 		fmt.Println("committed", committed.Header.Epoch)
-		if committed != nil {
-			social := BreezeComiittedBlockToSocialBlock(committed)
-			if social == nil {
-				slog.Error("BreezeComiittedBlockToSocialBlock: return nil")
-				return
-			}
-			b.blocks <- social
+		social := BreezeComiittedBlockToSocialBlock(committed)
+		if social == nil {
+			slog.Error("BreezeComiittedBlockToSocialBlock: return nil")
+			return
 		}
+		b.blocks <- social
 	}
 }
 
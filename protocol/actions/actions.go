@@ -1,7 +1,7 @@
 /*
 Package actions implements the actions of the Breeze protocol.
 
-Within Breeze thre are four types of actions:
+Within Breeze thre are eleven types of actions:
 
 1. Transfer: A transfer action is used to transfer tokens from one account to
 one or more other accounts. A transfer action is signed by the sender account.
@@ -11,6 +11,22 @@ participating in the consensus.
 4. Void: A void action is general purpose action that can intends to use
 the Breeze protocol for the basic purpose of an action gateway for more
 specialized protocols.
+5. Multisig Policy: A multisig policy action converts a wallet into a M-of-N
+multisig wallet.
+6. Multisig Transfer: A transfer from a multisig wallet cosigned by at least
+the threshold number of signers of the wallet policy.
+7. Lock: A lock action transfers tokens into a wallet under an unlock
+schedule, either at a future epoch or vesting linearly.
+8. Batch: An atomic settlement of transfers from many senders, each leg signed
+by its own sender. Either every leg is paid or none is.
+9. Delegate: A delegate action locks wallet tokens as stake backing a validator
+token. Delegated stake counts toward the weight of the validator and earns a
+share of its fees.
+10. Undelegate: An undelegate action releases delegated stake into the
+unbonding queue of the delegator.
+11. Register Protocol: A register protocol action claims a protocol code of
+void actions for a token, with rules on the size and on the fee of void
+actions of the protocol.
 
 actions package implements the serialization and deserialization of the
 mentioned actions. And provides basic interface to sign actions and verify
@@ -32,6 +48,13 @@ const (
 	ITransfer
 	IDeposit
 	IWithdraw
+	IMultisigPolicy
+	IMultisigTransfer
+	ILock
+	IBatch
+	IDelegate
+	IUndelegate
+	IRegisterProtocol
 	IUnkown
 )
 
@@ -73,9 +96,9 @@ func NewPayment(debitAcc crypto.Hash, value uint64) *Payment {
 }
 
 func (p *Payment) NewCredit(account crypto.Hash, value uint64) {
-	for _, credit := range p.Credit {
+	for n, credit := range p.Credit {
 		if credit.Account.Equal(account) {
-			credit.FungibleTokens += value
+			p.Credit[n].FungibleTokens += value
 			return
 		}
 	}
@@ -83,39 +106,159 @@ func (p *Payment) NewCredit(account crypto.Hash, value uint64) {
 }
 
 func (p *Payment) NewDebit(account crypto.Hash, value uint64) {
-	for _, debit := range p.Debit {
+	for n, debit := range p.Debit {
 		if debit.Account.Equal(account) {
-			debit.FungibleTokens += value
+			p.Debit[n].FungibleTokens += value
 			return
 		}
 	}
 	p.Debit = append(p.Debit, Wallet{Account: account, FungibleTokens: value})
 }
 
+// overflows returns true if the sum of the values does not fit into an uint64.
+// Actions whose payments would overflow are rejected by the parsers.
+func overflows(values ...uint64) bool {
+	total := uint64(0)
+	for _, value := range values {
+		if total+value < total {
+			return true
+		}
+		total += value
+	}
+	return false
+}
+
+// tokenValues returns the values of the token value pairs.
+func tokenValues(pairs []crypto.TokenValue) []uint64 {
+	values := make([]uint64, len(pairs))
+	for n, pair := range pairs {
+		values[n] = pair.Value
+	}
+	return values
+}
+
 func Kind(data []byte) byte {
 	return data[1]
 }
 
-func ParseAction(data []byte) Action {
+// verifier checks the signature of a token over a message of an action being
+// parsed.
+type verifier func(token crypto.Token, msg []byte, signature crypto.Signature) bool
+
+// verifySignature verifies signatures one at a time.
+func verifySignature(token crypto.Token, msg []byte, signature crypto.Signature) bool {
+	return token.Verify(msg, signature)
+}
+
+// skipVerification accepts every signature, for parsing of fields only.
+func skipVerification(token crypto.Token, msg []byte, signature crypto.Signature) bool {
+	return true
+}
+
+// checkKind returns a ParseError of the structure if the data is not an action
+// of the given kind.
+func checkKind(structure string, data []byte, kind byte) error {
+	if len(data) < 2 {
+		return util.NewParseError(structure, len(data), util.ErrTruncated)
+	}
+	if data[1] != kind {
+		return util.NewParseError(structure, 1, util.ErrUnknownKind)
+	}
+	return nil
+}
+
+// checkSignature returns a ParseError of the structure if the fields parsed up
+// to position are not followed by a single signature ending the data.
+func checkSignature(structure string, data []byte, position int) error {
+	return util.CheckEnd(structure, data, position+crypto.SignatureSize)
+}
+
+// SignedMessage is a signature carried by an action together with the signing
+// token and the signed message.
+type SignedMessage struct {
+	Token     crypto.Token
+	Message   []byte
+	Signature crypto.Signature
+}
+
+// ParseAction parses an action of any kind. Returns a util.ParseError if the
+// data is not a valid action or if any of its signatures is invalid.
+func ParseAction(data []byte) (Action, error) {
+	return parseAction(data, verifySignature)
+}
+
+// ParseActionUnverified parses an action of any kind without verifying its
+// signatures. It returns the signatures carried by the action, which must be
+// verified by the caller (see crypto.BatchVerifier) before the action is
+// taken as valid. Returns a util.ParseError if the data is not a valid action.
+func ParseActionUnverified(data []byte) (Action, []SignedMessage, error) {
+	signatures := make([]SignedMessage, 0, 1)
+	collect := func(token crypto.Token, msg []byte, signature crypto.Signature) bool {
+		signatures = append(signatures, SignedMessage{Token: token, Message: msg, Signature: signature})
+		return true
+	}
+	action, err := parseAction(data, collect)
+	if err != nil {
+		return nil, nil, err
+	}
+	return action, signatures, nil
+}
+
+// parseAction parses an action verifying its signatures with verify. Nil
+// pointers of parsers are converted into a nil Action.
+func parseAction(data []byte, verify verifier) (Action, error) {
+	if len(data) < 2 {
+		return nil, util.NewParseError("action", len(data), util.ErrTruncated)
+	}
 	if data[0] != 0 {
-		return nil
+		// only transfers are defined beyond version zero
+		if data[0] == NonceVersion && data[1] == ITransfer {
+			return nilAction(parseTransfer(data, verify))
+		}
+		return nil, util.NewParseError("action", 0, util.ErrUnknownKind)
 	}
 	switch data[1] {
 	case ITransfer:
-		return ParseTransfer(data)
+		return nilAction(parseTransfer(data, verify))
 	case IDeposit:
-		return ParseDeposit(data)
+		return nilAction(parseDeposit(data, verify))
 	case IWithdraw:
-		return ParseWithdraw(data)
+		return nilAction(parseWithdraw(data, verify))
 	case IVoid:
-		return ParseVoid(data)
+		return nilAction(parseVoid(data, verify))
+	case IMultisigPolicy:
+		return nilAction(parseMultisigPolicy(data, verify))
+	case IMultisigTransfer:
+		return nilAction(parseMultisigTransfer(data, verify))
+	case ILock:
+		return nilAction(parseLock(data, verify))
+	case IBatch:
+		return nilAction(parseBatch(data, verify))
+	case IDelegate:
+		return nilAction(parseDelegate(data, verify))
+	case IUndelegate:
+		return nilAction(parseUndelegate(data, verify))
+	case IRegisterProtocol:
+		return nilAction(parseRegisterProtocol(data, verify))
 	}
-	return nil
+	return nil, util.NewParseError("action", 1, util.ErrUnknownKind)
 }
 
-func GetTokens(data []byte) []crypto.Token {
-	action := ParseAction(data)
+// nilAction returns nil for a nil pointer to an action so that a failed parse
+// is not wrapped into a non nil Action interface.
+func nilAction[T any, P interface {
+	*T
+	Action
+}](action P, err error) (Action, error) {
 	if action == nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+func GetTokens(data []byte) []crypto.Token {
+	action, err := ParseAction(data)
+	if err != nil {
 		return nil
 	}
 	return action.Tokens()
@@ -130,7 +273,21 @@ func GetFeeFromBytes(action []byte) uint64 {
 	if len(action) < crypto.SignatureSize+8 {
 		return 0
 	}
-	fees, _ := util.ParseUint64(action, len(action)-crypto.SignatureSize-8-1)
+	if action[1] == IMultisigTransfer {
+		// cosignatures are appended after the fee
+		if transfer, err := parseMultisigTransfer(action, skipVerification); err == nil {
+			return transfer.Fee
+		}
+		return 0
+	}
+	if action[1] == IBatch {
+		// one signature per leg is appended after the fee
+		if batch, err := parseBatch(action, skipVerification); err == nil {
+			return batch.Fee
+		}
+		return 0
+	}
+	fees, _ := util.ParseUint64(action, len(action)-crypto.SignatureSize-8)
 	return fees
 }
 
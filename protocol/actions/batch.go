@@ -0,0 +1,217 @@
+package actions
+
+import (
+	"strings"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// MaxBatchLegs is the maximum number of legs of a batch transfer.
+const MaxBatchLegs = 256
+
+// BatchLeg is a transfer from the From wallet to the To wallets within a batch
+// transfer. The signature of the leg is the signature of the From wallet over
+// the entire batch, so that every sender agrees on the whole settlement.
+type BatchLeg struct {
+	From      crypto.Token
+	To        []crypto.TokenValue
+	Signature crypto.Signature
+}
+
+// Batch is an atomic settlement of transfers from many senders. Each leg is a
+// transfer signed by its own sender and the batch is validated as a single
+// action: either every leg is paid or none is. Senders must be distinct and
+// each sender must afford its leg with its balance prior to the credits of the
+// batch. The fee is paid by the sender of the first leg.
+type Batch struct {
+	TimeStamp uint64
+	Legs      []BatchLeg
+	Reason    string
+	Fee       uint64
+}
+
+func (b *Batch) Tokens() []crypto.Token {
+	tokens := make([]crypto.Token, 0)
+	seen := make(map[crypto.Token]struct{})
+	for _, leg := range b.Legs {
+		if _, ok := seen[leg.From]; !ok {
+			seen[leg.From] = struct{}{}
+			tokens = append(tokens, leg.From)
+		}
+		for _, to := range leg.To {
+			if _, ok := seen[to.Token]; !ok {
+				seen[to.Token] = struct{}{}
+				tokens = append(tokens, to.Token)
+			}
+		}
+	}
+	return tokens
+}
+
+func (b *Batch) FeePaid() uint64 {
+	return b.Fee
+}
+
+// Senders returns the tokens of the senders of the legs of the batch.
+func (b *Batch) Senders() []crypto.Token {
+	senders := make([]crypto.Token, len(b.Legs))
+	for n, leg := range b.Legs {
+		senders[n] = leg.From
+	}
+	return senders
+}
+
+func (b *Batch) serializeSign() []byte {
+	bytes := []byte{0, IBatch}
+	util.PutUint64(b.TimeStamp, &bytes)
+	util.PutUint16(uint16(len(b.Legs)), &bytes)
+	for _, leg := range b.Legs {
+		util.PutToken(leg.From, &bytes)
+		util.PutUint16(uint16(len(leg.To)), &bytes)
+		for _, to := range leg.To {
+			util.PutToken(to.Token, &bytes)
+			util.PutUint64(to.Value, &bytes)
+		}
+	}
+	util.PutString(b.Reason, &bytes)
+	util.PutUint64(b.Fee, &bytes)
+	return bytes
+}
+
+func (b *Batch) Serialize() []byte {
+	bytes := b.serializeSign()
+	for _, leg := range b.Legs {
+		util.PutSignature(leg.Signature, &bytes)
+	}
+	return bytes
+}
+
+func (b *Batch) Epoch() uint64 {
+	return b.TimeStamp
+}
+
+func (b *Batch) Kind() byte {
+	return IBatch
+}
+
+func (b *Batch) Payments() *Payment {
+	payment := &Payment{
+		Credit: make([]Wallet, 0),
+		Debit:  make([]Wallet, 0),
+	}
+	for n, leg := range b.Legs {
+		total := uint64(0)
+		for _, credit := range leg.To {
+			payment.NewCredit(crypto.HashToken(credit.Token), credit.Value)
+			total += credit.Value
+		}
+		if n == 0 {
+			total += b.Fee
+		}
+		payment.NewDebit(crypto.HashToken(leg.From), total)
+	}
+	return payment
+}
+
+// Sign signs the batch on behalf of the sender of the leg associated to the
+// key. Legs must be signed after every other field of the batch is set. It
+// returns false if the key is not the sender of any leg.
+func (b *Batch) Sign(key crypto.PrivateKey) bool {
+	token := key.PublicKey()
+	for n, leg := range b.Legs {
+		if leg.From.Equal(token) {
+			b.Legs[n].Signature = key.Sign(b.serializeSign())
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Batch) JSON() string {
+	legs := make([]string, len(b.Legs))
+	for n, leg := range b.Legs {
+		bulk := &util.JSONBuilder{}
+		bulk.PutHex("from", leg.From[:])
+		bulk.PutTokenValueArray("to", leg.To)
+		bulk.PutBase64("signature", leg.Signature[:])
+		legs[n] = bulk.ToString()
+	}
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "batch")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(IBatch))
+	bulk.PutUint64("epoch", b.TimeStamp)
+	bulk.PutJSON("legs", "["+strings.Join(legs, ",")+"]")
+	bulk.PutString("reason", b.Reason)
+	bulk.PutUint64("fee", b.Fee)
+	return bulk.ToString()
+}
+
+// ParseBatch parses a batch transfer action. Returns a util.ParseError if the
+// batch has no legs or more than MaxBatchLegs, if a leg has no recipients, if
+// the total of a leg overflows, if senders are repeated or if the signature of
+// any leg is invalid.
+func ParseBatch(data []byte) (*Batch, error) {
+	return parseBatch(data, verifySignature)
+}
+
+func parseBatch(data []byte, verify verifier) (*Batch, error) {
+	if err := checkKind("batch", data, IBatch); err != nil {
+		return nil, err
+	}
+	p := Batch{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	var count uint16
+	count, position = util.ParseUint16(data, position)
+	if err := util.CheckTruncated("batch", data, position+int(count)*(crypto.TokenSize+2+crypto.SignatureSize)); err != nil {
+		return nil, err
+	}
+	if count == 0 || count > MaxBatchLegs {
+		return nil, util.NewParseError("batch", position-2, util.ErrInvalidValue)
+	}
+	p.Legs = make([]BatchLeg, int(count))
+	totals := make([]uint64, int(count))
+	for n := range p.Legs {
+		var recipients uint16
+		p.Legs[n].From, position = util.ParseToken(data, position)
+		recipients, position = util.ParseUint16(data, position)
+		if err := util.CheckTruncated("batch", data, position+int(recipients)*(crypto.TokenSize+8)); err != nil {
+			return nil, err
+		}
+		if recipients == 0 {
+			return nil, util.NewParseError("batch", position-2, util.ErrInvalidValue)
+		}
+		p.Legs[n].To = make([]crypto.TokenValue, int(recipients))
+		total := uint64(0)
+		for i := range p.Legs[n].To {
+			p.Legs[n].To[i].Token, position = util.ParseToken(data, position)
+			p.Legs[n].To[i].Value, position = util.ParseUint64(data, position)
+			if total+p.Legs[n].To[i].Value < total {
+				return nil, util.NewParseError("batch", position-8, util.ErrInvalidValue)
+			}
+			total += p.Legs[n].To[i].Value
+		}
+		totals[n] = total
+	}
+	p.Reason, position = util.ParseString(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := util.CheckEnd("batch", data, position+int(count)*crypto.SignatureSize); err != nil {
+		return nil, err
+	}
+	if totals[0]+p.Fee < totals[0] {
+		return nil, util.NewParseError("batch", position-8, util.ErrInvalidValue)
+	}
+	if hasDuplicateTokens(p.Senders()) {
+		return nil, util.NewParseError("batch", 12, util.ErrInvalidValue)
+	}
+	msg := data[0:position]
+	for n := range p.Legs {
+		p.Legs[n].Signature, position = util.ParseSignature(data, position)
+		if !verify(p.Legs[n].From, msg, p.Legs[n].Signature) {
+			return nil, util.NewParseError("batch", position-crypto.SignatureSize, util.ErrBadSignature)
+		}
+	}
+	return &p, nil
+}
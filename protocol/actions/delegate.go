@@ -0,0 +1,202 @@
+package actions
+
+import (
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Delegate locks Value from the wallet of the delegator as stake backing the
+// validator token. Delegated stake counts toward the weight of the validator
+// and earns the delegator a proportional share of the fees collected by the
+// validator. It is signed by the delegator, so that token holders can back a
+// validator without handing over keys.
+type Delegate struct {
+	TimeStamp uint64
+	Delegator crypto.Token
+	Validator crypto.Token
+	Value     uint64
+	Fee       uint64
+	Signature crypto.Signature
+}
+
+func (d *Delegate) Tokens() []crypto.Token {
+	return []crypto.Token{d.Delegator, d.Validator}
+}
+
+func (d *Delegate) FeePaid() uint64 {
+	return d.Fee
+}
+
+func (d *Delegate) serializeSign() []byte {
+	bytes := []byte{0, IDelegate}
+	util.PutUint64(d.TimeStamp, &bytes)
+	util.PutToken(d.Delegator, &bytes)
+	util.PutToken(d.Validator, &bytes)
+	util.PutUint64(d.Value, &bytes)
+	util.PutUint64(d.Fee, &bytes)
+	return bytes
+}
+
+func (d *Delegate) Serialize() []byte {
+	bytes := d.serializeSign()
+	util.PutSignature(d.Signature, &bytes)
+	return bytes
+}
+
+func (d *Delegate) Epoch() uint64 {
+	return d.TimeStamp
+}
+
+func (d *Delegate) Kind() byte {
+	return IDelegate
+}
+
+func (d *Delegate) Payments() *Payment {
+	return NewPayment(crypto.HashToken(d.Delegator), d.Value+d.Fee)
+}
+
+func (d *Delegate) Sign(key crypto.PrivateKey) {
+	d.Signature = key.Sign(d.serializeSign())
+}
+
+func (d *Delegate) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "delegate")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(IDelegate))
+	bulk.PutUint64("epoch", d.TimeStamp)
+	bulk.PutHex("delegator", d.Delegator[:])
+	bulk.PutHex("validator", d.Validator[:])
+	bulk.PutUint64("value", d.Value)
+	bulk.PutUint64("fee", d.Fee)
+	bulk.PutBase64("signature", d.Signature[:])
+	return bulk.ToString()
+}
+
+// ParseDelegate parses a delegate action. Returns a util.ParseError if the
+// data is not a valid delegate action or if the signature of the delegator is
+// invalid.
+func ParseDelegate(data []byte) (*Delegate, error) {
+	return parseDelegate(data, verifySignature)
+}
+
+func parseDelegate(data []byte, verify verifier) (*Delegate, error) {
+	if err := checkKind("delegate", data, IDelegate); err != nil {
+		return nil, err
+	}
+	p := Delegate{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	p.Delegator, position = util.ParseToken(data, position)
+	p.Validator, position = util.ParseToken(data, position)
+	p.Value, position = util.ParseUint64(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("delegate", data, position); err != nil {
+		return nil, err
+	}
+	if overflows(p.Value, p.Fee) {
+		return nil, util.NewParseError("delegate", position, util.ErrInvalidValue)
+	}
+	msgToVerify := data[0:position]
+	p.Signature, _ = util.ParseSignature(data, position)
+	if !verify(p.Delegator, msgToVerify, p.Signature) {
+		return nil, util.NewParseError("delegate", position, util.ErrBadSignature)
+	}
+	return &p, nil
+}
+
+// Undelegate releases Value of the stake delegated by the delegator to the
+// validator. The released stake enters the unbonding queue of the delegator
+// and reaches its wallet after the unbonding period. The fee is paid from the
+// wallet of the delegator.
+type Undelegate struct {
+	TimeStamp uint64
+	Delegator crypto.Token
+	Validator crypto.Token
+	Value     uint64
+	Fee       uint64
+	Signature crypto.Signature
+}
+
+func (u *Undelegate) Tokens() []crypto.Token {
+	return []crypto.Token{u.Delegator, u.Validator}
+}
+
+func (u *Undelegate) FeePaid() uint64 {
+	return u.Fee
+}
+
+func (u *Undelegate) serializeSign() []byte {
+	bytes := []byte{0, IUndelegate}
+	util.PutUint64(u.TimeStamp, &bytes)
+	util.PutToken(u.Delegator, &bytes)
+	util.PutToken(u.Validator, &bytes)
+	util.PutUint64(u.Value, &bytes)
+	util.PutUint64(u.Fee, &bytes)
+	return bytes
+}
+
+func (u *Undelegate) Serialize() []byte {
+	bytes := u.serializeSign()
+	util.PutSignature(u.Signature, &bytes)
+	return bytes
+}
+
+func (u *Undelegate) Epoch() uint64 {
+	return u.TimeStamp
+}
+
+func (u *Undelegate) Kind() byte {
+	return IUndelegate
+}
+
+func (u *Undelegate) Payments() *Payment {
+	return NewPayment(crypto.HashToken(u.Delegator), u.Fee)
+}
+
+func (u *Undelegate) Sign(key crypto.PrivateKey) {
+	u.Signature = key.Sign(u.serializeSign())
+}
+
+func (u *Undelegate) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "undelegate")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(IUndelegate))
+	bulk.PutUint64("epoch", u.TimeStamp)
+	bulk.PutHex("delegator", u.Delegator[:])
+	bulk.PutHex("validator", u.Validator[:])
+	bulk.PutUint64("value", u.Value)
+	bulk.PutUint64("fee", u.Fee)
+	bulk.PutBase64("signature", u.Signature[:])
+	return bulk.ToString()
+}
+
+// ParseUndelegate parses an undelegate action. Returns a util.ParseError if the
+// data is not a valid undelegate action or if the signature of the delegator is
+// invalid.
+func ParseUndelegate(data []byte) (*Undelegate, error) {
+	return parseUndelegate(data, verifySignature)
+}
+
+func parseUndelegate(data []byte, verify verifier) (*Undelegate, error) {
+	if err := checkKind("undelegate", data, IUndelegate); err != nil {
+		return nil, err
+	}
+	p := Undelegate{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	p.Delegator, position = util.ParseToken(data, position)
+	p.Validator, position = util.ParseToken(data, position)
+	p.Value, position = util.ParseUint64(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("undelegate", data, position); err != nil {
+		return nil, err
+	}
+	msgToVerify := data[0:position]
+	p.Signature, _ = util.ParseSignature(data, position)
+	if !verify(p.Delegator, msgToVerify, p.Signature) {
+		return nil, util.NewParseError("undelegate", position, util.ErrBadSignature)
+	}
+	return &p, nil
+}
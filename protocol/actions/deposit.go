@@ -70,9 +70,15 @@ func (d *Deposit) JSON() string {
 	return bulk.ToString()
 }
 
-func ParseDeposit(data []byte) *Deposit {
-	if len(data) < 2 || data[1] != IDeposit {
-		return nil
+// ParseDeposit parses a deposit action. Returns a util.ParseError if the data
+// is not a valid deposit or if the signature is invalid.
+func ParseDeposit(data []byte) (*Deposit, error) {
+	return parseDeposit(data, verifySignature)
+}
+
+func parseDeposit(data []byte, verify verifier) (*Deposit, error) {
+	if err := checkKind("deposit", data, IDeposit); err != nil {
+		return nil, err
 	}
 	p := Deposit{}
 	position := 2
@@ -80,10 +86,16 @@ func ParseDeposit(data []byte) *Deposit {
 	p.Token, position = util.ParseToken(data, position)
 	p.Value, position = util.ParseUint64(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("deposit", data, position); err != nil {
+		return nil, err
+	}
+	if overflows(p.Value, p.Fee) {
+		return nil, util.NewParseError("deposit", position, util.ErrInvalidValue)
+	}
 	msgToVerify := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
-	if !p.Token.Verify(msgToVerify, p.Signature) {
-		return nil
+	if !verify(p.Token, msgToVerify, p.Signature) {
+		return nil, util.NewParseError("deposit", position, util.ErrBadSignature)
 	}
-	return &p
+	return &p, nil
 }
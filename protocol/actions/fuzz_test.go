@@ -0,0 +1,90 @@
+package actions
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// seedActions returns a signed action of every kind for the fuzzing corpus.
+func seedActions() []Action {
+	token, key := crypto.RandomAsymetricKey()
+	cosigner, cokey := crypto.RandomAsymetricKey()
+	transfer := &Transfer{TimeStamp: 10, From: token, To: []crypto.TokenValue{{Token: cosigner, Value: 5}}, Reason: "seed", Fee: 1}
+	transfer.Sign(key)
+	nonce := &Transfer{TimeStamp: 10, Nonce: 1, From: token, To: []crypto.TokenValue{{Token: cosigner, Value: 5}}, Fee: 1}
+	nonce.Sign(key)
+	deposit := &Deposit{TimeStamp: 10, Token: token, Value: 100, Fee: 1}
+	deposit.Sign(key)
+	withdraw := &Withdraw{TimeStamp: 10, Token: token, Value: 50, Fee: 1}
+	withdraw.Sign(key)
+	void := &Void{TimeStamp: 10, Protocol: 7, Data: []byte{1, 2, 3}, Wallet: token, Fee: 1}
+	void.Sign(key)
+	policy := &MultisigPolicy{TimeStamp: 10, Owner: token, Threshold: 1, Signers: []crypto.Token{cosigner}, Fee: 1}
+	policy.Sign(key)
+	multisig := &MultisigTransfer{TimeStamp: 10, From: token, To: []crypto.TokenValue{{Token: cosigner, Value: 5}}, Fee: 1}
+	multisig.Cosign(cokey)
+	lock := &Lock{TimeStamp: 10, From: token, To: cosigner, Value: 5, Unlock: 20, Vesting: 5, Fee: 1}
+	lock.Sign(key)
+	batch := &Batch{TimeStamp: 10, Legs: []BatchLeg{{From: token, To: []crypto.TokenValue{{Token: cosigner, Value: 5}}}, {From: cosigner, To: []crypto.TokenValue{{Token: token, Value: 3}}}}, Fee: 1}
+	batch.Sign(key)
+	batch.Sign(cokey)
+	delegate := &Delegate{TimeStamp: 10, Delegator: token, Validator: cosigner, Value: 20, Fee: 1}
+	delegate.Sign(key)
+	undelegate := &Undelegate{TimeStamp: 10, Delegator: token, Validator: cosigner, Value: 10, Fee: 1}
+	undelegate.Sign(key)
+	register := &RegisterProtocol{TimeStamp: 10, Owner: token, Protocol: 7, MaxDataSize: 10, MinFee: 2, Fee: 1}
+	register.Sign(key)
+	return []Action{transfer, nonce, deposit, withdraw, void, policy, multisig, lock, batch, delegate, undelegate, register}
+}
+
+// FuzzParseAction checks that arbitrary bytes never crash the parsers, that an
+// accepted action has a single serialization (so that its hash cannot be
+// malleated to escape replay protection) and that signatures are verified
+// alike by ParseAction and by the batch path of ParseActionUnverified.
+func FuzzParseAction(f *testing.F) {
+	for _, action := range seedActions() {
+		f.Add(action.Serialize())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		verified, verifiedErr := ParseAction(data)
+		action, signatures, err := ParseActionUnverified(data)
+		var parseErr *util.ParseError
+		if err != nil {
+			if verified != nil {
+				t.Fatal("verified action not parsed without verification")
+			}
+			if !errors.As(err, &parseErr) || !errors.As(verifiedErr, &parseErr) {
+				t.Fatalf("parsers returned errors of unexpected type: %v, %v", err, verifiedErr)
+			}
+			if errors.Is(verifiedErr, util.ErrBadSignature) {
+				t.Fatalf("signature checked on invalid action: %v", err)
+			}
+			return
+		}
+		if !bytes.Equal(action.Serialize(), data) {
+			t.Fatalf("action does not serialize back into its data: %x", data)
+		}
+		if action.Kind() != data[1] {
+			t.Fatalf("action of kind %v parsed from instruction %v", action.Kind(), data[1])
+		}
+		if fee := GetFeeFromBytes(data); fee != action.FeePaid() {
+			t.Fatalf("fee %v read from bytes, %v paid by action", fee, action.FeePaid())
+		}
+		valid := len(signatures) > 0
+		for _, signature := range signatures {
+			if !signature.Token.Verify(signature.Message, signature.Signature) {
+				valid = false
+			}
+		}
+		if valid != (verified != nil) {
+			t.Fatalf("signature verification disagrees with ParseAction: %v", valid)
+		}
+		if !valid && !errors.Is(verifiedErr, util.ErrBadSignature) {
+			t.Fatalf("invalid signature rejected with unexpected error: %v", verifiedErr)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package actions
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+// jsonTokenValue is the JSON representation of a crypto.TokenValue.
+type jsonTokenValue struct {
+	Token string `json:"token"`
+	Value uint64 `json:"value"`
+}
+
+// jsonAction gathers the fields emitted by the JSON method of the supported
+// actions.
+type jsonAction struct {
+	Kind            string           `json:"kind"`
+	Version         uint64           `json:"version"`
+	InstructionType *uint64          `json:"instructionType"`
+	Epoch           uint64           `json:"epoch"`
+	Nonce           uint64           `json:"nonce"`
+	From            string           `json:"from"`
+	To              []jsonTokenValue `json:"to"`
+	Reason          string           `json:"reason"`
+	Token           string           `json:"token"`
+	Value           uint64           `json:"value"`
+	Protocol        uint32           `json:"protocol"`
+	Data            string           `json:"data"`
+	Wallet          string           `json:"wallet"`
+	Delegator       string           `json:"delegator"`
+	Validator       string           `json:"validator"`
+	Fee             uint64           `json:"fee"`
+	Signature       string           `json:"signature"`
+}
+
+var jsonKinds = map[string]byte{
+	"void":       IVoid,
+	"transfer":   ITransfer,
+	"deposit":    IDeposit,
+	"withdraw":   IWithdraw,
+	"delegate":   IDelegate,
+	"undelegate": IUndelegate,
+}
+
+// ParseJSON parses the JSON representation of a Transfer, Deposit, Withdraw,
+// Delegate, Undelegate or Void action as produced by their JSON method. The
+// kind of action is given by the instructionType field or, if absent, by the
+// kind field. Tokens are expected as hex strings (with or without 0x prefix),
+// data and signature as base64 strings. The signature is optional so that unsigned actions can be
+// parsed, filled and signed.
+func ParseJSON(data []byte) (Action, error) {
+	var parsed jsonAction
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	kind, ok := jsonKinds[parsed.Kind]
+	if parsed.InstructionType != nil {
+		if ok && uint64(kind) != *parsed.InstructionType {
+			return nil, fmt.Errorf("kind %v does not match instruction type %v", parsed.Kind, *parsed.InstructionType)
+		}
+		if *parsed.InstructionType > 255 {
+			return nil, fmt.Errorf("invalid instruction type %v", *parsed.InstructionType)
+		}
+		kind = byte(*parsed.InstructionType)
+	} else if !ok {
+		return nil, errors.New("missing instruction type")
+	}
+	if parsed.Version > 0 && (kind != ITransfer || parsed.Version != uint64(NonceVersion)) {
+		return nil, fmt.Errorf("unsupported version %v", parsed.Version)
+	}
+	if parsed.Nonce > 0 && kind != ITransfer {
+		return nil, errors.New("nonce is only supported for transfers")
+	}
+	signature, err := parseJSONSignature(parsed.Signature)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case ITransfer:
+		if parsed.Version == uint64(NonceVersion) && parsed.Nonce == 0 {
+			return nil, errors.New("missing nonce")
+		}
+		transfer := Transfer{
+			TimeStamp: parsed.Epoch,
+			Nonce:     parsed.Nonce,
+			Reason:    parsed.Reason,
+			Fee:       parsed.Fee,
+			Signature: signature,
+			To:        make([]crypto.TokenValue, 0, len(parsed.To)),
+		}
+		if transfer.From, err = parseJSONToken("from", parsed.From); err != nil {
+			return nil, err
+		}
+		for _, to := range parsed.To {
+			token, err := parseJSONToken("to", to.Token)
+			if err != nil {
+				return nil, err
+			}
+			transfer.To = append(transfer.To, crypto.TokenValue{Token: token, Value: to.Value})
+		}
+		return &transfer, nil
+	case IDeposit, IWithdraw:
+		token, err := parseJSONToken("token", parsed.Token)
+		if err != nil {
+			return nil, err
+		}
+		if kind == IDeposit {
+			return &Deposit{TimeStamp: parsed.Epoch, Token: token, Value: parsed.Value, Fee: parsed.Fee, Signature: signature}, nil
+		}
+		return &Withdraw{TimeStamp: parsed.Epoch, Token: token, Value: parsed.Value, Fee: parsed.Fee, Signature: signature}, nil
+	case IDelegate, IUndelegate:
+		delegator, err := parseJSONToken("delegator", parsed.Delegator)
+		if err != nil {
+			return nil, err
+		}
+		validator, err := parseJSONToken("validator", parsed.Validator)
+		if err != nil {
+			return nil, err
+		}
+		if kind == IDelegate {
+			return &Delegate{TimeStamp: parsed.Epoch, Delegator: delegator, Validator: validator, Value: parsed.Value, Fee: parsed.Fee, Signature: signature}, nil
+		}
+		return &Undelegate{TimeStamp: parsed.Epoch, Delegator: delegator, Validator: validator, Value: parsed.Value, Fee: parsed.Fee, Signature: signature}, nil
+	case IVoid:
+		void := Void{
+			TimeStamp: parsed.Epoch,
+			Protocol:  parsed.Protocol,
+			Fee:       parsed.Fee,
+			Signature: signature,
+		}
+		if void.Data, err = base64.StdEncoding.DecodeString(parsed.Data); err != nil {
+			return nil, fmt.Errorf("invalid data: %v", err)
+		}
+		if void.Wallet, err = parseJSONToken("wallet", parsed.Wallet); err != nil {
+			return nil, err
+		}
+		return &void, nil
+	}
+	return nil, fmt.Errorf("unsupported instruction type %v", kind)
+}
+
+func parseJSONToken(field, value string) (crypto.Token, error) {
+	var token crypto.Token
+	bytes, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return token, fmt.Errorf("invalid %v token: %v", field, err)
+	}
+	if len(bytes) != crypto.TokenSize {
+		return token, fmt.Errorf("invalid %v token size: %v", field, len(bytes))
+	}
+	copy(token[:], bytes)
+	return token, nil
+}
+
+func parseJSONSignature(value string) (crypto.Signature, error) {
+	var signature crypto.Signature
+	if value == "" {
+		return signature, nil
+	}
+	bytes, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return signature, fmt.Errorf("invalid signature: %v", err)
+	}
+	if len(bytes) != crypto.SignatureSize {
+		return signature, fmt.Errorf("invalid signature size: %v", len(bytes))
+	}
+	copy(signature[:], bytes)
+	return signature, nil
+}
@@ -0,0 +1,65 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+)
+
+func TestParseJSON(t *testing.T) {
+	token, key := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	signed := []Action{
+		&Transfer{TimeStamp: 10, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 5}, {Token: token, Value: 7}}, Reason: `say "hi"`, Fee: 1},
+		&Transfer{TimeStamp: 11, Nonce: 3, From: token, To: []crypto.TokenValue{{Token: receiver, Value: 5}}, Fee: 2},
+		&Deposit{TimeStamp: 12, Token: token, Value: 100, Fee: 3},
+		&Withdraw{TimeStamp: 13, Token: token, Value: 50, Fee: 4},
+		&Void{TimeStamp: 14, Protocol: 7, Data: []byte{1, 2, 3}, Wallet: token, Fee: 5},
+		&Delegate{TimeStamp: 15, Delegator: token, Validator: receiver, Value: 20, Fee: 6},
+		&Undelegate{TimeStamp: 16, Delegator: token, Validator: receiver, Value: 10, Fee: 7},
+	}
+	for _, action := range signed {
+		switch v := action.(type) {
+		case *Transfer:
+			v.Sign(key)
+		case *Deposit:
+			v.Sign(key)
+		case *Withdraw:
+			v.Sign(key)
+		case *Void:
+			v.Sign(key)
+		case *Delegate:
+			v.Sign(key)
+		case *Undelegate:
+			v.Sign(key)
+		}
+		parsed, err := ParseJSON([]byte(action.JSON()))
+		if err != nil {
+			t.Fatalf("could not parse %v: %v", action.JSON(), err)
+		}
+		if !bytes.Equal(parsed.Serialize(), action.Serialize()) {
+			t.Errorf("round trip mismatch for %v", action.JSON())
+		}
+	}
+	unsigned, err := ParseJSON([]byte(`{"kind":"deposit","epoch":1,"token":"` + hex.EncodeToString(token[:]) + `","value":10}`))
+	if err != nil {
+		t.Fatalf("could not parse unsigned deposit: %v", err)
+	}
+	if deposit, ok := unsigned.(*Deposit); !ok || deposit.Value != 10 || deposit.Token != token {
+		t.Errorf("unexpected unsigned deposit %+v", unsigned)
+	}
+	invalid := []string{
+		`{"kind":"deposit","instructionType":1}`,
+		`{"instructionType":2,"version":1,"nonce":1}`,
+		`{"instructionType":1,"version":1,"from":"00"}`,
+		`{"kind":"multisig"}`,
+		`not json`,
+	}
+	for _, text := range invalid {
+		if _, err := ParseJSON([]byte(text)); err == nil {
+			t.Errorf("expected error parsing %v", text)
+		}
+	}
+}
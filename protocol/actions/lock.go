@@ -0,0 +1,119 @@
+package actions
+
+import (
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Lock transfers Value from the From wallet into the To wallet under an unlock
+// schedule. The funds are locked until the Unlock epoch. If Vesting is zero all
+// funds are released at Unlock, otherwise they are released linearly along the
+// Vesting epochs following Unlock. Locked funds cannot be spent by the To
+// wallet.
+type Lock struct {
+	TimeStamp uint64
+	From      crypto.Token
+	To        crypto.Token
+	Value     uint64
+	Unlock    uint64
+	Vesting   uint64
+	Fee       uint64
+	Signature crypto.Signature
+}
+
+func (l *Lock) Tokens() []crypto.Token {
+	if l.From.Equal(l.To) {
+		return []crypto.Token{l.From}
+	}
+	return []crypto.Token{l.From, l.To}
+}
+
+func (l *Lock) FeePaid() uint64 {
+	return l.Fee
+}
+
+func (l *Lock) serializeSign() []byte {
+	bytes := []byte{0, ILock}
+	util.PutUint64(l.TimeStamp, &bytes)
+	util.PutToken(l.From, &bytes)
+	util.PutToken(l.To, &bytes)
+	util.PutUint64(l.Value, &bytes)
+	util.PutUint64(l.Unlock, &bytes)
+	util.PutUint64(l.Vesting, &bytes)
+	util.PutUint64(l.Fee, &bytes)
+	return bytes
+}
+
+func (l *Lock) Serialize() []byte {
+	bytes := l.serializeSign()
+	util.PutSignature(l.Signature, &bytes)
+	return bytes
+}
+
+func (l *Lock) Epoch() uint64 {
+	return l.TimeStamp
+}
+
+func (l *Lock) Kind() byte {
+	return ILock
+}
+
+func (l *Lock) Payments() *Payment {
+	payment := NewPayment(crypto.HashToken(l.From), l.Value+l.Fee)
+	payment.NewCredit(crypto.HashToken(l.To), l.Value)
+	return payment
+}
+
+func (l *Lock) Sign(key crypto.PrivateKey) {
+	bytes := l.serializeSign()
+	l.Signature = key.Sign(bytes)
+}
+
+func (l *Lock) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "lock")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(ILock))
+	bulk.PutUint64("epoch", l.TimeStamp)
+	bulk.PutHex("from", l.From[:])
+	bulk.PutHex("to", l.To[:])
+	bulk.PutUint64("value", l.Value)
+	bulk.PutUint64("unlock", l.Unlock)
+	bulk.PutUint64("vesting", l.Vesting)
+	bulk.PutUint64("fee", l.Fee)
+	bulk.PutBase64("signature", l.Signature[:])
+	return bulk.ToString()
+}
+
+// ParseLock parses a lock action. Returns a util.ParseError if the signature is
+// invalid or if the locked value is zero.
+func ParseLock(data []byte) (*Lock, error) {
+	return parseLock(data, verifySignature)
+}
+
+func parseLock(data []byte, verify verifier) (*Lock, error) {
+	if err := checkKind("lock", data, ILock); err != nil {
+		return nil, err
+	}
+	p := Lock{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	p.From, position = util.ParseToken(data, position)
+	p.To, position = util.ParseToken(data, position)
+	p.Value, position = util.ParseUint64(data, position)
+	p.Unlock, position = util.ParseUint64(data, position)
+	p.Vesting, position = util.ParseUint64(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("lock", data, position); err != nil {
+		return nil, err
+	}
+	if p.Value == 0 || overflows(p.Value, p.Fee) {
+		return nil, util.NewParseError("lock", position, util.ErrInvalidValue)
+	}
+	msg := data[0:position]
+	p.Signature, _ = util.ParseSignature(data, position)
+	if !verify(p.From, msg, p.Signature) {
+		return nil, util.NewParseError("lock", position, util.ErrBadSignature)
+	}
+	return &p, nil
+}
@@ -0,0 +1,321 @@
+package actions
+
+import (
+	"errors"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// MaxMultisigSigners is the maximum number of signers of a multisig policy.
+const MaxMultisigSigners = 64
+
+// MaxMultisigRecipients is the maximum number of recipients of a multisig
+// transfer, as their count is serialized as a uint16.
+const MaxMultisigRecipients = 1<<16 - 1
+
+// ErrTooManyRecipients is returned by MultisigTransfer.Cosign for transfers
+// with more than MaxMultisigRecipients recipients.
+var ErrTooManyRecipients = errors.New("multisig transfer with too many recipients")
+
+// MultisigPolicy converts the Owner wallet into a M-of-N multisig wallet. Once
+// the policy is incorporated into the state, funds of the Owner wallet can only
+// be moved by a MultisigTransfer cosigned by at least Threshold of the Signers.
+// The policy is signed by the Owner and the fee is paid by the Owner.
+type MultisigPolicy struct {
+	TimeStamp uint64
+	Owner     crypto.Token
+	Threshold byte
+	Signers   []crypto.Token
+	Fee       uint64
+	Signature crypto.Signature
+}
+
+func (m *MultisigPolicy) Tokens() []crypto.Token {
+	return []crypto.Token{m.Owner}
+}
+
+func (m *MultisigPolicy) FeePaid() uint64 {
+	return m.Fee
+}
+
+func (m *MultisigPolicy) serializeSign() []byte {
+	bytes := []byte{0, IMultisigPolicy}
+	util.PutUint64(m.TimeStamp, &bytes)
+	util.PutToken(m.Owner, &bytes)
+	util.PutByte(m.Threshold, &bytes)
+	util.PutTokenArray(m.Signers, &bytes)
+	util.PutUint64(m.Fee, &bytes)
+	return bytes
+}
+
+func (m *MultisigPolicy) Serialize() []byte {
+	bytes := m.serializeSign()
+	util.PutSignature(m.Signature, &bytes)
+	return bytes
+}
+
+func (m *MultisigPolicy) Epoch() uint64 {
+	return m.TimeStamp
+}
+
+func (m *MultisigPolicy) Kind() byte {
+	return IMultisigPolicy
+}
+
+func (m *MultisigPolicy) Payments() *Payment {
+	return NewPayment(crypto.HashToken(m.Owner), m.Fee)
+}
+
+func (m *MultisigPolicy) Sign(key crypto.PrivateKey) {
+	bytes := m.serializeSign()
+	m.Signature = key.Sign(bytes)
+}
+
+func (m *MultisigPolicy) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "multisig policy")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(IMultisigPolicy))
+	bulk.PutUint64("epoch", m.TimeStamp)
+	bulk.PutHex("owner", m.Owner[:])
+	bulk.PutUint64("threshold", uint64(m.Threshold))
+	bulk.PutTokenArray("signers", m.Signers)
+	bulk.PutUint64("fee", m.Fee)
+	bulk.PutBase64("signature", m.Signature[:])
+	return bulk.ToString()
+}
+
+// ParseMultisigPolicy parses a multisig policy action. Returns a
+// util.ParseError if the signature is invalid, if the threshold is zero or
+// greater than the number of signers, or if signers are repeated.
+func ParseMultisigPolicy(data []byte) (*MultisigPolicy, error) {
+	return parseMultisigPolicy(data, verifySignature)
+}
+
+func parseMultisigPolicy(data []byte, verify verifier) (*MultisigPolicy, error) {
+	if err := checkKind("multisig policy", data, IMultisigPolicy); err != nil {
+		return nil, err
+	}
+	p := MultisigPolicy{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	p.Owner, position = util.ParseToken(data, position)
+	p.Threshold, position = util.ParseByte(data, position)
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if err := util.CheckTruncated("multisig policy", data, position); err != nil {
+		return nil, err
+	}
+	if count == 0 || count > MaxMultisigSigners || p.Threshold == 0 || uint32(p.Threshold) > count {
+		return nil, util.NewParseError("multisig policy", position-5, util.ErrInvalidValue)
+	}
+	if err := util.CheckTruncated("multisig policy", data, position+int(count)*crypto.TokenSize); err != nil {
+		return nil, err
+	}
+	p.Signers = make([]crypto.Token, int(count))
+	for n := 0; n < int(count); n++ {
+		p.Signers[n], position = util.ParseToken(data, position)
+	}
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("multisig policy", data, position); err != nil {
+		return nil, err
+	}
+	if hasDuplicateTokens(p.Signers) {
+		return nil, util.NewParseError("multisig policy", position-8-int(count)*crypto.TokenSize, util.ErrInvalidValue)
+	}
+	msg := data[0:position]
+	p.Signature, _ = util.ParseSignature(data, position)
+	if !verify(p.Owner, msg, p.Signature) {
+		return nil, util.NewParseError("multisig policy", position, util.ErrBadSignature)
+	}
+	return &p, nil
+}
+
+// Cosignature is the signature of a signer of a multisig policy.
+type Cosignature struct {
+	Token     crypto.Token
+	Signature crypto.Signature
+}
+
+// MultisigTransfer is a transfer from a multisig wallet. It must be cosigned by
+// at least the threshold number of signers of the policy associated to the
+// From wallet. Signature checking against the policy is performed by the
+// state validator, the parser only checks that each cosignature is valid.
+type MultisigTransfer struct {
+	TimeStamp    uint64
+	From         crypto.Token
+	To           []crypto.TokenValue
+	Reason       string
+	Fee          uint64
+	Cosignatures []Cosignature
+}
+
+func (t *MultisigTransfer) Tokens() []crypto.Token {
+	tokens := []crypto.Token{t.From}
+	for _, to := range t.To {
+		isNew := true
+		for _, t := range tokens {
+			if t.Equal(to.Token) {
+				isNew = false
+				break
+			}
+		}
+		if isNew {
+			tokens = append(tokens, to.Token)
+		}
+	}
+	return tokens
+}
+
+func (t *MultisigTransfer) FeePaid() uint64 {
+	return t.Fee
+}
+
+// Signers returns the tokens of the cosigners of the transfer.
+func (t *MultisigTransfer) Signers() []crypto.Token {
+	signers := make([]crypto.Token, len(t.Cosignatures))
+	for n, cosignature := range t.Cosignatures {
+		signers[n] = cosignature.Token
+	}
+	return signers
+}
+
+func (t *MultisigTransfer) serializeSign() []byte {
+	bytes := []byte{0, IMultisigTransfer}
+	util.PutUint64(t.TimeStamp, &bytes)
+	util.PutToken(t.From, &bytes)
+	util.PutUint16(uint16(len(t.To)), &bytes)
+	for _, to := range t.To {
+		util.PutToken(to.Token, &bytes)
+		util.PutUint64(to.Value, &bytes)
+	}
+	util.PutString(t.Reason, &bytes)
+	util.PutUint64(t.Fee, &bytes)
+	return bytes
+}
+
+func (t *MultisigTransfer) Serialize() []byte {
+	bytes := t.serializeSign()
+	util.PutByte(byte(len(t.Cosignatures)), &bytes)
+	for _, cosignature := range t.Cosignatures {
+		util.PutToken(cosignature.Token, &bytes)
+		util.PutSignature(cosignature.Signature, &bytes)
+	}
+	return bytes
+}
+
+func (t *MultisigTransfer) Epoch() uint64 {
+	return t.TimeStamp
+}
+
+func (t *MultisigTransfer) Kind() byte {
+	return IMultisigTransfer
+}
+
+func (t *MultisigTransfer) Payments() *Payment {
+	total := uint64(0)
+	payment := &Payment{
+		Credit: make([]Wallet, 0),
+		Debit:  make([]Wallet, 0),
+	}
+	for _, credit := range t.To {
+		payment.NewCredit(crypto.HashToken(credit.Token), credit.Value)
+		total += credit.Value
+	}
+	payment.NewDebit(crypto.HashToken(t.From), total+t.Fee)
+	return payment
+}
+
+// Cosign appends the signature of key to the transfer. Cosignatures must be
+// appended after every other field of the transfer is set. It returns
+// ErrTooManyRecipients without signing if the recipients do not fit the
+// serialization of the transfer.
+func (t *MultisigTransfer) Cosign(key crypto.PrivateKey) error {
+	if len(t.To) > MaxMultisigRecipients {
+		return ErrTooManyRecipients
+	}
+	bytes := t.serializeSign()
+	t.Cosignatures = append(t.Cosignatures, Cosignature{Token: key.PublicKey(), Signature: key.Sign(bytes)})
+	return nil
+}
+
+func (t *MultisigTransfer) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "multisig transfer")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(IMultisigTransfer))
+	bulk.PutUint64("epoch", t.TimeStamp)
+	bulk.PutHex("from", t.From[:])
+	bulk.PutTokenValueArray("to", t.To)
+	bulk.PutString("reason", t.Reason)
+	bulk.PutUint64("fee", t.Fee)
+	bulk.PutTokenArray("signers", t.Signers())
+	return bulk.ToString()
+}
+
+// ParseMultisigTransfer parses a multisig transfer action. Returns a
+// util.ParseError if any cosignature is invalid or if a cosigner is repeated.
+func ParseMultisigTransfer(data []byte) (*MultisigTransfer, error) {
+	return parseMultisigTransfer(data, verifySignature)
+}
+
+func parseMultisigTransfer(data []byte, verify verifier) (*MultisigTransfer, error) {
+	if err := checkKind("multisig transfer", data, IMultisigTransfer); err != nil {
+		return nil, err
+	}
+	p := MultisigTransfer{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	p.From, position = util.ParseToken(data, position)
+	var count uint16
+	count, position = util.ParseUint16(data, position)
+	if err := util.CheckTruncated("multisig transfer", data, position+int(count)*(crypto.TokenSize+8)); err != nil {
+		return nil, err
+	}
+	p.To = make([]crypto.TokenValue, int(count))
+	for i := 0; i < int(count); i++ {
+		p.To[i].Token, position = util.ParseToken(data, position)
+		p.To[i].Value, position = util.ParseUint64(data, position)
+	}
+	p.Reason, position = util.ParseString(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := util.CheckTruncated("multisig transfer", data, position+1); err != nil {
+		return nil, err
+	}
+	if overflows(append(tokenValues(p.To), p.Fee)...) {
+		return nil, util.NewParseError("multisig transfer", position, util.ErrInvalidValue)
+	}
+	msg := data[0:position]
+	var signers byte
+	signers, position = util.ParseByte(data, position)
+	if signers == 0 {
+		return nil, util.NewParseError("multisig transfer", position-1, util.ErrInvalidValue)
+	}
+	if err := util.CheckEnd("multisig transfer", data, position+int(signers)*(crypto.TokenSize+crypto.SignatureSize)); err != nil {
+		return nil, err
+	}
+	p.Cosignatures = make([]Cosignature, int(signers))
+	for n := 0; n < int(signers); n++ {
+		p.Cosignatures[n].Token, position = util.ParseToken(data, position)
+		p.Cosignatures[n].Signature, position = util.ParseSignature(data, position)
+		if !verify(p.Cosignatures[n].Token, msg, p.Cosignatures[n].Signature) {
+			return nil, util.NewParseError("multisig transfer", position-crypto.SignatureSize, util.ErrBadSignature)
+		}
+	}
+	if hasDuplicateTokens(p.Signers()) {
+		return nil, util.NewParseError("multisig transfer", len(msg)+1, util.ErrInvalidValue)
+	}
+	return &p, nil
+}
+
+func hasDuplicateTokens(tokens []crypto.Token) bool {
+	seen := make(map[crypto.Token]struct{}, len(tokens))
+	for _, token := range tokens {
+		if _, ok := seen[token]; ok {
+			return true
+		}
+		seen[token] = struct{}{}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// RegisterProtocol claims the protocol code of void actions for the Owner
+// token and sets the rules enforced on void actions of the protocol. An
+// unclaimed code is claimed by the first registration; afterwards only the
+// owner can register new rules for the code. MaxDataSize is the maximum size in
+// bytes of the data of a void action of the protocol, zero for no limit.
+// MinFee is the minimum fee of a void action of the protocol. The registration
+// is signed by the Owner and the fee is paid by the Owner.
+type RegisterProtocol struct {
+	TimeStamp   uint64
+	Owner       crypto.Token
+	Protocol    uint32
+	MaxDataSize uint32
+	MinFee      uint64
+	Fee         uint64
+	Signature   crypto.Signature
+}
+
+func (r *RegisterProtocol) Tokens() []crypto.Token {
+	return []crypto.Token{r.Owner}
+}
+
+func (r *RegisterProtocol) FeePaid() uint64 {
+	return r.Fee
+}
+
+func (r *RegisterProtocol) serializeSign() []byte {
+	bytes := []byte{0, IRegisterProtocol}
+	util.PutUint64(r.TimeStamp, &bytes)
+	util.PutToken(r.Owner, &bytes)
+	util.PutUint32(r.Protocol, &bytes)
+	util.PutUint32(r.MaxDataSize, &bytes)
+	util.PutUint64(r.MinFee, &bytes)
+	util.PutUint64(r.Fee, &bytes)
+	return bytes
+}
+
+func (r *RegisterProtocol) Serialize() []byte {
+	bytes := r.serializeSign()
+	util.PutSignature(r.Signature, &bytes)
+	return bytes
+}
+
+func (r *RegisterProtocol) Epoch() uint64 {
+	return r.TimeStamp
+}
+
+func (r *RegisterProtocol) Kind() byte {
+	return IRegisterProtocol
+}
+
+func (r *RegisterProtocol) Payments() *Payment {
+	return NewPayment(crypto.HashToken(r.Owner), r.Fee)
+}
+
+func (r *RegisterProtocol) Sign(key crypto.PrivateKey) {
+	r.Signature = key.Sign(r.serializeSign())
+}
+
+func (r *RegisterProtocol) JSON() string {
+	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "register protocol")
+	bulk.PutUint64("version", 0)
+	bulk.PutUint64("instructionType", uint64(IRegisterProtocol))
+	bulk.PutUint64("epoch", r.TimeStamp)
+	bulk.PutHex("owner", r.Owner[:])
+	bulk.PutUint64("protocol", uint64(r.Protocol))
+	bulk.PutUint64("maxDataSize", uint64(r.MaxDataSize))
+	bulk.PutUint64("minFee", r.MinFee)
+	bulk.PutUint64("fee", r.Fee)
+	bulk.PutBase64("signature", r.Signature[:])
+	return bulk.ToString()
+}
+
+// ParseRegisterProtocol parses a protocol registration action. Returns a
+// util.ParseError if the data is not a valid registration, if the protocol
+// code is zero or if the signature of the owner is invalid.
+func ParseRegisterProtocol(data []byte) (*RegisterProtocol, error) {
+	return parseRegisterProtocol(data, verifySignature)
+}
+
+func parseRegisterProtocol(data []byte, verify verifier) (*RegisterProtocol, error) {
+	if err := checkKind("register protocol", data, IRegisterProtocol); err != nil {
+		return nil, err
+	}
+	p := RegisterProtocol{}
+	position := 2
+	p.TimeStamp, position = util.ParseUint64(data, position)
+	p.Owner, position = util.ParseToken(data, position)
+	p.Protocol, position = util.ParseUint32(data, position)
+	p.MaxDataSize, position = util.ParseUint32(data, position)
+	p.MinFee, position = util.ParseUint64(data, position)
+	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("register protocol", data, position); err != nil {
+		return nil, err
+	}
+	if p.Protocol == 0 {
+		return nil, util.NewParseError("register protocol", 10+crypto.TokenSize, util.ErrInvalidValue)
+	}
+	msgToVerify := data[0:position]
+	p.Signature, _ = util.ParseSignature(data, position)
+	if !verify(p.Owner, msgToVerify, p.Signature) {
+		return nil, util.NewParseError("register protocol", position, util.ErrBadSignature)
+	}
+	return &p, nil
+}
@@ -1,14 +1,21 @@
 package actions
 
 import (
-	"fmt"
-
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/util"
 )
 
+// NonceVersion is the serialization version of transfers carrying a nonce.
+const NonceVersion byte = 1
+
+// Transfer moves tokens from the From wallet to one or more To wallets. A
+// transfer with a non-zero Nonce is serialized under NonceVersion and must
+// carry the sequence number immediately following the last nonce used by the
+// From wallet. A pending transfer can thus be replaced (or cancelled) by
+// another one with the same nonce and a higher fee.
 type Transfer struct {
 	TimeStamp uint64
+	Nonce     uint64
 	From      crypto.Token
 	To        []crypto.TokenValue
 	Reason    string
@@ -40,6 +47,10 @@ func (t *Transfer) FeePaid() uint64 {
 func (t *Transfer) serializeSign() []byte {
 	bytes := []byte{0, ITransfer}
 	util.PutUint64(t.TimeStamp, &bytes)
+	if t.Nonce > 0 {
+		bytes[0] = NonceVersion
+		util.PutUint64(t.Nonce, &bytes)
+	}
 	util.PutToken(t.From, &bytes)
 	util.PutUint16(uint16(len(t.To)), &bytes)
 	count := len(t.To)
@@ -95,9 +106,16 @@ func (t *Transfer) Sign(key crypto.PrivateKey) {
 func (t *Transfer) JSON() string {
 	bulk := &util.JSONBuilder{}
 	bulk.PutString("kind", "transfer")
-	bulk.PutUint64("version", 0)
+	if t.Nonce > 0 {
+		bulk.PutUint64("version", uint64(NonceVersion))
+	} else {
+		bulk.PutUint64("version", 0)
+	}
 	bulk.PutUint64("instructionType", uint64(ITransfer))
 	bulk.PutUint64("epoch", t.TimeStamp)
+	if t.Nonce > 0 {
+		bulk.PutUint64("nonce", t.Nonce)
+	}
 	bulk.PutHex("from", t.From[:])
 	bulk.PutTokenValueArray("to", t.To)
 	bulk.PutString("reason", t.Reason)
@@ -106,17 +124,36 @@ func (t *Transfer) JSON() string {
 	return bulk.ToString()
 }
 
-func ParseTransfer(data []byte) *Transfer {
-	if len(data) < 2 || data[1] != ITransfer {
-		fmt.Println("invalid transfer", data)
-		return nil
+// ParseTransfer parses a transfer of either version. Returns a util.ParseError
+// if the signature is invalid or if a NonceVersion transfer carries a zero
+// nonce.
+func ParseTransfer(data []byte) (*Transfer, error) {
+	return parseTransfer(data, verifySignature)
+}
+
+// parseTransfer parses the action verifying its signatures with verify.
+func parseTransfer(data []byte, verify verifier) (*Transfer, error) {
+	if err := checkKind("transfer", data, ITransfer); err != nil {
+		return nil, err
+	}
+	if data[0] > NonceVersion {
+		return nil, util.NewParseError("transfer", 0, util.ErrUnknownKind)
 	}
 	p := Transfer{}
 	position := 2
 	p.TimeStamp, position = util.ParseUint64(data, position)
+	if data[0] == NonceVersion {
+		p.Nonce, position = util.ParseUint64(data, position)
+		if p.Nonce == 0 {
+			return nil, util.NewParseError("transfer", 10, util.ErrInvalidValue)
+		}
+	}
 	p.From, position = util.ParseToken(data, position)
 	var count uint16
 	count, position = util.ParseUint16(data, position)
+	if err := util.CheckTruncated("transfer", data, position+int(count)*(crypto.TokenSize+8)); err != nil {
+		return nil, err
+	}
 	p.To = make([]crypto.TokenValue, int(count))
 	for i := 0; i < int(count); i++ {
 		p.To[i].Token, position = util.ParseToken(data, position)
@@ -124,11 +161,16 @@ func ParseTransfer(data []byte) *Transfer {
 	}
 	p.Reason, position = util.ParseString(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("transfer", data, position); err != nil {
+		return nil, err
+	}
+	if overflows(append(tokenValues(p.To), p.Fee)...) {
+		return nil, util.NewParseError("transfer", position, util.ErrInvalidValue)
+	}
 	msg := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
-	if !p.From.Verify(msg, p.Signature) {
-		fmt.Printf("%+v\n\n", p)
-		return nil
+	if !verify(p.From, msg, p.Signature) {
+		return nil, util.NewParseError("transfer", position, util.ErrBadSignature)
 	}
-	return &p
+	return &p, nil
 }
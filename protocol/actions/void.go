@@ -81,31 +81,34 @@ func (t *Void) Sign(key crypto.PrivateKey) {
 	t.Signature = key.Sign(bytes)
 }
 
-func ParseVoid(data []byte) *Void {
-	if len(data) < 2 || data[1] != IVoid {
-		return nil
+// ParseVoid parses a void action. Returns a util.ParseError if the data is not
+// a valid void action or if the signature of the wallet is invalid.
+func ParseVoid(data []byte) (*Void, error) {
+	return parseVoid(data, verifySignature)
+}
+
+func parseVoid(data []byte, verify verifier) (*Void, error) {
+	if err := checkKind("void", data, IVoid); err != nil {
+		return nil, err
 	}
 	p := Void{}
 	position := 2
 	p.TimeStamp, position = util.ParseUint64(data, position)
 	p.Protocol, position = util.ParseUint32(data, position)
 	if len(data)-voidTail < position {
-		return nil
+		return nil, util.NewParseError("void", len(data), util.ErrTruncated)
 	}
 	p.Data = data[position : len(data)-voidTail]
 	//p.Data, position = util.ParseByteArray(data, position)
 	position = len(data) - voidTail
 	p.Wallet, position = util.ParseToken(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
-	if position >= len(data) {
-		return nil
-	}
 	msg := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
-	if !p.Wallet.Verify(msg, p.Signature) {
-		return nil
+	if !verify(p.Wallet, msg, p.Signature) {
+		return nil, util.NewParseError("void", position, util.ErrBadSignature)
 	}
-	return &p
+	return &p, nil
 }
 
 func Dress(data []byte, wallet crypto.PrivateKey, fee uint64) []byte {
@@ -59,6 +59,7 @@ func (w *Withdraw) Sign(key crypto.PrivateKey) {
 
 func (w *Withdraw) JSON() string {
 	bulk := &util.JSONBuilder{}
+	bulk.PutString("kind", "withdraw")
 	bulk.PutUint64("version", 0)
 	bulk.PutUint64("instructionType", uint64(IWithdraw))
 	bulk.PutUint64("epoch", w.TimeStamp)
@@ -69,9 +70,15 @@ func (w *Withdraw) JSON() string {
 	return bulk.ToString()
 }
 
-func ParseWithdraw(data []byte) *Withdraw {
-	if len(data) < 2 || data[1] != IWithdraw {
-		return nil
+// ParseWithdraw parses a withdraw action. Returns a util.ParseError if the
+// data is not a valid withdraw or if the signature is invalid.
+func ParseWithdraw(data []byte) (*Withdraw, error) {
+	return parseWithdraw(data, verifySignature)
+}
+
+func parseWithdraw(data []byte, verify verifier) (*Withdraw, error) {
+	if err := checkKind("withdraw", data, IWithdraw); err != nil {
+		return nil, err
 	}
 	p := Withdraw{}
 	position := 2
@@ -79,10 +86,13 @@ func ParseWithdraw(data []byte) *Withdraw {
 	p.Token, position = util.ParseToken(data, position)
 	p.Value, position = util.ParseUint64(data, position)
 	p.Fee, position = util.ParseUint64(data, position)
+	if err := checkSignature("withdraw", data, position); err != nil {
+		return nil, err
+	}
 	msgToVerify := data[0:position]
 	p.Signature, _ = util.ParseSignature(data, position)
-	if !p.Token.Verify(msgToVerify, p.Signature) {
-		return nil
+	if !verify(p.Token, msgToVerify, p.Signature) {
+		return nil, util.NewParseError("withdraw", position, util.ErrBadSignature)
 	}
-	return &p
+	return &p, nil
 }
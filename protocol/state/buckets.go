@@ -0,0 +1,79 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bucketFiles keeps append only records of a state component on one file per
+// bucket next to the file of the component: filePath.<bucket>. Components
+// append the records of each incorporation to the bucket they belong to and
+// prune old buckets by deleting whole files, instead of rewriting the entire
+// component at every block.
+type bucketFiles struct {
+	filePath string
+}
+
+// path returns the name of the file of the bucket.
+func (b bucketFiles) path(bucket uint64) string {
+	return fmt.Sprintf("%v.%d", b.filePath, bucket)
+}
+
+// buckets returns the existing buckets in ascending order.
+func (b bucketFiles) buckets() []uint64 {
+	matches, _ := filepath.Glob(b.filePath + ".*")
+	buckets := make([]uint64, 0, len(matches))
+	for _, match := range matches {
+		bucket, err := strconv.ParseUint(strings.TrimPrefix(match, b.filePath+"."), 10, 64)
+		if err == nil {
+			buckets = append(buckets, bucket)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return buckets
+}
+
+// append appends data to the file of the bucket, creating it if necessary.
+func (b bucketFiles) append(bucket uint64, data []byte) error {
+	file, err := os.OpenFile(b.path(bucket), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// read returns the records of the bucket. A record partially written before a
+// crash at the end of the file is ignored.
+func (b bucketFiles) read(bucket uint64, recordSize int) ([]byte, error) {
+	data, err := os.ReadFile(b.path(bucket))
+	if err != nil {
+		return nil, err
+	}
+	return data[:len(data)-len(data)%recordSize], nil
+}
+
+// remove deletes the file of the bucket.
+func (b bucketFiles) remove(bucket uint64) error {
+	if err := os.Remove(b.path(bucket)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// clear deletes the files of every bucket.
+func (b bucketFiles) clear() error {
+	for _, bucket := range b.buckets() {
+		if err := b.remove(bucket); err != nil {
+			return err
+		}
+	}
+	return nil
+}
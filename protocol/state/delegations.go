@@ -0,0 +1,207 @@
+package state
+
+import (
+	"log/slog"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Delegations keeps the stake delegated by wallets to validators indexed by the
+// hash of the validator token and by the hash of the delegator token. Delegated
+// stake leaves the delegator wallet, counts toward the weight of the validator
+// and earns a proportional share of the fees collected by the validator. It is
+// slashed alongside the validator deposit. Delegations is part of the state
+// checksum. If a file path is provided the delegations of the validators
+// changed at every incorporation are appended to the file (see deltaFiles).
+type Delegations struct {
+	delegations map[crypto.Hash]map[crypto.Hash]uint64
+	filePath    string
+}
+
+// NewDelegations returns an empty in memory set of delegations.
+func NewDelegations() *Delegations {
+	return &Delegations{delegations: make(map[crypto.Hash]map[crypto.Hash]uint64)}
+}
+
+// NewFileDelegations returns a set of delegations persisted on the given file.
+// If the file exists its contents and the deltas appended to it are loaded.
+func NewFileDelegations(filePath string) *Delegations {
+	base, deltas, err := deltaFiles{filePath: filePath}.read()
+	if err != nil {
+		slog.Error("NewFileDelegations: could not read existing file", "path", filePath, "err", err)
+		return nil
+	}
+	delegations := NewDelegations()
+	if len(base) > 0 {
+		if delegations = ParseDelegations(base); delegations == nil {
+			slog.Error("NewFileDelegations: could not parse existing file", "path", filePath)
+			return nil
+		}
+	}
+	for _, delta := range deltas {
+		changed := ParseDelegations(delta)
+		if changed == nil {
+			slog.Error("NewFileDelegations: could not parse delta", "path", filePath)
+			return nil
+		}
+		// validators without delegators on a delta lost all their delegations
+		for validator, delegators := range changed.delegations {
+			if len(delegators) == 0 {
+				delete(delegations.delegations, validator)
+			} else {
+				delegations.delegations[validator] = delegators
+			}
+		}
+	}
+	delegations.filePath = filePath
+	return delegations
+}
+
+// NewFileDelegationsFromBytes creates a set of delegations from its serialized
+// form persisted on the given file.
+func NewFileDelegationsFromBytes(filePath string, data []byte) *Delegations {
+	delegations := ParseDelegations(data)
+	if delegations == nil {
+		return nil
+	}
+	delegations.filePath = filePath
+	if err := (deltaFiles{filePath: filePath}).reset(delegations.Serialize()); err != nil {
+		slog.Error("NewFileDelegationsFromBytes: could not persist delegations", "path", filePath, "err", err)
+		return nil
+	}
+	return delegations
+}
+
+// Get returns the stake delegated by the delegator to the validator.
+func (d *Delegations) Get(validator, delegator crypto.Hash) uint64 {
+	return d.delegations[validator][delegator]
+}
+
+// Delegated returns the total stake delegated to the validator.
+func (d *Delegations) Delegated(validator crypto.Hash) uint64 {
+	total := uint64(0)
+	for _, value := range d.delegations[validator] {
+		total += value
+	}
+	return total
+}
+
+// Total returns the total stake delegated to all validators.
+func (d *Delegations) Total() uint64 {
+	total := uint64(0)
+	for validator := range d.delegations {
+		total += d.Delegated(validator)
+	}
+	return total
+}
+
+// Delegators returns a copy of the stakes delegated to the validator indexed
+// by the hash of the delegator.
+func (d *Delegations) Delegators(validator crypto.Hash) map[crypto.Hash]uint64 {
+	delegators := make(map[crypto.Hash]uint64, len(d.delegations[validator]))
+	for delegator, value := range d.delegations[validator] {
+		delegators[delegator] = value
+	}
+	return delegators
+}
+
+// Incorporate applies the delegation deltas of the mutations and, if file
+// based, appends the delegations of the changed validators to the file.
+func (d *Delegations) Incorporate(m *Mutations) {
+	if len(m.Delegations) == 0 {
+		return
+	}
+	for validator, deltas := range m.Delegations {
+		delegators, ok := d.delegations[validator]
+		if !ok {
+			delegators = make(map[crypto.Hash]uint64)
+			d.delegations[validator] = delegators
+		}
+		for delegator, delta := range deltas {
+			value := int(delegators[delegator]) + delta
+			if value > 0 {
+				delegators[delegator] = uint64(value)
+			} else {
+				delete(delegators, delegator)
+			}
+		}
+		if len(delegators) == 0 {
+			delete(d.delegations, validator)
+		}
+	}
+	if d.filePath != "" {
+		changed := NewDelegations()
+		for validator := range m.Delegations {
+			changed.delegations[validator] = d.delegations[validator]
+		}
+		if err := (deltaFiles{filePath: d.filePath}).append(changed.Serialize(), d.Serialize); err != nil {
+			slog.Error("Delegations: could not persist delegations", "path", d.filePath, "err", err)
+		}
+	}
+}
+
+// Clone returns an in memory copy of the delegations.
+func (d *Delegations) Clone() *Delegations {
+	clone := NewDelegations()
+	for validator := range d.delegations {
+		clone.delegations[validator] = d.Delegators(validator)
+	}
+	return clone
+}
+
+// Serialize returns a deterministic byte representation of the delegations
+// sorted by validator hash and, within a validator, by delegator hash.
+func (d *Delegations) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint32(uint32(len(d.delegations)), &bytes)
+	for _, validator := range sortedHashes(d.delegations) {
+		delegators := d.delegations[validator]
+		util.PutHash(validator, &bytes)
+		util.PutUint32(uint32(len(delegators)), &bytes)
+		for _, delegator := range sortedHashes(delegators) {
+			util.PutHash(delegator, &bytes)
+			util.PutUint64(delegators[delegator], &bytes)
+		}
+	}
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (d *Delegations) Bytes() []byte {
+	return d.Serialize()
+}
+
+// Hash returns the hash of the serialized delegations.
+func (d *Delegations) Hash() crypto.Hash {
+	return crypto.Hasher(d.Serialize())
+}
+
+// ParseDelegations parses a serialized set of delegations. Returns nil if the
+// data is not a valid serialization.
+func ParseDelegations(data []byte) *Delegations {
+	delegations := NewDelegations()
+	count, position, ok := parseCount(data, 0, crypto.Size+4)
+	if !ok {
+		return nil
+	}
+	for n := 0; n < count; n++ {
+		var validator crypto.Hash
+		var size int
+		validator, position = util.ParseHash(data, position)
+		if size, position, ok = parseCount(data, position, crypto.Size+8); !ok {
+			return nil
+		}
+		delegators := make(map[crypto.Hash]uint64, size)
+		for i := 0; i < size; i++ {
+			var delegator crypto.Hash
+			delegator, position = util.ParseHash(data, position)
+			delegators[delegator], position = util.ParseUint64(data, position)
+		}
+		delegations.delegations[validator] = delegators
+	}
+	if position != len(data) {
+		return nil
+	}
+	return delegations
+}
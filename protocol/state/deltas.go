@@ -0,0 +1,104 @@
+package state
+
+import (
+	"os"
+
+	"github.com/freehandle/breeze/util"
+)
+
+// deltaCompactionSize is the size in bytes a log of deltas may reach before
+// it is compacted regardless of the size of the base file.
+const deltaCompactionSize = 1 << 16
+
+// deltaFiles keeps a keyed state component as a base file, with the
+// serialization of the component at some point, followed by an append only
+// log, filePath.log, with one record per incorporation holding the entries
+// changed by the incorporation. Components append the entries they change
+// instead of rewriting the entire component at every block. Once the log grows
+// larger than the base it is compacted into a new base, so the write cost of
+// an incorporation is proportional to the entries it changes and the files
+// stay proportional to the size of the component. Records hold the final
+// value of the entries, so replaying a log over a base that already includes
+// it (as after a crash in the middle of a compaction) is harmless.
+type deltaFiles struct {
+	filePath string
+}
+
+// logPath returns the name of the log file.
+func (d deltaFiles) logPath() string {
+	return d.filePath + ".log"
+}
+
+// reset replaces the base by the given data and removes the log.
+func (d deltaFiles) reset(base []byte) error {
+	if err := persistFile(d.filePath, base); err != nil {
+		return err
+	}
+	if err := os.Remove(d.logPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// append appends a record with the delta to the log. If the log would outgrow
+// the base it is compacted instead into the base returned by the base
+// function, which must already include the delta.
+func (d deltaFiles) append(delta []byte, base func() []byte) error {
+	baseSize, logSize := int64(0), int64(0)
+	if info, err := os.Stat(d.filePath); err == nil {
+		baseSize = info.Size()
+	}
+	if info, err := os.Stat(d.logPath()); err == nil {
+		logSize = info.Size()
+	}
+	logSize += int64(len(delta) + 4)
+	if logSize > baseSize && logSize > deltaCompactionSize {
+		return d.reset(base())
+	}
+	record := make([]byte, 0, len(delta)+4)
+	util.PutUint32(uint32(len(delta)), &record)
+	record = append(record, delta...)
+	file, err := os.OpenFile(d.logPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(record); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// read returns the base, nil if there is none, and the deltas of the log in
+// the order they were appended. A record partially written before a crash at
+// the end of the log is ignored and truncated, so that later records are
+// appended after the last complete one.
+func (d deltaFiles) read() ([]byte, [][]byte, error) {
+	base, err := os.ReadFile(d.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(d.logPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return base, nil, nil
+		}
+		return nil, nil, err
+	}
+	deltas := make([][]byte, 0)
+	position := 0
+	for position+4 <= len(data) {
+		size, start := util.ParseUint32(data, position)
+		if start+int(size) > len(data) {
+			break
+		}
+		deltas = append(deltas, data[start:start+int(size)])
+		position = start + int(size)
+	}
+	if position < len(data) {
+		if err := os.Truncate(d.logPath(), int64(position)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return base, deltas, nil
+}
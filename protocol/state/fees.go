@@ -0,0 +1,206 @@
+package state
+
+import (
+	"log/slog"
+	"math/bits"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// BaseFeeChangeDenominator bounds the change of the base fee between blocks to
+// 1/BaseFeeChangeDenominator of its value.
+const BaseFeeChangeDenominator = 8
+
+// feeBucketEpochs is the number of epochs of fee market records kept on each
+// bucket file of a file based fee market.
+const feeBucketEpochs = 1000
+
+// feeMarketSize is the size in bytes of a serialized fee market.
+const feeMarketSize = 24
+
+// FeeMarket keeps the parameters of the protocol fee market. Actions must pay
+// at least BaseFeePerByte for each byte of their serialization. The base fee
+// portion of the fee is burned and only the remainder is collected by the
+// block proposer. The base fee adapts to the fullness of incorporated blocks:
+// it rises when blocks are above TargetBlockSize and falls when they are below,
+// but never below MinFeePerByte. FeeMarket is part of the state checksum. If a
+// file path is provided the fee market is appended at every incorporation to
+// the bucket file of the epoch (see bucketFiles) and older buckets are deleted
+// once a new bucket is started.
+type FeeMarket struct {
+	MinFeePerByte   uint64
+	BaseFeePerByte  uint64
+	TargetBlockSize uint64
+	filePath        string
+	bucket          uint64
+}
+
+// NewFeeMarket returns an in memory fee market with base fee at the given
+// minimum fee per byte.
+func NewFeeMarket(minFeePerByte, targetBlockSize uint64) *FeeMarket {
+	return &FeeMarket{
+		MinFeePerByte:   minFeePerByte,
+		BaseFeePerByte:  minFeePerByte,
+		TargetBlockSize: targetBlockSize,
+	}
+}
+
+// NewFileFeeMarket returns a fee market persisted on the given file. If bucket
+// files of the fee market exist the last record is loaded, otherwise a new fee
+// market with the given parameters is created.
+func NewFileFeeMarket(filePath string, minFeePerByte, targetBlockSize uint64) *FeeMarket {
+	files := bucketFiles{filePath: filePath}
+	buckets := files.buckets()
+	for n := len(buckets) - 1; n >= 0; n-- {
+		data, err := files.read(buckets[n], feeMarketSize)
+		if err != nil {
+			slog.Error("NewFileFeeMarket: could not read bucket", "path", filePath, "bucket", buckets[n], "err", err)
+			return nil
+		}
+		if len(data) == 0 {
+			continue
+		}
+		fees := ParseFeeMarket(data[len(data)-feeMarketSize:])
+		if fees == nil {
+			slog.Error("NewFileFeeMarket: could not parse existing file", "path", filePath)
+			return nil
+		}
+		fees.filePath = filePath
+		fees.bucket = buckets[n]
+		return fees
+	}
+	fees := NewFeeMarket(minFeePerByte, targetBlockSize)
+	fees.filePath = filePath
+	return fees
+}
+
+// NewFileFeeMarketFromBytes creates a fee market from its serialized form
+// persisted on the given file. Existing bucket files are replaced.
+func NewFileFeeMarketFromBytes(filePath string, data []byte) *FeeMarket {
+	fees := ParseFeeMarket(data)
+	if fees == nil {
+		return nil
+	}
+	fees.filePath = filePath
+	files := bucketFiles{filePath: filePath}
+	if err := files.clear(); err != nil {
+		slog.Error("NewFileFeeMarketFromBytes: could not remove buckets", "path", filePath, "err", err)
+		return nil
+	}
+	if err := files.append(fees.bucket, fees.Serialize()); err != nil {
+		slog.Error("NewFileFeeMarketFromBytes: could not persist fee market", "path", filePath, "err", err)
+		return nil
+	}
+	return fees
+}
+
+// MinimumFee returns the minimum fee for an action with the given size in
+// bytes. It is also the amount of the fee to be burned.
+func (f *FeeMarket) MinimumFee(size int) uint64 {
+	return f.BaseFeePerByte * uint64(size)
+}
+
+// Adjust moves the base fee according to the size in bytes of the actions of
+// an incorporated block.
+func (f *FeeMarket) Adjust(size uint64) {
+	if f.TargetBlockSize == 0 {
+		return
+	}
+	target := f.TargetBlockSize
+	if size > 2*target {
+		size = 2 * target
+	}
+	base := f.BaseFeePerByte
+	if size > target {
+		delta := scaleFee(base, size-target, target) / BaseFeeChangeDenominator
+		if delta == 0 {
+			delta = 1
+		}
+		base += delta
+	} else if size < target {
+		delta := scaleFee(base, target-size, target) / BaseFeeChangeDenominator
+		base -= delta
+	}
+	if base < f.MinFeePerByte {
+		base = f.MinFeePerByte
+	}
+	f.BaseFeePerByte = base
+}
+
+// scaleFee returns fee * numerator / denominator without overflow of the
+// intermediate product. numerator must not exceed denominator.
+func scaleFee(fee, numerator, denominator uint64) uint64 {
+	hi, lo := bits.Mul64(fee, numerator)
+	scaled, _ := bits.Div64(hi, lo, denominator)
+	return scaled
+}
+
+// Incorporate adjusts the base fee to the size of the actions validated on the
+// mutations. If the fee market is file based it is appended to the bucket of
+// the mutations epoch and buckets before it are deleted.
+func (f *FeeMarket) Incorporate(m *Mutations) {
+	f.Adjust(m.Size)
+	if f.filePath == "" {
+		return
+	}
+	files := bucketFiles{filePath: f.filePath}
+	bucket := m.Epoch / feeBucketEpochs
+	if err := files.append(bucket, f.Serialize()); err != nil {
+		slog.Error("FeeMarket: could not persist fee market", "path", f.filePath, "err", err)
+		return
+	}
+	if bucket == f.bucket {
+		return
+	}
+	f.bucket = bucket
+	for _, old := range files.buckets() {
+		if old < bucket {
+			if err := files.remove(old); err != nil {
+				slog.Error("FeeMarket: could not remove old bucket", "path", f.filePath, "bucket", old, "err", err)
+			}
+		}
+	}
+}
+
+// Clone returns an in memory copy of the fee market.
+func (f *FeeMarket) Clone() *FeeMarket {
+	return &FeeMarket{
+		MinFeePerByte:   f.MinFeePerByte,
+		BaseFeePerByte:  f.BaseFeePerByte,
+		TargetBlockSize: f.TargetBlockSize,
+	}
+}
+
+// Serialize returns a byte representation of the fee market.
+func (f *FeeMarket) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(f.MinFeePerByte, &bytes)
+	util.PutUint64(f.BaseFeePerByte, &bytes)
+	util.PutUint64(f.TargetBlockSize, &bytes)
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (f *FeeMarket) Bytes() []byte {
+	return f.Serialize()
+}
+
+// Hash returns the hash of the serialized fee market.
+func (f *FeeMarket) Hash() crypto.Hash {
+	return crypto.Hasher(f.Serialize())
+}
+
+// ParseFeeMarket parses a serialized fee market. Returns nil if the data is not
+// a valid serialization.
+func ParseFeeMarket(data []byte) *FeeMarket {
+	if len(data) != feeMarketSize {
+		return nil
+	}
+	fees := FeeMarket{}
+	position := 0
+	fees.MinFeePerByte, position = util.ParseUint64(data, position)
+	fees.BaseFeePerByte, position = util.ParseUint64(data, position)
+	fees.TargetBlockSize, _ = util.ParseUint64(data, position)
+	return &fees
+}
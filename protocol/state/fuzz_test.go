@@ -0,0 +1,175 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+)
+
+// fuzzKeys are the deterministic keys of the fuzzing harness. The first key
+// owns the genesis wallet and deposit.
+var fuzzKeys = func() []crypto.PrivateKey {
+	keys := make([]crypto.PrivateKey, 4)
+	for n := range keys {
+		keys[n] = crypto.PrivateKeyFromSeed([32]byte{byte(n + 1)})
+	}
+	return keys
+}()
+
+// fuzzGenesis returns a genesis state funding the first fuzzing key. The fee
+// market is static so that the base fee does not depend on how mutations are
+// grouped for incorporation.
+func fuzzGenesis() *State {
+	genesis := NewGenesisStateWithToken(fuzzKeys[0].PublicKey(), "")
+	genesis.Unbonding.Period = 3
+	return genesis
+}
+
+// fuzzInstructionSize is the number of bytes of a fuzzing program consumed
+// by each action (see fuzzAction) and fuzzMaxInstructions the maximum number of
+// instructions run from a program.
+const (
+	fuzzInstructionSize = 5
+	fuzzMaxInstructions = 64
+)
+
+// fuzzAction builds the signed action encoded by an instruction of a fuzzing
+// program at the given epoch. The instruction bytes are the operation and the
+// fee, the sender, the receiver, and a value and its binary exponent. Returns
+// nil for instructions closing the block.
+func fuzzAction(instruction []byte, epoch uint64) []byte {
+	op, fee := instruction[0]%16, uint64(instruction[0]>>4)
+	from, to := fuzzKeys[int(instruction[1])%len(fuzzKeys)], fuzzKeys[int(instruction[2])%len(fuzzKeys)]
+	value := uint64(instruction[3]) << (instruction[4] % 64)
+	small := uint64(instruction[3])
+	switch op {
+	case 0:
+		transfer := actions.Transfer{TimeStamp: epoch, From: from.PublicKey(), To: []crypto.TokenValue{{Token: to.PublicKey(), Value: value}}, Fee: fee}
+		transfer.Sign(from)
+		return transfer.Serialize()
+	case 1:
+		transfer := actions.Transfer{TimeStamp: epoch, Nonce: small%4 + 1, From: from.PublicKey(), To: []crypto.TokenValue{{Token: to.PublicKey(), Value: small}}, Fee: fee}
+		transfer.Sign(from)
+		return transfer.Serialize()
+	case 2:
+		deposit := actions.Deposit{TimeStamp: epoch, Token: from.PublicKey(), Value: value, Fee: fee}
+		deposit.Sign(from)
+		return deposit.Serialize()
+	case 3:
+		withdraw := actions.Withdraw{TimeStamp: epoch, Token: from.PublicKey(), Value: value, Fee: fee}
+		withdraw.Sign(from)
+		return withdraw.Serialize()
+	case 4:
+		lock := actions.Lock{TimeStamp: epoch, From: from.PublicKey(), To: to.PublicKey(), Value: value, Unlock: epoch + small%4, Vesting: uint64(instruction[4] % 4), Fee: fee}
+		lock.Sign(from)
+		return lock.Serialize()
+	case 5:
+		delegate := actions.Delegate{TimeStamp: epoch, Delegator: from.PublicKey(), Validator: to.PublicKey(), Value: value, Fee: fee}
+		delegate.Sign(from)
+		return delegate.Serialize()
+	case 6:
+		undelegate := actions.Undelegate{TimeStamp: epoch, Delegator: from.PublicKey(), Validator: to.PublicKey(), Value: value, Fee: fee}
+		undelegate.Sign(from)
+		return undelegate.Serialize()
+	case 7:
+		policy := actions.MultisigPolicy{TimeStamp: epoch, Owner: from.PublicKey(), Threshold: 1, Signers: []crypto.Token{to.PublicKey()}, Fee: fee}
+		policy.Sign(from)
+		return policy.Serialize()
+	case 8:
+		transfer := actions.MultisigTransfer{TimeStamp: epoch, From: from.PublicKey(), To: []crypto.TokenValue{{Token: to.PublicKey(), Value: value}}, Fee: fee}
+		transfer.Cosign(to)
+		return transfer.Serialize()
+	case 9:
+		legs := []actions.BatchLeg{{From: from.PublicKey(), To: []crypto.TokenValue{{Token: to.PublicKey(), Value: value}}}}
+		if !from.PublicKey().Equal(to.PublicKey()) {
+			legs = append(legs, actions.BatchLeg{From: to.PublicKey(), To: []crypto.TokenValue{{Token: from.PublicKey(), Value: small}}})
+		}
+		batch := actions.Batch{TimeStamp: epoch, Legs: legs, Fee: fee}
+		batch.Sign(from)
+		batch.Sign(to)
+		return batch.Serialize()
+	case 10:
+		register := actions.RegisterProtocol{TimeStamp: epoch, Owner: from.PublicKey(), Protocol: uint32(small%3) + 1, MaxDataSize: uint32(instruction[4] % 4), MinFee: uint64(instruction[4] % 8), Fee: fee}
+		register.Sign(from)
+		return register.Serialize()
+	case 11:
+		void := actions.Void{TimeStamp: epoch, Protocol: uint32(small % 4), Data: make([]byte, instruction[4]%8), Wallet: from.PublicKey(), Fee: fee}
+		void.Sign(from)
+		return void.Serialize()
+	}
+	return nil
+}
+
+// FuzzValidate runs fuzzing programs of actions through MutatingState.Validate
+// over several blocks. After each block the total supply must match the tokens
+// circulating on the state, that is, wallets, deposits, pending withdrawals and
+// delegated stake must account for every token minted and every fee burned.
+// At the end incorporating the mutations of every block grouped with
+// Mutations.Append into the genesis state must arrive at the same state as
+// incorporating them block by block.
+func FuzzValidate(f *testing.F) {
+	f.Add([]byte{0x10, 0, 1, 100, 4, 0x12, 1, 1, 50, 0, 0x1e, 0, 0, 0, 0, 0x13, 1, 0, 20, 0, 0x15, 0, 2, 10, 8})
+	f.Add([]byte{0x10, 0, 2, 1, 20, 0x17, 2, 3, 0, 0, 0x18, 2, 3, 7, 2, 0x14, 0, 1, 9, 3, 0x1f, 0, 0, 0, 0, 0x10, 1, 3, 4, 1})
+	f.Add([]byte{0x1a, 0, 0, 1, 3, 0x2b, 0, 0, 1, 2, 0x19, 0, 1, 3, 10, 0x1e, 0, 0, 0, 0, 0x16, 0, 2, 5, 0, 0x1c, 0, 0, 0, 0})
+	f.Add([]byte{0x10, 0, 1, 255, 63, 0x12, 0, 0, 255, 63, 0x15, 0, 1, 128, 56, 0x19, 0, 1, 255, 60})
+	f.Fuzz(func(t *testing.T, program []byte) {
+		if len(program) > fuzzMaxInstructions*fuzzInstructionSize {
+			program = program[:fuzzMaxInstructions*fuzzInstructionSize]
+		}
+		genesis := fuzzGenesis()
+		grouped := genesis.Clone()
+		defer genesis.Shutdown()
+		defer grouped.Shutdown()
+		blocks := make([]*Mutations, 0)
+		epoch := uint64(1)
+		validator := genesis.Validator(NewMutations(epoch), epoch)
+		commit := func() {
+			validator.Incorporate(fuzzKeys[int(epoch)%len(fuzzKeys)].PublicKey())
+			if !genesis.Audit() {
+				t.Fatalf("epoch %d: supply %d, circulating %d", epoch, genesis.Issuance.Supply, genesis.Circulating())
+			}
+			blocks = append(blocks, validator.Mutations())
+			epoch++
+			validator = genesis.Validator(NewMutations(epoch), epoch)
+		}
+		var last []byte
+		for ; len(program) >= fuzzInstructionSize; program = program[fuzzInstructionSize:] {
+			data := fuzzAction(program[:fuzzInstructionSize], epoch)
+			switch {
+			case program[0]%16 == 12 && last != nil:
+				data = last
+			case data == nil:
+				commit()
+				continue
+			}
+			validator.Validate(data)
+			last = data
+		}
+		commit()
+		grouped.IncorporateMutations(NewMutations(epoch - 1).Append(blocks))
+		if !grouped.ComponentsHash().Equal(genesis.ComponentsHash()) || !grouped.BalanceTree().Root().Equal(genesis.BalanceTree().Root()) {
+			t.Fatal("grouped mutations and block by block incorporation diverge")
+		}
+	})
+}
+
+// FuzzValidateAction feeds arbitrary actions, parsed without signature
+// verification, into MutatingState.ValidateAction and checks that validated
+// actions cannot create or destroy tokens beyond the fees burned.
+func FuzzValidateAction(f *testing.F) {
+	for op := byte(0); op < 12; op++ {
+		f.Add(fuzzAction([]byte{0x10 | op, 0, 1, 100, 4}, 1))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		genesis := fuzzGenesis()
+		defer genesis.Shutdown()
+		validator := genesis.Validator(NewMutations(1), 1)
+		action, _, _ := actions.ParseActionUnverified(data)
+		validator.ValidateAction(data, action)
+		validator.Incorporate(fuzzKeys[1].PublicKey())
+		if !genesis.Audit() {
+			t.Fatalf("supply %d, circulating %d", genesis.Issuance.Supply, genesis.Circulating())
+		}
+	})
+}
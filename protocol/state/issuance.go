@@ -0,0 +1,262 @@
+package state
+
+import (
+	"bytes"
+	"log/slog"
+	"math/bits"
+	"os"
+	"sort"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// GenesisMint is the amount of tokens credited to both the wallet and the
+// deposit of the genesis token.
+const GenesisMint = 1e9
+
+// KeepWindows is the number of checksum windows for which the weights of the
+// validators are kept by the issuance, the newest one included.
+const KeepWindows = 3
+
+// InflationDenominator is the denominator of IssuanceSchedule.InflationRate:
+// the inflation rate is the number of tokens minted per block for each
+// InflationDenominator tokens of total supply.
+const InflationDenominator = 1e9
+
+// IssuanceSchedule defines the tokens minted at every incorporated block as
+// reward for the validators of the checksum window. The reward is the block
+// reward, halved every HalvingInterval epochs if HalvingInterval is not zero,
+// plus a percentage of the total supply given by InflationRate.
+type IssuanceSchedule struct {
+	BlockReward     uint64 // tokens minted per block prior to any halving
+	HalvingInterval uint64 // epochs between halvings of the block reward
+	InflationRate   uint64 // tokens minted per block per InflationDenominator of supply
+}
+
+// Reward returns the tokens to be minted for the block of the given epoch when
+// the total supply is the given supply.
+func (s IssuanceSchedule) Reward(epoch, supply uint64) uint64 {
+	reward := s.BlockReward
+	if s.HalvingInterval > 0 {
+		if halvings := epoch / s.HalvingInterval; halvings < 64 {
+			reward = reward >> halvings
+		} else {
+			reward = 0
+		}
+	}
+	if s.InflationRate > 0 {
+		hi, lo := bits.Mul64(supply, s.InflationRate)
+		if hi < InflationDenominator {
+			inflation, _ := bits.Div64(hi, lo, InflationDenominator)
+			reward += inflation
+		}
+	}
+	return reward
+}
+
+// Issuance keeps the issuance schedule and the total supply of tokens. Supply
+// grows with minted rewards and shrinks with burned fees and slashed stakes.
+// It must equal the sum of wallets, deposits, delegated stake and withdrawals
+// pending on the unbonding queue (see State.Audit). Windows holds the weights
+// of the validators of the last KeepWindows checksum windows indexed by the
+// first epoch of each window; block rewards are split according to them.
+// Issuance is part of the state checksum. If a file path is provided the
+// issuance is persisted to disk at every incorporation.
+type Issuance struct {
+	Schedule IssuanceSchedule
+	Supply   uint64
+	Windows  map[uint64]map[crypto.Token]int
+	filePath string
+}
+
+// NewIssuance returns an in memory issuance with the given schedule and total
+// supply.
+func NewIssuance(schedule IssuanceSchedule, supply uint64) *Issuance {
+	return &Issuance{Schedule: schedule, Supply: supply, Windows: make(map[uint64]map[crypto.Token]int)}
+}
+
+// NewFileIssuance returns an issuance persisted on the given file. If the file
+// exists its contents are loaded, otherwise a new issuance with the given
+// schedule and supply is created.
+func NewFileIssuance(filePath string, schedule IssuanceSchedule, supply uint64) *Issuance {
+	data, err := os.ReadFile(filePath)
+	if err != nil || len(data) == 0 {
+		issuance := NewIssuance(schedule, supply)
+		issuance.filePath = filePath
+		return issuance
+	}
+	issuance := ParseIssuance(data)
+	if issuance == nil {
+		slog.Error("NewFileIssuance: could not parse existing file", "path", filePath)
+		return nil
+	}
+	issuance.filePath = filePath
+	return issuance
+}
+
+// NewFileIssuanceFromBytes creates an issuance from its serialized form
+// persisted on the given file.
+func NewFileIssuanceFromBytes(filePath string, data []byte) *Issuance {
+	issuance := ParseIssuance(data)
+	if issuance == nil {
+		return nil
+	}
+	issuance.filePath = filePath
+	if err := persistFile(filePath, issuance.Serialize()); err != nil {
+		slog.Error("NewFileIssuanceFromBytes: could not persist issuance", "path", filePath, "err", err)
+		return nil
+	}
+	return issuance
+}
+
+// Reward returns the tokens to be minted for the block of the given epoch.
+func (i *Issuance) Reward(epoch uint64) uint64 {
+	return i.Schedule.Reward(epoch, i.Supply)
+}
+
+// WindowWeights returns the weights of the validators of the checksum window
+// starting at the given epoch or nil if they are not known.
+func (i *Issuance) WindowWeights(start uint64) map[crypto.Token]int {
+	return i.Windows[start]
+}
+
+// Incorporate updates the total supply with the tokens minted and burned on
+// the mutations, records the window weights of the mutations and persists the
+// issuance if file based.
+func (i *Issuance) Incorporate(m *Mutations) {
+	if m.Minted == 0 && m.Burned == 0 && len(m.Windows) == 0 {
+		return
+	}
+	i.Supply = i.Supply + m.Minted - m.Burned
+	for start, weights := range m.Windows {
+		i.Windows[start] = copyWeights(weights)
+	}
+	if len(i.Windows) > KeepWindows {
+		starts := sortedStarts(i.Windows)
+		for _, start := range starts[:len(starts)-KeepWindows] {
+			delete(i.Windows, start)
+		}
+	}
+	if i.filePath != "" {
+		if err := persistFile(i.filePath, i.Serialize()); err != nil {
+			slog.Error("Issuance: could not persist issuance", "path", i.filePath, "err", err)
+		}
+	}
+}
+
+// Clone returns an in memory copy of the issuance.
+func (i *Issuance) Clone() *Issuance {
+	clone := NewIssuance(i.Schedule, i.Supply)
+	for start, weights := range i.Windows {
+		clone.Windows[start] = copyWeights(weights)
+	}
+	return clone
+}
+
+// Serialize returns a byte representation of the issuance.
+func (i *Issuance) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(i.Schedule.BlockReward, &bytes)
+	util.PutUint64(i.Schedule.HalvingInterval, &bytes)
+	util.PutUint64(i.Schedule.InflationRate, &bytes)
+	util.PutUint64(i.Supply, &bytes)
+	putWindowWeights(i.Windows, &bytes)
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (i *Issuance) Bytes() []byte {
+	return i.Serialize()
+}
+
+// Hash returns the hash of the serialized issuance.
+func (i *Issuance) Hash() crypto.Hash {
+	return crypto.Hasher(i.Serialize())
+}
+
+// ParseIssuance parses a serialized issuance. Returns nil if the data is not a
+// valid serialization.
+func ParseIssuance(data []byte) *Issuance {
+	if len(data) < 32 {
+		return nil
+	}
+	issuance := Issuance{Windows: make(map[uint64]map[crypto.Token]int)}
+	position := 0
+	issuance.Schedule.BlockReward, position = util.ParseUint64(data, position)
+	issuance.Schedule.HalvingInterval, position = util.ParseUint64(data, position)
+	issuance.Schedule.InflationRate, position = util.ParseUint64(data, position)
+	issuance.Supply, position = util.ParseUint64(data, position)
+	position, ok := parseWindowWeights(data, position, issuance.Windows)
+	if !ok || position != len(data) {
+		return nil
+	}
+	return &issuance
+}
+
+// copyWeights returns a copy of the weights of the validators of a window.
+func copyWeights(weights map[crypto.Token]int) map[crypto.Token]int {
+	copied := make(map[crypto.Token]int, len(weights))
+	for token, weight := range weights {
+		copied[token] = weight
+	}
+	return copied
+}
+
+// sortedStarts returns the starting epochs of the windows in ascending order.
+func sortedStarts(windows map[uint64]map[crypto.Token]int) []uint64 {
+	starts := make([]uint64, 0, len(windows))
+	for start := range windows {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// putWindowWeights appends a deterministic byte representation of the weights
+// of the windows sorted by window start and token.
+func putWindowWeights(windows map[uint64]map[crypto.Token]int, data *[]byte) {
+	util.PutUint32(uint32(len(windows)), data)
+	for _, start := range sortedStarts(windows) {
+		weights := windows[start]
+		tokens := make([]crypto.Token, 0, len(weights))
+		for token := range weights {
+			tokens = append(tokens, token)
+		}
+		sort.Slice(tokens, func(i, j int) bool { return bytes.Compare(tokens[i][:], tokens[j][:]) < 0 })
+		util.PutUint64(start, data)
+		util.PutUint32(uint32(len(tokens)), data)
+		for _, token := range tokens {
+			util.PutToken(token, data)
+			util.PutUint32(uint32(weights[token]), data)
+		}
+	}
+}
+
+// parseWindowWeights parses weights serialized by putWindowWeights into the
+// given map. Returns the position after the weights and false if the data is
+// not a valid serialization.
+func parseWindowWeights(data []byte, position int, windows map[uint64]map[crypto.Token]int) (int, bool) {
+	count, position, ok := parseCount(data, position, 12)
+	if !ok {
+		return position, false
+	}
+	for n := 0; n < count; n++ {
+		var start uint64
+		var size int
+		start, position = util.ParseUint64(data, position)
+		if size, position, ok = parseCount(data, position, crypto.TokenSize+4); !ok {
+			return position, false
+		}
+		weights := make(map[crypto.Token]int, size)
+		for i := 0; i < size; i++ {
+			var token crypto.Token
+			var weight uint32
+			token, position = util.ParseToken(data, position)
+			weight, position = util.ParseUint32(data, position)
+			weights[token] = int(weight)
+		}
+		windows[start] = weights
+	}
+	return position, true
+}
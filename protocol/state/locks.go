@@ -0,0 +1,226 @@
+package state
+
+import (
+	"log/slog"
+	"sort"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// TimeLock is a locked amount of a wallet balance. The full Value is locked
+// until the Unlock epoch. If Vesting is zero the Value is released at Unlock,
+// otherwise it is released linearly over the Vesting epochs following Unlock.
+type TimeLock struct {
+	Value   uint64
+	Unlock  uint64
+	Vesting uint64
+}
+
+// Locked returns the amount still locked at the given epoch.
+func (t TimeLock) Locked(epoch uint64) uint64 {
+	if epoch < t.Unlock {
+		return t.Value
+	}
+	if t.Vesting == 0 || epoch >= t.Unlock+t.Vesting {
+		return 0
+	}
+	elapsed := epoch - t.Unlock
+	// released = Value * elapsed / Vesting computed without overflow
+	released := (t.Value/t.Vesting)*elapsed + ((t.Value%t.Vesting)*elapsed)/t.Vesting
+	return t.Value - released
+}
+
+// Locks keeps the time locks of wallet balances indexed by the hash of the
+// wallet token. Locked balances remain in the Wallets store but cannot be
+// spent. Locks is part of the state checksum. If a file path is provided the
+// locks of the wallets changed at every incorporation are appended to the file
+// (see deltaFiles).
+type Locks struct {
+	locks    map[crypto.Hash][]TimeLock
+	filePath string
+}
+
+// NewLocks returns an empty in memory set of time locks.
+func NewLocks() *Locks {
+	return &Locks{locks: make(map[crypto.Hash][]TimeLock)}
+}
+
+// NewFileLocks returns a set of time locks persisted on the given file. If the
+// file exists its contents and the deltas appended to it are loaded.
+func NewFileLocks(filePath string) *Locks {
+	base, deltas, err := deltaFiles{filePath: filePath}.read()
+	if err != nil {
+		slog.Error("NewFileLocks: could not read existing file", "path", filePath, "err", err)
+		return nil
+	}
+	locks := NewLocks()
+	if len(base) > 0 {
+		if locks = ParseLocks(base); locks == nil {
+			slog.Error("NewFileLocks: could not parse existing file", "path", filePath)
+			return nil
+		}
+	}
+	for _, delta := range deltas {
+		changed := ParseLocks(delta)
+		if changed == nil {
+			slog.Error("NewFileLocks: could not parse delta", "path", filePath)
+			return nil
+		}
+		// wallets without locks on a delta had all their locks released
+		for hash, wallet := range changed.locks {
+			if len(wallet) == 0 {
+				delete(locks.locks, hash)
+			} else {
+				locks.locks[hash] = wallet
+			}
+		}
+	}
+	locks.filePath = filePath
+	return locks
+}
+
+// NewFileLocksFromBytes creates a set of time locks from its serialized form
+// persisted on the given file.
+func NewFileLocksFromBytes(filePath string, data []byte) *Locks {
+	locks := ParseLocks(data)
+	if locks == nil {
+		return nil
+	}
+	locks.filePath = filePath
+	if err := (deltaFiles{filePath: filePath}).reset(locks.Serialize()); err != nil {
+		slog.Error("NewFileLocksFromBytes: could not persist locks", "path", filePath, "err", err)
+		return nil
+	}
+	return locks
+}
+
+// Locked returns the total amount locked at the given epoch for the wallet with
+// the given hash.
+func (l *Locks) Locked(hash crypto.Hash, epoch uint64) uint64 {
+	total := uint64(0)
+	for _, lock := range l.locks[hash] {
+		total += lock.Locked(epoch)
+	}
+	return total
+}
+
+// Incorporate appends the locks created on the mutations and purges locks fully
+// released at the mutations epoch. If file based, appends the locks of the
+// changed wallets to the file.
+func (l *Locks) Incorporate(m *Mutations) {
+	changed := NewLocks()
+	for hash, locks := range m.Locks {
+		l.locks[hash] = append(l.locks[hash], locks...)
+		changed.locks[hash] = nil
+	}
+	for hash, locks := range l.locks {
+		active := make([]TimeLock, 0, len(locks))
+		for _, lock := range locks {
+			if lock.Locked(m.Epoch) > 0 {
+				active = append(active, lock)
+			}
+		}
+		if len(active) == len(locks) {
+			continue
+		}
+		changed.locks[hash] = nil
+		if len(active) == 0 {
+			delete(l.locks, hash)
+		} else {
+			l.locks[hash] = active
+		}
+	}
+	if l.filePath != "" && len(changed.locks) > 0 {
+		for hash := range changed.locks {
+			changed.locks[hash] = l.locks[hash]
+		}
+		if err := (deltaFiles{filePath: l.filePath}).append(changed.Serialize(), l.Serialize); err != nil {
+			slog.Error("Locks: could not persist locks", "path", l.filePath, "err", err)
+		}
+	}
+}
+
+// Clone returns an in memory copy of the locks.
+func (l *Locks) Clone() *Locks {
+	clone := NewLocks()
+	for hash, locks := range l.locks {
+		clone.locks[hash] = append([]TimeLock{}, locks...)
+	}
+	return clone
+}
+
+// Serialize returns a deterministic byte representation of the locks sorted by
+// wallet hash and, within a wallet, by unlock epoch, vesting and value.
+func (l *Locks) Serialize() []byte {
+	hashes := make([]crypto.Hash, 0, len(l.locks))
+	for hash := range l.locks {
+		hashes = append(hashes, hash)
+	}
+	sortHashes(hashes)
+	bytes := make([]byte, 0)
+	util.PutUint32(uint32(len(hashes)), &bytes)
+	for _, hash := range hashes {
+		locks := append([]TimeLock{}, l.locks[hash]...)
+		sort.Slice(locks, func(i, j int) bool {
+			if locks[i].Unlock != locks[j].Unlock {
+				return locks[i].Unlock < locks[j].Unlock
+			}
+			if locks[i].Vesting != locks[j].Vesting {
+				return locks[i].Vesting < locks[j].Vesting
+			}
+			return locks[i].Value < locks[j].Value
+		})
+		util.PutHash(hash, &bytes)
+		util.PutUint32(uint32(len(locks)), &bytes)
+		for _, lock := range locks {
+			util.PutUint64(lock.Value, &bytes)
+			util.PutUint64(lock.Unlock, &bytes)
+			util.PutUint64(lock.Vesting, &bytes)
+		}
+	}
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (l *Locks) Bytes() []byte {
+	return l.Serialize()
+}
+
+// Hash returns the hash of the serialized locks.
+func (l *Locks) Hash() crypto.Hash {
+	return crypto.Hasher(l.Serialize())
+}
+
+// ParseLocks parses a serialized set of time locks. Returns nil if the data is
+// not a valid serialization.
+func ParseLocks(data []byte) *Locks {
+	if len(data) < 4 {
+		return nil
+	}
+	locks := NewLocks()
+	count, position := util.ParseUint32(data, 0)
+	for n := 0; n < int(count); n++ {
+		if position+crypto.Size+4 > len(data) {
+			return nil
+		}
+		var hash crypto.Hash
+		var size uint32
+		hash, position = util.ParseHash(data, position)
+		size, position = util.ParseUint32(data, position)
+		if position+int(size)*24 > len(data) {
+			return nil
+		}
+		wallet := make([]TimeLock, int(size))
+		for i := 0; i < int(size); i++ {
+			wallet[i].Value, position = util.ParseUint64(data, position)
+			wallet[i].Unlock, position = util.ParseUint64(data, position)
+			wallet[i].Vesting, position = util.ParseUint64(data, position)
+		}
+		locks.locks[hash] = wallet
+	}
+	if position != len(data) {
+		return nil
+	}
+	return locks
+}
@@ -0,0 +1,332 @@
+package state
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// maxProofDepth is the maximum number of siblings of a balance proof, one for
+// each bit of an account hash.
+const maxProofDepth = 8 * crypto.Size
+
+// accountSize is the size in bytes of a serialized account.
+const accountSize = crypto.Size + 16
+
+// Account is the wallet and deposit balance of an account on the state.
+type Account struct {
+	Hash    crypto.Hash
+	Wallet  uint64
+	Deposit uint64
+}
+
+// leafHash is the commitment of an account on the balance tree.
+func (a Account) leafHash() crypto.Hash {
+	data := []byte{0}
+	util.PutHash(a.Hash, &data)
+	util.PutUint64(a.Wallet, &data)
+	util.PutUint64(a.Deposit, &data)
+	return crypto.Hasher(data)
+}
+
+// nodeHash is the commitment of an internal node of the balance tree.
+func nodeHash(left, right crypto.Hash) crypto.Hash {
+	data := []byte{1}
+	util.PutHash(left, &data)
+	util.PutHash(right, &data)
+	return crypto.Hasher(data)
+}
+
+// bit returns the n-th bit of the hash, most significant first.
+func bit(hash crypto.Hash, n int) byte {
+	return (hash[n/8] >> (7 - n%8)) & 1
+}
+
+// sharesPrefix returns true if the first n bits of both hashes are equal.
+func sharesPrefix(a, b crypto.Hash, n int) bool {
+	for i := 0; i < n; i++ {
+		if bit(a, i) != bit(b, i) {
+			return false
+		}
+	}
+	return true
+}
+
+// BalanceTree is a compact sparse Merkle tree over the accounts of the state.
+// Accounts are placed on the path given by the bits of their hash. A subtree
+// with a single account is replaced by the account leaf and an empty subtree
+// commits to the zero hash, so that the depth of the tree grows with the
+// logarithm of the number of accounts. Leaves and internal nodes are domain
+// separated. The tree supports proofs of inclusion of an account balance as
+// well as proofs that an account has zero balance.
+type BalanceTree struct {
+	root *balanceNode
+}
+
+type balanceNode struct {
+	hash  crypto.Hash
+	left  *balanceNode
+	right *balanceNode
+	leaf  *Account
+}
+
+// NewBalanceTree returns the balance tree of the given accounts. Accounts with
+// zero wallet and deposit balances are ignored.
+func NewBalanceTree(accounts []Account) *BalanceTree {
+	sorted := make([]Account, 0, len(accounts))
+	for _, account := range accounts {
+		if account.Wallet > 0 || account.Deposit > 0 {
+			sorted = append(sorted, account)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Hash[:], sorted[j].Hash[:]) < 0
+	})
+	return &BalanceTree{root: buildBalanceNode(sorted, 0)}
+}
+
+// buildBalanceNode builds the subtree of the sorted accounts sharing the first
+// depth bits of their hashes.
+func buildBalanceNode(accounts []Account, depth int) *balanceNode {
+	if len(accounts) == 0 {
+		return nil
+	}
+	if len(accounts) == 1 {
+		return &balanceNode{hash: accounts[0].leafHash(), leaf: &accounts[0]}
+	}
+	split := sort.Search(len(accounts), func(n int) bool { return bit(accounts[n].Hash, depth) == 1 })
+	node := &balanceNode{
+		left:  buildBalanceNode(accounts[:split], depth+1),
+		right: buildBalanceNode(accounts[split:], depth+1),
+	}
+	node.hash = nodeHash(node.left.Hash(), node.right.Hash())
+	return node
+}
+
+// Update returns the balance tree with the balances of the given accounts
+// replaced. Accounts with zero wallet and deposit balances are removed from the
+// tree. Only the paths to the accounts are rebuilt, the rest of the nodes are
+// shared with the original tree, which is not changed, so that trees handed
+// out for proofs remain valid. The root is the same as the root of the tree
+// built from scratch over the resulting accounts.
+func (t *BalanceTree) Update(accounts []Account) *BalanceTree {
+	root := t.root
+	for _, account := range accounts {
+		if account.Wallet > 0 || account.Deposit > 0 {
+			root = root.insert(account, 0)
+		} else {
+			root = root.remove(account.Hash, 0)
+		}
+	}
+	return &BalanceTree{root: root}
+}
+
+// insert returns a copy of the subtree at the given depth with the leaf of the
+// account added or replaced.
+func (n *balanceNode) insert(account Account, depth int) *balanceNode {
+	if n == nil {
+		return &balanceNode{hash: account.leafHash(), leaf: &account}
+	}
+	if n.leaf != nil {
+		if n.leaf.Hash.Equal(account.Hash) {
+			return &balanceNode{hash: account.leafHash(), leaf: &account}
+		}
+		pair := []Account{*n.leaf, account}
+		if bytes.Compare(pair[0].Hash[:], pair[1].Hash[:]) > 0 {
+			pair[0], pair[1] = pair[1], pair[0]
+		}
+		return buildBalanceNode(pair, depth)
+	}
+	node := &balanceNode{left: n.left, right: n.right}
+	if bit(account.Hash, depth) == 0 {
+		node.left = n.left.insert(account, depth+1)
+	} else {
+		node.right = n.right.insert(account, depth+1)
+	}
+	node.hash = nodeHash(node.left.Hash(), node.right.Hash())
+	return node
+}
+
+// remove returns a copy of the subtree at the given depth without the leaf of
+// the account with the given hash. A subtree left with a single leaf is
+// replaced by the leaf.
+func (n *balanceNode) remove(hash crypto.Hash, depth int) *balanceNode {
+	if n == nil {
+		return nil
+	}
+	if n.leaf != nil {
+		if n.leaf.Hash.Equal(hash) {
+			return nil
+		}
+		return n
+	}
+	left, right := n.left, n.right
+	if bit(hash, depth) == 0 {
+		left = n.left.remove(hash, depth+1)
+	} else {
+		right = n.right.remove(hash, depth+1)
+	}
+	if left == n.left && right == n.right {
+		return n
+	}
+	if left == nil && (right == nil || right.leaf != nil) {
+		return right
+	}
+	if right == nil && left.leaf != nil {
+		return left
+	}
+	return &balanceNode{hash: nodeHash(left.Hash(), right.Hash()), left: left, right: right}
+}
+
+// Hash returns the commitment of the node. Empty nodes commit to zero hash.
+func (n *balanceNode) Hash() crypto.Hash {
+	if n == nil {
+		return crypto.ZeroHash
+	}
+	return n.hash
+}
+
+// Root returns the root commitment of the tree.
+func (t *BalanceTree) Root() crypto.Hash {
+	return t.root.Hash()
+}
+
+// Prove returns a proof of the balance of the account with the given hash. If
+// the account is not on the tree the proof is a proof of zero balance.
+func (t *BalanceTree) Prove(hash crypto.Hash) *BalanceProof {
+	proof := &BalanceProof{Account: Account{Hash: hash}, Siblings: make([]crypto.Hash, 0)}
+	node := t.root
+	for depth := 0; node != nil && node.leaf == nil; depth++ {
+		if bit(hash, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, node.right.Hash())
+			node = node.left
+		} else {
+			proof.Siblings = append(proof.Siblings, node.left.Hash())
+			node = node.right
+		}
+	}
+	if node != nil {
+		if node.leaf.Hash.Equal(hash) {
+			proof.Account = *node.leaf
+		} else {
+			neighbour := *node.leaf
+			proof.Neighbour = &neighbour
+		}
+	}
+	return proof
+}
+
+// BalanceProof is a proof of the wallet and deposit balance of an account
+// against the root of a balance tree. Siblings are ordered from the root
+// down to the subtree where the account path ends. If the account has zero
+// balance the path ends either on an empty subtree or on the leaf of another
+// account, the neighbour, sharing the path with the account.
+type BalanceProof struct {
+	Account   Account
+	Siblings  []crypto.Hash
+	Neighbour *Account
+}
+
+// Root returns the root of the balance tree implied by the proof. It returns
+// zero hash and false if the proof is inconsistent.
+func (p *BalanceProof) Root() (crypto.Hash, bool) {
+	depth := len(p.Siblings)
+	if depth > maxProofDepth {
+		return crypto.ZeroHash, false
+	}
+	hash := crypto.ZeroHash
+	if p.Account.Wallet > 0 || p.Account.Deposit > 0 {
+		if p.Neighbour != nil {
+			return crypto.ZeroHash, false
+		}
+		hash = p.Account.leafHash()
+	} else if p.Neighbour != nil {
+		neighbour := *p.Neighbour
+		if neighbour.Hash.Equal(p.Account.Hash) || (neighbour.Wallet == 0 && neighbour.Deposit == 0) || !sharesPrefix(neighbour.Hash, p.Account.Hash, depth) {
+			return crypto.ZeroHash, false
+		}
+		hash = neighbour.leafHash()
+	}
+	for n := depth - 1; n >= 0; n-- {
+		if bit(p.Account.Hash, n) == 0 {
+			hash = nodeHash(hash, p.Siblings[n])
+		} else {
+			hash = nodeHash(p.Siblings[n], hash)
+		}
+	}
+	return hash, true
+}
+
+// Verify returns true if the proof is consistent with the given root.
+func (p *BalanceProof) Verify(root crypto.Hash) bool {
+	hash, ok := p.Root()
+	return ok && hash.Equal(root)
+}
+
+// Serialize returns a byte representation of the proof.
+func (p *BalanceProof) Serialize() []byte {
+	bytes := make([]byte, 0)
+	putAccount(p.Account, &bytes)
+	util.PutHashArray(p.Siblings, &bytes)
+	if p.Neighbour != nil {
+		util.PutBool(true, &bytes)
+		putAccount(*p.Neighbour, &bytes)
+	} else {
+		util.PutBool(false, &bytes)
+	}
+	return bytes
+}
+
+// ParseBalanceProof parses a serialized balance proof. Returns nil if the data
+// is not a valid serialization.
+func ParseBalanceProof(data []byte) *BalanceProof {
+	proof, position := ParseBalanceProofPosition(data, 0)
+	if proof == nil || position != len(data) {
+		return nil
+	}
+	return proof
+}
+
+// ParseBalanceProofPosition parses a balance proof in the middle of a byte
+// slice and returns the proof and the position after it.
+func ParseBalanceProofPosition(data []byte, position int) (*BalanceProof, int) {
+	proof := BalanceProof{}
+	if position+accountSize+4 > len(data) {
+		return nil, len(data) + 1
+	}
+	proof.Account, position = parseAccount(data, position)
+	if count, _ := util.ParseUint32(data, position); count > maxProofDepth || position+4+int(count)*crypto.Size > len(data) {
+		return nil, len(data) + 1
+	}
+	proof.Siblings, position = util.ParseHashArray(data, position)
+	var hasNeighbour bool
+	hasNeighbour, position = util.ParseBool(data, position)
+	if hasNeighbour {
+		if position+accountSize > len(data) {
+			return nil, len(data) + 1
+		}
+		var neighbour Account
+		neighbour, position = parseAccount(data, position)
+		proof.Neighbour = &neighbour
+	}
+	if position > len(data) {
+		return nil, position
+	}
+	return &proof, position
+}
+
+func putAccount(account Account, data *[]byte) {
+	util.PutHash(account.Hash, data)
+	util.PutUint64(account.Wallet, data)
+	util.PutUint64(account.Deposit, data)
+}
+
+func parseAccount(data []byte, position int) (Account, int) {
+	account := Account{}
+	account.Hash, position = util.ParseHash(data, position)
+	account.Wallet, position = util.ParseUint64(data, position)
+	account.Deposit, position = util.ParseUint64(data, position)
+	return account, position
+}
@@ -0,0 +1,188 @@
+package state
+
+import (
+	"log/slog"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Policy is the M-of-N signature policy of a multisig wallet.
+type Policy struct {
+	Threshold byte
+	Signers   []crypto.Token
+}
+
+// Authorizes returns true if at least Threshold distinct signers of the policy
+// are among the given tokens.
+func (p *Policy) Authorizes(tokens []crypto.Token) bool {
+	signed := make(map[crypto.Token]struct{})
+	for _, token := range tokens {
+		for _, signer := range p.Signers {
+			if signer.Equal(token) {
+				signed[token] = struct{}{}
+				break
+			}
+		}
+	}
+	return len(signed) >= int(p.Threshold)
+}
+
+// MultisigPolicies keeps the signature policy of multisig wallets indexed by
+// the hash of the wallet token. It is part of the state checksum. If a file
+// path is provided the policies registered at every incorporation are appended
+// to the file (see deltaFiles).
+type MultisigPolicies struct {
+	policies map[crypto.Hash]*Policy
+	filePath string
+}
+
+// NewMultisigPolicies returns an empty in memory set of multisig policies.
+func NewMultisigPolicies() *MultisigPolicies {
+	return &MultisigPolicies{policies: make(map[crypto.Hash]*Policy)}
+}
+
+// NewFileMultisigPolicies returns a set of multisig policies persisted on the
+// given file. If the file exists its contents and the deltas appended to it
+// are loaded.
+func NewFileMultisigPolicies(filePath string) *MultisigPolicies {
+	base, deltas, err := deltaFiles{filePath: filePath}.read()
+	if err != nil {
+		slog.Error("NewFileMultisigPolicies: could not read existing file", "path", filePath, "err", err)
+		return nil
+	}
+	policies := NewMultisigPolicies()
+	if len(base) > 0 {
+		if policies = ParseMultisigPolicies(base); policies == nil {
+			slog.Error("NewFileMultisigPolicies: could not parse existing file", "path", filePath)
+			return nil
+		}
+	}
+	for _, delta := range deltas {
+		registered := ParseMultisigPolicies(delta)
+		if registered == nil {
+			slog.Error("NewFileMultisigPolicies: could not parse delta", "path", filePath)
+			return nil
+		}
+		for hash, policy := range registered.policies {
+			policies.policies[hash] = policy
+		}
+	}
+	policies.filePath = filePath
+	return policies
+}
+
+// NewFileMultisigPoliciesFromBytes creates a set of multisig policies from its
+// serialized form persisted on the given file.
+func NewFileMultisigPoliciesFromBytes(filePath string, data []byte) *MultisigPolicies {
+	policies := ParseMultisigPolicies(data)
+	if policies == nil {
+		return nil
+	}
+	policies.filePath = filePath
+	if err := (deltaFiles{filePath: filePath}).reset(policies.Serialize()); err != nil {
+		slog.Error("NewFileMultisigPoliciesFromBytes: could not persist policies", "path", filePath, "err", err)
+		return nil
+	}
+	return policies
+}
+
+// Get returns the policy of the wallet with the given hash, nil if the wallet
+// is not a multisig wallet.
+func (m *MultisigPolicies) Get(hash crypto.Hash) *Policy {
+	return m.policies[hash]
+}
+
+// Set associates the policy to the wallet with the given hash.
+func (m *MultisigPolicies) Set(hash crypto.Hash, policy *Policy) {
+	m.policies[hash] = policy
+}
+
+// Incorporate sets the policies registered on the mutations and, if file
+// based, appends them to the file.
+func (m *MultisigPolicies) Incorporate(mutations *Mutations) {
+	if len(mutations.Policies) == 0 {
+		return
+	}
+	for hash, policy := range mutations.Policies {
+		m.policies[hash] = policy
+	}
+	if m.filePath != "" {
+		registered := &MultisigPolicies{policies: mutations.Policies}
+		if err := (deltaFiles{filePath: m.filePath}).append(registered.Serialize(), m.Serialize); err != nil {
+			slog.Error("MultisigPolicies: could not persist policies", "path", m.filePath, "err", err)
+		}
+	}
+}
+
+// Clone returns an in memory copy of the policies. Policies are immutable once
+// registered and are shared with the clone.
+func (m *MultisigPolicies) Clone() *MultisigPolicies {
+	clone := NewMultisigPolicies()
+	for hash, policy := range m.policies {
+		clone.policies[hash] = policy
+	}
+	return clone
+}
+
+// Serialize returns a deterministic byte representation of the policies sorted
+// by wallet hash.
+func (m *MultisigPolicies) Serialize() []byte {
+	hashes := make([]crypto.Hash, 0, len(m.policies))
+	for hash := range m.policies {
+		hashes = append(hashes, hash)
+	}
+	sortHashes(hashes)
+	bytes := make([]byte, 0)
+	util.PutUint32(uint32(len(hashes)), &bytes)
+	for _, hash := range hashes {
+		policy := m.policies[hash]
+		util.PutHash(hash, &bytes)
+		util.PutByte(policy.Threshold, &bytes)
+		util.PutTokenArray(policy.Signers, &bytes)
+	}
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (m *MultisigPolicies) Bytes() []byte {
+	return m.Serialize()
+}
+
+// Hash returns the hash of the serialized policies.
+func (m *MultisigPolicies) Hash() crypto.Hash {
+	return crypto.Hasher(m.Serialize())
+}
+
+// ParseMultisigPolicies parses a serialized set of policies. Returns nil if the
+// data is not a valid serialization.
+func ParseMultisigPolicies(data []byte) *MultisigPolicies {
+	if len(data) < 4 {
+		return nil
+	}
+	policies := NewMultisigPolicies()
+	count, position := util.ParseUint32(data, 0)
+	for n := 0; n < int(count); n++ {
+		if position+crypto.Size+5 > len(data) {
+			return nil
+		}
+		var hash crypto.Hash
+		policy := Policy{}
+		hash, position = util.ParseHash(data, position)
+		policy.Threshold, position = util.ParseByte(data, position)
+		var signers uint32
+		signers, position = util.ParseUint32(data, position)
+		if position+int(signers)*crypto.TokenSize > len(data) {
+			return nil
+		}
+		policy.Signers = make([]crypto.Token, int(signers))
+		for s := 0; s < int(signers); s++ {
+			policy.Signers[s], position = util.ParseToken(data, position)
+		}
+		policies.policies[hash] = &policy
+	}
+	if position != len(data) {
+		return nil
+	}
+	return policies
+}
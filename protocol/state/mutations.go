@@ -2,22 +2,57 @@ package state
 
 import (
 	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
 )
 
 // Mutation is a change in the state of a wallet or a deposit kept in memory by
 // a golang hashmap from the hash of token into deltas of wallets and deposits.
+// Actions maps the hash of each validated action into its epoch. Policies
+// holds the multisig policies registered by validated actions and Locks the
+// time locks created by validated actions. Unbonding holds the withdrawals
+// entering the unbonding queue and SlashedUnbonding the amounts slashed from
+// withdrawals pending in the queue. Nonces holds the last nonce used by each
+// wallet on validated actions. Delegations holds the deltas of stake delegated
+// to validators indexed by validator hash and delegator hash. Protocols holds
+// the rules of protocol codes registered by validated actions. Windows holds
+// the weights of the validators of checksum windows recorded by the block,
+// indexed by the first epoch of the window. Minted is the
+// amount of tokens issued as block rewards and Burned the amount of tokens
+// destroyed by the fee market and by slashing. Size is the total size in bytes
+// of validated actions.
 type Mutations struct {
-	Epoch         uint64
-	DeltaWallets  map[crypto.Hash]int
-	DeltaDeposits map[crypto.Hash]int
+	Epoch            uint64
+	DeltaWallets     map[crypto.Hash]int
+	DeltaDeposits    map[crypto.Hash]int
+	Actions          map[crypto.Hash]uint64
+	Policies         map[crypto.Hash]*Policy
+	Locks            map[crypto.Hash][]TimeLock
+	Unbonding        []Unbonding
+	SlashedUnbonding map[crypto.Hash]uint64
+	Nonces           map[crypto.Hash]uint64
+	Delegations      map[crypto.Hash]map[crypto.Hash]int
+	Protocols        map[uint32]*ProtocolRule
+	Windows          map[uint64]map[crypto.Token]int
+	Minted           uint64
+	Burned           uint64
+	Size             uint64
 }
 
 // NewMutations creates a new mutation object with the given epoch.
 func NewMutations(epoch uint64) *Mutations {
 	return &Mutations{
-		Epoch:         epoch,
-		DeltaWallets:  make(map[crypto.Hash]int),
-		DeltaDeposits: make(map[crypto.Hash]int),
+		Epoch:            epoch,
+		DeltaWallets:     make(map[crypto.Hash]int),
+		DeltaDeposits:    make(map[crypto.Hash]int),
+		Actions:          make(map[crypto.Hash]uint64),
+		Policies:         make(map[crypto.Hash]*Policy),
+		Locks:            make(map[crypto.Hash][]TimeLock),
+		Unbonding:        make([]Unbonding, 0),
+		SlashedUnbonding: make(map[crypto.Hash]uint64),
+		Nonces:           make(map[crypto.Hash]uint64),
+		Delegations:      make(map[crypto.Hash]map[crypto.Hash]int),
+		Protocols:        make(map[uint32]*ProtocolRule),
+		Windows:          make(map[uint64]map[crypto.Token]int),
 	}
 }
 
@@ -32,6 +67,24 @@ func (m *Mutations) DeltaBalance(hash crypto.Hash) int {
 	return value
 }
 
+// DeltaDelegation adds delta to the stake delegated by the delegator to the
+// validator.
+func (m *Mutations) DeltaDelegation(validator, delegator crypto.Hash, delta int) {
+	deltas, ok := m.Delegations[validator]
+	if !ok {
+		deltas = make(map[crypto.Hash]int)
+		m.Delegations[validator] = deltas
+	}
+	deltas[delegator] += delta
+}
+
+// HasAction returns true if an action with the given hash was already
+// validated into the mutations.
+func (m *Mutations) HasAction(hash crypto.Hash) bool {
+	_, ok := m.Actions[hash]
+	return ok
+}
+
 // Append mutations into a single mutation object with epoch given by the
 // caller of the method.
 func (m *Mutations) Append(array []*Mutations) *Mutations {
@@ -61,6 +114,239 @@ func (m *Mutations) Append(array []*Mutations) *Mutations {
 				grouped.DeltaDeposits[hash] = delta
 			}
 		}
+		for hash, epoch := range mutations.Actions {
+			grouped.Actions[hash] = epoch
+		}
+		for hash, policy := range mutations.Policies {
+			grouped.Policies[hash] = policy
+		}
+		for hash, locks := range mutations.Locks {
+			grouped.Locks[hash] = append(grouped.Locks[hash], locks...)
+		}
+		grouped.Unbonding = append(grouped.Unbonding, mutations.Unbonding...)
+		for hash, value := range mutations.SlashedUnbonding {
+			grouped.SlashedUnbonding[hash] += value
+		}
+		grouped.Size += mutations.Size
+		grouped.Minted += mutations.Minted
+		grouped.Burned += mutations.Burned
+		for hash, nonce := range mutations.Nonces {
+			if nonce > grouped.Nonces[hash] {
+				grouped.Nonces[hash] = nonce
+			}
+		}
+		for validator, deltas := range mutations.Delegations {
+			for delegator, delta := range deltas {
+				grouped.DeltaDelegation(validator, delegator, delta)
+			}
+		}
+		for code, rule := range mutations.Protocols {
+			grouped.Protocols[code] = rule
+		}
+		for start, weights := range mutations.Windows {
+			grouped.Windows[start] = weights
+		}
 	}
 	return grouped
 }
+
+// sortedHashes returns the keys of a hash indexed map in ascending order.
+func sortedHashes[T any](m map[crypto.Hash]T) []crypto.Hash {
+	hashes := make([]crypto.Hash, 0, len(m))
+	for hash := range m {
+		hashes = append(hashes, hash)
+	}
+	sortHashes(hashes)
+	return hashes
+}
+
+// Serialize returns a deterministic byte representation of the mutations.
+// Hash indexed entries are sorted by hash. The order of time locks within a
+// wallet and of withdrawals entering the unbonding queue is preserved.
+func (m *Mutations) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(m.Epoch, &bytes)
+	util.PutUint64(m.Size, &bytes)
+	util.PutUint64(m.Minted, &bytes)
+	util.PutUint64(m.Burned, &bytes)
+	for _, deltas := range []map[crypto.Hash]int{m.DeltaWallets, m.DeltaDeposits} {
+		util.PutUint32(uint32(len(deltas)), &bytes)
+		for _, hash := range sortedHashes(deltas) {
+			util.PutHash(hash, &bytes)
+			util.PutUint64(uint64(int64(deltas[hash])), &bytes)
+		}
+	}
+	for _, values := range []map[crypto.Hash]uint64{m.Actions, m.SlashedUnbonding, m.Nonces} {
+		util.PutUint32(uint32(len(values)), &bytes)
+		for _, hash := range sortedHashes(values) {
+			util.PutHash(hash, &bytes)
+			util.PutUint64(values[hash], &bytes)
+		}
+	}
+	util.PutUint32(uint32(len(m.Policies)), &bytes)
+	for _, hash := range sortedHashes(m.Policies) {
+		policy := m.Policies[hash]
+		util.PutHash(hash, &bytes)
+		util.PutByte(policy.Threshold, &bytes)
+		util.PutTokenArray(policy.Signers, &bytes)
+	}
+	util.PutUint32(uint32(len(m.Locks)), &bytes)
+	for _, hash := range sortedHashes(m.Locks) {
+		util.PutHash(hash, &bytes)
+		util.PutUint32(uint32(len(m.Locks[hash])), &bytes)
+		for _, lock := range m.Locks[hash] {
+			util.PutUint64(lock.Value, &bytes)
+			util.PutUint64(lock.Unlock, &bytes)
+			util.PutUint64(lock.Vesting, &bytes)
+		}
+	}
+	util.PutUint32(uint32(len(m.Unbonding)), &bytes)
+	for _, unbonding := range m.Unbonding {
+		util.PutHash(unbonding.Hash, &bytes)
+		util.PutUint64(unbonding.Value, &bytes)
+		util.PutUint64(unbonding.Matures, &bytes)
+	}
+	util.PutUint32(uint32(len(m.Delegations)), &bytes)
+	for _, validator := range sortedHashes(m.Delegations) {
+		deltas := m.Delegations[validator]
+		util.PutHash(validator, &bytes)
+		util.PutUint32(uint32(len(deltas)), &bytes)
+		for _, delegator := range sortedHashes(deltas) {
+			util.PutHash(delegator, &bytes)
+			util.PutUint64(uint64(int64(deltas[delegator])), &bytes)
+		}
+	}
+	putProtocolRules(m.Protocols, &bytes)
+	putWindowWeights(m.Windows, &bytes)
+	return bytes
+}
+
+// parseCount parses the number of entries of a section of serialized mutations
+// and checks that at least size bytes per entry are available.
+func parseCount(data []byte, position, size int) (int, int, bool) {
+	if position+4 > len(data) {
+		return 0, position, false
+	}
+	count, position := util.ParseUint32(data, position)
+	if position+int(count)*size > len(data) {
+		return 0, position, false
+	}
+	return int(count), position, true
+}
+
+// ParseMutations parses a serialized mutations object. Returns nil if the data
+// is not a valid serialization.
+func ParseMutations(data []byte) *Mutations {
+	if len(data) < 32 {
+		return nil
+	}
+	m := NewMutations(0)
+	position := 0
+	m.Epoch, position = util.ParseUint64(data, position)
+	m.Size, position = util.ParseUint64(data, position)
+	m.Minted, position = util.ParseUint64(data, position)
+	m.Burned, position = util.ParseUint64(data, position)
+	for _, deltas := range []map[crypto.Hash]int{m.DeltaWallets, m.DeltaDeposits} {
+		count, next, ok := parseCount(data, position, crypto.Size+8)
+		if !ok {
+			return nil
+		}
+		position = next
+		for n := 0; n < count; n++ {
+			var hash crypto.Hash
+			var delta uint64
+			hash, position = util.ParseHash(data, position)
+			delta, position = util.ParseUint64(data, position)
+			deltas[hash] = int(int64(delta))
+		}
+	}
+	for _, values := range []map[crypto.Hash]uint64{m.Actions, m.SlashedUnbonding, m.Nonces} {
+		count, next, ok := parseCount(data, position, crypto.Size+8)
+		if !ok {
+			return nil
+		}
+		position = next
+		for n := 0; n < count; n++ {
+			var hash crypto.Hash
+			hash, position = util.ParseHash(data, position)
+			values[hash], position = util.ParseUint64(data, position)
+		}
+	}
+	count, position, ok := parseCount(data, position, crypto.Size+5)
+	if !ok {
+		return nil
+	}
+	for n := 0; n < count; n++ {
+		var hash crypto.Hash
+		var signers int
+		policy := Policy{}
+		hash, position = util.ParseHash(data, position)
+		policy.Threshold, position = util.ParseByte(data, position)
+		if signers, position, ok = parseCount(data, position, crypto.TokenSize); !ok {
+			return nil
+		}
+		policy.Signers = make([]crypto.Token, signers)
+		for s := 0; s < signers; s++ {
+			policy.Signers[s], position = util.ParseToken(data, position)
+		}
+		m.Policies[hash] = &policy
+	}
+	if count, position, ok = parseCount(data, position, crypto.Size+4); !ok {
+		return nil
+	}
+	for n := 0; n < count; n++ {
+		var hash crypto.Hash
+		var size int
+		hash, position = util.ParseHash(data, position)
+		if size, position, ok = parseCount(data, position, 24); !ok {
+			return nil
+		}
+		locks := make([]TimeLock, size)
+		for i := 0; i < size; i++ {
+			locks[i].Value, position = util.ParseUint64(data, position)
+			locks[i].Unlock, position = util.ParseUint64(data, position)
+			locks[i].Vesting, position = util.ParseUint64(data, position)
+		}
+		m.Locks[hash] = locks
+	}
+	if count, position, ok = parseCount(data, position, crypto.Size+16); !ok {
+		return nil
+	}
+	for n := 0; n < count; n++ {
+		unbonding := Unbonding{}
+		unbonding.Hash, position = util.ParseHash(data, position)
+		unbonding.Value, position = util.ParseUint64(data, position)
+		unbonding.Matures, position = util.ParseUint64(data, position)
+		m.Unbonding = append(m.Unbonding, unbonding)
+	}
+	if count, position, ok = parseCount(data, position, crypto.Size+4); !ok {
+		return nil
+	}
+	for n := 0; n < count; n++ {
+		var validator crypto.Hash
+		var size int
+		validator, position = util.ParseHash(data, position)
+		if size, position, ok = parseCount(data, position, crypto.Size+8); !ok {
+			return nil
+		}
+		deltas := make(map[crypto.Hash]int, size)
+		for i := 0; i < size; i++ {
+			var delegator crypto.Hash
+			var delta uint64
+			delegator, position = util.ParseHash(data, position)
+			delta, position = util.ParseUint64(data, position)
+			deltas[delegator] = int(int64(delta))
+		}
+		m.Delegations[validator] = deltas
+	}
+	if position, ok = parseProtocolRules(data, position, m.Protocols); !ok {
+		return nil
+	}
+	if position, ok = parseWindowWeights(data, position, m.Windows); !ok {
+		return nil
+	}
+	if position != len(data) {
+		return nil
+	}
+	return m
+}
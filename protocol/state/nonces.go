@@ -0,0 +1,147 @@
+package state
+
+import (
+	"log/slog"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Nonces keeps the sequence number of the last incorporated nonce bearing
+// action of each wallet indexed by the hash of the wallet token. Nonces is
+// part of the state checksum. If a file path is provided the nonces changed at
+// every incorporation are appended to the file (see deltaFiles).
+type Nonces struct {
+	nonces   map[crypto.Hash]uint64
+	filePath string
+}
+
+// NewNonces returns an empty in memory set of nonces.
+func NewNonces() *Nonces {
+	return &Nonces{nonces: make(map[crypto.Hash]uint64)}
+}
+
+// NewFileNonces returns a set of nonces persisted on the given file. If the
+// file exists its contents and the deltas appended to it are loaded.
+func NewFileNonces(filePath string) *Nonces {
+	base, deltas, err := deltaFiles{filePath: filePath}.read()
+	if err != nil {
+		slog.Error("NewFileNonces: could not read existing file", "path", filePath, "err", err)
+		return nil
+	}
+	nonces := NewNonces()
+	if len(base) > 0 {
+		if nonces = ParseNonces(base); nonces == nil {
+			slog.Error("NewFileNonces: could not parse existing file", "path", filePath)
+			return nil
+		}
+	}
+	for _, delta := range deltas {
+		changed := ParseNonces(delta)
+		if changed == nil {
+			slog.Error("NewFileNonces: could not parse delta", "path", filePath)
+			return nil
+		}
+		for hash, nonce := range changed.nonces {
+			nonces.nonces[hash] = nonce
+		}
+	}
+	nonces.filePath = filePath
+	return nonces
+}
+
+// NewFileNoncesFromBytes creates a set of nonces from its serialized form
+// persisted on the given file.
+func NewFileNoncesFromBytes(filePath string, data []byte) *Nonces {
+	nonces := ParseNonces(data)
+	if nonces == nil {
+		return nil
+	}
+	nonces.filePath = filePath
+	if err := (deltaFiles{filePath: filePath}).reset(nonces.Serialize()); err != nil {
+		slog.Error("NewFileNoncesFromBytes: could not persist nonces", "path", filePath, "err", err)
+		return nil
+	}
+	return nonces
+}
+
+// Get returns the last nonce used by the wallet with the given hash, zero if
+// the wallet never used a nonce.
+func (n *Nonces) Get(hash crypto.Hash) uint64 {
+	return n.nonces[hash]
+}
+
+// Incorporate sets the nonces used on the mutations and, if file based, appends
+// the changed nonces to the file.
+func (n *Nonces) Incorporate(m *Mutations) {
+	if len(m.Nonces) == 0 {
+		return
+	}
+	changed := NewNonces()
+	for hash, nonce := range m.Nonces {
+		if nonce > n.nonces[hash] {
+			n.nonces[hash] = nonce
+			changed.nonces[hash] = nonce
+		}
+	}
+	if n.filePath != "" && len(changed.nonces) > 0 {
+		if err := (deltaFiles{filePath: n.filePath}).append(changed.Serialize(), n.Serialize); err != nil {
+			slog.Error("Nonces: could not persist nonces", "path", n.filePath, "err", err)
+		}
+	}
+}
+
+// Clone returns an in memory copy of the nonces.
+func (n *Nonces) Clone() *Nonces {
+	clone := NewNonces()
+	for hash, nonce := range n.nonces {
+		clone.nonces[hash] = nonce
+	}
+	return clone
+}
+
+// Serialize returns a deterministic byte representation of the nonces sorted
+// by wallet hash.
+func (n *Nonces) Serialize() []byte {
+	hashes := make([]crypto.Hash, 0, len(n.nonces))
+	for hash := range n.nonces {
+		hashes = append(hashes, hash)
+	}
+	sortHashes(hashes)
+	bytes := make([]byte, 0)
+	util.PutUint32(uint32(len(hashes)), &bytes)
+	for _, hash := range hashes {
+		util.PutHash(hash, &bytes)
+		util.PutUint64(n.nonces[hash], &bytes)
+	}
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (n *Nonces) Bytes() []byte {
+	return n.Serialize()
+}
+
+// Hash returns the hash of the serialized nonces.
+func (n *Nonces) Hash() crypto.Hash {
+	return crypto.Hasher(n.Serialize())
+}
+
+// ParseNonces parses a serialized set of nonces. Returns nil if the data is not
+// a valid serialization.
+func ParseNonces(data []byte) *Nonces {
+	if len(data) < 4 {
+		return nil
+	}
+	nonces := NewNonces()
+	count, position := util.ParseUint32(data, 0)
+	if position+int(count)*(crypto.Size+8) != len(data) {
+		return nil
+	}
+	for i := 0; i < int(count); i++ {
+		var hash crypto.Hash
+		hash, position = util.ParseHash(data, position)
+		nonces.nonces[hash], position = util.ParseUint64(data, position)
+	}
+	return nonces
+}
@@ -0,0 +1,190 @@
+package state
+
+import (
+	"log/slog"
+	"sort"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/util"
+)
+
+// ProtocolRule is the rule of a registered protocol code of void actions.
+// MaxDataSize is the maximum size of the data of a void action of the
+// protocol, zero for no limit. MinFee is the minimum fee of a void action of
+// the protocol.
+type ProtocolRule struct {
+	Owner       crypto.Token
+	MaxDataSize uint32
+	MinFee      uint64
+}
+
+// Accepts returns true if the void action complies with the rule.
+func (r *ProtocolRule) Accepts(void *actions.Void) bool {
+	if r.MaxDataSize > 0 && len(void.Data) > int(r.MaxDataSize) {
+		return false
+	}
+	return void.Fee >= r.MinFee
+}
+
+// Protocols is the registry of protocol codes of void actions claimed by
+// tokens, indexed by protocol code. Void actions of unregistered codes are not
+// subject to any rule. It is part of the state checksum. If a file path is
+// provided the rules registered at every incorporation are appended to the
+// file (see deltaFiles).
+type Protocols struct {
+	rules    map[uint32]*ProtocolRule
+	filePath string
+}
+
+// NewProtocols returns an empty in memory registry of protocols.
+func NewProtocols() *Protocols {
+	return &Protocols{rules: make(map[uint32]*ProtocolRule)}
+}
+
+// NewFileProtocols returns a registry of protocols persisted on the given file.
+// If the file exists its contents and the deltas appended to it are loaded.
+func NewFileProtocols(filePath string) *Protocols {
+	base, deltas, err := deltaFiles{filePath: filePath}.read()
+	if err != nil {
+		slog.Error("NewFileProtocols: could not read existing file", "path", filePath, "err", err)
+		return nil
+	}
+	protocols := NewProtocols()
+	if len(base) > 0 {
+		if protocols = ParseProtocols(base); protocols == nil {
+			slog.Error("NewFileProtocols: could not parse existing file", "path", filePath)
+			return nil
+		}
+	}
+	for _, delta := range deltas {
+		if position, ok := parseProtocolRules(delta, 0, protocols.rules); !ok || position != len(delta) {
+			slog.Error("NewFileProtocols: could not parse delta", "path", filePath)
+			return nil
+		}
+	}
+	protocols.filePath = filePath
+	return protocols
+}
+
+// NewFileProtocolsFromBytes creates a registry of protocols from its serialized
+// form persisted on the given file.
+func NewFileProtocolsFromBytes(filePath string, data []byte) *Protocols {
+	protocols := ParseProtocols(data)
+	if protocols == nil {
+		return nil
+	}
+	protocols.filePath = filePath
+	if err := (deltaFiles{filePath: filePath}).reset(protocols.Serialize()); err != nil {
+		slog.Error("NewFileProtocolsFromBytes: could not persist protocols", "path", filePath, "err", err)
+		return nil
+	}
+	return protocols
+}
+
+// Get returns the rule of the protocol code, nil if the code is not
+// registered.
+func (p *Protocols) Get(code uint32) *ProtocolRule {
+	return p.rules[code]
+}
+
+// Incorporate sets the rules registered on the mutations and, if file based,
+// appends them to the file.
+func (p *Protocols) Incorporate(m *Mutations) {
+	if len(m.Protocols) == 0 {
+		return
+	}
+	for code, rule := range m.Protocols {
+		p.rules[code] = rule
+	}
+	if p.filePath != "" {
+		delta := make([]byte, 0)
+		putProtocolRules(m.Protocols, &delta)
+		if err := (deltaFiles{filePath: p.filePath}).append(delta, p.Serialize); err != nil {
+			slog.Error("Protocols: could not persist protocols", "path", p.filePath, "err", err)
+		}
+	}
+}
+
+// Clone returns an in memory copy of the registry. Rules are replaced, never
+// modified, and are shared with the clone.
+func (p *Protocols) Clone() *Protocols {
+	clone := NewProtocols()
+	for code, rule := range p.rules {
+		clone.rules[code] = rule
+	}
+	return clone
+}
+
+// sortedCodes returns the keys of a protocol code indexed map in ascending
+// order.
+func sortedCodes[T any](m map[uint32]T) []uint32 {
+	codes := make([]uint32, 0, len(m))
+	for code := range m {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// putProtocolRules appends a deterministic byte representation of the rules
+// sorted by protocol code.
+func putProtocolRules(rules map[uint32]*ProtocolRule, bytes *[]byte) {
+	util.PutUint32(uint32(len(rules)), bytes)
+	for _, code := range sortedCodes(rules) {
+		rule := rules[code]
+		util.PutUint32(code, bytes)
+		util.PutToken(rule.Owner, bytes)
+		util.PutUint32(rule.MaxDataSize, bytes)
+		util.PutUint64(rule.MinFee, bytes)
+	}
+}
+
+// parseProtocolRules parses rules serialized by putProtocolRules into the
+// given map. Returns the position after the rules and false if the data is
+// not a valid serialization.
+func parseProtocolRules(data []byte, position int, rules map[uint32]*ProtocolRule) (int, bool) {
+	count, position, ok := parseCount(data, position, 4+crypto.TokenSize+4+8)
+	if !ok {
+		return position, false
+	}
+	for n := 0; n < count; n++ {
+		var code uint32
+		rule := ProtocolRule{}
+		code, position = util.ParseUint32(data, position)
+		rule.Owner, position = util.ParseToken(data, position)
+		rule.MaxDataSize, position = util.ParseUint32(data, position)
+		rule.MinFee, position = util.ParseUint64(data, position)
+		rules[code] = &rule
+	}
+	return position, true
+}
+
+// Serialize returns a deterministic byte representation of the registry sorted
+// by protocol code.
+func (p *Protocols) Serialize() []byte {
+	bytes := make([]byte, 0)
+	putProtocolRules(p.rules, &bytes)
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (p *Protocols) Bytes() []byte {
+	return p.Serialize()
+}
+
+// Hash returns the hash of the serialized registry.
+func (p *Protocols) Hash() crypto.Hash {
+	return crypto.Hasher(p.Serialize())
+}
+
+// ParseProtocols parses a serialized registry of protocols. Returns nil if the
+// data is not a valid serialization.
+func ParseProtocols(data []byte) *Protocols {
+	protocols := NewProtocols()
+	position, ok := parseProtocolRules(data, 0, protocols.rules)
+	if !ok || position != len(data) {
+		return nil
+	}
+	return protocols
+}
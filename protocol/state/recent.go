@@ -0,0 +1,302 @@
+package state
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// RecentActions keeps the hashes of actions incorporated into the state whose
+// epoch is still within MaxEpochDifference of the state epoch. Hashes are
+// bucketed by the epoch of the action. Actions outside that window are
+// rejected by the validator on epoch grounds, so their hashes can be safely
+// purged. RecentActions is part of the state checksum and must evolve
+// identically on every node. If a file path is provided the epoch of the record
+// is persisted on the file and the hashes of each action epoch are appended at
+// every incorporation to their own bucket file (see bucketFiles), deleted once
+// the action epoch falls out of the record.
+type RecentActions struct {
+	Epoch    uint64
+	hashes   map[uint64]map[crypto.Hash]struct{}
+	filePath string
+}
+
+// NewRecentActions returns an empty in memory record of recent actions.
+func NewRecentActions(epoch uint64) *RecentActions {
+	return &RecentActions{
+		Epoch:  epoch,
+		hashes: make(map[uint64]map[crypto.Hash]struct{}),
+	}
+}
+
+// NewFileRecentActions returns a record of recent actions persisted on the
+// given file. If the file exists the record is loaded from it and its bucket
+// files, otherwise an empty record is created for the given epoch.
+func NewFileRecentActions(filePath string, epoch uint64) *RecentActions {
+	files := bucketFiles{filePath: filePath}
+	data, err := os.ReadFile(filePath)
+	if err != nil || len(data) == 0 {
+		if err := files.clear(); err != nil {
+			slog.Error("NewFileRecentActions: could not remove stale buckets", "path", filePath, "err", err)
+			return nil
+		}
+		recent := NewRecentActions(epoch)
+		recent.filePath = filePath
+		return recent
+	}
+	if len(data) != 8 {
+		slog.Error("NewFileRecentActions: could not parse existing file", "path", filePath)
+		return nil
+	}
+	epoch, _ = util.ParseUint64(data, 0)
+	recent := NewRecentActions(epoch)
+	recent.filePath = filePath
+	for _, actionEpoch := range files.buckets() {
+		if actionEpoch+MaxEpochDifference < epoch {
+			files.remove(actionEpoch)
+			continue
+		}
+		hashes, err := files.read(actionEpoch, crypto.Size)
+		if err != nil {
+			slog.Error("NewFileRecentActions: could not read bucket", "path", filePath, "epoch", actionEpoch, "err", err)
+			return nil
+		}
+		for position := 0; position < len(hashes); position += crypto.Size {
+			recent.Append(crypto.Hash(hashes[position:position+crypto.Size]), actionEpoch)
+		}
+	}
+	return recent
+}
+
+// NewFileRecentActionsFromBytes creates a record of recent actions from its
+// serialized form (typically received from a state sync job) persisted on the
+// given file. Existing bucket files are replaced.
+func NewFileRecentActionsFromBytes(filePath string, data []byte) *RecentActions {
+	recent := ParseRecentActions(data)
+	if recent == nil {
+		return nil
+	}
+	recent.filePath = filePath
+	files := bucketFiles{filePath: filePath}
+	if err := files.clear(); err != nil {
+		slog.Error("NewFileRecentActionsFromBytes: could not remove buckets", "path", filePath, "err", err)
+		return nil
+	}
+	for epoch, hashes := range recent.hashes {
+		if err := files.append(epoch, hashesBytes(hashes)); err != nil {
+			slog.Error("NewFileRecentActionsFromBytes: could not persist recent actions", "path", filePath, "err", err)
+			return nil
+		}
+	}
+	if err := recent.persistEpoch(); err != nil {
+		slog.Error("NewFileRecentActionsFromBytes: could not persist recent actions", "path", filePath, "err", err)
+		return nil
+	}
+	return recent
+}
+
+// persistEpoch writes the epoch of the record on its file.
+func (r *RecentActions) persistEpoch() error {
+	bytes := make([]byte, 0, 8)
+	util.PutUint64(r.Epoch, &bytes)
+	return persistFile(r.filePath, bytes)
+}
+
+// hashesBytes returns the concatenation of the hashes.
+func hashesBytes(hashes map[crypto.Hash]struct{}) []byte {
+	bytes := make([]byte, 0, len(hashes)*crypto.Size)
+	for hash := range hashes {
+		bytes = append(bytes, hash[:]...)
+	}
+	return bytes
+}
+
+// Exists returns true if the hash of an action with the given epoch has
+// already been incorporated.
+func (r *RecentActions) Exists(hash crypto.Hash, epoch uint64) bool {
+	if hashes, ok := r.hashes[epoch]; ok {
+		_, exists := hashes[hash]
+		return exists
+	}
+	return false
+}
+
+// Append records the hash of an action with the given epoch.
+func (r *RecentActions) Append(hash crypto.Hash, epoch uint64) {
+	if hashes, ok := r.hashes[epoch]; ok {
+		hashes[hash] = struct{}{}
+	} else {
+		r.hashes[epoch] = map[crypto.Hash]struct{}{hash: {}}
+	}
+}
+
+// MoveTo advances the record to the given epoch, purging the hashes of actions
+// that are no longer within MaxEpochDifference of the new epoch.
+func (r *RecentActions) MoveTo(epoch uint64) {
+	r.Epoch = epoch
+	for actionEpoch := range r.hashes {
+		if actionEpoch+MaxEpochDifference < epoch {
+			delete(r.hashes, actionEpoch)
+		}
+	}
+}
+
+// Incorporate appends the hashes recorded on the mutations and moves the record
+// to the mutations epoch. If the record is file based the new hashes are
+// appended to the bucket files of their epochs and buckets purged from the
+// record are deleted.
+func (r *RecentActions) Incorporate(m *Mutations) {
+	added := make(map[uint64]map[crypto.Hash]struct{})
+	for hash, epoch := range m.Actions {
+		if !r.Exists(hash, epoch) {
+			if _, ok := added[epoch]; !ok {
+				added[epoch] = make(map[crypto.Hash]struct{})
+			}
+			added[epoch][hash] = struct{}{}
+		}
+		r.Append(hash, epoch)
+	}
+	expired := make([]uint64, 0)
+	for epoch := range r.hashes {
+		if epoch+MaxEpochDifference < m.Epoch {
+			expired = append(expired, epoch)
+		}
+	}
+	r.MoveTo(m.Epoch)
+	if r.filePath == "" {
+		return
+	}
+	files := bucketFiles{filePath: r.filePath}
+	for epoch, hashes := range added {
+		if epoch+MaxEpochDifference < m.Epoch {
+			continue
+		}
+		if err := files.append(epoch, hashesBytes(hashes)); err != nil {
+			slog.Error("RecentActions: could not persist recent actions", "path", r.filePath, "epoch", epoch, "err", err)
+		}
+	}
+	for _, epoch := range expired {
+		if err := files.remove(epoch); err != nil {
+			slog.Error("RecentActions: could not remove expired bucket", "path", r.filePath, "epoch", epoch, "err", err)
+		}
+	}
+	if err := r.persistEpoch(); err != nil {
+		slog.Error("RecentActions: could not persist recent actions", "path", r.filePath, "err", err)
+	}
+}
+
+// Clone returns an in memory copy of the record.
+func (r *RecentActions) Clone() *RecentActions {
+	clone := NewRecentActions(r.Epoch)
+	for epoch, hashes := range r.hashes {
+		cloned := make(map[crypto.Hash]struct{}, len(hashes))
+		for hash := range hashes {
+			cloned[hash] = struct{}{}
+		}
+		clone.hashes[epoch] = cloned
+	}
+	return clone
+}
+
+// Len returns the number of hashes in the record.
+func (r *RecentActions) Len() int {
+	count := 0
+	for _, hashes := range r.hashes {
+		count += len(hashes)
+	}
+	return count
+}
+
+// Serialize returns a deterministic byte representation of the record with
+// epochs in ascending order and hashes in lexicographic order within each
+// epoch.
+func (r *RecentActions) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(r.Epoch, &bytes)
+	epochs := make([]uint64, 0, len(r.hashes))
+	for epoch, hashes := range r.hashes {
+		if len(hashes) > 0 {
+			epochs = append(epochs, epoch)
+		}
+	}
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	util.PutUint32(uint32(len(epochs)), &bytes)
+	for _, epoch := range epochs {
+		hashes := make([]crypto.Hash, 0, len(r.hashes[epoch]))
+		for hash := range r.hashes[epoch] {
+			hashes = append(hashes, hash)
+		}
+		sortHashes(hashes)
+		util.PutUint64(epoch, &bytes)
+		util.PutHashArray(hashes, &bytes)
+	}
+	return bytes
+}
+
+// Bytes is an alias for Serialize to conform with the wallet store interface
+// used on state sync jobs.
+func (r *RecentActions) Bytes() []byte {
+	return r.Serialize()
+}
+
+// Hash returns the hash of the serialized record.
+func (r *RecentActions) Hash() crypto.Hash {
+	return crypto.Hasher(r.Serialize())
+}
+
+// ParseRecentActions parses a serialized record of recent actions. Returns nil
+// if the data is not a valid serialization.
+func ParseRecentActions(data []byte) *RecentActions {
+	if len(data) < 12 {
+		return nil
+	}
+	position := 0
+	var epoch uint64
+	epoch, position = util.ParseUint64(data, position)
+	recent := NewRecentActions(epoch)
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	for n := 0; n < int(count); n++ {
+		if position+12 > len(data) {
+			return nil
+		}
+		var actionEpoch uint64
+		var hashes []crypto.Hash
+		actionEpoch, position = util.ParseUint64(data, position)
+		hashes, position = util.ParseHashArray(data, position)
+		if position > len(data) {
+			return nil
+		}
+		for _, hash := range hashes {
+			recent.Append(hash, actionEpoch)
+		}
+	}
+	if position != len(data) {
+		return nil
+	}
+	return recent
+}
+
+func sortHashes(hashes []crypto.Hash) {
+	sort.Slice(hashes, func(i, j int) bool {
+		for n := 0; n < crypto.Size; n++ {
+			if hashes[i][n] != hashes[j][n] {
+				return hashes[i][n] < hashes[j][n]
+			}
+		}
+		return false
+	})
+}
+
+// persistFile writes data into a temporary file and renames it to filePath so
+// that a crash never leaves a partially written file on disk.
+func persistFile(filePath string, data []byte) error {
+	temp := filePath + ".tmp"
+	if err := os.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, filePath)
+}
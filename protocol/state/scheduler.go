@@ -0,0 +1,279 @@
+package state
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/util"
+)
+
+// protocolKey returns the conflict key of actions reading or writing the rule
+// of the protocol code.
+func protocolKey(code uint32) crypto.Hash {
+	bytes := []byte("protocol")
+	util.PutUint32(code, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+// conflictKeys returns the keys of the state read or written by the action:
+// the hashes of the tokens of the action and of the accounts of its payments
+// and, for void actions and protocol registrations of a code in registered,
+// the key of the protocol code. Actions sharing no key can be validated in any
+// order with the same outcome.
+func conflictKeys(action actions.Action, registered map[uint32]struct{}) []crypto.Hash {
+	keys := make([]crypto.Hash, 0)
+	for _, token := range action.Tokens() {
+		keys = append(keys, crypto.HashToken(token))
+	}
+	payments := action.Payments()
+	for _, debit := range payments.Debit {
+		keys = append(keys, debit.Account)
+	}
+	for _, credit := range payments.Credit {
+		keys = append(keys, credit.Account)
+	}
+	switch v := action.(type) {
+	case *actions.Void:
+		if _, ok := registered[v.Protocol]; ok {
+			keys = append(keys, protocolKey(v.Protocol))
+		}
+	case *actions.RegisterProtocol:
+		keys = append(keys, protocolKey(v.Protocol))
+	}
+	return keys
+}
+
+// addKeys adds the keys of a hash indexed map to keys.
+func addKeys[T any](keys map[crypto.Hash]struct{}, m map[crypto.Hash]T) {
+	for hash := range m {
+		keys[hash] = struct{}{}
+	}
+}
+
+// touchedKeys returns the conflict keys written by the mutations.
+func (m *Mutations) touchedKeys() map[crypto.Hash]struct{} {
+	keys := make(map[crypto.Hash]struct{})
+	addKeys(keys, m.DeltaWallets)
+	addKeys(keys, m.DeltaDeposits)
+	addKeys(keys, m.Policies)
+	addKeys(keys, m.Locks)
+	addKeys(keys, m.SlashedUnbonding)
+	addKeys(keys, m.Nonces)
+	addKeys(keys, m.Delegations)
+	for _, deltas := range m.Delegations {
+		addKeys(keys, deltas)
+	}
+	for _, unbonding := range m.Unbonding {
+		keys[unbonding.Hash] = struct{}{}
+	}
+	for code := range m.Protocols {
+		keys[protocolKey(code)] = struct{}{}
+	}
+	return keys
+}
+
+// merge incorporates mutations written by a disjoint set of conflict keys into
+// the mutations. Withdrawals entering the unbonding queue are not merged.
+func (m *Mutations) merge(other *Mutations) {
+	for hash, delta := range other.DeltaWallets {
+		m.DeltaWallets[hash] += delta
+	}
+	for hash, delta := range other.DeltaDeposits {
+		m.DeltaDeposits[hash] += delta
+	}
+	for hash, epoch := range other.Actions {
+		m.Actions[hash] = epoch
+	}
+	for hash, policy := range other.Policies {
+		m.Policies[hash] = policy
+	}
+	for hash, locks := range other.Locks {
+		m.Locks[hash] = append(m.Locks[hash], locks...)
+	}
+	for hash, nonce := range other.Nonces {
+		m.Nonces[hash] = nonce
+	}
+	for validator, deltas := range other.Delegations {
+		for delegator, delta := range deltas {
+			m.DeltaDelegation(validator, delegator, delta)
+		}
+	}
+	for code, rule := range other.Protocols {
+		m.Protocols[code] = rule
+	}
+	m.Size += other.Size
+}
+
+// scheduledUnbonding is a withdrawal entering the unbonding queue by the
+// action at the given position of a scheduled batch.
+type scheduledUnbonding struct {
+	position  int
+	unbonding Unbonding
+}
+
+// ValidateParallel validates the actions (provided as byte arrays) with the
+// same outcome as calling Validate on each of them in the given order. Returns
+// the validity of each action. Actions are parsed across all available cores
+// and then validated in parallel by ValidateActions.
+func (c *MutatingState) ValidateParallel(data [][]byte) []bool {
+	parsed := make([]actions.Action, len(data))
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for n := w; n < len(data); n += workers {
+				parsed[n], _ = actions.ParseAction(data[n])
+			}
+		}(w)
+	}
+	wg.Wait()
+	return c.ValidateActions(data, parsed)
+}
+
+// ValidateActions validates actions already parsed from data (nil for actions
+// that could not be parsed) with the same outcome on validity and on the
+// resulting mutations as calling ValidateAction on each of them in the given
+// order. Actions are grouped by the conflict keys they share (see
+// conflictKeys) and independent groups are validated in parallel on copies of
+// the MutatingState with empty mutations. Groups touching keys already written
+// by the mutations of the MutatingState are validated on the MutatingState
+// itself. Mutations of the copies are merged back at the end, keeping the order
+// of withdrawals entering the unbonding queue. Returns the validity of each
+// action.
+func (c *MutatingState) ValidateActions(data [][]byte, parsed []actions.Action) []bool {
+	return c.validateActions(data, parsed, runtime.NumCPU())
+}
+
+// validateActions is ValidateActions spread over up to the given number of
+// workers.
+func (c *MutatingState) validateActions(data [][]byte, parsed []actions.Action, workers int) []bool {
+	valid := make([]bool, len(data))
+	registered := make(map[uint32]struct{})
+	for code := range c.mutations.Protocols {
+		registered[code] = struct{}{}
+	}
+	for _, action := range parsed {
+		if register, ok := action.(*actions.RegisterProtocol); ok {
+			registered[register.Protocol] = struct{}{}
+		}
+	}
+	// union find over actions, position len(data) stands for the keys already
+	// written by the mutations
+	anchor := len(data)
+	parent := make([]int, len(data)+1)
+	for n := range parent {
+		parent[n] = n
+	}
+	find := func(n int) int {
+		root := n
+		for parent[root] != root {
+			root = parent[root]
+		}
+		for parent[n] != root {
+			parent[n], n = root, parent[n]
+		}
+		return root
+	}
+	// the root of a group is its first action, or the anchor
+	union := func(a, b int) {
+		a, b = find(a), find(b)
+		if b == anchor || (a != anchor && b < a) {
+			a, b = b, a
+		}
+		if a != b {
+			parent[b] = a
+		}
+	}
+	owner := make(map[crypto.Hash]int)
+	for key := range c.mutations.touchedKeys() {
+		owner[key] = anchor
+	}
+	for n, action := range parsed {
+		if action == nil {
+			continue
+		}
+		if c.mutations.HasAction(crypto.Hasher(data[n])) {
+			union(n, anchor)
+		}
+		for _, key := range conflictKeys(action, registered) {
+			if first, ok := owner[key]; ok {
+				union(n, first)
+			} else {
+				owner[key] = n
+			}
+		}
+	}
+	// groups are assigned to the least loaded worker in order of their first
+	// action. Worker zero is the MutatingState itself.
+	if workers > len(data) {
+		workers = len(data)
+	}
+	if workers == 0 {
+		return valid
+	}
+	load := make([]int, workers)
+	assigned := make(map[int]int)
+	assigned[anchor] = 0
+	scheduled := make([][]int, workers)
+	for n, action := range parsed {
+		if action == nil {
+			continue
+		}
+		root := find(n)
+		worker, ok := assigned[root]
+		if !ok {
+			for w := range load {
+				if load[w] < load[worker] {
+					worker = w
+				}
+			}
+			assigned[root] = worker
+		}
+		load[worker]++
+		scheduled[worker] = append(scheduled[worker], n)
+	}
+	forks := make([]*MutatingState, workers)
+	forks[0] = c
+	for w := 1; w < workers; w++ {
+		forks[w] = &MutatingState{Epoch: c.Epoch, State: c.State, mutations: NewMutations(c.mutations.Epoch)}
+	}
+	existing := len(c.mutations.Unbonding)
+	unbonding := make([][]scheduledUnbonding, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			fork := forks[w]
+			for _, n := range scheduled[w] {
+				before := len(fork.mutations.Unbonding)
+				valid[n] = fork.ValidateAction(data[n], parsed[n])
+				for _, entry := range fork.mutations.Unbonding[before:] {
+					unbonding[w] = append(unbonding[w], scheduledUnbonding{position: n, unbonding: entry})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	queue := make([]scheduledUnbonding, 0)
+	for w, fork := range forks {
+		queue = append(queue, unbonding[w]...)
+		if w == 0 {
+			continue
+		}
+		c.mutations.merge(fork.mutations)
+		c.FeesCollected += fork.FeesCollected
+		c.FeesBurned += fork.FeesBurned
+	}
+	sort.SliceStable(queue, func(i, j int) bool { return queue[i].position < queue[j].position })
+	c.mutations.Unbonding = c.mutations.Unbonding[:existing]
+	for _, entry := range queue {
+		c.mutations.Unbonding = append(c.mutations.Unbonding, entry.unbonding)
+	}
+	return valid
+}
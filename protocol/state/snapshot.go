@@ -0,0 +1,89 @@
+package state
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/freehandle/breeze/util"
+)
+
+// Snapshot returns a byte representation of the entire state: the epoch, the
+// wallet and deposit stores and the serialization of every other component.
+// The state can be recreated from its snapshot by ParseSnapshot.
+func (s *State) Snapshot() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(s.Epoch, &bytes)
+	util.PutLargeByteArray(s.Wallets.Bytes(), &bytes)
+	util.PutLargeByteArray(s.Deposits.Bytes(), &bytes)
+	util.PutLargeByteArray(s.Unbonding.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Locks.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Recent.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Multisig.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Nonces.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Fees.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Delegations.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Issuance.Serialize(), &bytes)
+	util.PutLargeByteArray(s.Protocols.Serialize(), &bytes)
+	return bytes
+}
+
+// ParseSnapshot recreates a state from its snapshot. If filePath is empty the
+// state is kept in memory, otherwise its stores are persisted on files under
+// filePath with the same names as NewGenesisStateWithToken. Returns nil if the
+// data is not a valid snapshot.
+func ParseSnapshot(data []byte, filePath string) *State {
+	if len(data) < 8 {
+		return nil
+	}
+	components := make([][]byte, 11)
+	epoch, position := util.ParseUint64(data, 0)
+	for n := range components {
+		if position+4 > len(data) {
+			return nil
+		}
+		components[n], position = util.ParseLargeByteArray(data, position)
+		if position > len(data) {
+			return nil
+		}
+	}
+	if position != len(data) || len(components[0]) == 0 || len(components[1]) == 0 {
+		return nil
+	}
+	state := State{Epoch: epoch}
+	if filePath == "" {
+		state.Wallets = NewMemoryWalletStoreFromBytes("wallet", components[0])
+		state.Deposits = NewMemoryWalletStoreFromBytes("deposit", components[1])
+		state.Unbonding = ParseUnbondingQueue(components[2])
+		state.Locks = ParseLocks(components[3])
+		state.Recent = ParseRecentActions(components[4])
+		state.Multisig = ParseMultisigPolicies(components[5])
+		state.Nonces = ParseNonces(components[6])
+		state.Fees = ParseFeeMarket(components[7])
+		state.Delegations = ParseDelegations(components[8])
+		state.Issuance = ParseIssuance(components[9])
+		state.Protocols = ParseProtocols(components[10])
+	} else {
+		state.Wallets = NewFileWalletStoreFromBytes(fmt.Sprintf("%vwallet.dat", filePath), "wallet", components[0])
+		state.Deposits = NewFileWalletStoreFromBytes(fmt.Sprintf("%vdeposit.dat", filePath), "deposit", components[1])
+		state.Unbonding = NewFileUnbondingQueueFromBytes(fmt.Sprintf("%vunbonding.dat", filePath), components[2])
+		state.Locks = NewFileLocksFromBytes(fmt.Sprintf("%vlocks.dat", filePath), components[3])
+		state.Recent = NewFileRecentActionsFromBytes(fmt.Sprintf("%vrecent.dat", filePath), components[4])
+		state.Multisig = NewFileMultisigPoliciesFromBytes(fmt.Sprintf("%vmultisig.dat", filePath), components[5])
+		state.Nonces = NewFileNoncesFromBytes(fmt.Sprintf("%vnonces.dat", filePath), components[6])
+		state.Fees = NewFileFeeMarketFromBytes(fmt.Sprintf("%vfees.dat", filePath), components[7])
+		state.Delegations = NewFileDelegationsFromBytes(fmt.Sprintf("%vdelegations.dat", filePath), components[8])
+		state.Issuance = NewFileIssuanceFromBytes(fmt.Sprintf("%vissuance.dat", filePath), components[9])
+		state.Protocols = NewFileProtocolsFromBytes(fmt.Sprintf("%vprotocols.dat", filePath), components[10])
+	}
+	if state.Wallets == nil || state.Deposits == nil || state.Unbonding == nil || state.Locks == nil || state.Recent == nil || state.Multisig == nil || state.Nonces == nil || state.Fees == nil || state.Delegations == nil || state.Issuance == nil || state.Protocols == nil {
+		slog.Error("ParseSnapshot: invalid state component")
+		if state.Wallets != nil {
+			state.Wallets.Close()
+		}
+		if state.Deposits != nil {
+			state.Deposits.Close()
+		}
+		return nil
+	}
+	return &state
+}
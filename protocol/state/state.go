@@ -7,12 +7,26 @@ import (
 	"github.com/freehandle/breeze/crypto"
 )
 
-// State is the state of the blockchain. It contains the epoch, the wallets and
-// the deposits.
+// State is the state of the blockchain. It contains the epoch, the wallets,
+// the deposits, the withdrawals pending unbonding, the time locks of wallet
+// balances, the record of recently incorporated actions, the policies of
+// multisig wallets, the last nonce used by each wallet, the fee market, the
+// stake delegated to validators, the issuance of tokens and the registry of
+// protocol codes of void actions.
 type State struct {
-	Epoch    uint64
-	Wallets  *Wallet // Available tokens per hash of crypto key
-	Deposits *Wallet // Available stakes per hash of crypto key
+	Epoch       uint64
+	Wallets     *Wallet         // Available tokens per hash of crypto key
+	Deposits    *Wallet         // Available stakes per hash of crypto key
+	Unbonding   *UnbondingQueue // Withdrawals pending release into wallets
+	Locks       *Locks          // Locked portion of wallets per hash of crypto key
+	Recent      *RecentActions  // Hashes of actions within the epoch window
+	Multisig    *MultisigPolicies
+	Nonces      *Nonces      // Last nonce used per hash of crypto key
+	Fees        *FeeMarket   // Minimum and base fee per byte of actions
+	Delegations *Delegations // Stake delegated to validators per delegator
+	Issuance    *Issuance    // Issuance schedule and total supply of tokens
+	Protocols   *Protocols   // Rules of protocol codes of void actions
+	tree        *BalanceTree // Balance tree kept up to date with mutations
 }
 
 // NewMutations creates a new mutation object with the following epoch.
@@ -23,6 +37,7 @@ func (s *State) NewMutations() *Mutations {
 // Validator combines a state and a mutation into a mutating state for epoch.
 func (s *State) Validator(mutations *Mutations, epoch uint64) *MutatingState {
 	return &MutatingState{
+		Epoch:     epoch,
 		State:     s,
 		mutations: mutations,
 	}
@@ -45,53 +60,144 @@ func NewGenesisState() (*State, crypto.PrivateKey) {
 // NewGenesisStateWithToken creates a new genesis state minting fungible tokens
 // to a given address. Returns the state.
 func NewGenesisStateWithToken(token crypto.Token, filePath string) *State {
+	accounts := []Account{{Hash: crypto.HashToken(token), Wallet: GenesisMint, Deposit: GenesisMint}}
+	return NewGenesisStateWithAccounts(accounts, filePath)
+}
+
+// NewGenesisStateWithAccounts creates a new genesis state minting fungible
+// tokens to the wallets and deposits of the given accounts. The total supply of
+// the issuance is the sum of every balance. Returns nil if the supply overflows
+// or if any store could not be created.
+func NewGenesisStateWithAccounts(accounts []Account, filePath string) *State {
+	supply := uint64(0)
+	for _, account := range accounts {
+		for _, value := range []uint64{account.Wallet, account.Deposit} {
+			if supply+value < supply {
+				slog.Error("NewGenesisStateWithAccounts: genesis supply overflow")
+				return nil
+			}
+			supply += value
+		}
+	}
 	state := State{Epoch: 0}
 	if filePath == "" {
 		if wallet := NewMemoryWalletStore("wallet", 8); wallet != nil {
 			state.Wallets = wallet
 		} else {
-			slog.Error("NewGenesisStateWithToken: could not create memory wallet")
+			slog.Error("NewGenesisStateWithAccounts: could not create memory wallet")
 			return nil
 		}
 		if deposit := NewMemoryWalletStore("deposit", 8); deposit != nil {
 			state.Deposits = deposit
 		} else {
-			slog.Error("NewGenesisStateWithToken: could not create memory deposit")
+			slog.Error("NewGenesisStateWithAccounts: could not create memory deposit")
 			return nil
 		}
+		state.Unbonding = NewUnbondingQueue(0)
+		state.Locks = NewLocks()
+		state.Recent = NewRecentActions(0)
+		state.Multisig = NewMultisigPolicies()
+		state.Nonces = NewNonces()
+		state.Fees = NewFeeMarket(0, 0)
+		state.Delegations = NewDelegations()
+		state.Issuance = NewIssuance(IssuanceSchedule{}, supply)
+		state.Protocols = NewProtocols()
 	} else {
 		if wallet := NewFileWalletStore(fmt.Sprintf("%vwallet.dat", filePath), "wallet", 8); wallet != nil {
 			state.Wallets = wallet
 		} else {
-			slog.Error("NewGenesisStateWithToken: could not create file wallet")
+			slog.Error("NewGenesisStateWithAccounts: could not create file wallet")
 			return nil
 		}
 		if deposit := NewFileWalletStore(fmt.Sprintf("%vdeposit.dat", filePath), "deposit", 8); deposit != nil {
 			state.Deposits = deposit
 		} else {
-			slog.Error("NewGenesisStateWithToken: could not create file deposit")
+			slog.Error("NewGenesisStateWithAccounts: could not create file deposit")
+			return nil
+		}
+		if unbonding := NewFileUnbondingQueue(fmt.Sprintf("%vunbonding.dat", filePath), 0); unbonding != nil {
+			state.Unbonding = unbonding
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file unbonding queue")
+			return nil
+		}
+		if locks := NewFileLocks(fmt.Sprintf("%vlocks.dat", filePath)); locks != nil {
+			state.Locks = locks
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file locks")
+			return nil
+		}
+		if recent := NewFileRecentActions(fmt.Sprintf("%vrecent.dat", filePath), 0); recent != nil {
+			state.Recent = recent
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file recent actions")
+			return nil
+		}
+		if multisig := NewFileMultisigPolicies(fmt.Sprintf("%vmultisig.dat", filePath)); multisig != nil {
+			state.Multisig = multisig
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file multisig policies")
+			return nil
+		}
+		if nonces := NewFileNonces(fmt.Sprintf("%vnonces.dat", filePath)); nonces != nil {
+			state.Nonces = nonces
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file nonces")
+			return nil
+		}
+		if fees := NewFileFeeMarket(fmt.Sprintf("%vfees.dat", filePath), 0, 0); fees != nil {
+			state.Fees = fees
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file fee market")
+			return nil
+		}
+		if delegations := NewFileDelegations(fmt.Sprintf("%vdelegations.dat", filePath)); delegations != nil {
+			state.Delegations = delegations
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file delegations")
+			return nil
+		}
+		if issuance := NewFileIssuance(fmt.Sprintf("%vissuance.dat", filePath), IssuanceSchedule{}, supply); issuance != nil {
+			state.Issuance = issuance
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file issuance")
+			return nil
+		}
+		if protocols := NewFileProtocols(fmt.Sprintf("%vprotocols.dat", filePath)); protocols != nil {
+			state.Protocols = protocols
+		} else {
+			slog.Error("NewGenesisStateWithAccounts: could not create file protocols")
 			return nil
 		}
 	}
-	if !state.Wallets.Credit(token, 1e9) {
-		slog.Error("NewGenesisStateWithToken: could not credit wallet")
-		return nil
-	}
-	if !state.Deposits.Credit(token, 1e9) {
-		slog.Error("NewGenesisStateWithToken: could not credit deposit")
-		return nil
+	for _, account := range accounts {
+		if account.Wallet > 0 && !state.Wallets.CreditHash(account.Hash, account.Wallet) {
+			slog.Error("NewGenesisStateWithAccounts: could not credit wallet")
+			return nil
+		}
+		if account.Deposit > 0 && !state.Deposits.CreditHash(account.Hash, account.Deposit) {
+			slog.Error("NewGenesisStateWithAccounts: could not credit deposit")
+			return nil
+		}
 	}
 	return &state
 }
 
-// IncorporateMutations applies the mutations to the state.
+// IncorporateMutations applies the mutations to the state. Withdrawals maturing
+// up to the mutations epoch are released from the unbonding queue into wallets.
+// The hashes of incorporated actions are appended to the record of recent
+// actions and those older than MaxEpochDifference with respect to the mutations
+// epoch are purged. The base fee is adjusted to the size of the incorporated
+// actions, so mutations are expected to be incorporated one block at a time.
 func (s *State) IncorporateMutations(m *Mutations) {
+	touched := make(map[crypto.Hash]struct{})
 	for hash, delta := range m.DeltaWallets {
 		if delta > 0 {
 			s.Wallets.CreditHash(hash, uint64(delta))
 		} else if delta < 0 {
 			s.Wallets.DebitHash(hash, uint64(-delta))
 		}
+		touched[hash] = struct{}{}
 	}
 	for hash, delta := range m.DeltaDeposits {
 		if delta > 0 {
@@ -99,18 +205,42 @@ func (s *State) IncorporateMutations(m *Mutations) {
 		} else if delta < 0 {
 			s.Deposits.DebitHash(hash, uint64(-delta))
 		}
+		touched[hash] = struct{}{}
+	}
+	for _, matured := range s.Unbonding.Incorporate(m) {
+		s.Wallets.CreditHash(matured.Hash, matured.Value)
+		touched[matured.Hash] = struct{}{}
 	}
+	s.updateBalanceTree(touched)
+	s.Locks.Incorporate(m)
+	s.Recent.Incorporate(m)
+	s.Multisig.Incorporate(m)
+	s.Nonces.Incorporate(m)
+	s.Fees.Incorporate(m)
+	s.Delegations.Incorporate(m)
+	s.Issuance.Incorporate(m)
+	s.Protocols.Incorporate(m)
 }
 
 // Clone creates a copy of the state by cloning the underlying papirus hashtable
-// stores.
+// stores. The cloned stores are ready for queries (see clonedWallet).
 func (s *State) Clone() *State {
-	wallets := &Wallet{HS: s.Wallets.HS.Clone()}
-	deposits := &Wallet{HS: s.Deposits.HS.Clone()}
+	wallets := clonedWallet(s.Wallets.HS.Clone())
+	deposits := clonedWallet(s.Deposits.HS.Clone())
 	return &State{
-		Epoch:    s.Epoch,
-		Wallets:  wallets,
-		Deposits: deposits,
+		Epoch:       s.Epoch,
+		Wallets:     wallets,
+		Deposits:    deposits,
+		Unbonding:   s.Unbonding.Clone(),
+		Locks:       s.Locks.Clone(),
+		Recent:      s.Recent.Clone(),
+		Multisig:    s.Multisig.Clone(),
+		Nonces:      s.Nonces.Clone(),
+		Fees:        s.Fees.Clone(),
+		Delegations: s.Delegations.Clone(),
+		Issuance:    s.Issuance.Clone(),
+		Protocols:   s.Protocols.Clone(),
+		tree:        s.tree,
 	}
 }
 
@@ -119,9 +249,19 @@ func (s *State) Clone() *State {
 func (s *State) CloneAsync() chan *State {
 	output := make(chan *State)
 	wallets := s.Wallets.HS.CloneAsync()
-	deposits := s.Wallets.HS.CloneAsync()
+	deposits := s.Deposits.HS.CloneAsync()
 	newState := &State{
-		Epoch: s.Epoch,
+		Epoch:       s.Epoch,
+		Unbonding:   s.Unbonding.Clone(),
+		Locks:       s.Locks.Clone(),
+		Recent:      s.Recent.Clone(),
+		Multisig:    s.Multisig.Clone(),
+		Nonces:      s.Nonces.Clone(),
+		Fees:        s.Fees.Clone(),
+		Delegations: s.Delegations.Clone(),
+		Issuance:    s.Issuance.Clone(),
+		Protocols:   s.Protocols.Clone(),
+		tree:        s.tree,
 	}
 	go func() {
 		count := 0
@@ -129,10 +269,10 @@ func (s *State) CloneAsync() chan *State {
 			select {
 			case wallet := <-wallets:
 				count += 1
-				newState.Wallets = &Wallet{HS: wallet}
+				newState.Wallets = clonedWallet(wallet)
 			case deposit := <-deposits:
 				count += 1
-				newState.Deposits = &Wallet{HS: deposit}
+				newState.Deposits = clonedWallet(deposit)
 			}
 			if count == 2 {
 				output <- newState
@@ -143,9 +283,99 @@ func (s *State) CloneAsync() chan *State {
 	return output
 }
 
-// ChecksumHash returns the hash of the checksum of the state.
+// ChecksumHash returns the hash of the checksum of the state. It covers the
+// root of the balance tree over wallets and deposits and the hash of the
+// remaining components of the state (see ComponentsHash).
 func (s *State) ChecksumHash() crypto.Hash {
-	walletHash := s.Wallets.HS.Hash(crypto.Hasher)
-	depositHash := s.Deposits.HS.Hash(crypto.Hasher)
-	return crypto.Hasher(append(walletHash[:], depositHash[:]...))
+	return CommitmentHash(s.BalanceTree().Root(), s.ComponentsHash())
+}
+
+// CommitmentHash combines the root of the balance tree and the hash of the
+// remaining components into the checksum hash of a state.
+func CommitmentHash(root, components crypto.Hash) crypto.Hash {
+	return crypto.Hasher(append(root[:], components[:]...))
+}
+
+// ComponentsHash returns the hash of the components of the state other than
+// the wallet and deposit balances: the unbonding queue, the time locks, the
+// record of recent actions, the multisig policies, the nonces, the fee market,
+// the delegations, the issuance and the registry of protocols.
+func (s *State) ComponentsHash() crypto.Hash {
+	unbondingHash := s.Unbonding.Hash()
+	locksHash := s.Locks.Hash()
+	recentHash := s.Recent.Hash()
+	multisigHash := s.Multisig.Hash()
+	noncesHash := s.Nonces.Hash()
+	feesHash := s.Fees.Hash()
+	delegationsHash := s.Delegations.Hash()
+	issuanceHash := s.Issuance.Hash()
+	protocolsHash := s.Protocols.Hash()
+	data := append(unbondingHash[:], locksHash[:]...)
+	data = append(data, recentHash[:]...)
+	data = append(data, multisigHash[:]...)
+	data = append(data, noncesHash[:]...)
+	data = append(data, feesHash[:]...)
+	data = append(data, delegationsHash[:]...)
+	data = append(data, issuanceHash[:]...)
+	return crypto.Hasher(append(data, protocolsHash[:]...))
+}
+
+// Circulating returns the sum of wallets, deposits, delegated stake and
+// withdrawals pending on the unbonding queue.
+func (s *State) Circulating() uint64 {
+	total := s.Unbonding.Total() + s.Delegations.Total()
+	for _, account := range s.Accounts() {
+		total += account.Wallet + account.Deposit
+	}
+	return total
+}
+
+// Audit returns true if the total supply tracked by the issuance matches the
+// tokens circulating on the state.
+func (s *State) Audit() bool {
+	return s.Circulating() == s.Issuance.Supply
+}
+
+// Accounts returns the wallet and deposit balance of every account with
+// non-zero balance on the state.
+func (s *State) Accounts() []Account {
+	wallets := s.Wallets.Accounts()
+	deposits := s.Deposits.Accounts()
+	accounts := make([]Account, 0, len(wallets)+len(deposits))
+	for hash, wallet := range wallets {
+		accounts = append(accounts, Account{Hash: hash, Wallet: wallet, Deposit: deposits[hash]})
+	}
+	for hash, deposit := range deposits {
+		if _, ok := wallets[hash]; !ok {
+			accounts = append(accounts, Account{Hash: hash, Deposit: deposit})
+		}
+	}
+	return accounts
+}
+
+// BalanceTree returns the Merkle commitment over the wallet and deposit
+// balances of the state. The tree is built on first use and then updated with
+// the balances touched by incorporated mutations. Returned trees are never
+// changed by later updates.
+func (s *State) BalanceTree() *BalanceTree {
+	if s.tree == nil {
+		s.tree = NewBalanceTree(s.Accounts())
+	}
+	return s.tree
+}
+
+// updateBalanceTree replaces on the balance tree, if already built, the
+// balances of the accounts with the given hashes by their current balances.
+func (s *State) updateBalanceTree(hashes map[crypto.Hash]struct{}) {
+	if s.tree == nil || len(hashes) == 0 {
+		return
+	}
+	accounts := make([]Account, 0, len(hashes))
+	for hash := range hashes {
+		account := Account{Hash: hash}
+		_, account.Wallet = s.Wallets.BalanceHash(hash)
+		_, account.Deposit = s.Deposits.BalanceHash(hash)
+		accounts = append(accounts, account)
+	}
+	s.tree = s.tree.Update(accounts)
 }
@@ -1,9 +1,16 @@
 package state
 
 import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/util"
 )
 
 func TestWalletClone(t *testing.T) {
@@ -29,3 +36,1104 @@ func TestWalletClone(t *testing.T) {
 		}
 	}
 }
+
+func signedTransfer(epoch uint64, from crypto.PrivateKey, value uint64) []byte {
+	to, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{
+		TimeStamp: epoch,
+		From:      from.PublicKey(),
+		To:        []crypto.TokenValue{{Token: to, Value: value}},
+		Fee:       1,
+	}
+	transfer.Sign(from)
+	return transfer.Serialize()
+}
+
+func TestValidateEpochWindow(t *testing.T) {
+	genesis, key := NewGenesisState()
+	epoch := uint64(2 * MaxEpochDifference)
+	validator := genesis.Validator(NewMutations(epoch), epoch)
+	if validator.Validate(signedTransfer(epoch+1, key, 10)) {
+		t.Error("accepted action from a future epoch")
+	}
+	if validator.Validate(signedTransfer(epoch-MaxEpochDifference-1, key, 10)) {
+		t.Error("accepted action older than MaxEpochDifference")
+	}
+	if !validator.Validate(signedTransfer(epoch-MaxEpochDifference, key, 10)) {
+		t.Error("rejected action at the edge of the epoch window")
+	}
+	if !validator.Validate(signedTransfer(epoch, key, 10)) {
+		t.Error("rejected action from current epoch")
+	}
+}
+
+func TestValidateReplay(t *testing.T) {
+	genesis, key := NewGenesisState()
+	action := signedTransfer(1, key, 10)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(action) {
+		t.Fatal("rejected valid action")
+	}
+	if validator.Validate(action) {
+		t.Error("accepted duplicate action within the same mutations")
+	}
+	validator.Incorporate(key.PublicKey())
+	for epoch := uint64(2); epoch <= 1+MaxEpochDifference; epoch++ {
+		validator = genesis.Validator(NewMutations(epoch), epoch)
+		if validator.Validate(action) {
+			t.Fatalf("accepted replayed action at epoch %v", epoch)
+		}
+		if epoch == 2 {
+			validator.Incorporate(key.PublicKey())
+		}
+	}
+	checksum := genesis.ChecksumHash()
+	genesis.Recent.Append(crypto.Hasher([]byte("another action")), 1)
+	if checksum.Equal(genesis.ChecksumHash()) {
+		t.Error("checksum should cover recent actions")
+	}
+	clone := ParseRecentActions(genesis.Recent.Serialize())
+	if clone == nil || !clone.Hash().Equal(genesis.Recent.Hash()) {
+		t.Error("recent actions serialization does not round trip")
+	}
+	genesis.Recent.MoveTo(2 + MaxEpochDifference)
+	if genesis.Recent.Len() != 0 {
+		t.Error("recent actions outside epoch window were not purged")
+	}
+}
+
+func TestBucketFilesPersistence(t *testing.T) {
+	dir := t.TempDir()
+	recentPath := filepath.Join(dir, "recent.dat")
+	feesPath := filepath.Join(dir, "fees.dat")
+	recent := NewFileRecentActions(recentPath, 0)
+	fees := NewFileFeeMarket(feesPath, 2, 1000)
+	for epoch := uint64(1); epoch <= 2*MaxEpochDifference; epoch++ {
+		mutations := NewMutations(epoch)
+		mutations.Actions[crypto.Hasher(util.Uint64ToBytes(epoch))] = epoch
+		mutations.Size = 2000
+		recent.Incorporate(mutations)
+		fees.Incorporate(mutations)
+	}
+	mutations := NewMutations(feeBucketEpochs)
+	mutations.Actions[crypto.Hasher([]byte("action"))] = feeBucketEpochs
+	recent.Incorporate(mutations)
+	fees.Incorporate(mutations)
+
+	reopened := NewFileRecentActions(recentPath, 0)
+	if reopened == nil || !reopened.Hash().Equal(recent.Hash()) {
+		t.Fatal("file recent actions do not survive reopening")
+	}
+	if buckets := (bucketFiles{filePath: recentPath}).buckets(); len(buckets) != 1 || buckets[0] != feeBucketEpochs {
+		t.Errorf("expired recent action buckets not deleted: %v", buckets)
+	}
+	if reopened := NewFileFeeMarket(feesPath, 0, 0); reopened == nil || !reopened.Hash().Equal(fees.Hash()) {
+		t.Fatal("file fee market does not survive reopening")
+	}
+	if buckets := (bucketFiles{filePath: feesPath}).buckets(); len(buckets) != 1 || buckets[0] != 1 {
+		t.Errorf("old fee market buckets not deleted: %v", buckets)
+	}
+	restored := NewFileRecentActionsFromBytes(recentPath, ParseRecentActions(recent.Serialize()).Serialize())
+	if restored == nil || !NewFileRecentActions(recentPath, 0).Hash().Equal(recent.Hash()) {
+		t.Error("file recent actions from bytes do not survive reopening")
+	}
+}
+
+func TestDeltaFilesPersistence(t *testing.T) {
+	dir := t.TempDir()
+	noncesPath := filepath.Join(dir, "nonces.dat")
+	nonces := NewFileNonces(noncesPath)
+	for epoch := uint64(1); epoch <= 3000; epoch++ {
+		mutations := NewMutations(epoch)
+		mutations.Nonces[crypto.Hasher(util.Uint64ToBytes(epoch))] = epoch
+		mutations.Nonces[crypto.Hasher([]byte("wallet"))] = epoch
+		nonces.Incorporate(mutations)
+	}
+	if base, _ := os.ReadFile(noncesPath); len(base) == 0 {
+		t.Error("nonces log not compacted")
+	}
+	if reopened := NewFileNonces(noncesPath); reopened == nil || !reopened.Hash().Equal(nonces.Hash()) {
+		t.Fatal("file nonces do not survive reopening")
+	}
+
+	// a record partially written before a crash is ignored and later records
+	// are appended after the last complete one
+	file, err := os.OpenFile(noncesPath+".log", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0, 0, 1, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	reopened := NewFileNonces(noncesPath)
+	if reopened == nil || !reopened.Hash().Equal(nonces.Hash()) {
+		t.Fatal("file nonces with partial record do not survive reopening")
+	}
+	mutations := NewMutations(3001)
+	mutations.Nonces[crypto.Hasher([]byte("wallet"))] = 3001
+	reopened.Incorporate(mutations)
+	if appended := NewFileNonces(noncesPath); appended == nil || !appended.Hash().Equal(reopened.Hash()) {
+		t.Fatal("nonces appended after partial record do not survive reopening")
+	}
+
+	restored := NewFileNoncesFromBytes(noncesPath, NewNonces().Serialize())
+	if restored == nil || !NewFileNonces(noncesPath).Hash().Equal(NewNonces().Hash()) {
+		t.Error("file nonces from bytes do not replace the deltas")
+	}
+
+	// locks are released and purged from the file as epochs advance
+	locksPath := filepath.Join(dir, "locks.dat")
+	locks := NewFileLocks(locksPath)
+	for epoch := uint64(1); epoch <= 3000; epoch++ {
+		mutations := NewMutations(epoch)
+		hash := crypto.Hasher(util.Uint64ToBytes(epoch % 50))
+		mutations.Locks[hash] = []TimeLock{{Value: epoch, Unlock: epoch + 5, Vesting: epoch % 3}}
+		locks.Incorporate(mutations)
+	}
+	if reopened := NewFileLocks(locksPath); reopened == nil || !reopened.Hash().Equal(locks.Hash()) {
+		t.Fatal("file locks do not survive reopening")
+	}
+	mutations = NewMutations(5000)
+	locks.Incorporate(mutations)
+	if reopened := NewFileLocks(locksPath); reopened == nil || !reopened.Hash().Equal(NewLocks().Hash()) {
+		t.Error("released locks not purged from file")
+	}
+
+	// delegations withdrawn in full are removed from the file
+	delegationsPath := filepath.Join(dir, "delegations.dat")
+	delegations := NewFileDelegations(delegationsPath)
+	for epoch := uint64(1); epoch <= 3000; epoch++ {
+		mutations := NewMutations(epoch)
+		validator := crypto.Hasher(util.Uint64ToBytes(epoch % 7))
+		delegator := crypto.Hasher(util.Uint64ToBytes(epoch % 11))
+		delta := int(epoch)
+		if current := delegations.Get(validator, delegator); epoch%4 == 0 {
+			delta = -int(current)
+		}
+		mutations.Delegations[validator] = map[crypto.Hash]int{delegator: delta}
+		delegations.Incorporate(mutations)
+	}
+	if reopened := NewFileDelegations(delegationsPath); reopened == nil || !reopened.Hash().Equal(delegations.Hash()) {
+		t.Fatal("file delegations do not survive reopening")
+	}
+
+	// rules registered again replace the previous ones
+	protocolsPath := filepath.Join(dir, "protocols.dat")
+	protocols := NewFileProtocols(protocolsPath)
+	owner, _ := crypto.RandomAsymetricKey()
+	for epoch := uint64(1); epoch <= 3000; epoch++ {
+		mutations := NewMutations(epoch)
+		mutations.Protocols[uint32(epoch%100)] = &ProtocolRule{Owner: owner, MaxDataSize: uint32(epoch), MinFee: epoch}
+		protocols.Incorporate(mutations)
+	}
+	if reopened := NewFileProtocols(protocolsPath); reopened == nil || !reopened.Hash().Equal(protocols.Hash()) {
+		t.Fatal("file protocols do not survive reopening")
+	}
+
+	multisigPath := filepath.Join(dir, "multisig.dat")
+	multisig := NewFileMultisigPolicies(multisigPath)
+	for epoch := uint64(1); epoch <= 1000; epoch++ {
+		mutations := NewMutations(epoch)
+		mutations.Policies[crypto.Hasher(util.Uint64ToBytes(epoch))] = &Policy{Threshold: byte(epoch%2 + 1), Signers: []crypto.Token{owner, owner}}
+		multisig.Incorporate(mutations)
+	}
+	if reopened := NewFileMultisigPolicies(multisigPath); reopened == nil || !reopened.Hash().Equal(multisig.Hash()) {
+		t.Fatal("file multisig policies do not survive reopening")
+	}
+}
+
+func TestMultisigWallet(t *testing.T) {
+	genesis, owner := NewGenesisState()
+	keys := make([]crypto.PrivateKey, 3)
+	signers := make([]crypto.Token, 3)
+	for n := range keys {
+		signers[n], keys[n] = crypto.RandomAsymetricKey()
+	}
+	policy := actions.MultisigPolicy{
+		TimeStamp: 1,
+		Owner:     owner.PublicKey(),
+		Threshold: 2,
+		Signers:   signers,
+		Fee:       1,
+	}
+	policy.Sign(owner)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(policy.Serialize()) {
+		t.Fatal("rejected valid multisig policy")
+	}
+	if validator.Validate(signedTransfer(1, owner, 10)) {
+		t.Error("accepted single signature transfer from multisig wallet")
+	}
+	validator.Incorporate(owner.PublicKey())
+	if genesis.Multisig.Get(crypto.HashToken(owner.PublicKey())) == nil {
+		t.Fatal("policy not incorporated into state")
+	}
+
+	to, _ := crypto.RandomAsymetricKey()
+	transfer := actions.MultisigTransfer{
+		TimeStamp: 2,
+		From:      owner.PublicKey(),
+		To:        []crypto.TokenValue{{Token: to, Value: 10}},
+		Fee:       1,
+	}
+	transfer.Cosign(keys[0])
+	validator = genesis.Validator(NewMutations(2), 2)
+	if validator.Validate(transfer.Serialize()) {
+		t.Error("accepted multisig transfer below threshold")
+	}
+	_, intruder := crypto.RandomAsymetricKey()
+	transfer.Cosign(intruder)
+	if validator.Validate(transfer.Serialize()) {
+		t.Error("accepted multisig transfer cosigned by a non signer")
+	}
+	transfer.Cosignatures = transfer.Cosignatures[:1]
+	transfer.Cosign(keys[2])
+	if !validator.Validate(transfer.Serialize()) {
+		t.Error("rejected multisig transfer at threshold")
+	}
+	if _, err := actions.ParseAction(transfer.Serialize()); err != nil {
+		t.Error("could not parse multisig transfer")
+	}
+	data := transfer.Serialize()
+	data[len(data)-1] ^= 1
+	if _, err := actions.ParseMultisigTransfer(data); !errors.Is(err, util.ErrBadSignature) {
+		t.Error("accepted multisig transfer with invalid cosignature")
+	}
+	oversized := transfer
+	oversized.Cosignatures = nil
+	oversized.To = make([]crypto.TokenValue, actions.MaxMultisigRecipients+1)
+	if err := oversized.Cosign(keys[0]); !errors.Is(err, actions.ErrTooManyRecipients) || len(oversized.Cosignatures) != 0 {
+		t.Error("cosigned multisig transfer with too many recipients")
+	}
+	clone := ParseMultisigPolicies(genesis.Multisig.Serialize())
+	if clone == nil || !clone.Hash().Equal(genesis.Multisig.Hash()) {
+		t.Error("multisig policies serialization does not round trip")
+	}
+}
+
+func TestTimeLock(t *testing.T) {
+	lock := TimeLock{Value: 1000, Unlock: 10, Vesting: 100}
+	if lock.Locked(5) != 1000 || lock.Locked(10) != 1000 || lock.Locked(60) != 500 || lock.Locked(110) != 0 {
+		t.Errorf("unexpected vesting schedule: %v %v %v %v", lock.Locked(5), lock.Locked(10), lock.Locked(60), lock.Locked(110))
+	}
+	cliff := TimeLock{Value: 1000, Unlock: 10}
+	if cliff.Locked(9) != 1000 || cliff.Locked(10) != 0 {
+		t.Error("unexpected cliff schedule")
+	}
+
+	genesis, key := NewGenesisState()
+	beneficiary, beneficiaryKey := crypto.RandomAsymetricKey()
+	action := actions.Lock{
+		TimeStamp: 1,
+		From:      key.PublicKey(),
+		To:        beneficiary,
+		Value:     1000,
+		Unlock:    10,
+		Vesting:   100,
+		Fee:       1,
+	}
+	action.Sign(key)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(action.Serialize()) {
+		t.Fatal("rejected valid lock")
+	}
+	if validator.Validate(signedTransfer(1, beneficiaryKey, 1)) {
+		t.Error("spent locked balance within the same mutations")
+	}
+	validator.Incorporate(key.PublicKey())
+
+	validator = genesis.Validator(NewMutations(60), 60)
+	if validator.Validate(signedTransfer(60, beneficiaryKey, 500)) {
+		t.Error("spent more than vested balance")
+	}
+	if !validator.Validate(signedTransfer(60, beneficiaryKey, 499)) {
+		t.Error("could not spend vested balance")
+	}
+	validator.Incorporate(key.PublicKey())
+
+	checksum := genesis.ChecksumHash()
+	clone := ParseLocks(genesis.Locks.Serialize())
+	if clone == nil || !clone.Hash().Equal(genesis.Locks.Hash()) {
+		t.Error("locks serialization does not round trip")
+	}
+	genesis.Locks.Incorporate(NewMutations(110))
+	if genesis.Locks.Locked(crypto.HashToken(beneficiary), 110) != 0 || checksum.Equal(genesis.ChecksumHash()) {
+		t.Error("released locks were not purged")
+	}
+}
+
+func TestWithdrawUnbonding(t *testing.T) {
+	genesis, key := NewGenesisState()
+	genesis.Unbonding.Period = 10
+	hash := crypto.HashToken(key.PublicKey())
+	_, wallet := genesis.Wallets.BalanceHash(hash)
+	_, deposit := genesis.Deposits.BalanceHash(hash)
+
+	withdraw := actions.Withdraw{TimeStamp: 1, Token: key.PublicKey(), Value: 1000, Fee: 1}
+	withdraw.Sign(key)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(withdraw.Serialize()) {
+		t.Fatal("rejected valid withdraw")
+	}
+	validator.Incorporate(key.PublicKey())
+	if _, balance := genesis.Deposits.BalanceHash(hash); balance != deposit-1000 {
+		t.Errorf("deposit not debited: %v", balance)
+	}
+	if genesis.Unbonding.Pending(hash, 1) != 1000 {
+		t.Error("withdraw not in unbonding queue")
+	}
+
+	validator = genesis.Validator(NewMutations(5), 5)
+	if burned := validator.Burn(hash, deposit); burned != deposit {
+		t.Errorf("expected %v burned, got %v", deposit, burned)
+	}
+	validator.Incorporate(key.PublicKey())
+	if pending := genesis.Unbonding.Pending(hash, 5); pending != 1000-(deposit-(deposit-1000)) {
+		t.Errorf("pending withdraw was not slashed: %v", pending)
+	}
+
+	checkpoint := genesis.Clone()
+	validator = genesis.Validator(NewMutations(11), 11)
+	validator.Incorporate(key.PublicKey())
+	// the withdraw fee was collected back by the same wallet as validator
+	if _, balance := genesis.Wallets.BalanceHash(hash); balance != wallet {
+		t.Errorf("unexpected wallet after maturity: %v", balance)
+	}
+	if checkpoint.Validator(NewMutations(11), 11).Balance(hash) != wallet {
+		t.Error("matured withdraw not accounted on older state")
+	}
+	if !ParseUnbondingQueue(checkpoint.Unbonding.Serialize()).Hash().Equal(checkpoint.Unbonding.Hash()) {
+		t.Error("unbonding queue serialization does not round trip")
+	}
+}
+
+func TestTransferNonce(t *testing.T) {
+	genesis, key := NewGenesisState()
+	to, _ := crypto.RandomAsymetricKey()
+	transfer := func(nonce, fee uint64) []byte {
+		action := actions.Transfer{
+			TimeStamp: 1,
+			Nonce:     nonce,
+			From:      key.PublicKey(),
+			To:        []crypto.TokenValue{{Token: to, Value: 10}},
+			Fee:       fee,
+		}
+		action.Sign(key)
+		return action.Serialize()
+	}
+	parsed, err := actions.ParseTransfer(transfer(7, 1))
+	if err != nil || parsed.Nonce != 7 {
+		t.Fatal("could not parse transfer with nonce")
+	}
+	validator := genesis.Validator(NewMutations(1), 1)
+	if validator.Validate(transfer(2, 1)) {
+		t.Error("accepted nonce out of sequence")
+	}
+	if !validator.Validate(transfer(1, 1)) {
+		t.Fatal("rejected first nonce")
+	}
+	if validator.Validate(transfer(1, 2)) {
+		t.Error("accepted nonce already used on mutations")
+	}
+	if !validator.Validate(transfer(0, 1)) {
+		t.Error("rejected transfer without nonce")
+	}
+	validator.Incorporate(key.PublicKey())
+	if genesis.Nonces.Get(crypto.HashToken(key.PublicKey())) != 1 {
+		t.Fatal("nonce not incorporated into state")
+	}
+	validator = genesis.Validator(NewMutations(2), 2)
+	if validator.Validate(transfer(1, 3)) {
+		t.Error("accepted nonce already used on state")
+	}
+	if !validator.Validate(transfer(2, 1)) {
+		t.Error("rejected next nonce")
+	}
+	cloned := ParseNonces(genesis.Nonces.Serialize())
+	if cloned == nil || !cloned.Hash().Equal(genesis.Nonces.Hash()) {
+		t.Error("nonces serialization round trip failed")
+	}
+}
+
+func TestFeeMarket(t *testing.T) {
+	genesis, key := NewGenesisState()
+	genesis.Fees = NewFeeMarket(2, 1000)
+	proposer, _ := crypto.RandomAsymetricKey()
+	action := signedTransfer(1, key, 10)
+	size := len(action)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if validator.Validate(action) {
+		t.Fatal("accepted action below the minimum fee")
+	}
+	to, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{TimeStamp: 1, From: key.PublicKey(), To: []crypto.TokenValue{{Token: to, Value: 10}}, Fee: uint64(2*size + 5)}
+	transfer.Sign(key)
+	if !validator.Validate(transfer.Serialize()) {
+		t.Fatal("rejected action paying the minimum fee")
+	}
+	if validator.FeesBurned != uint64(2*size) || validator.FeesCollected != 5 {
+		t.Fatalf("unexpected fees: burned %v collected %v", validator.FeesBurned, validator.FeesCollected)
+	}
+	validator.Incorporate(proposer)
+	if _, balance := genesis.Wallets.Balance(proposer); balance != 5 {
+		t.Errorf("proposer collected %v instead of 5", balance)
+	}
+	// empty blocks lower the base fee down to the minimum
+	if genesis.Fees.BaseFeePerByte != 2 {
+		t.Errorf("base fee below minimum: %v", genesis.Fees.BaseFeePerByte)
+	}
+	genesis.Fees.Adjust(2000)
+	if genesis.Fees.BaseFeePerByte != 3 {
+		t.Errorf("base fee did not rise on full block: %v", genesis.Fees.BaseFeePerByte)
+	}
+	for n := 0; n < 20; n++ {
+		genesis.Fees.Adjust(2000)
+	}
+	high := genesis.Fees.BaseFeePerByte
+	genesis.Fees.Adjust(0)
+	if genesis.Fees.BaseFeePerByte >= high || genesis.Fees.BaseFeePerByte < high-high/BaseFeeChangeDenominator {
+		t.Errorf("unexpected base fee fall from %v to %v", high, genesis.Fees.BaseFeePerByte)
+	}
+	if !ParseFeeMarket(genesis.Fees.Serialize()).Hash().Equal(genesis.Fees.Hash()) {
+		t.Error("fee market serialization does not round trip")
+	}
+	// base fee times block size beyond uint64 range
+	large := &FeeMarket{MinFeePerByte: 1, BaseFeePerByte: 1 << 60, TargetBlockSize: 1 << 20}
+	large.Adjust(1 << 21)
+	if large.BaseFeePerByte != (1<<60)+(1<<60)/BaseFeeChangeDenominator {
+		t.Errorf("base fee overflow on full block: %v", large.BaseFeePerByte)
+	}
+	large.Adjust(0)
+	if large.BaseFeePerByte >= (1<<60)+(1<<60)/BaseFeeChangeDenominator {
+		t.Errorf("base fee overflow on empty block: %v", large.BaseFeePerByte)
+	}
+}
+
+func TestBalanceTree(t *testing.T) {
+	wallets := NewMemoryWalletStore("wallet", 6)
+	deposits := NewMemoryWalletStore("deposit", 6)
+	tokens := make([]crypto.Token, 0)
+	for i := 0; i < 500; i++ {
+		token, _ := crypto.RandomAsymetricKey()
+		tokens = append(tokens, token)
+		if i%3 != 0 {
+			wallets.Credit(token, uint64(i+1))
+		}
+		if i%2 == 0 {
+			deposits.Credit(token, uint64(2*i+1))
+		}
+	}
+	accounts := wallets.Accounts()
+	if len(accounts) != 333 {
+		t.Fatalf("expected 333 wallet accounts, got %v", len(accounts))
+	}
+	state := &State{Wallets: wallets, Deposits: deposits}
+	tree := state.BalanceTree()
+	root := tree.Root()
+	for i, token := range tokens {
+		proof := ParseBalanceProof(tree.Prove(crypto.HashToken(token)).Serialize())
+		if proof == nil || !proof.Verify(root) {
+			t.Fatalf("invalid proof for account %v", i)
+		}
+		_, wallet := wallets.Balance(token)
+		_, deposit := deposits.Balance(token)
+		if proof.Account.Wallet != wallet || proof.Account.Deposit != deposit {
+			t.Fatalf("unexpected balance on proof for account %v", i)
+		}
+		proof.Account.Wallet += 1
+		if proof.Verify(root) {
+			t.Fatalf("tampered proof verified for account %v", i)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		token, _ := crypto.RandomAsymetricKey()
+		proof := tree.Prove(crypto.HashToken(token))
+		if !proof.Verify(root) || proof.Account.Wallet != 0 || proof.Account.Deposit != 0 {
+			t.Fatal("invalid zero balance proof")
+		}
+		proof.Account.Deposit = 1
+		if proof.Verify(root) {
+			t.Fatal("tampered zero balance proof verified")
+		}
+	}
+	if NewBalanceTree(state.Accounts()).Root() != root {
+		t.Error("balance tree is not deterministic")
+	}
+	wallets.Credit(tokens[0], 1)
+	_, wallet := wallets.Balance(tokens[0])
+	_, deposit := deposits.Balance(tokens[0])
+	updated := tree.Update([]Account{{Hash: crypto.HashToken(tokens[0]), Wallet: wallet, Deposit: deposit}})
+	if updated.Root() == root || tree.Root() != root {
+		t.Error("balance tree root did not change with balance")
+	}
+	if updated.Root() != NewBalanceTree(state.Accounts()).Root() {
+		t.Error("updated balance tree differs from fresh balance tree")
+	}
+}
+
+func TestBalanceTreeUpdate(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	balances := make(map[crypto.Hash]Account)
+	tree := NewBalanceTree(nil)
+	hashes := make([]crypto.Hash, 0)
+	for round := 0; round < 50; round++ {
+		updates := make([]Account, 0)
+		for n := 0; n < 20; n++ {
+			var account Account
+			if len(hashes) > 0 && random.Intn(2) == 0 {
+				account.Hash = hashes[random.Intn(len(hashes))]
+			} else {
+				random.Read(account.Hash[:])
+				hashes = append(hashes, account.Hash)
+			}
+			// a third of the updates zero the balance and remove the account
+			if random.Intn(3) > 0 {
+				account.Wallet = uint64(random.Intn(1000))
+				account.Deposit = uint64(random.Intn(2))
+			}
+			updates = append(updates, account)
+			balances[account.Hash] = account
+		}
+		previous := tree.Root()
+		updated := tree.Update(updates)
+		if tree.Root() != previous {
+			t.Fatal("update changed the original tree")
+		}
+		tree = updated
+		accounts := make([]Account, 0, len(balances))
+		for _, account := range balances {
+			accounts = append(accounts, account)
+		}
+		if tree.Root() != NewBalanceTree(accounts).Root() {
+			t.Fatalf("round %v: updated root differs from fresh build", round)
+		}
+	}
+	// removing every account leaves an empty tree
+	removals := make([]Account, 0, len(hashes))
+	for _, hash := range hashes {
+		removals = append(removals, Account{Hash: hash})
+	}
+	if tree.Update(removals).Root() != crypto.ZeroHash {
+		t.Error("tree without accounts has non zero root")
+	}
+
+	genesis, key := NewGenesisState()
+	genesis.Unbonding.Period = 2
+	before := genesis.BalanceTree()
+	for epoch := uint64(1); epoch <= 5; epoch++ {
+		validator := genesis.Validator(NewMutations(epoch), epoch)
+		if epoch == 1 {
+			withdraw := actions.Withdraw{TimeStamp: 1, Token: key.PublicKey(), Value: 500, Fee: 1}
+			withdraw.Sign(key)
+			validator.Validate(withdraw.Serialize())
+		}
+		validator.Validate(signedTransfer(epoch, key, 10))
+		validator.Incorporate(key.PublicKey())
+		if genesis.BalanceTree().Root() != NewBalanceTree(genesis.Accounts()).Root() {
+			t.Fatalf("epoch %v: state balance tree differs from fresh build", epoch)
+		}
+	}
+	if before.Root() == genesis.BalanceTree().Root() {
+		t.Error("state balance tree not updated with mutations")
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	genesis, key := NewGenesisState()
+	genesis.Unbonding.Period = 10
+	signer, _ := crypto.RandomAsymetricKey()
+	beneficiary, _ := crypto.RandomAsymetricKey()
+	policy := actions.MultisigPolicy{TimeStamp: 1, Owner: key.PublicKey(), Threshold: 1, Signers: []crypto.Token{signer}, Fee: 1}
+	lock := actions.Lock{TimeStamp: 1, From: key.PublicKey(), To: beneficiary, Value: 1000, Unlock: 10, Vesting: 10, Fee: 1}
+	withdraw := actions.Withdraw{TimeStamp: 1, Token: key.PublicKey(), Value: 500, Fee: 1}
+	nonce := actions.Transfer{TimeStamp: 1, Nonce: 1, From: key.PublicKey(), To: []crypto.TokenValue{{Token: signer, Value: 10}}, Fee: 1}
+	lock.Sign(key)
+	withdraw.Sign(key)
+	nonce.Sign(key)
+	policy.Sign(key)
+	register := actions.RegisterProtocol{TimeStamp: 1, Owner: key.PublicKey(), Protocol: 7, MaxDataSize: 100, MinFee: 5, Fee: 1}
+	register.Sign(key)
+	validator := genesis.Validator(NewMutations(1), 1)
+	// the policy comes last as it turns the wallet into a multisig wallet
+	for _, action := range [][]byte{lock.Serialize(), withdraw.Serialize(), nonce.Serialize(), signedTransfer(1, key, 10), register.Serialize(), policy.Serialize()} {
+		if !validator.Validate(action) {
+			t.Fatal("rejected valid action")
+		}
+	}
+	validator.Burn(crypto.HashToken(key.PublicKey()), 1)
+	mutations := validator.Mutations()
+	parsed := ParseMutations(mutations.Serialize())
+	if parsed == nil || !bytes.Equal(parsed.Serialize(), mutations.Serialize()) {
+		t.Fatal("mutations serialization does not round trip")
+	}
+	if ParseMutations(mutations.Serialize()[1:]) != nil {
+		t.Error("parsed truncated mutations")
+	}
+
+	snapshot := genesis.Snapshot()
+	replica := ParseSnapshot(snapshot, "")
+	if replica == nil || !replica.ChecksumHash().Equal(genesis.ChecksumHash()) {
+		t.Fatal("snapshot does not round trip")
+	}
+	validator.Incorporate(key.PublicKey())
+	replica.IncorporateMutations(ParseMutations(mutations.Serialize()))
+	if !replica.ChecksumHash().Equal(genesis.ChecksumHash()) {
+		t.Error("replayed mutations diverge from incorporated mutations")
+	}
+	onFile := ParseSnapshot(genesis.Snapshot(), t.TempDir()+"/")
+	if onFile == nil || !onFile.ChecksumHash().Equal(genesis.ChecksumHash()) {
+		t.Error("file snapshot does not round trip")
+	}
+	if ParseSnapshot(snapshot[:len(snapshot)-1], "") != nil {
+		t.Error("parsed truncated snapshot")
+	}
+}
+
+func TestBatchTransfer(t *testing.T) {
+	genesis, key := NewGenesisState()
+	other, otherKey := crypto.RandomAsymetricKey()
+	receiver, _ := crypto.RandomAsymetricKey()
+	funding := actions.Transfer{TimeStamp: 1, From: key.PublicKey(), To: []crypto.TokenValue{{Token: other, Value: 100}}, Fee: 1}
+	funding.Sign(key)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(funding.Serialize()) {
+		t.Fatal("rejected funding transfer")
+	}
+	validator.Incorporate(key.PublicKey())
+	_, balance := genesis.Wallets.Balance(key.PublicKey())
+
+	batch := func(value uint64, signers ...crypto.PrivateKey) []byte {
+		action := actions.Batch{
+			TimeStamp: 2,
+			Legs: []actions.BatchLeg{
+				{From: key.PublicKey(), To: []crypto.TokenValue{{Token: receiver, Value: 10}, {Token: other, Value: 5}}},
+				{From: other, To: []crypto.TokenValue{{Token: receiver, Value: value}}},
+			},
+			Fee: 1,
+		}
+		for _, signer := range signers {
+			action.Sign(signer)
+		}
+		return action.Serialize()
+	}
+	if _, err := actions.ParseBatch(batch(50, key)); !errors.Is(err, util.ErrBadSignature) {
+		t.Error("parsed batch without every leg signed")
+	}
+	validator = genesis.Validator(NewMutations(2), 2)
+	if validator.Validate(batch(101, key, otherKey)) {
+		t.Error("accepted batch with an unfunded leg")
+	}
+	if len(validator.Mutations().DeltaWallets) != 0 {
+		t.Fatal("rejected batch left mutations behind")
+	}
+	// debits are checked against balances prior to the batch credits
+	if !validator.Validate(batch(100, key, otherKey)) {
+		t.Fatal("rejected valid batch")
+	}
+	validator.Incorporate(key.PublicKey())
+	if _, received := genesis.Wallets.Balance(receiver); received != 110 {
+		t.Errorf("receiver credited %v instead of 110", received)
+	}
+	if _, remaining := genesis.Wallets.Balance(other); remaining != 5 {
+		t.Errorf("second sender left with %v", remaining)
+	}
+	// the fee paid by the first sender is collected back as proposer
+	if _, remaining := genesis.Wallets.Balance(key.PublicKey()); remaining != balance-15 {
+		t.Errorf("first sender left with %v instead of %v", remaining, balance-15)
+	}
+
+	duplicate := actions.Batch{
+		TimeStamp: 3,
+		Legs: []actions.BatchLeg{
+			{From: key.PublicKey(), To: []crypto.TokenValue{{Token: receiver, Value: 1}}},
+			{From: key.PublicKey(), To: []crypto.TokenValue{{Token: receiver, Value: 1}}},
+		},
+	}
+	duplicate.Sign(key)
+	duplicate.Legs[1].Signature = duplicate.Legs[0].Signature
+	if _, err := actions.ParseBatch(duplicate.Serialize()); !errors.Is(err, util.ErrInvalidValue) {
+		t.Error("parsed batch with repeated senders")
+	}
+	payment := (&actions.Batch{Legs: []actions.BatchLeg{{From: key.PublicKey(), To: []crypto.TokenValue{{Token: receiver, Value: 1}, {Token: receiver, Value: 2}}}}}).Payments()
+	if len(payment.Credit) != 1 || payment.Credit[0].FungibleTokens != 3 {
+		t.Error("credits to the same wallet were not aggregated")
+	}
+}
+
+func TestDelegation(t *testing.T) {
+	genesis, key := NewGenesisState()
+	genesis.Unbonding.Period = 10
+	validatorToken := key.PublicKey()
+	validatorHash := crypto.HashToken(validatorToken)
+	delegatorToken, delegatorKey := crypto.RandomAsymetricKey()
+	delegatorHash := crypto.HashToken(delegatorToken)
+	genesis.Wallets.Credit(delegatorToken, 2e9)
+	_, deposit := genesis.Deposits.BalanceHash(validatorHash)
+
+	delegate := actions.Delegate{TimeStamp: 1, Delegator: delegatorToken, Validator: validatorToken, Value: 1e9, Fee: 1}
+	delegate.Sign(delegatorKey)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(delegate.Serialize()) {
+		t.Fatal("rejected valid delegation")
+	}
+	if validator.Delegated(validatorHash, delegatorHash) != 1e9 {
+		t.Error("delegation not accounted on mutations")
+	}
+	undelegate := actions.Undelegate{TimeStamp: 1, Delegator: delegatorToken, Validator: validatorToken, Value: 1e9 + 1, Fee: 1}
+	undelegate.Sign(delegatorKey)
+	if validator.Validate(undelegate.Serialize()) {
+		t.Error("accepted undelegation above delegated stake")
+	}
+	validator.Incorporate(validatorToken)
+	if _, balance := genesis.Wallets.BalanceHash(delegatorHash); balance != 1e9-1 {
+		t.Errorf("delegator wallet not debited: %v", balance)
+	}
+	if genesis.Delegations.Delegated(validatorHash) != 1e9 || genesis.Delegations.Get(validatorHash, delegatorHash) != 1e9 {
+		t.Error("delegation not incorporated")
+	}
+
+	// fees are split in proportion to deposit and delegated stake
+	to, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{TimeStamp: 2, From: delegatorToken, To: []crypto.TokenValue{{Token: to, Value: 1}}, Fee: 101}
+	transfer.Sign(delegatorKey)
+	validator = genesis.Validator(NewMutations(2), 2)
+	if !validator.Validate(transfer.Serialize()) {
+		t.Fatal("rejected valid transfer")
+	}
+	_, before := genesis.Wallets.BalanceHash(validatorHash)
+	validator.Incorporate(validatorToken)
+	if _, balance := genesis.Wallets.BalanceHash(delegatorHash); balance != 1e9-1-1-101+50 {
+		t.Errorf("unexpected delegator fee share: %v", balance)
+	}
+	if _, balance := genesis.Wallets.BalanceHash(validatorHash); balance != before+51 {
+		t.Errorf("unexpected validator fee share: %v", balance-before)
+	}
+
+	undelegate = actions.Undelegate{TimeStamp: 3, Delegator: delegatorToken, Validator: validatorToken, Value: 4e8, Fee: 1}
+	undelegate.Sign(delegatorKey)
+	validator = genesis.Validator(NewMutations(3), 3)
+	if !validator.Validate(undelegate.Serialize()) {
+		t.Fatal("rejected valid undelegation")
+	}
+	validator.Incorporate(validatorToken)
+	if genesis.Delegations.Get(validatorHash, delegatorHash) != 6e8 || genesis.Unbonding.Pending(delegatorHash, 3) != 4e8 {
+		t.Error("undelegated stake not moved into unbonding queue")
+	}
+
+	// slashing exhausts the deposit before reaching delegated stake
+	validator = genesis.Validator(NewMutations(4), 4)
+	if burned := validator.Burn(validatorHash, deposit+3e8); burned != deposit+3e8 {
+		t.Errorf("expected %v burned, got %v", deposit+3e8, burned)
+	}
+	validator.Incorporate(validatorToken)
+	if genesis.Delegations.Get(validatorHash, delegatorHash) != 3e8 {
+		t.Errorf("delegated stake not slashed: %v", genesis.Delegations.Get(validatorHash, delegatorHash))
+	}
+	if !ParseDelegations(genesis.Delegations.Serialize()).Hash().Equal(genesis.Delegations.Hash()) {
+		t.Error("delegations serialization does not round trip")
+	}
+}
+
+func TestIssuance(t *testing.T) {
+	schedule := IssuanceSchedule{BlockReward: 1000, HalvingInterval: 10}
+	if schedule.Reward(9, 0) != 1000 || schedule.Reward(10, 0) != 500 || schedule.Reward(25, 0) != 250 || schedule.Reward(1000, 0) != 0 {
+		t.Error("unexpected halving schedule")
+	}
+	if (IssuanceSchedule{InflationRate: 1e6}).Reward(1, 2e9) != 2e6 {
+		t.Error("unexpected inflation")
+	}
+
+	genesis, key := NewGenesisState()
+	genesis.Fees = NewFeeMarket(2, 1000)
+	genesis.Issuance.Schedule = schedule
+	if !genesis.Audit() {
+		t.Fatal("genesis supply does not match circulating tokens")
+	}
+	one, _ := crypto.RandomAsymetricKey()
+	two, _ := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{TimeStamp: 1, From: key.PublicKey(), To: []crypto.TokenValue{{Token: one, Value: 10}}, Fee: 1000}
+	transfer.Sign(key)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(transfer.Serialize()) {
+		t.Fatal("rejected valid transfer")
+	}
+	burned := validator.FeesBurned + validator.Burn(crypto.HashToken(key.PublicKey()), 100)
+	if minted := validator.Reward(map[crypto.Token]int{one: 1, two: 2}); minted != 999 {
+		t.Errorf("expected 999 minted, got %v", minted)
+	}
+	validator.Incorporate(one)
+	if _, balance := genesis.Wallets.Balance(two); balance != 666 {
+		t.Errorf("unexpected reward share: %v", balance)
+	}
+	if genesis.Issuance.Supply != 2*GenesisMint+999-burned {
+		t.Errorf("unexpected supply: %v", genesis.Issuance.Supply)
+	}
+	if !genesis.Audit() {
+		t.Errorf("supply %v does not match circulating tokens %v", genesis.Issuance.Supply, genesis.Circulating())
+	}
+	if !ParseIssuance(genesis.Issuance.Serialize()).Hash().Equal(genesis.Issuance.Hash()) {
+		t.Error("issuance serialization does not round trip")
+	}
+}
+
+func TestProtocolRegistry(t *testing.T) {
+	genesis, owner := NewGenesisState()
+	_, other := crypto.RandomAsymetricKey()
+	transfer := actions.Transfer{TimeStamp: 1, From: owner.PublicKey(), To: []crypto.TokenValue{{Token: other.PublicKey(), Value: 1000}}, Fee: 1}
+	transfer.Sign(owner)
+	register := actions.RegisterProtocol{TimeStamp: 1, Owner: owner.PublicKey(), Protocol: 1, MaxDataSize: 4, MinFee: 10, Fee: 1}
+	register.Sign(owner)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(transfer.Serialize()) || !validator.Validate(register.Serialize()) {
+		t.Fatal("rejected valid protocol registration")
+	}
+	squat := actions.RegisterProtocol{TimeStamp: 1, Owner: other.PublicKey(), Protocol: 1, Fee: 1}
+	squat.Sign(other)
+	if validator.Validate(squat.Serialize()) {
+		t.Error("accepted registration of a code claimed on the mutations")
+	}
+	validator.Incorporate(owner.PublicKey())
+	if rule := genesis.Protocols.Get(1); rule == nil || !rule.Owner.Equal(owner.PublicKey()) {
+		t.Fatal("protocol registration not incorporated into state")
+	}
+
+	void := func(protocol uint32, data []byte, fee uint64) []byte {
+		action := actions.Void{TimeStamp: 2, Protocol: protocol, Data: data, Wallet: other.PublicKey(), Fee: fee}
+		action.Sign(other)
+		return action.Serialize()
+	}
+	squat.TimeStamp = 2
+	squat.Sign(other)
+	validator = genesis.Validator(NewMutations(2), 2)
+	if validator.Validate(squat.Serialize()) {
+		t.Error("accepted registration of a code claimed by another token")
+	}
+	if validator.Validate(void(1, []byte{1, 2, 3, 4, 5}, 10)) {
+		t.Error("accepted void action above the maximum data size")
+	}
+	if validator.Validate(void(1, []byte{1, 2, 3, 4}, 9)) {
+		t.Error("accepted void action below the minimum fee")
+	}
+	if !validator.Validate(void(1, []byte{1, 2, 3, 4}, 10)) {
+		t.Error("rejected void action within the protocol rules")
+	}
+	if !validator.Validate(void(2, []byte{1, 2, 3, 4, 5}, 1)) {
+		t.Error("rejected void action of an unregistered code")
+	}
+	update := actions.RegisterProtocol{TimeStamp: 2, Owner: owner.PublicKey(), Protocol: 1, MinFee: 20, Fee: 1}
+	update.Sign(owner)
+	if !validator.Validate(update.Serialize()) {
+		t.Error("rejected update of the rules by the owner")
+	}
+	if validator.Validate(void(1, []byte{1}, 15)) {
+		t.Error("accepted void action below the updated minimum fee")
+	}
+	zero := actions.RegisterProtocol{TimeStamp: 2, Owner: owner.PublicKey(), Protocol: 0, Fee: 1}
+	zero.Sign(owner)
+	if _, err := actions.ParseRegisterProtocol(zero.Serialize()); !errors.Is(err, util.ErrInvalidValue) {
+		t.Error("parsed registration of protocol code zero")
+	}
+	clone := ParseProtocols(genesis.Protocols.Serialize())
+	if clone == nil || !clone.Hash().Equal(genesis.Protocols.Hash()) {
+		t.Error("protocols serialization does not round trip")
+	}
+}
+
+// fundedWallets returns a state with count wallets funded with value tokens at
+// epoch 1 and their keys.
+func fundedWallets(count int, value uint64) (*State, []crypto.PrivateKey) {
+	genesis, key := NewGenesisState()
+	keys := make([]crypto.PrivateKey, count)
+	validator := genesis.Validator(NewMutations(1), 1)
+	for n := range keys {
+		_, keys[n] = crypto.RandomAsymetricKey()
+		transfer := actions.Transfer{TimeStamp: 1, From: key.PublicKey(), To: []crypto.TokenValue{{Token: keys[n].PublicKey(), Value: value}}, Fee: 1}
+		transfer.Sign(key)
+		validator.Validate(transfer.Serialize())
+	}
+	validator.Incorporate(key.PublicKey())
+	return genesis, keys
+}
+
+func TestValidateParallel(t *testing.T) {
+	genesis, keys := fundedWallets(12, 1000)
+	genesis.Unbonding.Period = 10
+	random := rand.New(rand.NewSource(1))
+	// actions touch wallets of one of four clusters, forming independent groups
+	cluster := 0
+	pick := func() crypto.PrivateKey { return keys[3*cluster+random.Intn(3)] }
+	data := make([][]byte, 0)
+	for n := 0; n < 600; n++ {
+		cluster = random.Intn(4)
+		from := pick()
+		var action interface {
+			Sign(crypto.PrivateKey)
+			Serialize() []byte
+		}
+		switch random.Intn(8) {
+		case 0:
+			action = &actions.Deposit{TimeStamp: 2, Token: from.PublicKey(), Value: uint64(random.Intn(300)), Fee: 1}
+		case 1:
+			action = &actions.Withdraw{TimeStamp: 2, Token: from.PublicKey(), Value: uint64(random.Intn(300)), Fee: 1}
+		case 2:
+			action = &actions.Lock{TimeStamp: 2, From: from.PublicKey(), To: pick().PublicKey(), Value: uint64(random.Intn(100)), Unlock: 20, Fee: 1}
+		case 3:
+			action = &actions.RegisterProtocol{TimeStamp: 2, Owner: from.PublicKey(), Protocol: uint32(4*cluster + random.Intn(2) + 1), MinFee: uint64(random.Intn(3)), Fee: 1}
+		case 4:
+			action = &actions.Void{TimeStamp: 2, Protocol: uint32(4*cluster + random.Intn(3) + 1), Wallet: from.PublicKey(), Fee: uint64(random.Intn(3) + 1)}
+		case 5:
+			action = &actions.Transfer{TimeStamp: 2, Nonce: uint64(random.Intn(3) + 1), From: from.PublicKey(), To: []crypto.TokenValue{{Token: pick().PublicKey(), Value: uint64(random.Intn(200))}}, Fee: 1}
+		default:
+			action = &actions.Transfer{TimeStamp: 2, From: from.PublicKey(), To: []crypto.TokenValue{{Token: pick().PublicKey(), Value: uint64(random.Intn(400))}}, Fee: 1}
+		}
+		action.Sign(from)
+		data = append(data, action.Serialize())
+		switch random.Intn(20) {
+		case 0:
+			data = append(data, data[random.Intn(len(data))]) // replay
+		case 1:
+			tampered := append([]byte{}, data[len(data)-1]...)
+			tampered[len(tampered)-1] ^= 1
+			data = append(data, tampered)
+		}
+	}
+	// both validators start from mutations slashing one of the wallets
+	sequential := genesis.Clone().Validator(NewMutations(2), 2)
+	parallel := genesis.Validator(NewMutations(2), 2)
+	sequential.Slash(keys[0].PublicKey(), 1, 10)
+	parallel.Slash(keys[0].PublicKey(), 1, 10)
+	parsed := make([]actions.Action, len(data))
+	for n, action := range data {
+		parsed[n], _ = actions.ParseAction(action)
+	}
+	valid := parallel.validateActions(data, parsed, 4)
+	accepted := 0
+	for n, action := range data {
+		if ok := sequential.Validate(action); ok != valid[n] {
+			t.Fatalf("action %d: sequential validity %v, parallel validity %v", n, ok, valid[n])
+		} else if ok {
+			accepted++
+		}
+	}
+	if accepted == 0 || accepted == len(data) {
+		t.Fatalf("degenerate test: %d of %d actions accepted", accepted, len(data))
+	}
+	if !bytes.Equal(sequential.Mutations().Serialize(), parallel.Mutations().Serialize()) {
+		t.Error("parallel mutations differ from sequential mutations")
+	}
+	if sequential.FeesCollected != parallel.FeesCollected || sequential.FeesBurned != parallel.FeesBurned {
+		t.Error("parallel fees differ from sequential fees")
+	}
+}
+
+func benchmarkTransfers(b *testing.B) (*State, [][]byte) {
+	genesis, keys := fundedWallets(256, 1000)
+	data := make([][]byte, 0, 4*len(keys))
+	for n := 0; n < 4*len(keys); n++ {
+		data = append(data, signedTransfer(2, keys[n%len(keys)], 10))
+	}
+	b.ResetTimer()
+	return genesis, data
+}
+
+func BenchmarkValidate(b *testing.B) {
+	genesis, data := benchmarkTransfers(b)
+	for i := 0; i < b.N; i++ {
+		validator := genesis.Validator(NewMutations(2), 2)
+		for _, action := range data {
+			validator.Validate(action)
+		}
+	}
+}
+
+func BenchmarkValidateParallel(b *testing.B) {
+	genesis, data := benchmarkTransfers(b)
+	for i := 0; i < b.N; i++ {
+		validator := genesis.Validator(NewMutations(2), 2)
+		validator.ValidateParallel(data)
+	}
+}
+
+func TestMutationsLog(t *testing.T) {
+	genesis, key := NewGenesisState()
+	genesis.Unbonding.Period = 1
+	withdraw := actions.Withdraw{TimeStamp: 1, Token: key.PublicKey(), Value: 500, Fee: 1}
+	withdraw.Sign(key)
+	validator := genesis.Validator(NewMutations(1), 1)
+	if !validator.Validate(withdraw.Serialize()) || !validator.Validate(signedTransfer(1, key, 10)) {
+		t.Fatal("rejected valid action")
+	}
+	validator.Incorporate(key.PublicKey())
+
+	onFile := ParseSnapshot(genesis.Snapshot(), t.TempDir()+"/")
+	reference := ParseSnapshot(genesis.Snapshot(), "")
+	if onFile == nil || reference == nil {
+		t.Fatal("could not recreate state from snapshot")
+	}
+	validator = reference.Validator(NewMutations(2), 2)
+	if !validator.Validate(signedTransfer(2, key, 10)) {
+		t.Fatal("rejected valid transfer")
+	}
+	mutations := validator.Mutations()
+	before := onFile.ChecksumHash()
+
+	log, err := OpenMutationsLog(filepath.Join(t.TempDir(), "mutations.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	entry := onFile.LogEntry(mutations, crypto.Hasher([]byte("block")))
+	if err := log.Begin(entry); err != nil {
+		t.Fatal(err)
+	}
+	logged, done, err := log.Last()
+	if err != nil || logged == nil || done || !bytes.Equal(logged.Serialize(), entry.Serialize()) {
+		t.Fatal("log entry does not round trip", err)
+	}
+
+	// interrupted after the wallets and the unbonding queue
+	interrupt := func() {
+		for hash, delta := range mutations.DeltaWallets {
+			if delta > 0 {
+				onFile.Wallets.CreditHash(hash, uint64(delta))
+			} else {
+				onFile.Wallets.DebitHash(hash, uint64(-delta))
+			}
+		}
+		for _, matured := range onFile.Unbonding.Incorporate(mutations) {
+			onFile.Wallets.CreditHash(matured.Hash, matured.Value)
+		}
+	}
+	interrupt()
+	if changed, err := onFile.Recover(logged, false); err != nil || changed == 0 {
+		t.Fatal("partial incorporation not rolled back", changed, err)
+	}
+	if !onFile.ChecksumHash().Equal(before) {
+		t.Fatal("rolled back state differs from state before mutations")
+	}
+	interrupt()
+	if _, err := onFile.Recover(logged, true); err != nil {
+		t.Fatal(err)
+	}
+	reference.IncorporateMutations(mutations)
+	if !onFile.ChecksumHash().Equal(reference.ChecksumHash()) {
+		t.Fatal("rolled forward state differs from state after mutations")
+	}
+	if changed, _ := onFile.Recover(logged, true); changed != 0 {
+		t.Errorf("rolled forward an incorporated state: %v changes", changed)
+	}
+
+	if err := log.Done(2); err != nil {
+		t.Fatal(err)
+	}
+	if logged, done, _ = log.Last(); logged == nil || !done {
+		t.Error("log entry not marked as done")
+	}
+	if err := log.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if logged, _, _ = log.Last(); logged != nil {
+		t.Error("discarded entry still on log")
+	}
+}
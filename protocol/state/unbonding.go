@@ -0,0 +1,221 @@
+package state
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Unbonding is an amount withdrawn from a deposit waiting to be released into
+// the wallet at the Matures epoch.
+type Unbonding struct {
+	Hash    crypto.Hash
+	Value   uint64
+	Matures uint64
+}
+
+// UnbondingQueue keeps withdrawals pending release. Withdrawn amounts leave the
+// Deposits store immediately but only reach the Wallets store Period epochs
+// later. Until then they remain subject to slashing. The queue, including its
+// period, is part of the state checksum. If a file path is provided the queue
+// is persisted to disk at every incorporation.
+type UnbondingQueue struct {
+	Period   uint64
+	pending  []Unbonding
+	filePath string
+}
+
+// NewUnbondingQueue returns an empty in memory unbonding queue with the given
+// unbonding period in epochs.
+func NewUnbondingQueue(period uint64) *UnbondingQueue {
+	return &UnbondingQueue{Period: period, pending: make([]Unbonding, 0)}
+}
+
+// NewFileUnbondingQueue returns an unbonding queue persisted on the given file.
+// If the file exists its contents are loaded, otherwise an empty queue with the
+// given period is created.
+func NewFileUnbondingQueue(filePath string, period uint64) *UnbondingQueue {
+	data, err := os.ReadFile(filePath)
+	if err != nil || len(data) == 0 {
+		queue := NewUnbondingQueue(period)
+		queue.filePath = filePath
+		return queue
+	}
+	queue := ParseUnbondingQueue(data)
+	if queue == nil {
+		slog.Error("NewFileUnbondingQueue: could not parse existing file", "path", filePath)
+		return nil
+	}
+	queue.filePath = filePath
+	return queue
+}
+
+// NewFileUnbondingQueueFromBytes creates an unbonding queue from its serialized
+// form persisted on the given file.
+func NewFileUnbondingQueueFromBytes(filePath string, data []byte) *UnbondingQueue {
+	queue := ParseUnbondingQueue(data)
+	if queue == nil {
+		return nil
+	}
+	queue.filePath = filePath
+	if err := persistFile(filePath, queue.Serialize()); err != nil {
+		slog.Error("NewFileUnbondingQueueFromBytes: could not persist queue", "path", filePath, "err", err)
+		return nil
+	}
+	return queue
+}
+
+// Pending returns the total amount for the given hash not yet matured at the
+// given epoch.
+func (u *UnbondingQueue) Pending(hash crypto.Hash, epoch uint64) uint64 {
+	total := uint64(0)
+	for _, pending := range u.pending {
+		if pending.Hash.Equal(hash) && pending.Matures > epoch {
+			total += pending.Value
+		}
+	}
+	return total
+}
+
+// Total returns the total amount of withdrawals on the queue.
+func (u *UnbondingQueue) Total() uint64 {
+	total := uint64(0)
+	for _, pending := range u.pending {
+		total += pending.Value
+	}
+	return total
+}
+
+// Matured returns the total amount for the given hash already matured at the
+// given epoch but not yet released into the wallet.
+func (u *UnbondingQueue) Matured(hash crypto.Hash, epoch uint64) uint64 {
+	total := uint64(0)
+	for _, pending := range u.pending {
+		if pending.Hash.Equal(hash) && pending.Matures <= epoch {
+			total += pending.Value
+		}
+	}
+	return total
+}
+
+// Slash reduces the amount pending release for the given hash by value,
+// starting with the withdrawals that mature last. Returns the amount actually
+// slashed.
+func (u *UnbondingQueue) Slash(hash crypto.Hash, value uint64) uint64 {
+	slashed := uint64(0)
+	for n := len(u.pending) - 1; n >= 0 && slashed < value; n-- {
+		if !u.pending[n].Hash.Equal(hash) {
+			continue
+		}
+		cut := value - slashed
+		if cut > u.pending[n].Value {
+			cut = u.pending[n].Value
+		}
+		u.pending[n].Value -= cut
+		slashed += cut
+	}
+	return slashed
+}
+
+// Incorporate appends the withdrawals of the mutations, applies slashes of
+// pending withdrawals and removes from the queue the withdrawals maturing up to
+// the mutations epoch. Returns the matured withdrawals that must be credited to
+// wallets. Persists the queue if file based.
+func (u *UnbondingQueue) Incorporate(m *Mutations) []Unbonding {
+	u.pending = append(u.pending, m.Unbonding...)
+	u.sort()
+	for hash, value := range m.SlashedUnbonding {
+		u.Slash(hash, value)
+	}
+	matured := make([]Unbonding, 0)
+	remaining := make([]Unbonding, 0, len(u.pending))
+	for _, pending := range u.pending {
+		if pending.Matures <= m.Epoch {
+			if pending.Value > 0 {
+				matured = append(matured, pending)
+			}
+		} else if pending.Value > 0 {
+			remaining = append(remaining, pending)
+		}
+	}
+	u.pending = remaining
+	if u.filePath != "" {
+		if err := persistFile(u.filePath, u.Serialize()); err != nil {
+			slog.Error("UnbondingQueue: could not persist queue", "path", u.filePath, "err", err)
+		}
+	}
+	return matured
+}
+
+// sort keeps pending withdrawals ordered by maturity, hash and value so that
+// the queue is independent of the order of incorporation.
+func (u *UnbondingQueue) sort() {
+	sort.SliceStable(u.pending, func(i, j int) bool {
+		a, b := u.pending[i], u.pending[j]
+		if a.Matures != b.Matures {
+			return a.Matures < b.Matures
+		}
+		for n := 0; n < crypto.Size; n++ {
+			if a.Hash[n] != b.Hash[n] {
+				return a.Hash[n] < b.Hash[n]
+			}
+		}
+		return a.Value < b.Value
+	})
+}
+
+// Clone returns an in memory copy of the queue.
+func (u *UnbondingQueue) Clone() *UnbondingQueue {
+	clone := NewUnbondingQueue(u.Period)
+	clone.pending = append(clone.pending, u.pending...)
+	return clone
+}
+
+// Serialize returns a byte representation of the queue.
+func (u *UnbondingQueue) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(u.Period, &bytes)
+	util.PutUint32(uint32(len(u.pending)), &bytes)
+	for _, pending := range u.pending {
+		util.PutHash(pending.Hash, &bytes)
+		util.PutUint64(pending.Value, &bytes)
+		util.PutUint64(pending.Matures, &bytes)
+	}
+	return bytes
+}
+
+// Bytes is an alias for Serialize.
+func (u *UnbondingQueue) Bytes() []byte {
+	return u.Serialize()
+}
+
+// Hash returns the hash of the serialized queue.
+func (u *UnbondingQueue) Hash() crypto.Hash {
+	return crypto.Hasher(u.Serialize())
+}
+
+// ParseUnbondingQueue parses a serialized unbonding queue. Returns nil if the
+// data is not a valid serialization.
+func ParseUnbondingQueue(data []byte) *UnbondingQueue {
+	if len(data) < 12 {
+		return nil
+	}
+	position := 0
+	queue := NewUnbondingQueue(0)
+	queue.Period, position = util.ParseUint64(data, position)
+	var count uint32
+	count, position = util.ParseUint32(data, position)
+	if position+int(count)*(crypto.Size+16) != len(data) {
+		return nil
+	}
+	queue.pending = make([]Unbonding, int(count))
+	for n := 0; n < int(count); n++ {
+		queue.pending[n].Hash, position = util.ParseHash(data, position)
+		queue.pending[n].Value, position = util.ParseUint64(data, position)
+		queue.pending[n].Matures, position = util.ParseUint64(data, position)
+	}
+	return queue
+}
@@ -1,33 +1,120 @@
 package state
 
 import (
+	"math/bits"
+
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/util"
 )
 
 const MaxEpochDifference = 100
 
 // MutatingState is a validator for the breeze protocol. It contains the state
-// and a mutation object. It keep tracks of collected fees.
+// and a mutation object. It keep tracks of fees collected by the validator and
+// of fees burned by the fee market.
 type MutatingState struct {
 	Epoch         uint64
 	State         *State
 	mutations     *Mutations
 	FeesCollected uint64
+	FeesBurned    uint64
 }
 
 // Incoraporate deposits the fees collected into the validator token and
-// incorporate mutations into the state
+// incorporate mutations into the state. The validator must be the proposer of
+// the block so that every node credits the same wallet. Fees collected are
+// shared with delegators of the validator (see Distribute). Fees burned are
+// deducted from the total supply.
 func (m *MutatingState) Incorporate(validator crypto.Token) {
-	validatorHash := crypto.HashToken(validator)
-	if delta, ok := m.mutations.DeltaWallets[validatorHash]; ok {
-		m.mutations.DeltaWallets[validatorHash] = delta + int(m.FeesCollected)
-	} else {
-		m.mutations.DeltaWallets[validatorHash] = int(m.FeesCollected)
-	}
+	m.settle(validator)
 	m.State.IncorporateMutations(m.mutations)
 }
 
+// IncorporateLogged is like Incorporate but records the mutations on the write
+// ahead log before incorporating them (see State.IncorporateMutationsLogged).
+// hash is the seal hash of the block of the mutations.
+func (m *MutatingState) IncorporateLogged(validator crypto.Token, hash crypto.Hash, log *MutationsLog) error {
+	m.settle(validator)
+	return m.State.IncorporateMutationsLogged(m.mutations, hash, log)
+}
+
+// settle adds the fees collected and burned to the mutations.
+func (m *MutatingState) settle(validator crypto.Token) {
+	m.Distribute(crypto.HashToken(validator), m.FeesCollected)
+	m.mutations.Burned += m.FeesBurned
+}
+
+// Distribute credits value to the validator with the given hash. If the
+// validator has delegated stake the value is split proportionally to the
+// deposit of the validator and the stake of each delegator on the state prior
+// to the mutations. Rounding remainders are credited to the validator.
+func (m *MutatingState) Distribute(validatorHash crypto.Hash, value uint64) {
+	remaining := value
+	delegators := m.State.Delegations.Delegators(validatorHash)
+	if len(delegators) > 0 && value > 0 {
+		_, total := m.State.Deposits.BalanceHash(validatorHash)
+		for _, stake := range delegators {
+			total += stake
+		}
+		for _, delegator := range sortedHashes(delegators) {
+			hi, lo := bits.Mul64(value, delegators[delegator])
+			share, _ := bits.Div64(hi, lo, total)
+			if share > 0 {
+				m.mutations.DeltaWallets[delegator] += int(share)
+				remaining -= share
+			}
+		}
+	}
+	m.mutations.DeltaWallets[validatorHash] += int(remaining)
+}
+
+// WindowWeights returns the weights of the validators of the checksum window
+// starting at the given epoch as recorded by the mutations or by the state.
+// Returns nil if they are not recorded.
+func (m *MutatingState) WindowWeights(start uint64) map[crypto.Token]int {
+	if weights, ok := m.mutations.Windows[start]; ok {
+		return weights
+	}
+	return m.State.Issuance.WindowWeights(start)
+}
+
+// SetWindowWeights records on the mutations the weights of the validators of
+// the checksum window starting at the given epoch.
+func (m *MutatingState) SetWindowWeights(start uint64, weights map[crypto.Token]int) {
+	m.mutations.Windows[start] = copyWeights(weights)
+}
+
+// Reward mints the block reward of the issuance schedule for the epoch of the
+// MutatingState and distributes it among the validators of the checksum
+// window proportionally to their weights. Rounding remainders are not minted.
+// Returns the amount minted.
+func (m *MutatingState) Reward(weights map[crypto.Token]int) uint64 {
+	reward := m.State.Issuance.Reward(m.Epoch)
+	if reward == 0 || len(weights) == 0 {
+		return 0
+	}
+	byHash := make(map[crypto.Hash]uint64, len(weights))
+	total := uint64(0)
+	for token, weight := range weights {
+		if weight > 0 {
+			byHash[crypto.HashToken(token)] += uint64(weight)
+			total += uint64(weight)
+		}
+	}
+	minted := uint64(0)
+	for _, hash := range sortedHashes(byHash) {
+		hi, lo := bits.Mul64(reward, byHash[hash])
+		share, _ := bits.Div64(hi, lo, total)
+		if share > 0 {
+			m.Distribute(hash, share)
+			minted += share
+		}
+	}
+	m.mutations.Minted += minted
+	return minted
+}
+
 // GetEpoch returns the epoch of the MutatingState
 func (m *MutatingState) GetEpoch() uint64 {
 	return m.Epoch
@@ -39,31 +126,172 @@ func (m *MutatingState) Mutations() *Mutations {
 }
 
 // Validate validates the action (provided as a byte array) returns true if the
-// action is valid, false otherwise.
+// action is valid, false otherwise. Actions must be dated within the last
+// MaxEpochDifference epochs and must not have been incorporated before, either
+// into the state or into the mutations under validation. Transfers carrying a
+// nonce must use the nonce following the last one used by the sender. Actions
+// must pay at least the minimum fee for their size. Void actions of a
+// registered protocol code must comply with the rule of the code. The base fee
+// part of the fee is burned and the remainder is collected.
 func (c *MutatingState) Validate(data []byte) bool {
-	action := actions.ParseAction(data)
+	action, err := actions.ParseAction(data)
+	if err != nil {
+		return false
+	}
+	return c.ValidateAction(data, action)
+}
+
+// ValidateAction validates an action already parsed from data, with its
+// signatures already verified by the caller (see chain.ActionArray.PreVerify).
+// Apart from parsing it is equivalent to Validate.
+func (c *MutatingState) ValidateAction(data []byte, action actions.Action) bool {
 	if action == nil {
 		return false
 	}
-	//epoch := action.Epoch()
-	//if (c.Epoch-epoch) > MaxEpochDifference || epoch > c.Epoch {
-	//	fmt.Println("action incompatible epoch", c.Epoch, epoch)
-	//	return false
-	//}
+	minimumFee := c.MinimumFee(len(data))
+	if action.FeePaid() < minimumFee {
+		return false
+	}
+	epoch := action.Epoch()
+	if epoch > c.Epoch || (c.Epoch-epoch) > MaxEpochDifference {
+		return false
+	}
+	hash := crypto.Hasher(data)
+	if c.mutations.HasAction(hash) || c.State.Recent.Exists(hash, epoch) {
+		return false
+	}
 	payments := action.Payments()
+	switch v := action.(type) {
+	case *actions.Withdraw:
+		if c.Policy(crypto.HashToken(v.Token)) != nil || !c.CanWithdraw(crypto.HashToken(v.Token), v.Value) {
+			return false
+		}
+	case *actions.MultisigPolicy:
+		if c.Policy(crypto.HashToken(v.Owner)) != nil {
+			return false
+		}
+	case *actions.MultisigTransfer:
+		policy := c.Policy(crypto.HashToken(v.From))
+		if policy == nil || !policy.Authorizes(v.Signers()) {
+			return false
+		}
+	case *actions.Undelegate:
+		delegator := crypto.HashToken(v.Delegator)
+		if c.Policy(delegator) != nil || c.Delegated(crypto.HashToken(v.Validator), delegator) < v.Value {
+			return false
+		}
+	case *actions.RegisterProtocol:
+		// a registered code can only be updated by its owner
+		if c.Policy(crypto.HashToken(v.Owner)) != nil {
+			return false
+		}
+		if rule := c.Protocol(v.Protocol); rule != nil && !rule.Owner.Equal(v.Owner) {
+			return false
+		}
+	case *actions.Void:
+		if c.Policy(crypto.HashToken(v.Wallet)) != nil {
+			return false
+		}
+		if rule := c.Protocol(v.Protocol); rule != nil && !rule.Accepts(v) {
+			return false
+		}
+	default:
+		// funds of multisig wallets can only be moved by multisig transfers
+		for _, debit := range payments.Debit {
+			if c.Policy(debit.Account) != nil {
+				return false
+			}
+		}
+	}
+	if transfer, ok := action.(*actions.Transfer); ok && transfer.Nonce > 0 {
+		// nonces must be used in strict sequence for each wallet
+		if transfer.Nonce != c.Nonce(crypto.HashToken(transfer.From))+1 {
+			return false
+		}
+	}
 	if !c.CanPay(payments) {
 		return false
 	}
 	c.TransferPayments(payments)
+	switch v := action.(type) {
+	case *actions.Transfer:
+		if v.Nonce > 0 {
+			c.mutations.Nonces[crypto.HashToken(v.From)] = v.Nonce
+		}
+	case *actions.MultisigPolicy:
+		c.mutations.Policies[crypto.HashToken(v.Owner)] = &Policy{Threshold: v.Threshold, Signers: v.Signers}
+	case *actions.Lock:
+		hash := crypto.HashToken(v.To)
+		c.mutations.Locks[hash] = append(c.mutations.Locks[hash], TimeLock{Value: v.Value, Unlock: v.Unlock, Vesting: v.Vesting})
+	case *actions.Deposit:
+		// the wallet was already debited by the payments
+		c.mutations.DeltaDeposits[crypto.HashToken(v.Token)] += int(v.Value)
+	case *actions.Withdraw:
+		c.Withdraw(crypto.HashToken(v.Token), v.Value)
+	case *actions.Delegate:
+		// the wallet was already debited by the payments
+		c.mutations.DeltaDelegation(crypto.HashToken(v.Validator), crypto.HashToken(v.Delegator), int(v.Value))
+	case *actions.Undelegate:
+		c.Undelegate(crypto.HashToken(v.Validator), crypto.HashToken(v.Delegator), v.Value)
+	case *actions.RegisterProtocol:
+		c.mutations.Protocols[v.Protocol] = &ProtocolRule{Owner: v.Owner, MaxDataSize: v.MaxDataSize, MinFee: v.MinFee}
+	}
+	c.mutations.Actions[hash] = epoch
+	c.mutations.Size += uint64(len(data))
+	c.FeesBurned += minimumFee
+	c.FeesCollected += action.FeePaid() - minimumFee
 	return true
 }
 
-// Balance returns the balance of the account with the given hash
+// MinimumFee returns the minimum fee for an action of the given size in bytes
+// according to the base fee of the state.
+func (c *MutatingState) MinimumFee(size int) uint64 {
+	return c.State.Fees.MinimumFee(size)
+}
+
+// Nonce returns the last nonce used by the wallet with the given hash either
+// on the mutations or on the state. Returns zero if the wallet never used a
+// nonce.
+func (c *MutatingState) Nonce(hash crypto.Hash) uint64 {
+	if nonce, ok := c.mutations.Nonces[hash]; ok {
+		return nonce
+	}
+	return c.State.Nonces.Get(hash)
+}
+
+// Policy returns the multisig policy of the wallet with the given hash either
+// registered on the mutations or on the state. Returns nil if the wallet is not
+// a multisig wallet.
+func (c *MutatingState) Policy(hash crypto.Hash) *Policy {
+	if policy, ok := c.mutations.Policies[hash]; ok {
+		return policy
+	}
+	return c.State.Multisig.Get(hash)
+}
+
+// Protocol returns the rule of the protocol code either registered on the
+// mutations or on the state. Returns nil if the code is not registered.
+func (c *MutatingState) Protocol(code uint32) *ProtocolRule {
+	if rule, ok := c.mutations.Protocols[code]; ok {
+		return rule
+	}
+	return c.State.Protocols.Get(code)
+}
+
+// Balance returns the balance of the account with the given hash, including
+// withdrawals matured at the epoch of the MutatingState not yet released from
+// the unbonding queue.
 func (c *MutatingState) Balance(hash crypto.Hash) uint64 {
 	_, balance := c.State.Wallets.BalanceHash(hash)
+	balance += c.State.Unbonding.Matured(hash, c.Epoch)
 	if c.mutations == nil {
 		return balance
 	}
+	for _, unbonding := range c.mutations.Unbonding {
+		if unbonding.Hash.Equal(hash) && unbonding.Matures <= c.Epoch {
+			balance += unbonding.Value
+		}
+	}
 	delta := c.mutations.DeltaBalance(hash)
 	if delta < 0 {
 		balance = balance - uint64(-delta)
@@ -73,22 +301,95 @@ func (c *MutatingState) Balance(hash crypto.Hash) uint64 {
 	return balance
 }
 
-// CanPay returns true if the payments can be paid, false otherwise
+// Locked returns the amount of the balance of the account with the given hash
+// that is time locked at the epoch of the MutatingState.
+func (c *MutatingState) Locked(hash crypto.Hash) uint64 {
+	locked := c.State.Locks.Locked(hash, c.Epoch)
+	for _, lock := range c.mutations.Locks[hash] {
+		locked += lock.Locked(c.Epoch)
+	}
+	return locked
+}
+
+// CanPay returns true if the payments can be paid with unlocked balances, false
+// otherwise
 func (b *MutatingState) CanPay(payments *actions.Payment) bool {
 	for _, debit := range payments.Debit {
 		existingBalance := b.Balance(debit.Account)
-		if int(existingBalance) < int(debit.FungibleTokens) {
+		locked := b.Locked(debit.Account)
+		if existingBalance < locked || existingBalance-locked < debit.FungibleTokens {
 			return false
 		}
 	}
 	return true
 }
 
+// DepositBalance returns the deposit of the account with the given hash
+func (c *MutatingState) DepositBalance(hash crypto.Hash) uint64 {
+	_, balance := c.State.Deposits.BalanceHash(hash)
+	if c.mutations == nil {
+		return balance
+	}
+	delta := c.mutations.DeltaDeposits[hash]
+	if delta < 0 {
+		balance = balance - uint64(-delta)
+	} else {
+		balance = balance + uint64(delta)
+	}
+	return balance
+}
+
+// Unbonding returns the amount withdrawn from the deposit of the account with
+// the given hash not yet matured at the epoch of the MutatingState.
+func (c *MutatingState) Unbonding(hash crypto.Hash) uint64 {
+	pending := c.State.Unbonding.Pending(hash, c.Epoch)
+	for _, unbonding := range c.mutations.Unbonding {
+		if unbonding.Hash.Equal(hash) && unbonding.Matures > c.Epoch {
+			pending += unbonding.Value
+		}
+	}
+	slashed := c.mutations.SlashedUnbonding[hash]
+	if slashed > pending {
+		return 0
+	}
+	return pending - slashed
+}
+
+// Delegated returns the stake delegated by the delegator to the validator
+// either on the state or on the mutations.
+func (c *MutatingState) Delegated(validator, delegator crypto.Hash) uint64 {
+	stake := int(c.State.Delegations.Get(validator, delegator))
+	if c.mutations != nil {
+		stake += c.mutations.Delegations[validator][delegator]
+	}
+	if stake < 0 {
+		return 0
+	}
+	return uint64(stake)
+}
+
+// Delegators returns the stake of each delegator of the validator either on the
+// state or on the mutations.
+func (c *MutatingState) Delegators(validator crypto.Hash) map[crypto.Hash]uint64 {
+	delegators := c.State.Delegations.Delegators(validator)
+	if c.mutations == nil {
+		return delegators
+	}
+	for delegator := range c.mutations.Delegations[validator] {
+		if stake := c.Delegated(validator, delegator); stake > 0 {
+			delegators[delegator] = stake
+		} else {
+			delete(delegators, delegator)
+		}
+	}
+	return delegators
+}
+
 // CanWithdraw returns true if the account with the given hash can withdraw the
-// given value, false otherwise
+// given value from its deposit, false otherwise
 func (b *MutatingState) CanWithdraw(hash crypto.Hash, value uint64) bool {
-	existingBalance := b.Balance(hash)
-	return value < existingBalance
+	existingBalance := b.DepositBalance(hash)
+	return value <= existingBalance
 }
 
 // Deposit Transfer resources from wallet to deposit. It does not check if
@@ -106,29 +407,104 @@ func (b *MutatingState) Deposit(hash crypto.Hash, value uint64) {
 	}
 }
 
-// Withdraw Transfer resources from deposit to wallet. It does not check if
-// the claim is valid.
+// Withdraw Transfer resources from deposit into the unbonding queue. They are
+// released to the wallet after the unbonding period of the state. It does not
+// check if the claim is valid.
 func (b *MutatingState) Withdraw(hash crypto.Hash, value uint64) {
 	if old, ok := b.mutations.DeltaDeposits[hash]; ok {
 		b.mutations.DeltaDeposits[hash] = old - int(value)
 	} else {
 		b.mutations.DeltaDeposits[hash] = -int(value)
 	}
-	if balance, ok := b.mutations.DeltaWallets[hash]; ok {
-		b.mutations.DeltaWallets[hash] = balance + int(value)
-	} else {
-		b.mutations.DeltaWallets[hash] = int(value)
+	unbonding := Unbonding{Hash: hash, Value: value, Matures: b.Epoch + b.State.Unbonding.Period}
+	b.mutations.Unbonding = append(b.mutations.Unbonding, unbonding)
+}
+
+// Undelegate transfers stake delegated to the validator into the unbonding
+// queue of the delegator. It does not check if the claim is valid.
+func (b *MutatingState) Undelegate(validator, delegator crypto.Hash, value uint64) {
+	b.mutations.DeltaDelegation(validator, delegator, -int(value))
+	unbonding := Unbonding{Hash: delegator, Value: value, Matures: b.Epoch + b.State.Unbonding.Period}
+	b.mutations.Unbonding = append(b.mutations.Unbonding, unbonding)
+}
+
+// Burn burns the given value from the deposit. If the deposit is not enough
+// the remaining is burned from withdrawals pending in the unbonding queue and
+// then from the stake delegated to the account, proportionally to the stake of
+// each delegator. The amount burned is deducted from the total supply. Returns
+// the amount actually burned.
+func (b *MutatingState) Burn(hash crypto.Hash, value uint64) uint64 {
+	fromDeposit := b.DepositBalance(hash)
+	if fromDeposit > value {
+		fromDeposit = value
+	}
+	if fromDeposit > 0 {
+		b.mutations.DeltaDeposits[hash] -= int(fromDeposit)
+	}
+	fromUnbonding := b.Unbonding(hash)
+	if fromUnbonding > value-fromDeposit {
+		fromUnbonding = value - fromDeposit
 	}
+	if fromUnbonding > 0 {
+		b.mutations.SlashedUnbonding[hash] += fromUnbonding
+	}
+	burned := fromDeposit + fromUnbonding + b.burnDelegated(hash, value-fromDeposit-fromUnbonding)
+	b.mutations.Burned += burned
+	return burned
 }
 
-// Burn burns the given value from the deposit. It does not check if the claim
-// is valid.
-func (b *MutatingState) Burn(hash crypto.Hash, value uint64) {
-	if old, ok := b.mutations.DeltaDeposits[hash]; ok {
-		b.mutations.DeltaDeposits[hash] = old - int(value)
-	} else {
-		b.mutations.DeltaDeposits[hash] = -int(value)
+// burnDelegated burns up to value from the stake delegated to the validator
+// proportionally to the stake of each delegator. Returns the amount actually
+// burned.
+func (b *MutatingState) burnDelegated(validator crypto.Hash, value uint64) uint64 {
+	if value == 0 {
+		return 0
+	}
+	delegators := b.Delegators(validator)
+	total := uint64(0)
+	for _, stake := range delegators {
+		total += stake
+	}
+	burned := uint64(0)
+	for _, delegator := range sortedHashes(delegators) {
+		stake := delegators[delegator]
+		if value < total {
+			hi, lo := bits.Mul64(value, stake)
+			stake, _ = bits.Div64(hi, lo, total)
+		}
+		if stake > 0 {
+			b.mutations.DeltaDelegation(validator, delegator, -int(stake))
+			burned += stake
+		}
+	}
+	return burned
+}
+
+// OffenseHash returns the hash under which the punishment of a consensus
+// offense by the token at the given epoch is recorded among recent actions.
+func OffenseHash(token crypto.Token, epoch uint64) crypto.Hash {
+	bytes := []byte("slash")
+	util.PutToken(token, &bytes)
+	util.PutUint64(epoch, &bytes)
+	return crypto.Hasher(bytes)
+}
+
+// Slash burns value from the deposit of the token as punishment for a consensus
+// offense committed at the offense epoch. Offenses must precede the epoch of
+// the MutatingState by at most MaxEpochDifference epochs. Each offense is
+// punished only once: it is recorded alongside recent actions and further
+// slashes for the same token and offense epoch are ignored. Returns the amount
+// actually burned.
+func (c *MutatingState) Slash(token crypto.Token, offense, value uint64) uint64 {
+	if offense >= c.Epoch || c.Epoch-offense > MaxEpochDifference {
+		return 0
+	}
+	hash := OffenseHash(token, offense)
+	if c.mutations.HasAction(hash) || c.State.Recent.Exists(hash, offense) {
+		return 0
 	}
+	c.mutations.Actions[hash] = offense
+	return c.Burn(crypto.HashToken(token), value)
 }
 
 // TransferPayments transfer payments from one account to another. It does not
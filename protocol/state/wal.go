@@ -0,0 +1,486 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/freehandle/breeze/crypto"
+	"github.com/freehandle/breeze/util"
+)
+
+// Kinds of records on the mutations log.
+const (
+	logBegin byte = iota + 1
+	logDone
+)
+
+// numberOfComponents is the number of state components other than the wallet
+// and deposit stores, in the order of IncorporateMutations.
+const numberOfComponents = 9
+
+// BalanceImage is the balance of a wallet or deposit before and after the
+// incorporation of mutations.
+type BalanceImage struct {
+	Hash   crypto.Hash
+	Before uint64
+	After  uint64
+}
+
+// LogEntry is the record of the incorporation of the mutations of a committed
+// block: the epoch and seal hash of the block, the mutations, the balances of
+// every wallet and deposit touched by the mutations (including withdrawals
+// maturing from the unbonding queue) before and after the incorporation, and
+// the serialization of every other component before the incorporation. With
+// the entry a state left half way through IncorporateMutations can be brought
+// either to the state before or to the state after the mutations (see Recover).
+type LogEntry struct {
+	Epoch      uint64
+	Hash       crypto.Hash
+	Mutations  *Mutations
+	Wallets    []BalanceImage
+	Deposits   []BalanceImage
+	Components [][]byte
+}
+
+// Serialize returns a byte representation of the entry.
+func (e *LogEntry) Serialize() []byte {
+	bytes := make([]byte, 0)
+	util.PutUint64(e.Epoch, &bytes)
+	util.PutHash(e.Hash, &bytes)
+	util.PutLargeByteArray(e.Mutations.Serialize(), &bytes)
+	for _, images := range [][]BalanceImage{e.Wallets, e.Deposits} {
+		util.PutUint32(uint32(len(images)), &bytes)
+		for _, image := range images {
+			util.PutHash(image.Hash, &bytes)
+			util.PutUint64(image.Before, &bytes)
+			util.PutUint64(image.After, &bytes)
+		}
+	}
+	for _, component := range e.Components {
+		util.PutLargeByteArray(component, &bytes)
+	}
+	return bytes
+}
+
+// ParseLogEntry parses a serialized log entry. Returns nil if the data is not a
+// valid serialization.
+func ParseLogEntry(data []byte) *LogEntry {
+	if len(data) < 8+crypto.Size+4 {
+		return nil
+	}
+	entry := LogEntry{}
+	position := 0
+	entry.Epoch, position = util.ParseUint64(data, position)
+	entry.Hash, position = util.ParseHash(data, position)
+	var mutations []byte
+	mutations, position = util.ParseLargeByteArray(data, position)
+	if position > len(data) {
+		return nil
+	}
+	if entry.Mutations = ParseMutations(mutations); entry.Mutations == nil {
+		return nil
+	}
+	for _, images := range []*[]BalanceImage{&entry.Wallets, &entry.Deposits} {
+		count, next, ok := parseCount(data, position, crypto.Size+16)
+		if !ok {
+			return nil
+		}
+		position = next
+		*images = make([]BalanceImage, count)
+		for n := 0; n < count; n++ {
+			(*images)[n].Hash, position = util.ParseHash(data, position)
+			(*images)[n].Before, position = util.ParseUint64(data, position)
+			(*images)[n].After, position = util.ParseUint64(data, position)
+		}
+	}
+	entry.Components = make([][]byte, numberOfComponents)
+	for n := range entry.Components {
+		if position+4 > len(data) {
+			return nil
+		}
+		entry.Components[n], position = util.ParseLargeByteArray(data, position)
+		if position > len(data) {
+			return nil
+		}
+	}
+	if position != len(data) {
+		return nil
+	}
+	return &entry
+}
+
+// MutationsLog is a write ahead log of the mutations incorporated into a state,
+// one committed epoch at a time. An entry is written and synced to disk before
+// the mutations are incorporated and marked as done afterwards, so that after a
+// crash in between the state can be recovered from the entry. Only the last
+// entry is kept on the log.
+type MutationsLog struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenMutationsLog opens the mutations log on the given file. The file is
+// created if it does not exist.
+func OpenMutationsLog(filePath string) (*MutationsLog, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &MutationsLog{file: file, size: stat.Size()}, nil
+}
+
+// write writes the record of the given kind at the given offset, truncating
+// whatever follows, and syncs the log.
+func (l *MutationsLog) write(kind byte, data []byte, offset int64) error {
+	record := append([]byte{kind}, data...)
+	bytes := make([]byte, 0, len(record)+4)
+	util.PutLargeByteArray(record, &bytes)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.file.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := l.file.WriteAt(bytes, offset); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.size = offset + int64(len(bytes))
+	return nil
+}
+
+// Begin replaces the log with the given entry. It returns once the entry is
+// on disk.
+func (l *MutationsLog) Begin(entry *LogEntry) error {
+	return l.write(logBegin, entry.Serialize(), 0)
+}
+
+// Done marks the entry of the given epoch as incorporated.
+func (l *MutationsLog) Done(epoch uint64) error {
+	bytes := make([]byte, 0, 8)
+	util.PutUint64(epoch, &bytes)
+	l.mu.Lock()
+	offset := l.size
+	l.mu.Unlock()
+	return l.write(logDone, bytes, offset)
+}
+
+// Discard erases the entry on the log.
+func (l *MutationsLog) Discard() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	l.size = 0
+	return l.file.Sync()
+}
+
+// Last returns the entry on the log and whether it is marked as done. It
+// returns a nil entry if the log is empty or if the entry was not entirely
+// written, in which case the mutations were never incorporated.
+func (l *MutationsLog) Last() (*LogEntry, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data, err := io.ReadAll(io.NewSectionReader(l.file, 0, l.size))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) < 4 {
+		return nil, false, nil
+	}
+	record, position := util.ParseLargeByteArray(data, 0)
+	if position > len(data) || len(record) == 0 || record[0] != logBegin {
+		return nil, false, nil
+	}
+	entry := ParseLogEntry(record[1:])
+	if entry == nil {
+		return nil, false, errors.New("invalid entry on the mutations log")
+	}
+	if position+4 > len(data) {
+		return entry, false, nil
+	}
+	record, position = util.ParseLargeByteArray(data, position)
+	if position > len(data) || len(record) != 9 || record[0] != logDone {
+		return entry, false, nil
+	}
+	epoch, _ := util.ParseUint64(record, 1)
+	return entry, epoch == entry.Epoch, nil
+}
+
+// Close closes the mutations log file.
+func (l *MutationsLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// nextBalance mirrors the credit or debit of delta to a wallet store balance:
+// debits exceeding the balance are not applied.
+func nextBalance(balance uint64, delta int) uint64 {
+	if delta > 0 {
+		return balance + uint64(delta)
+	}
+	if uint64(-delta) <= balance {
+		return balance - uint64(-delta)
+	}
+	return balance
+}
+
+// balanceImages returns the balances of the given wallet store before and after
+// the deltas followed by the credits.
+func balanceImages(wallet *Wallet, deltas map[crypto.Hash]int, credits map[crypto.Hash][]uint64) []BalanceImage {
+	touched := make(map[crypto.Hash]struct{})
+	for hash := range deltas {
+		touched[hash] = struct{}{}
+	}
+	for hash := range credits {
+		touched[hash] = struct{}{}
+	}
+	images := make([]BalanceImage, 0, len(touched))
+	for _, hash := range sortedHashes(touched) {
+		_, before := wallet.BalanceHash(hash)
+		after := nextBalance(before, deltas[hash])
+		for _, credit := range credits[hash] {
+			after += credit
+		}
+		images = append(images, BalanceImage{Hash: hash, Before: before, After: after})
+	}
+	return images
+}
+
+// setBalance credits or debits the wallet store so that the balance of hash
+// equals value. Returns true if the balance had to be changed.
+func setBalance(wallet *Wallet, hash crypto.Hash, value uint64) bool {
+	_, balance := wallet.BalanceHash(hash)
+	if value > balance {
+		wallet.CreditHash(hash, value-balance)
+	} else if value < balance {
+		wallet.DebitHash(hash, balance-value)
+	} else {
+		return false
+	}
+	return true
+}
+
+// componentsBytes returns the serialization of every component other than the
+// wallet and deposit stores.
+func (s *State) componentsBytes() [][]byte {
+	return [][]byte{
+		s.Unbonding.Serialize(),
+		s.Locks.Serialize(),
+		s.Recent.Serialize(),
+		s.Multisig.Serialize(),
+		s.Nonces.Serialize(),
+		s.Fees.Serialize(),
+		s.Delegations.Serialize(),
+		s.Issuance.Serialize(),
+		s.Protocols.Serialize(),
+	}
+}
+
+// incorporateComponent incorporates the mutations into the n-th component.
+func (s *State) incorporateComponent(n int, m *Mutations) {
+	switch n {
+	case 0:
+		s.Unbonding.Incorporate(m)
+	case 1:
+		s.Locks.Incorporate(m)
+	case 2:
+		s.Recent.Incorporate(m)
+	case 3:
+		s.Multisig.Incorporate(m)
+	case 4:
+		s.Nonces.Incorporate(m)
+	case 5:
+		s.Fees.Incorporate(m)
+	case 6:
+		s.Delegations.Incorporate(m)
+	case 7:
+		s.Issuance.Incorporate(m)
+	case 8:
+		s.Protocols.Incorporate(m)
+	}
+}
+
+// restoreComponent replaces the n-th component by its serialization. File
+// based components are persisted on the same file. Returns false if data is
+// not a valid serialization.
+func (s *State) restoreComponent(n int, data []byte) bool {
+	switch n {
+	case 0:
+		restored := ParseUnbondingQueue(data)
+		if restored != nil && s.Unbonding.filePath != "" {
+			restored = NewFileUnbondingQueueFromBytes(s.Unbonding.filePath, data)
+		}
+		if restored != nil {
+			s.Unbonding = restored
+		}
+		return restored != nil
+	case 1:
+		restored := ParseLocks(data)
+		if restored != nil && s.Locks.filePath != "" {
+			restored = NewFileLocksFromBytes(s.Locks.filePath, data)
+		}
+		if restored != nil {
+			s.Locks = restored
+		}
+		return restored != nil
+	case 2:
+		restored := ParseRecentActions(data)
+		if restored != nil && s.Recent.filePath != "" {
+			restored = NewFileRecentActionsFromBytes(s.Recent.filePath, data)
+		}
+		if restored != nil {
+			s.Recent = restored
+		}
+		return restored != nil
+	case 3:
+		restored := ParseMultisigPolicies(data)
+		if restored != nil && s.Multisig.filePath != "" {
+			restored = NewFileMultisigPoliciesFromBytes(s.Multisig.filePath, data)
+		}
+		if restored != nil {
+			s.Multisig = restored
+		}
+		return restored != nil
+	case 4:
+		restored := ParseNonces(data)
+		if restored != nil && s.Nonces.filePath != "" {
+			restored = NewFileNoncesFromBytes(s.Nonces.filePath, data)
+		}
+		if restored != nil {
+			s.Nonces = restored
+		}
+		return restored != nil
+	case 5:
+		restored := ParseFeeMarket(data)
+		if restored != nil && s.Fees.filePath != "" {
+			restored = NewFileFeeMarketFromBytes(s.Fees.filePath, data)
+		}
+		if restored != nil {
+			s.Fees = restored
+		}
+		return restored != nil
+	case 6:
+		restored := ParseDelegations(data)
+		if restored != nil && s.Delegations.filePath != "" {
+			restored = NewFileDelegationsFromBytes(s.Delegations.filePath, data)
+		}
+		if restored != nil {
+			s.Delegations = restored
+		}
+		return restored != nil
+	case 7:
+		restored := ParseIssuance(data)
+		if restored != nil && s.Issuance.filePath != "" {
+			restored = NewFileIssuanceFromBytes(s.Issuance.filePath, data)
+		}
+		if restored != nil {
+			s.Issuance = restored
+		}
+		return restored != nil
+	case 8:
+		restored := ParseProtocols(data)
+		if restored != nil && s.Protocols.filePath != "" {
+			restored = NewFileProtocolsFromBytes(s.Protocols.filePath, data)
+		}
+		if restored != nil {
+			s.Protocols = restored
+		}
+		return restored != nil
+	}
+	return false
+}
+
+// LogEntry returns the entry of the mutations for the write ahead log as of
+// the current state, without changing the state. hash is the seal hash of the
+// block of the mutations.
+func (s *State) LogEntry(m *Mutations, hash crypto.Hash) *LogEntry {
+	credits := make(map[crypto.Hash][]uint64)
+	for _, matured := range s.Unbonding.Clone().Incorporate(m) {
+		credits[matured.Hash] = append(credits[matured.Hash], matured.Value)
+	}
+	return &LogEntry{
+		Epoch:      m.Epoch,
+		Hash:       hash,
+		Mutations:  m,
+		Wallets:    balanceImages(s.Wallets, m.DeltaWallets, credits),
+		Deposits:   balanceImages(s.Deposits, m.DeltaDeposits, nil),
+		Components: s.componentsBytes(),
+	}
+}
+
+// IncorporateMutationsLogged records the mutations on the log before
+// incorporating them into the state (see IncorporateMutations) and marks them
+// as done afterwards. The mutations are incorporated even if the log cannot be
+// written, so that the state keeps up with the chain, and the error of the log
+// is returned.
+func (s *State) IncorporateMutationsLogged(m *Mutations, hash crypto.Hash, log *MutationsLog) error {
+	if err := log.Begin(s.LogEntry(m, hash)); err != nil {
+		s.IncorporateMutations(m)
+		return err
+	}
+	s.IncorporateMutations(m)
+	return log.Done(m.Epoch)
+}
+
+// Recover brings a state interrupted at any point of the incorporation of the
+// mutations of the entry to the state after the incorporation if forward is
+// true, or to the state before the incorporation otherwise. It also works on a
+// state on which the incorporation never started. Returns the number of
+// balances and components that had to be changed, zero if the state was
+// already consistent.
+func (s *State) Recover(entry *LogEntry, forward bool) (int, error) {
+	if len(entry.Components) != numberOfComponents {
+		return 0, errors.New("invalid log entry")
+	}
+	changed := 0
+	touched := make(map[crypto.Hash]struct{})
+	defer s.updateBalanceTree(touched)
+	for _, images := range []struct {
+		wallet *Wallet
+		images []BalanceImage
+	}{{s.Wallets, entry.Wallets}, {s.Deposits, entry.Deposits}} {
+		for _, image := range images.images {
+			value := image.Before
+			if forward {
+				value = image.After
+			}
+			if setBalance(images.wallet, image.Hash, value) {
+				changed += 1
+			}
+			touched[image.Hash] = struct{}{}
+		}
+	}
+	current := s.componentsBytes()
+	for n, before := range entry.Components {
+		// components are persisted as a whole, so each one is either before or
+		// after the incorporation
+		untouched := bytes.Equal(current[n], before)
+		if forward && untouched {
+			// incorporating mutations that do not change the component again
+			// is harmless
+			s.incorporateComponent(n, entry.Mutations)
+			if !bytes.Equal(s.componentsBytes()[n], before) {
+				changed += 1
+			}
+		} else if !forward && !untouched {
+			if !s.restoreComponent(n, before) {
+				return changed, errors.New("invalid component on log entry")
+			}
+			changed += 1
+		}
+	}
+	return changed, nil
+}
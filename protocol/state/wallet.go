@@ -166,6 +166,61 @@ func newWalltetStoreFromBytes(name string, store papirus.ByteStore, data []byte)
 	return w
 }
 
+// clonedWallet wraps a cloned hash store into a wallet. Papirus clones are not
+// running and would block on the first query. The clone is started here since
+// cloned states are queried: the checkpoint state validates the actions of a
+// rollover and the permission rules read deposits from it.
+func clonedWallet(hs *papirus.HashStore[crypto.Hash]) *Wallet {
+	if hs != nil {
+		hs.Start()
+	}
+	return &Wallet{HS: hs}
+}
+
 func (w *Wallet) Bytes() []byte {
 	return w.HS.Bytes()
 }
+
+// Accounts returns the balance of every account on the wallet indexed by the
+// account hash. It walks a serialized copy of the underlying hash store, so it
+// is safe to call while the wallet is live, but it is meant for checksum
+// states that are no longer mutated.
+func (w *Wallet) Accounts() map[crypto.Hash]uint64 {
+	accounts := make(map[crypto.Hash]uint64)
+	data := w.HS.Bytes()
+	if len(data) < 1 {
+		return accounts
+	}
+	var itemBytes, itemsPerBucket, buckets, count, free uint64
+	position := 1
+	itemBytes, position = papirus.ParseUint64(data, position)
+	itemsPerBucket, position = papirus.ParseUint64(data, position)
+	buckets, position = papirus.ParseUint64(data, position)
+	if itemBytes != crypto.Size+8 || itemsPerBucket == 0 || position+8*int(buckets) > len(data) {
+		return accounts
+	}
+	counts := make([]int64, buckets)
+	for n := range counts {
+		count, position = papirus.ParseUint64(data, position)
+		counts[n] = int64(count)
+	}
+	free, position = papirus.ParseUint64(data, position)
+	position += 8 * int(free)
+	if position > len(data) {
+		return accounts
+	}
+	bytestore := papirus.NewMemoryStore(0)
+	bytestore.Append(data[position:])
+	store := papirus.NewBucketStore(int64(itemBytes), int64(itemsPerBucket), bytestore)
+	for n, count := range counts {
+		if count == 0 {
+			continue
+		}
+		for _, item := range store.ReadBucket(int64(n)).ReadBulk(count) {
+			var hash crypto.Hash
+			copy(hash[:], item[0:crypto.Size])
+			accounts[hash] = binary.LittleEndian.Uint64(item[crypto.Size:])
+		}
+	}
+	return accounts
+}
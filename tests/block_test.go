@@ -7,13 +7,15 @@ import (
 	"github.com/freehandle/breeze/consensus/chain"
 	"github.com/freehandle/breeze/crypto"
 	"github.com/freehandle/breeze/protocol/actions"
+	"github.com/freehandle/breeze/protocol/state"
 )
 
 func TestBlockchain(t *testing.T) {
 	token, pk := crypto.RandomAsymetricKey()
 	token2, _ := crypto.RandomAsymetricKey()
 	hashToken := crypto.HashToken(token)
-	testChain := chain.BlockchainFromGenesisState(pk, "", hashToken, time.Second, 15)
+	testChain := chain.BlockchainFromGenesisState(pk, "", hashToken, time.Second, 15, 2, 0, 0, state.IssuanceSchedule{})
+	testChain.SetWindowWeights(1, map[crypto.Token]int{token: 1})
 	block, err := testChain.BlockBuilder(1)
 	if err != nil {
 		t.Error(err)
@@ -46,7 +46,8 @@ func (j *JSONBuilder) PutBase64(fieldName string, value []byte) {
 }
 
 func (j *JSONBuilder) PutString(fieldName, value string) {
-	j.putGeneral(fieldName, fmt.Sprintf(`"%v"`, value))
+	quoted, _ := json.Marshal(value)
+	j.putGeneral(fieldName, string(quoted))
 }
 
 func (j *JSONBuilder) PutJSON(fieldName, value string) {
@@ -63,15 +64,30 @@ func (j *JSONBuilder) PutTokenValueArray(fieldName string, tokens []crypto.Token
 	}
 	array := &JSONBuilder{}
 	array.Encode.WriteRune('[')
-	first := true
-	for _, r := range tokens {
-		if !first {
+	for n, r := range tokens {
+		if n > 0 {
 			array.Encode.WriteRune(',')
 		}
-		fmt.Fprintf(&array.Encode, `{"token":"%v","value":%v`, base64.StdEncoding.EncodeToString(r.Token[:]), r.Value)
+		fmt.Fprintf(&array.Encode, `{"token":"0x%v","value":%v}`, hex.EncodeToString(r.Token[:]), r.Value)
 	}
 	array.Encode.WriteRune(']')
-	j.PutString(fieldName, array.Encode.String())
+	j.PutJSON(fieldName, array.Encode.String())
+}
+
+func (j *JSONBuilder) PutTokenArray(fieldName string, tokens []crypto.Token) {
+	if len(tokens) == 0 {
+		return
+	}
+	array := &JSONBuilder{}
+	array.Encode.WriteRune('[')
+	for n, token := range tokens {
+		if n > 0 {
+			array.Encode.WriteRune(',')
+		}
+		fmt.Fprintf(&array.Encode, `"0x%v"`, hex.EncodeToString(token[:]))
+	}
+	array.Encode.WriteRune(']')
+	j.PutJSON(fieldName, array.Encode.String())
 }
 
 func (j *JSONBuilder) PutTokenCiphers(fieldName string, tc crypto.TokenCiphers) {
@@ -80,15 +96,14 @@ func (j *JSONBuilder) PutTokenCiphers(fieldName string, tc crypto.TokenCiphers)
 	}
 	array := &JSONBuilder{}
 	array.Encode.WriteRune('[')
-	first := true
-	for _, r := range tc {
-		if !first {
+	for n, r := range tc {
+		if n > 0 {
 			array.Encode.WriteRune(',')
 		}
-		fmt.Fprintf(&array.Encode, `{"token":"%v","cipher":%v`, base64.StdEncoding.EncodeToString(r.Token[:]), base64.StdEncoding.EncodeToString(r.Cipher))
+		fmt.Fprintf(&array.Encode, `{"token":"0x%v","cipher":"%v"}`, hex.EncodeToString(r.Token[:]), base64.StdEncoding.EncodeToString(r.Cipher))
 	}
 	array.Encode.WriteRune(']')
-	j.PutString(fieldName, array.Encode.String())
+	j.PutJSON(fieldName, array.Encode.String())
 }
 
 func PrintJson(v any) {
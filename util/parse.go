@@ -0,0 +1,60 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons for rejecting a serialized wire structure. Parsers return them
+// wrapped into a ParseError so that callers can log where parsing failed and
+// tell the reason apart with errors.Is.
+var (
+	ErrTruncated     = errors.New("truncated data")
+	ErrTrailingBytes = errors.New("trailing bytes")
+	ErrBadSignature  = errors.New("invalid signature")
+	ErrUnknownKind   = errors.New("unknown kind")
+	ErrInvalidValue  = errors.New("invalid value")
+)
+
+// ParseError is the error of parsing a wire structure. Position is the byte of
+// the serialized structure at which parsing failed and Err the reason, either
+// one of the reasons above or the ParseError of an embedded structure.
+type ParseError struct {
+	Structure string
+	Position  int
+	Err       error
+}
+
+// NewParseError returns a ParseError of the structure at the given position.
+func NewParseError(structure string, position int, err error) error {
+	return &ParseError{Structure: structure, Position: position, Err: err}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at byte %d: %v", e.Structure, e.Position, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// CheckTruncated returns an ErrTruncated ParseError of the structure if the
+// position returned by the Parse functions of this package is past the end of
+// the data, and nil otherwise.
+func CheckTruncated(structure string, data []byte, position int) error {
+	if position > len(data) {
+		return NewParseError(structure, len(data), ErrTruncated)
+	}
+	return nil
+}
+
+// CheckEnd returns a ParseError of the structure if the position returned by
+// the Parse functions of this package is not the end of the data: either
+// ErrTruncated if it is past the end or ErrTrailingBytes if it falls short of
+// it. Returns nil otherwise.
+func CheckEnd(structure string, data []byte, position int) error {
+	if position < len(data) {
+		return NewParseError(structure, position, ErrTrailingBytes)
+	}
+	return CheckTruncated(structure, data, position)
+}
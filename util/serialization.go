@@ -163,10 +163,15 @@ func PutByte(b byte, data *[]byte) {
 	*data = append(*data, b)
 }
 
+// Parse functions read a value at the position of the data and return the
+// position following it. If the data is too short they return a zero value and
+// a position past the end of the data, so that overruns can be detected by the
+// caller (see CheckTruncated and CheckEnd).
+
 func ParseToken(data []byte, position int) (crypto.Token, int) {
 	var token crypto.Token
 	if position+crypto.TokenSize > len(data) {
-		return token, position
+		return token, position + crypto.TokenSize
 	}
 	copy(token[:], data[position:position+crypto.TokenSize])
 	return token, position + crypto.TokenSize
@@ -175,18 +180,27 @@ func ParseToken(data []byte, position int) (crypto.Token, int) {
 func ParseSecret(data []byte, position int) (crypto.PrivateKey, int) {
 	var secret crypto.PrivateKey
 	if position+crypto.PrivateKeySize > len(data) {
-		return secret, position
+		return secret, position + crypto.PrivateKeySize
 	}
 	copy(secret[:], data[position:position+crypto.PrivateKeySize])
 	return secret, position + crypto.PrivateKeySize
 }
 
+// countFits returns true if count items of at least size bytes each fit into
+// the data after position. Array parsers check it before allocating.
+func countFits(data []byte, position, count, size int) bool {
+	return position <= len(data) && count <= (len(data)-position)/size
+}
+
 func ParseActionsArray(data []byte, position int) ([][]byte, int) {
 	if position+3 >= len(data) {
-		return [][]byte{}, position
+		return [][]byte{}, position + 4
 	}
 	var count uint32
 	count, position = ParseUint32(data, position)
+	if !countFits(data, position, int(count), 2) {
+		return nil, len(data) + 1
+	}
 	array := make([][]byte, int(count))
 	for n := 0; n < int(count); n++ {
 		array[n], position = ParseByteArray(data, position)
@@ -199,10 +213,13 @@ func ParseActionsArray(data []byte, position int) ([][]byte, int) {
 
 func ParseHashArray(data []byte, position int) ([]crypto.Hash, int) {
 	if position+3 >= len(data) {
-		return []crypto.Hash{}, position
+		return []crypto.Hash{}, position + 4
 	}
 	var count uint32
 	count, position = ParseUint32(data, position)
+	if !countFits(data, position, int(count), crypto.Size) {
+		return nil, len(data) + 1
+	}
 	array := make([]crypto.Hash, int(count))
 	for n := 0; n < int(count); n++ {
 		array[n], position = ParseHash(data, position)
@@ -212,10 +229,13 @@ func ParseHashArray(data []byte, position int) ([]crypto.Hash, int) {
 
 func ParseTokenArray(data []byte, position int) ([]crypto.Token, int) {
 	if position+3 >= len(data) {
-		return []crypto.Token{}, position
+		return []crypto.Token{}, position + 4
 	}
 	var count uint32
 	count, position = ParseUint32(data, position)
+	if !countFits(data, position, int(count), crypto.TokenSize) {
+		return nil, len(data) + 1
+	}
 	array := make([]crypto.Token, int(count))
 	for n := 0; n < int(count); n++ {
 		array[n], position = ParseToken(data, position)
@@ -226,7 +246,7 @@ func ParseTokenArray(data []byte, position int) ([]crypto.Token, int) {
 func ParseHash(data []byte, position int) (crypto.Hash, int) {
 	var hash crypto.Hash
 	if position+crypto.Size > len(data) {
-		return hash, position
+		return hash, position + crypto.Size
 	}
 	copy(hash[:], data[position:position+crypto.Size])
 	return hash, position + crypto.Size
@@ -255,7 +275,7 @@ func PutTokenCiphers(tcs crypto.TokenCiphers, data *[]byte) {
 func ParseSignature(data []byte, position int) (crypto.Signature, int) {
 	var sign crypto.Signature
 	if position+crypto.SignatureSize > len(data) {
-		return sign, position
+		return sign, position + crypto.SignatureSize
 	}
 	copy(sign[0:crypto.SignatureSize], data[position:position+crypto.SignatureSize])
 	return sign, position + crypto.SignatureSize
@@ -263,10 +283,13 @@ func ParseSignature(data []byte, position int) (crypto.Signature, int) {
 
 func ParseByteArrayArray(data []byte, position int) ([][]byte, int) {
 	if position+1 >= len(data) {
-		return [][]byte{}, position
+		return [][]byte{}, position + 2
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8
 	position += 2
+	if !countFits(data, position, length, 2) {
+		return nil, len(data) + 1
+	}
 	output := make([][]byte, length)
 	for n := 0; n < length; n++ {
 		output[n], position = ParseByteArray(data, position)
@@ -276,7 +299,7 @@ func ParseByteArrayArray(data []byte, position int) ([][]byte, int) {
 
 func ParseLongByteArray(data []byte, position int) ([]byte, int) {
 	if position+3 >= len(data) {
-		return []byte{}, position
+		return []byte{}, position + 4
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8 | int(data[position+2])<<16 | int(data[position+3])<<24
 	if length == 0 {
@@ -291,7 +314,7 @@ func ParseLongByteArray(data []byte, position int) ([]byte, int) {
 
 func ParseByteArray(data []byte, position int) ([]byte, int) {
 	if position+1 >= len(data) {
-		return []byte{}, position
+		return []byte{}, position + 2
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8
 	if length == 0 {
@@ -304,8 +327,8 @@ func ParseByteArray(data []byte, position int) ([]byte, int) {
 }
 
 func ParseLargeByteArray(data []byte, position int) ([]byte, int) {
-	if position+1 >= len(data) {
-		return []byte{}, position
+	if position+3 >= len(data) {
+		return []byte{}, position + 4
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8 | int(data[position+2])<<16 | int(data[position+3])<<24
 	if length == 0 {
@@ -387,9 +410,6 @@ func ParseByte(data []byte, position int) (byte, int) {
 
 func ParseTokenCipher(data []byte, position int) (crypto.TokenCipher, int) {
 	tc := crypto.TokenCipher{}
-	if position+1 >= len(data) {
-		return tc, position
-	}
 	tc.Token, position = ParseToken(data, position)
 	tc.Cipher, position = ParseByteArray(data, position)
 	return tc, position
@@ -397,15 +417,12 @@ func ParseTokenCipher(data []byte, position int) (crypto.TokenCipher, int) {
 
 func ParseTokenCiphers(data []byte, position int) (crypto.TokenCiphers, int) {
 	if position+1 >= len(data) {
-		return crypto.TokenCiphers{}, position
+		return crypto.TokenCiphers{}, position + 2
 	}
 	length := int(data[position+0]) | int(data[position+1])<<8
 	position += 2
-	if length == 0 {
-		return crypto.TokenCiphers{}, position + 2
-	}
-	if position+length+2 > len(data) {
-		return crypto.TokenCiphers{}, position + length + 2
+	if !countFits(data, position, length, crypto.TokenSize+2) {
+		return crypto.TokenCiphers{}, len(data) + 1
 	}
 	tcs := make(crypto.TokenCiphers, length)
 	for n := 0; n < length; n++ {
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -42,3 +43,40 @@ func TestUint64(t *testing.T) {
 		t.Errorf("Wrong uint64 serialization")
 	}
 }
+
+func TestParseOverrun(t *testing.T) {
+	short := []byte{1, 2, 3}
+	if _, position := ParseToken(short, 0); position <= len(short) {
+		t.Errorf("token overrun not reported")
+	}
+	if _, position := ParseHash(short, 0); position <= len(short) {
+		t.Errorf("hash overrun not reported")
+	}
+	if _, position := ParseSignature(short, 0); position <= len(short) {
+		t.Errorf("signature overrun not reported")
+	}
+	if _, position := ParseByteArray(short, 2); position <= len(short) {
+		t.Errorf("byte array overrun not reported")
+	}
+	if _, position := ParseLargeByteArray(short, 0); position <= len(short) {
+		t.Errorf("large byte array overrun not reported")
+	}
+	// a count of hashes beyond the data must not be allocated
+	huge := []byte{255, 255, 255, 255, 0}
+	if array, position := ParseHashArray(huge, 0); array != nil || position <= len(huge) {
+		t.Errorf("hash array overrun not reported")
+	}
+	if err := CheckEnd("test", short, 4); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected truncated data, got %v", err)
+	}
+	if err := CheckEnd("test", short, 2); !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("expected trailing bytes, got %v", err)
+	}
+	var parseErr *ParseError
+	if err := CheckEnd("test", short, 2); !errors.As(err, &parseErr) || parseErr.Position != 2 {
+		t.Errorf("expected parse error at position 2, got %v", err)
+	}
+	if err := CheckEnd("test", short, 3); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}